@@ -99,13 +99,22 @@ func ProvideOSSService(
 		log:            log.New("accesscontrol.service"),
 		roles:          accesscontrol.BuildBasicRoleDefinitions(),
 		store:          store,
-		reconciler:     dualwrite.NewZanzanaReconciler(zclient, db, lock),
 		permRegistry:   permRegistry,
 	}
+	s.reconciler = dualwrite.NewZanzanaReconciler(zclient, db, lock, dualwrite.WithBasicRolePermissions(s.basicRolePermissions))
 
 	return s
 }
 
+// basicRolePermissions returns the permissions of every basic role registered so far.
+func (s *Service) basicRolePermissions() map[string][]accesscontrol.Permission {
+	out := make(map[string][]accesscontrol.Permission, len(s.roles))
+	for role, basicRole := range s.roles {
+		out[role] = basicRole.Permissions
+	}
+	return out
+}
+
 // Service is the service implementing role based access control.
 type Service struct {
 	actionResolver accesscontrol.ActionResolver
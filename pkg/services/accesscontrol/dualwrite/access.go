@@ -0,0 +1,194 @@
+package dualwrite
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+// AccessChange is a relation a user or service account has on an object, either granted
+// directly or inherited through team memberships, basic roles or parent folders.
+type AccessChange struct {
+	Subject  string
+	Relation string
+	Object   string
+}
+
+// EffectiveAccessDiff summarizes the net effect of a reconciliation on what users can access.
+// Changes to tuples that don't change effective access, e.g. a direct grant replacing one
+// inherited from a team, are not part of it.
+type EffectiveAccessDiff struct {
+	Gained []AccessChange
+	Lost   []AccessChange
+}
+
+// EffectiveAccessDiff computes the changes all reconcilers would make for namespace, like DryRun,
+// and resolves how they change effective access of users.
+func (r *ZanzanaReconciler) EffectiveAccessDiff(ctx context.Context, namespace string) (*EffectiveAccessDiff, error) {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.EffectiveAccessDiff")
+	defer span.End()
+
+	result, err := r.dryRun(ctx, namespace, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var before []*openfgav1.TupleKey
+	err = streamTuples(ctx, r.client, &authzextv1.ReadRequest{Namespace: namespace}, func(t *openfgav1.TupleKey) error {
+		before = append(before, t)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	diff := newEffectiveAccessDiff(before, applyResult(before, result))
+	return &diff, nil
+}
+
+// applyResult returns tuples with the changes of result applied.
+func applyResult(tuples []*openfgav1.TupleKey, result *ReconcileResult) []*openfgav1.TupleKey {
+	key := func(object, relation, user string) string {
+		return object + "#" + relation + "@" + user
+	}
+
+	removed := make(map[string]struct{}, len(result.Deletions)+len(result.Updates)+len(result.Additions))
+	for _, t := range append(slices.Clone(result.Deletions), result.Updates...) {
+		removed[key(t.Object, t.Relation, t.User)] = struct{}{}
+	}
+	// additions with an updated condition replace the stored tuple
+	for _, t := range result.Additions {
+		removed[key(t.Object, t.Relation, t.User)] = struct{}{}
+	}
+
+	out := make([]*openfgav1.TupleKey, 0, len(tuples)+len(result.Additions))
+	for _, t := range tuples {
+		if _, ok := removed[key(t.Object, t.Relation, t.User)]; !ok {
+			out = append(out, t)
+		}
+	}
+	return append(out, result.Additions...)
+}
+
+// newEffectiveAccessDiff resolves effective access for before and after and returns what was
+// gained and lost.
+func newEffectiveAccessDiff(before, after []*openfgav1.TupleKey) EffectiveAccessDiff {
+	had := resolveEffectiveAccess(before)
+	has := resolveEffectiveAccess(after)
+
+	var diff EffectiveAccessDiff
+	for access := range has {
+		if _, ok := had[access]; !ok {
+			diff.Gained = append(diff.Gained, access)
+		}
+	}
+	for access := range had {
+		if _, ok := has[access]; !ok {
+			diff.Lost = append(diff.Lost, access)
+		}
+	}
+
+	sortAccessChanges(diff.Gained)
+	sortAccessChanges(diff.Lost)
+	return diff
+}
+
+// membershipRelations are relations that make subjects part of a userset instead of granting access.
+var membershipRelations = []string{zanzana.RelationTeamMember, zanzana.RelationTeamAdmin, zanzana.RelationAssignee}
+
+// resolveEffectiveAccess resolves tuples into the relations users and service accounts have on
+// objects. Usersets like team:1#member are expanded into their members, team admins are members,
+// and relations on folders are inherited by all subfolders. Conditions are not evaluated so
+// conditional access is treated as granted.
+func resolveEffectiveAccess(tuples []*openfgav1.TupleKey) map[AccessChange]struct{} {
+	members := make(map[string][]string)
+	children := make(map[string][]string)
+	var grants []*openfgav1.TupleKey
+
+	for _, t := range tuples {
+		switch {
+		case t.Relation == zanzana.RelationParent:
+			children[t.User] = append(children[t.User], t.Object)
+		case slices.Contains(membershipRelations, t.Relation):
+			members[t.Object+"#"+t.Relation] = append(members[t.Object+"#"+t.Relation], t.User)
+			if t.Relation == zanzana.RelationTeamAdmin {
+				members[t.Object+"#"+zanzana.RelationTeamMember] = append(members[t.Object+"#"+zanzana.RelationTeamMember], t.User)
+			}
+		default:
+			grants = append(grants, t)
+		}
+	}
+
+	access := make(map[AccessChange]struct{})
+	for _, t := range grants {
+		subjects := expandSubject(members, t.User, map[string]struct{}{})
+		objects := append([]string{t.Object}, descendantFolders(children, t.Object)...)
+		for _, subject := range subjects {
+			for _, object := range objects {
+				access[AccessChange{Subject: subject, Relation: t.Relation, Object: object}] = struct{}{}
+			}
+		}
+	}
+	return access
+}
+
+// expandSubject returns the users and service accounts subject resolves to. Usersets are
+// expanded recursively, seen guards against cycles.
+func expandSubject(members map[string][]string, subject string, seen map[string]struct{}) []string {
+	if !strings.Contains(subject, "#") {
+		if strings.HasPrefix(subject, common.TypeUser+":") || strings.HasPrefix(subject, common.TypeServiceAccount+":") {
+			return []string{subject}
+		}
+		return nil
+	}
+
+	if _, ok := seen[subject]; ok {
+		return nil
+	}
+	seen[subject] = struct{}{}
+
+	var out []string
+	for _, m := range members[subject] {
+		out = append(out, expandSubject(members, m, seen)...)
+	}
+	return out
+}
+
+// descendantFolders returns all folders below object, nothing is returned for other objects.
+func descendantFolders(children map[string][]string, object string) []string {
+	var out []string
+	seen := map[string]struct{}{object: {}}
+	queue := []string{object}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		for _, child := range children[next] {
+			if _, ok := seen[child]; ok {
+				continue
+			}
+			seen[child] = struct{}{}
+			out = append(out, child)
+			queue = append(queue, child)
+		}
+	}
+	return out
+}
+
+func sortAccessChanges(changes []AccessChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Subject != changes[j].Subject {
+			return changes[i].Subject < changes[j].Subject
+		}
+		if changes[i].Object != changes[j].Object {
+			return changes[i].Object < changes[j].Object
+		}
+		return changes[i].Relation < changes[j].Relation
+	})
+}
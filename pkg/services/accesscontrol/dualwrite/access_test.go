@@ -0,0 +1,75 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grafana/authlib/claims"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestEffectiveAccessDiff(t *testing.T) {
+	parent := &openfgav1.TupleKey{Object: "folder:child", Relation: zanzana.RelationParent, User: "folder:root"}
+	membership := &openfgav1.TupleKey{Object: "team:t1", Relation: zanzana.RelationTeamMember, User: "user:u1"}
+	teamGrant := common.NewFolderTuple("team:t1#member", zanzana.RelationRead, "root")
+
+	t.Run("should report access inherited through teams and parent folders", func(t *testing.T) {
+		diff := newEffectiveAccessDiff(
+			[]*openfgav1.TupleKey{parent, membership},
+			[]*openfgav1.TupleKey{parent, membership, teamGrant},
+		)
+
+		assert.Equal(t, []AccessChange{
+			{Subject: "user:u1", Relation: zanzana.RelationRead, Object: "folder:child"},
+			{Subject: "user:u1", Relation: zanzana.RelationRead, Object: "folder:root"},
+		}, diff.Gained)
+		assert.Empty(t, diff.Lost)
+	})
+
+	t.Run("should report access lost when a folder is moved", func(t *testing.T) {
+		moved := &openfgav1.TupleKey{Object: "folder:child", Relation: zanzana.RelationParent, User: "folder:other"}
+		diff := newEffectiveAccessDiff(
+			[]*openfgav1.TupleKey{parent, membership, teamGrant},
+			[]*openfgav1.TupleKey{moved, membership, teamGrant},
+		)
+
+		assert.Empty(t, diff.Gained)
+		assert.Equal(t, []AccessChange{
+			{Subject: "user:u1", Relation: zanzana.RelationRead, Object: "folder:child"},
+		}, diff.Lost)
+	})
+
+	t.Run("should not report tuple changes that keep effective access", func(t *testing.T) {
+		direct := common.NewFolderTuple("user:u1", zanzana.RelationRead, "root")
+		diff := newEffectiveAccessDiff(
+			[]*openfgav1.TupleKey{membership, teamGrant},
+			[]*openfgav1.TupleKey{membership, direct},
+		)
+
+		assert.Empty(t, diff.Gained)
+		assert.Empty(t, diff.Lost)
+	})
+
+	t.Run("should resolve diff of reconciliation", func(t *testing.T) {
+		namespace := claims.OrgNamespaceFormatter(1)
+		client := newFakeZanzanaClient()
+		client.seed(namespace, parent, teamGrant)
+
+		r := NewZanzanaReconciler(client, nil, nil)
+		rr := newResourceReconciler("team memberships", staticCollector(membership), zanzanaCollector([]string{zanzana.RelationTeamMember}), client)
+		rr.cfg = r.cfg
+		r.reconcilers = []resourceReconciler{rr}
+
+		diff, err := r.EffectiveAccessDiff(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Len(t, diff.Gained, 2)
+		assert.Empty(t, diff.Lost)
+		// nothing is written
+		assert.Len(t, client.stored(namespace), 2)
+	})
+}
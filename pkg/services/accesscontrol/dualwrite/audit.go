@@ -0,0 +1,81 @@
+package dualwrite
+
+import (
+	"context"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+)
+
+// droppedUnsupportedSubject is used when a permission is granted to something other than a user or team.
+const droppedUnsupportedSubject = "unsupported subject"
+
+// TranslationAuditEntry records how a single legacy permission was translated.
+type TranslationAuditEntry struct {
+	RoleName   string
+	Action     string
+	Kind       string
+	Identifier string
+	Subject    string
+	// Tuple is the tuple the permission was translated into, it is not set if the permission was dropped.
+	// Tuples for folder resources and subresources are merged per subject during collection.
+	Tuple *openfgav1.TupleKey
+	// Dropped is the reason the permission was not translated.
+	Dropped string
+}
+
+// AuditTranslations translates every managed permission in org and records what tuple it produced or
+// why it was dropped. All kinds are included, not only the ones that are reconciled, so this is
+// heavier than a normal collection.
+func (r *ZanzanaReconciler) AuditTranslations(ctx context.Context, orgId int64) ([]TranslationAuditEntry, error) {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.AuditTranslations")
+	defer span.End()
+
+	query := managedPermissionsQuery(r.store, r.cfg.legacySchema) + `
+		AND r.org_id = ?
+	`
+
+	var permissions []managedPermission
+	err := r.store.WithDbSession(ctx, func(sess *db.Session) error {
+		return sess.SQL(query, orgId).Find(&permissions)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return auditManagedPermissions(normalizeScopes(permissions), r.cfg.translationVersion), nil
+}
+
+// auditManagedPermissions translates permissions and returns one entry per permission.
+func auditManagedPermissions(permissions []managedPermission, version zanzana.TranslationVersion) []TranslationAuditEntry {
+	entries := make([]TranslationAuditEntry, 0, len(permissions))
+	for _, p := range permissions {
+		entry := TranslationAuditEntry{
+			RoleName:   p.RoleName,
+			Action:     p.Action,
+			Kind:       p.Kind,
+			Identifier: p.Identifier,
+		}
+
+		subject, ok := managedPermissionSubject(p)
+		if !ok {
+			entry.Dropped = droppedUnsupportedSubject
+			entries = append(entries, entry)
+			continue
+		}
+		entry.Subject = subject
+
+		tuple, err := zanzana.TranslateResourcePermission(version, subject, p.Action, p.Kind, p.Identifier)
+		if err != nil {
+			entry.Dropped = err.Error()
+		} else {
+			entry.Tuple = tuple
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
@@ -0,0 +1,49 @@
+package dualwrite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestAuditManagedPermissions(t *testing.T) {
+	permissions := []managedPermission{
+		{RoleName: "managed:users:1:permissions", Action: "dashboards:read", Kind: zanzana.KindDashboards, Identifier: "d1", UserUID: "u1"},
+		{RoleName: "managed:teams:1:permissions", Action: "dashboards:read", Kind: zanzana.KindFolders, Identifier: "f1", TeamUID: "t1"},
+		{RoleName: "managed:builtins:editor:permissions", Action: "dashboards:read", Kind: zanzana.KindDashboards, Identifier: "d1"},
+		{RoleName: "managed:users:1:permissions", Action: "datasources:query", Kind: "datasources", Identifier: "ds1", UserUID: "u1"},
+		{RoleName: "managed:users:1:permissions", Action: "dashboards:unknown", Kind: zanzana.KindDashboards, Identifier: "d1", UserUID: "u1"},
+		{RoleName: "managed:users:1:permissions", Action: "panels:read", Kind: zanzana.KindPanels, Identifier: "d1", UserUID: "u1"},
+	}
+
+	entries := auditManagedPermissions(permissions, zanzana.TranslationLatest)
+	require.Len(t, entries, len(permissions))
+
+	for i, p := range permissions {
+		assert.Equal(t, p.RoleName, entries[i].RoleName)
+		assert.Equal(t, p.Action, entries[i].Action)
+		assert.Equal(t, p.Kind, entries[i].Kind)
+		assert.Equal(t, p.Identifier, entries[i].Identifier)
+	}
+
+	assert.Equal(t, common.NewResourceTuple("user:u1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d1").String(), entries[0].Tuple.String())
+	assert.Empty(t, entries[0].Dropped)
+	assert.Equal(t, common.NewFolderResourceTuple("team:t1#member", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1").String(), entries[1].Tuple.String())
+	assert.Equal(t, "team:t1#member", entries[1].Subject)
+
+	expectedDropped := []string{
+		droppedUnsupportedSubject,
+		zanzana.ErrUnsupportedKind.Error(),
+		zanzana.ErrUnsupportedAction.Error(),
+		zanzana.ErrInvalidIdentifier.Error(),
+	}
+	for i, reason := range expectedDropped {
+		entry := entries[i+2]
+		assert.Nil(t, entry.Tuple)
+		assert.Equal(t, reason, entry.Dropped)
+	}
+}
@@ -0,0 +1,53 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestCompareBackends(t *testing.T) {
+	const namespace = "default"
+
+	shared := common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")
+	sourceOnly := common.NewFolderTuple("user:2", zanzana.RelationRead, "f1")
+	targetOnly := common.NewFolderTuple("user:3", zanzana.RelationRead, "f1")
+	sourceCondition := common.NewFolderResourceTuple("user:4", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")
+	targetCondition := common.NewFolderResourceTuple("user:4", zanzana.RelationRead, dashboardGroup, "librarypanels", "f1")
+
+	source := newFakeZanzanaClient()
+	source.seed(namespace, shared, sourceOnly, sourceCondition)
+	target := newFakeZanzanaClient()
+	target.seed(namespace, shared, targetOnly, targetCondition)
+	// paging is used to read the backends
+	source.pageSize = 1
+	target.pageSize = 2
+
+	t.Run("should report tuples stored in only one backend", func(t *testing.T) {
+		delta, err := CompareBackends(context.Background(), source, target, namespace)
+		require.NoError(t, err)
+		assert.False(t, delta.Empty())
+		assert.ElementsMatch(t, tupleStrings(sourceOnly, sourceCondition), tupleStrings(delta.SourceOnly...))
+		assert.ElementsMatch(t, tupleStrings(targetOnly, targetCondition), tupleStrings(delta.TargetOnly...))
+	})
+
+	t.Run("should be empty for backends with the same tuples", func(t *testing.T) {
+		delta, err := CompareBackends(context.Background(), source, source, namespace)
+		require.NoError(t, err)
+		assert.True(t, delta.Empty())
+	})
+}
+
+func tupleStrings(tuples ...*openfgav1.TupleKey) []string {
+	out := make([]string, 0, len(tuples))
+	for _, t := range tuples {
+		out = append(out, t.String())
+	}
+	return out
+}
@@ -0,0 +1,207 @@
+package dualwrite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/authlib/claims"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/infra/serverlock"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+// ChangeKey identifies a legacy entity that has changed.
+type ChangeKey struct {
+	OrgID int64 `xorm:"org_id"`
+	// Kind is the legacy kind of the entity, e.g. teams, folders or dashboards.
+	Kind string `xorm:"kind"`
+	// UID identifies the entity. For permissions this is the identifier of the permission scope.
+	UID string `xorm:"uid"`
+}
+
+// ChangeFeed emits keys of legacy entities that changed since the previous call.
+type ChangeFeed interface {
+	Changes(ctx context.Context) ([]ChangeKey, error)
+}
+
+var _ ChangeFeed = (*PollingChangeFeed)(nil)
+
+// changeQueries select keys of rows updated after a given time. Keep this in sync with the
+// tables read by the collectors.
+var changeQueries = []string{
+	`SELECT org_id, '` + zanzana.KindTeams + `' AS kind, uid FROM team WHERE updated > ?`,
+	`SELECT t.org_id, '` + zanzana.KindTeams + `' AS kind, t.uid FROM team_member tm INNER JOIN team t ON tm.team_id = t.id WHERE tm.updated > ?`,
+	`SELECT org_id, '` + zanzana.KindFolders + `' AS kind, uid FROM folder WHERE updated > ?`,
+	`SELECT r.org_id, p.kind, p.identifier AS uid FROM permission p INNER JOIN role r ON p.role_id = r.id WHERE r.name LIKE 'managed:%' AND p.updated > ?`,
+}
+
+// PollingChangeFeed is a ChangeFeed that polls the updated columns of legacy tables.
+// Deleted rows can't be observed this way, tuples for them are removed by the periodic
+// full reconciliation.
+type PollingChangeFeed struct {
+	store db.DB
+	since time.Time
+	clock clock.Clock
+}
+
+// NewPollingChangeFeed creates a feed emitting changes made after it was created.
+func NewPollingChangeFeed(store db.DB) *PollingChangeFeed {
+	return newPollingChangeFeed(store, clock.New())
+}
+
+func newPollingChangeFeed(store db.DB, clk clock.Clock) *PollingChangeFeed {
+	return &PollingChangeFeed{store: store, since: clk.Now(), clock: clk}
+}
+
+func (f *PollingChangeFeed) Changes(ctx context.Context) ([]ChangeKey, error) {
+	// Rows updated while polling are emitted again by the next call, reconciling an object
+	// twice is harmless while missing a change is not.
+	now := f.clock.Now()
+
+	var keys []ChangeKey
+	err := f.store.WithDbSession(ctx, func(sess *db.Session) error {
+		for _, query := range changeQueries {
+			var rows []ChangeKey
+			if err := sess.SQL(query, f.since).Find(&rows); err != nil {
+				return err
+			}
+			keys = append(keys, rows...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	f.since = now
+	return keys, nil
+}
+
+// ReconcileChanges polls feed every interval and reconciles the objects affected by the
+// emitted changes until ctx is done. Every poll holds the reconciliation server lock so
+// changes are never reconciled while another instance runs a full reconciliation. A poll
+// is skipped while the lock is taken, the feed is not read so the skipped changes are
+// emitted by the next poll.
+func (r *ZanzanaReconciler) ReconcileChanges(ctx context.Context, feed ChangeFeed, interval time.Duration) error {
+	ticker := r.cfg.clock.Ticker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.reconcileChangesLocked(ctx, feed); err != nil {
+				r.log.Warn("Failed to reconcile changes", "err", err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *ZanzanaReconciler) reconcileChangesLocked(ctx context.Context, feed ChangeFeed) error {
+	if r.lock == nil {
+		return r.reconcileChanges(ctx, feed)
+	}
+
+	var err error
+	lockErr := r.lock.LockExecuteAndRelease(ctx, reconciliationLockName, reconciliationLockMaxInterval, func(ctx context.Context) {
+		err = r.reconcileChanges(ctx, feed)
+	})
+
+	var existsErr *serverlock.ServerLockExistsError
+	if errors.As(lockErr, &existsErr) {
+		r.log.Debug("Skipping changes, reconciliation is running on another instance")
+		return nil
+	}
+	if lockErr != nil {
+		return lockErr
+	}
+	return err
+}
+
+func (r *ZanzanaReconciler) reconcileChanges(ctx context.Context, feed ChangeFeed) error {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.reconcileChanges")
+	defer span.End()
+
+	ctx = r.withRunRetryBudget(ctx)
+	budget := runRetryBudgetFromContext(ctx)
+
+	keys, err := feed.Changes(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read changes: %w", err)
+	}
+
+	byOrg := make(map[int64][]ChangeKey)
+	for _, key := range keys {
+		byOrg[key.OrgID] = append(byOrg[key.OrgID], key)
+	}
+
+	for orgId, keys := range byOrg {
+		namespace := claims.OrgNamespaceFormatter(orgId)
+		for _, reconciler := range r.reconcilers {
+			if budget.isExhausted() {
+				return errRetryBudgetExhausted
+			}
+
+			objects := changedObjects(keys, reconciler, r.cfg.translationVersion)
+			if len(objects) == 0 {
+				continue
+			}
+
+			report, err := reconciler.reconcileObjects(ctx, namespace, objects)
+			if err != nil {
+				r.log.Warn("Failed to reconcile changed objects", "name", reconciler.name, "namespace", namespace, "err", err)
+				continue
+			}
+			r.log.Debug(
+				"Reconciled changed objects",
+				"name", report.Name,
+				"namespace", report.Namespace,
+				"objects", len(objects),
+				"writes", report.Writes,
+				"deletes", report.Deletes,
+				"elapsed", report.Total,
+			)
+		}
+	}
+
+	return nil
+}
+
+// changedObjects returns the sorted objects affected by keys that are owned by reconciler.
+func changedObjects(keys []ChangeKey, reconciler resourceReconciler, version zanzana.TranslationVersion) []string {
+	var objects []string
+	for _, key := range keys {
+		if reconciler.owns(key.Kind) {
+			objects = append(objects, changeObjects(key, version)...)
+		}
+	}
+
+	slices.Sort(objects)
+	return slices.Compact(objects)
+}
+
+// changeObjects returns the objects tuples for key are written to.
+func changeObjects(key ChangeKey, version zanzana.TranslationVersion) []string {
+	switch key.Kind {
+	case zanzana.KindTeams:
+		return []string{common.NewTypedIdent(common.TypeTeam, key.UID)}
+	case zanzana.KindFolders:
+		return []string{common.NewFolderIdent(key.UID)}
+	case zanzana.KindServiceAccounts:
+		return []string{common.NewTypedIdent(common.TypeServiceAccount, key.UID)}
+	}
+
+	prefixes := zanzana.ResourceObjectPrefixes(version, key.Kind)
+	objects := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		objects = append(objects, prefix+key.UID)
+	}
+	return objects
+}
@@ -0,0 +1,221 @@
+package dualwrite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/infra/serverlock"
+	"github.com/grafana/grafana/pkg/infra/tracing"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+// fakeChangeFeed emits one batch of changes for every call.
+type fakeChangeFeed struct {
+	batches [][]ChangeKey
+	err     error
+}
+
+func (f *fakeChangeFeed) Changes(ctx context.Context) ([]ChangeKey, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if len(f.batches) == 0 {
+		return nil, nil
+	}
+	batch := f.batches[0]
+	f.batches = f.batches[1:]
+	return batch, nil
+}
+
+func TestZanzanaReconciler_ReconcileChanges(t *testing.T) {
+	const namespace = "default"
+
+	newReconciler := func(client *fakeZanzanaClient, permissions ...managedPermission) *ZanzanaReconciler {
+		return &ZanzanaReconciler{
+			log: log.NewNopLogger(),
+			cfg: newReconcileConfig(),
+			reconcilers: []resourceReconciler{
+				newResourceReconciler(
+					"folders",
+					permissionCollector(zanzana.TranslationLatest, permissions...),
+					zanzanaCollector(zanzana.FolderRelations),
+					client,
+				).withKinds(zanzana.KindFolders),
+				newResourceReconciler(
+					"dashboards",
+					permissionCollector(zanzana.TranslationLatest, permissions...),
+					zanzanaCollector(zanzana.ResourceRelations),
+					client,
+				).withKinds(zanzana.KindDashboards),
+			},
+		}
+	}
+
+	stored := func(client *fakeZanzanaClient) []string {
+		var out []string
+		for _, tuple := range client.stored(namespace) {
+			out = append(out, tuple.GetObject()+"#"+tuple.GetRelation()+"@"+tuple.GetUser())
+		}
+		return out
+	}
+
+	permissions := []managedPermission{
+		{Action: "folders:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+		{Action: "folders:read", Kind: zanzana.KindFolders, Identifier: "f2", UserUID: "u1"},
+		{Action: "dashboards:read", Kind: zanzana.KindDashboards, Identifier: "d1", UserUID: "u1"},
+	}
+
+	t.Run("should only reconcile changed objects", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		r := newReconciler(client, permissions...)
+
+		err := r.reconcileChanges(context.Background(), &fakeChangeFeed{batches: [][]ChangeKey{
+			{{OrgID: 1, Kind: zanzana.KindFolders, UID: "f1"}},
+		}})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"folder:f1#read@user:u1"}, stored(client))
+	})
+
+	t.Run("should reconcile changes from every batch", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		r := newReconciler(client, permissions...)
+		feed := &fakeChangeFeed{batches: [][]ChangeKey{
+			{{OrgID: 1, Kind: zanzana.KindFolders, UID: "f2"}},
+			{{OrgID: 1, Kind: zanzana.KindDashboards, UID: "d1"}, {OrgID: 1, Kind: zanzana.KindDashboards, UID: "d1"}},
+		}}
+
+		require.NoError(t, r.reconcileChanges(context.Background(), feed))
+		require.NoError(t, r.reconcileChanges(context.Background(), feed))
+		assert.ElementsMatch(t, []string{
+			"folder:f2#read@user:u1",
+			"resource:dashboard.grafana.app/dashboards/d1#read@user:u1",
+		}, stored(client))
+	})
+
+	t.Run("should remove tuples of changed objects missing from legacy", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		client.seed(namespace,
+			common.NewFolderTuple("user:u1", zanzana.RelationRead, "f3"),
+			common.NewFolderTuple("user:u1", zanzana.RelationRead, "f4"),
+		)
+		r := newReconciler(client, permissions...)
+
+		err := r.reconcileChanges(context.Background(), &fakeChangeFeed{batches: [][]ChangeKey{
+			{{OrgID: 1, Kind: zanzana.KindFolders, UID: "f3"}},
+		}})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"folder:f4#read@user:u1"}, stored(client))
+	})
+
+	t.Run("should ignore changes of kinds without a reconciler", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		r := newReconciler(client, permissions...)
+
+		err := r.reconcileChanges(context.Background(), &fakeChangeFeed{batches: [][]ChangeKey{
+			{{OrgID: 1, Kind: "datasources", UID: "ds1"}, {OrgID: 1, Kind: zanzana.KindTeams, UID: "t1"}},
+		}})
+		require.NoError(t, err)
+		assert.Empty(t, client.writes)
+	})
+
+	t.Run("should poll feed on every tick of the clock", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		r := newReconciler(client, permissions...)
+		clk := clock.NewMock()
+		r.cfg.clock = clk
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- r.ReconcileChanges(ctx, &fakeChangeFeed{batches: [][]ChangeKey{
+				{{OrgID: 1, Kind: zanzana.KindFolders, UID: "f1"}},
+			}}, time.Minute)
+		}()
+
+		assert.Eventually(t, func() bool {
+			clk.Add(time.Minute)
+			return len(stored(client)) == 1
+		}, time.Second, 10*time.Millisecond)
+
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+
+	t.Run("should return error when changes can't be read", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		r := newReconciler(client, permissions...)
+
+		err := r.reconcileChanges(context.Background(), &fakeChangeFeed{err: errors.New("boom")})
+		require.Error(t, err)
+		assert.Empty(t, client.writes)
+	})
+}
+
+func TestIntegrationZanzanaReconciler_ReconcileChangesLock(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	client := newFakeZanzanaClient()
+	r := &ZanzanaReconciler{
+		lock: serverlock.ProvideService(db.InitTestDB(t), tracing.InitializeTracerForTest()),
+		log:  log.NewNopLogger(),
+		cfg:  newReconcileConfig(),
+		reconcilers: []resourceReconciler{
+			newResourceReconciler(
+				"folders",
+				permissionCollector(zanzana.TranslationLatest, managedPermission{
+					Action: "folders:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1",
+				}),
+				zanzanaCollector(zanzana.FolderRelations),
+				client,
+			).withKinds(zanzana.KindFolders),
+		},
+	}
+	feed := &fakeChangeFeed{batches: [][]ChangeKey{
+		{{OrgID: 1, Kind: zanzana.KindFolders, UID: "f1"}},
+	}}
+
+	// A full reconciliation on another instance holds the lock, changes must not be read.
+	err := r.lock.LockExecuteAndRelease(context.Background(), reconciliationLockName, reconciliationLockMaxInterval, func(ctx context.Context) {
+		require.NoError(t, r.reconcileChangesLocked(ctx, feed))
+	})
+	require.NoError(t, err)
+	assert.Len(t, feed.batches, 1)
+	assert.Empty(t, client.writes)
+
+	require.NoError(t, r.reconcileChangesLocked(context.Background(), feed))
+	assert.Empty(t, feed.batches)
+	assert.Len(t, client.stored("default"), 1)
+}
+
+func TestChangeObjects(t *testing.T) {
+	tests := []struct {
+		key      ChangeKey
+		expected []string
+	}{
+		{key: ChangeKey{Kind: zanzana.KindTeams, UID: "t1"}, expected: []string{"team:t1"}},
+		{key: ChangeKey{Kind: zanzana.KindFolders, UID: "f1"}, expected: []string{"folder:f1"}},
+		{key: ChangeKey{Kind: zanzana.KindServiceAccounts, UID: "1"}, expected: []string{"service_account:1"}},
+		{key: ChangeKey{Kind: zanzana.KindDashboards, UID: "d1"}, expected: []string{
+			"resource:annotation.grafana.app/annotations/d1",
+			"resource:dashboard.grafana.app/dashboards/d1",
+		}},
+		{key: ChangeKey{Kind: "datasources", UID: "ds1"}, expected: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key.Kind, func(t *testing.T) {
+			assert.Equal(t, tt.expected, changeObjects(tt.key, zanzana.TranslationLatest))
+		})
+	}
+}
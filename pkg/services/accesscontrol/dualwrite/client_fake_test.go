@@ -0,0 +1,173 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/grafana/authlib/authz"
+	"github.com/grafana/authlib/claims"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+var _ zanzana.Client = (*fakeZanzanaClient)(nil)
+
+// fakeZanzanaClient is an in memory zanzana client storing tuples per namespace.
+type fakeZanzanaClient struct {
+	mu sync.Mutex
+	// tuples are stored by namespace and tuple key without condition
+	tuples map[string]map[string]*openfgav1.TupleKey
+	// writes contains every write request made to the client
+	writes []*authzextv1.WriteRequest
+	// pageSize controls how many tuples are returned for each read, 0 means all
+	pageSize int
+
+	checkFn func(id claims.AuthInfo, req authz.CheckRequest) (bool, error)
+}
+
+func newFakeZanzanaClient() *fakeZanzanaClient {
+	return &fakeZanzanaClient{tuples: map[string]map[string]*openfgav1.TupleKey{}}
+}
+
+func (c *fakeZanzanaClient) seed(namespace string, tuples ...*openfgav1.TupleKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range tuples {
+		c.put(namespace, t)
+	}
+}
+
+func (c *fakeZanzanaClient) put(namespace string, t *openfgav1.TupleKey) {
+	if c.tuples[namespace] == nil {
+		c.tuples[namespace] = map[string]*openfgav1.TupleKey{}
+	}
+	c.tuples[namespace][tupleStringWithoutCondition(t)] = t
+}
+
+// stored returns all tuples stored for namespace.
+func (c *fakeZanzanaClient) stored(namespace string) []*openfgav1.TupleKey {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.tuples[namespace]))
+	for k := range c.tuples[namespace] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]*openfgav1.TupleKey, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, c.tuples[namespace][k])
+	}
+	return out
+}
+
+func (c *fakeZanzanaClient) Check(ctx context.Context, id claims.AuthInfo, req authz.CheckRequest) (authz.CheckResponse, error) {
+	if c.checkFn == nil {
+		return authz.CheckResponse{}, nil
+	}
+	allowed, err := c.checkFn(id, req)
+	if err != nil {
+		return authz.CheckResponse{}, err
+	}
+	return authz.CheckResponse{Allowed: allowed}, nil
+}
+
+func (c *fakeZanzanaClient) Compile(ctx context.Context, id claims.AuthInfo, req authz.ListRequest) (authz.ItemChecker, error) {
+	return func(namespace, name, folder string) bool { return false }, nil
+}
+
+func (c *fakeZanzanaClient) List(ctx context.Context, id claims.AuthInfo, req authz.ListRequest) (*authzextv1.ListResponse, error) {
+	return &authzextv1.ListResponse{}, nil
+}
+
+func (c *fakeZanzanaClient) Read(ctx context.Context, req *authzextv1.ReadRequest) (*authzextv1.ReadResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	matches := make([]*authzextv1.Tuple, 0)
+	for _, t := range c.stored(req.GetNamespace()) {
+		key := req.GetTupleKey()
+		if !matchObject(key.GetObject(), t.GetObject()) {
+			continue
+		}
+		if key.GetRelation() != "" && key.GetRelation() != t.GetRelation() {
+			continue
+		}
+		if key.GetUser() != "" && key.GetUser() != t.GetUser() {
+			continue
+		}
+		matches = append(matches, &authzextv1.Tuple{Key: common.ToAuthzExtTupleKey(t)})
+	}
+
+	start := 0
+	if req.GetContinuationToken() != "" {
+		var err error
+		if start, err = strconv.Atoi(req.GetContinuationToken()); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.pageSize == 0 || start+c.pageSize >= len(matches) {
+		return &authzextv1.ReadResponse{Tuples: matches[start:]}, nil
+	}
+
+	end := start + c.pageSize
+	return &authzextv1.ReadResponse{
+		Tuples:            matches[start:end],
+		ContinuationToken: strconv.Itoa(end),
+	}, nil
+}
+
+func (c *fakeZanzanaClient) Write(ctx context.Context, req *authzextv1.WriteRequest) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// zanzana rejects requests where the same tuple is both written and deleted
+	seen := make(map[string]struct{})
+	for _, t := range req.GetDeletes().GetTupleKeys() {
+		seen[t.GetUser()+"#"+t.GetRelation()+"@"+t.GetObject()] = struct{}{}
+	}
+	for _, t := range req.GetWrites().GetTupleKeys() {
+		if _, ok := seen[t.GetUser()+"#"+t.GetRelation()+"@"+t.GetObject()]; ok {
+			return fmt.Errorf("duplicate tuple in write request: %s", t.String())
+		}
+	}
+
+	c.writes = append(c.writes, req)
+	for _, t := range req.GetDeletes().GetTupleKeys() {
+		delete(c.tuples[req.GetNamespace()], tupleStringWithoutCondition(&openfgav1.TupleKey{
+			User:     t.GetUser(),
+			Relation: t.GetRelation(),
+			Object:   t.GetObject(),
+		}))
+	}
+	for _, t := range req.GetWrites().GetTupleKeys() {
+		c.put(req.GetNamespace(), common.ToOpenFGATupleKey(t))
+	}
+
+	return nil
+}
+
+// matchObject matches object against filter, a filter ending with ":" only matches the type like openfga does.
+func matchObject(filter, object string) bool {
+	if filter == "" {
+		return true
+	}
+	if strings.HasSuffix(filter, ":") {
+		return strings.HasPrefix(object, filter)
+	}
+	return filter == object
+}
@@ -0,0 +1,116 @@
+package dualwrite
+
+import (
+	"context"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+)
+
+const (
+	// suspiciousMinRows is the number of rows a collector must have read before
+	// producing no tuples is considered suspicious.
+	suspiciousMinRows = 10
+	// suspiciousMinRatio is the lowest expected ratio of tuples to rows.
+	suspiciousMinRatio = 0.1
+)
+
+// rowCountQueries counts the legacy rows each reconciler translates into tuples for an org.
+var rowCountQueries = map[string]struct {
+	query string
+	args  []any
+}{
+	"team memberships": {query: "SELECT COUNT(*) FROM team_member WHERE org_id = ?"},
+	"folder tree":      {query: "SELECT COUNT(*) FROM folder WHERE org_id = ? AND parent_uid IS NOT NULL AND parent_uid != ''"},
+	"managed folder permissions": {
+		query: managedPermissionCountQuery,
+		args:  []any{zanzana.KindFolders},
+	},
+	"managed dashboard permissions": {
+		query: managedPermissionCountQuery,
+		args:  []any{zanzana.KindDashboards},
+	},
+}
+
+const managedPermissionCountQuery = `
+	SELECT COUNT(*) FROM permission p
+	INNER JOIN role r ON p.role_id = r.id
+	WHERE r.org_id = ? AND r.name LIKE 'managed:%' AND p.kind = ?
+`
+
+// CollectionCheck compares the number of legacy rows with the number of tuples produced for an org.
+type CollectionCheck struct {
+	OrgID   int64
+	Entries []CollectionCheckEntry
+}
+
+// Suspicious returns true if any of the entries is suspicious.
+func (c *CollectionCheck) Suspicious() bool {
+	for _, e := range c.Entries {
+		if e.Suspicious {
+			return true
+		}
+	}
+	return false
+}
+
+type CollectionCheckEntry struct {
+	// Name is the name of the reconciler.
+	Name   string
+	Rows   int
+	Tuples int
+	// Suspicious is set when few or no tuples were produced from many rows.
+	Suspicious bool
+}
+
+// CheckCollection runs the legacy collectors for org and compares the number of rows in the
+// tables they read with the number of tuples they produce.
+func (r *ZanzanaReconciler) CheckCollection(ctx context.Context, orgId int64) (*CollectionCheck, error) {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.CheckCollection")
+	defer span.End()
+
+	check := &CollectionCheck{OrgID: orgId}
+	for _, reconciler := range r.reconcilers {
+		q, ok := rowCountQueries[reconciler.name]
+		if !ok {
+			continue
+		}
+
+		var rows int
+		err := r.store.WithDbSession(ctx, func(sess *db.Session) error {
+			_, err := sess.SQL(q.query, append([]any{orgId}, q.args...)...).Get(&rows)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		tuples, err := reconciler.legacy(ctx, orgId)
+		if err != nil {
+			return nil, err
+		}
+
+		check.Entries = append(check.Entries, newCollectionCheckEntry(reconciler.name, rows, countTuples(tuples)))
+	}
+
+	return check, nil
+}
+
+func newCollectionCheckEntry(name string, rows, tuples int) CollectionCheckEntry {
+	return CollectionCheckEntry{
+		Name:       name,
+		Rows:       rows,
+		Tuples:     tuples,
+		Suspicious: rows >= suspiciousMinRows && float64(tuples) < float64(rows)*suspiciousMinRatio,
+	}
+}
+
+func countTuples(tuples map[string]map[string]*openfgav1.TupleKey) int {
+	var count int
+	for _, object := range tuples {
+		count += len(object)
+	}
+	return count
+}
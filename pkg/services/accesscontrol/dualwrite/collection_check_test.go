@@ -0,0 +1,37 @@
+package dualwrite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectionCheck(t *testing.T) {
+	t.Run("should not flag a healthy org", func(t *testing.T) {
+		check := &CollectionCheck{OrgID: 1, Entries: []CollectionCheckEntry{
+			newCollectionCheckEntry("team memberships", 40, 40),
+			// permissions are merged so fewer tuples than rows are expected
+			newCollectionCheckEntry("managed folder permissions", 120, 30),
+			// too few rows to tell
+			newCollectionCheckEntry("folder tree", 3, 0),
+		}}
+
+		for _, e := range check.Entries {
+			assert.False(t, e.Suspicious, e.Name)
+		}
+		assert.False(t, check.Suspicious())
+	})
+
+	t.Run("should flag an org with no or too few tuples for many rows", func(t *testing.T) {
+		check := &CollectionCheck{OrgID: 2, Entries: []CollectionCheckEntry{
+			newCollectionCheckEntry("team memberships", 40, 0),
+			newCollectionCheckEntry("managed folder permissions", 1000, 5),
+			newCollectionCheckEntry("folder tree", 20, 20),
+		}}
+
+		assert.True(t, check.Entries[0].Suspicious)
+		assert.True(t, check.Entries[1].Suspicious)
+		assert.False(t, check.Entries[2].Suspicious)
+		assert.True(t, check.Suspicious())
+	})
+}
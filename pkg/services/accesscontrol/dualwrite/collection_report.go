@@ -0,0 +1,136 @@
+package dualwrite
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+)
+
+// CollectorStats are the statistics of running a single legacy collector for an org.
+type CollectorStats struct {
+	// Name is the name of the reconciler.
+	Name string
+	// Rows is the number of legacy rows the collector translates, it is only counted for
+	// collectors listed in rowCountQueries.
+	Rows    int
+	Objects int
+	Tuples  int
+	// Duration is the wall-clock time of the collection.
+	Duration time.Duration
+	// Skipped is set when the collector failed and has no tuples, Error holds the reason.
+	Skipped bool
+	Error   string
+}
+
+// CollectionReport aggregates the statistics of all legacy collectors for an org, e.g. for a
+// post-mortem of a migration.
+type CollectionReport struct {
+	OrgID      int64
+	Collectors []CollectorStats
+	// Rows, Objects, Tuples and Duration are the sums over all collectors.
+	Rows     int
+	Objects  int
+	Tuples   int
+	Duration time.Duration
+	// Skipped is the number of collectors that failed.
+	Skipped int
+}
+
+type collectionReportJSON struct {
+	OrgID      int64                `json:"orgId"`
+	Rows       int                  `json:"rows"`
+	Objects    int                  `json:"objects"`
+	Tuples     int                  `json:"tuples"`
+	Duration   string               `json:"duration"`
+	Skipped    int                  `json:"skipped"`
+	Collectors []collectorStatsJSON `json:"collectors"`
+}
+
+type collectorStatsJSON struct {
+	Name     string `json:"name"`
+	Rows     int    `json:"rows"`
+	Objects  int    `json:"objects"`
+	Tuples   int    `json:"tuples"`
+	Duration string `json:"duration"`
+	Skipped  bool   `json:"skipped,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// newCollectionReport sums the statistics of collectors into a report.
+func newCollectionReport(orgId int64, collectors []CollectorStats) *CollectionReport {
+	report := &CollectionReport{OrgID: orgId, Collectors: collectors}
+	for _, c := range collectors {
+		report.Rows += c.Rows
+		report.Objects += c.Objects
+		report.Tuples += c.Tuples
+		report.Duration += c.Duration
+		if c.Skipped {
+			report.Skipped++
+		}
+	}
+	return report
+}
+
+// JSON renders the report as indented JSON, durations are formatted as strings.
+func (c *CollectionReport) JSON() ([]byte, error) {
+	out := collectionReportJSON{
+		OrgID:      c.OrgID,
+		Rows:       c.Rows,
+		Objects:    c.Objects,
+		Tuples:     c.Tuples,
+		Duration:   c.Duration.String(),
+		Skipped:    c.Skipped,
+		Collectors: make([]collectorStatsJSON, 0, len(c.Collectors)),
+	}
+	for _, s := range c.Collectors {
+		out.Collectors = append(out.Collectors, collectorStatsJSON{
+			Name:     s.Name,
+			Rows:     s.Rows,
+			Objects:  s.Objects,
+			Tuples:   s.Tuples,
+			Duration: s.Duration.String(),
+			Skipped:  s.Skipped,
+			Error:    s.Error,
+		})
+	}
+	return json.MarshalIndent(out, "", "  ")
+}
+
+// CollectionReport runs every legacy collector for org and reports their statistics. A failing
+// collector is reported as skipped and doesn't fail the report, nothing is written to zanzana.
+func (r *ZanzanaReconciler) CollectionReport(ctx context.Context, orgId int64) (*CollectionReport, error) {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.CollectionReport")
+	defer span.End()
+
+	stats := make([]CollectorStats, 0, len(r.reconcilers))
+	for _, reconciler := range r.reconcilers {
+		s := CollectorStats{Name: reconciler.name}
+
+		if q, ok := rowCountQueries[reconciler.name]; ok {
+			err := r.store.WithDbSession(ctx, func(sess *db.Session) error {
+				_, err := sess.SQL(q.query, append([]any{orgId}, q.args...)...).Get(&s.Rows)
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		start := r.cfg.clock.Now()
+		tuples, err := reconciler.legacy(ctx, orgId)
+		s.Duration = r.cfg.clock.Since(start)
+		if err != nil {
+			s.Skipped = true
+			s.Error = err.Error()
+		} else {
+			s.Objects = len(tuples)
+			s.Tuples = countTuples(tuples)
+		}
+
+		stats = append(stats, s)
+	}
+
+	return newCollectionReport(orgId, stats), nil
+}
@@ -0,0 +1,81 @@
+package dualwrite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestCollectionReport(t *testing.T) {
+	failing := func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		return nil, errors.New("table not found")
+	}
+
+	r := &ZanzanaReconciler{
+		log: log.NewNopLogger(),
+		cfg: newReconcileConfig(),
+		reconcilers: []resourceReconciler{
+			newResourceReconciler("teams", staticCollector(
+				teamMembershipTuple(teamMembership{TeamUID: "t1", UserUID: "u1"}),
+				teamMembershipTuple(teamMembership{TeamUID: "t1", UserUID: "u2"}),
+				teamMembershipTuple(teamMembership{TeamUID: "t2", UserUID: "u1"}),
+			), nil, nil),
+			newResourceReconciler("folders", staticCollector(
+				common.NewFolderTuple("user:u1", zanzana.RelationRead, "f1"),
+			), nil, nil),
+			newResourceReconciler("broken", failing, nil, nil),
+		},
+	}
+
+	report, err := r.CollectionReport(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, report.Collectors, 3)
+
+	teams, folders, broken := report.Collectors[0], report.Collectors[1], report.Collectors[2]
+	assert.Equal(t, 2, teams.Objects)
+	assert.Equal(t, 3, teams.Tuples)
+	assert.Equal(t, 1, folders.Objects)
+	assert.Equal(t, 1, folders.Tuples)
+	assert.True(t, broken.Skipped)
+	assert.Equal(t, "table not found", broken.Error)
+
+	assert.Equal(t, teams.Objects+folders.Objects+broken.Objects, report.Objects)
+	assert.Equal(t, teams.Tuples+folders.Tuples+broken.Tuples, report.Tuples)
+	assert.Equal(t, teams.Duration+folders.Duration+broken.Duration, report.Duration)
+	assert.Equal(t, 1, report.Skipped)
+}
+
+func TestCollectionReport_JSON(t *testing.T) {
+	report := newCollectionReport(2, []CollectorStats{
+		{Name: "team memberships", Rows: 10, Objects: 2, Tuples: 10, Duration: time.Second},
+		{Name: "folder tree", Rows: 5, Objects: 5, Tuples: 5, Duration: 500 * time.Millisecond},
+		{Name: "managed folder permissions", Duration: time.Millisecond, Skipped: true, Error: "timeout"},
+	})
+
+	data, err := report.JSON()
+	require.NoError(t, err)
+
+	var out collectionReportJSON
+	require.NoError(t, json.Unmarshal(data, &out))
+	assert.Equal(t, int64(2), out.OrgID)
+	assert.Equal(t, 15, out.Rows)
+	assert.Equal(t, 7, out.Objects)
+	assert.Equal(t, 15, out.Tuples)
+	assert.Equal(t, "1.501s", out.Duration)
+	assert.Equal(t, 1, out.Skipped)
+
+	require.Len(t, out.Collectors, 3)
+	assert.Equal(t, "500ms", out.Collectors[1].Duration)
+	assert.False(t, out.Collectors[1].Skipped)
+	assert.Equal(t, "timeout", out.Collectors[2].Error)
+}
@@ -2,63 +2,553 @@ package dualwrite
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	openfgav1 "github.com/openfga/api/proto/openfga/v1"
 
+	"github.com/grafana/grafana/pkg/apimachinery/identity"
+	dashboardalpha1 "github.com/grafana/grafana/pkg/apis/dashboard/v0alpha1"
 	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/accesscontrol"
 	"github.com/grafana/grafana/pkg/services/authz/zanzana"
 	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
 	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
 )
 
-func teamMembershipCollector(store db.DB) legacyTupleCollector {
+// teamMembershipCollector collects team memberships as member and admin tuples. The creator of a
+// team is stored as its admin when the team is created, so teams created by editors with the
+// editors_can_admin setting enabled need no extra tuples.
+func teamMembershipCollector(store db.DB, cfg *reconcileConfig) legacyTupleCollector {
 	return func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		// When members were last seen is only read when it is reported.
+		lastSeen := ""
+		if cfg.teamMemberLastSeen != nil {
+			lastSeen = ", u.last_seen_at"
+		}
+
 		query := `
-			SELECT t.uid as team_uid, u.uid as user_uid, tm.permission
+			SELECT t.uid as team_uid, u.uid as user_uid, u.is_service_account, tm.permission` + lastSeen + `
 			FROM team_member tm
 			INNER JOIN team t ON tm.team_id = t.id
 			INNER JOIN ` + store.GetDialect().Quote("user") + ` u ON tm.user_id = u.id
+			WHERE t.org_id = ?
 		`
 
-		type membership struct {
-			TeamUID    string `xorm:"team_uid"`
-			UserUID    string `xorm:"user_uid"`
-			Permission int
+		var memberships []teamMembership
+		err := store.WithDbSession(ctx, func(sess *db.Session) error {
+			_, err := fetchRows(sess, store.GetDialect().DriverName(), cfg.fetchSize, &memberships, query, orgId)
+			return err
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		reportTeamMemberLastSeen(memberships, cfg.teamMemberLastSeen)
+		return teamMembershipTuples(memberships), nil
+	}
+}
+
+// teamMembershipTuples translates memberships into tuples grouped by team.
+func teamMembershipTuples(memberships []teamMembership) map[string]map[string]*openfgav1.TupleKey {
+	tuples := make(map[string]map[string]*openfgav1.TupleKey)
+
+	for _, m := range memberships {
+		tuple := teamMembershipTuple(m)
+		if tuples[tuple.Object] == nil {
+			tuples[tuple.Object] = make(map[string]*openfgav1.TupleKey)
 		}
 
-		var memberships []membership
+		tuples[tuple.Object][tupleKey(tuple)] = tuple
+	}
+
+	return tuples
+}
+
+type teamMembership struct {
+	TeamUID          string    `xorm:"team_uid"`
+	UserUID          string    `xorm:"user_uid"`
+	IsServiceAccount bool      `xorm:"is_service_account"`
+	LastSeenAt       time.Time `xorm:"last_seen_at"`
+	Permission       int
+}
+
+// userSubjectType returns the subject type of a row of the user table. Service accounts are
+// stored as users but are written with their own subject type by every collector.
+func userSubjectType(isServiceAccount bool) string {
+	if isServiceAccount {
+		return zanzana.TypeServiceAccount
+	}
+	return zanzana.TypeUser
+}
+
+// teamMembershipTuple translates a team membership into a member or admin tuple. Service accounts
+// can only be members.
+func teamMembershipTuple(m teamMembership) *openfgav1.TupleKey {
+	tuple := &openfgav1.TupleKey{
+		User:   zanzana.NewTupleEntry(userSubjectType(m.IsServiceAccount), m.UserUID, ""),
+		Object: zanzana.NewTupleEntry(zanzana.TypeTeam, m.TeamUID, ""),
+	}
+
+	if m.IsServiceAccount {
+		tuple.Relation = zanzana.RelationTeamMember
+		return tuple
+	}
+
+	// Admin permission is 4 and member 0
+	if m.Permission == 4 {
+		tuple.Relation = zanzana.RelationTeamAdmin
+	} else {
+		tuple.Relation = zanzana.RelationTeamMember
+	}
+
+	return tuple
+}
+
+// groupMembershipCollector collects memberships of external identity provider groups.
+// Grafana does not store raw IdP groups, but users assigned roles through a group mapping
+// are stored with the uid of the mapping, so every mapping is represented as a group.
+func groupMembershipCollector(store db.DB) legacyTupleCollector {
+	return func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		query := `
+			SELECT DISTINCT ur.group_mapping_uid, u.uid as user_uid
+			FROM user_role ur
+			INNER JOIN ` + store.GetDialect().Quote("user") + ` u ON ur.user_id = u.id
+			WHERE ur.org_id = ? AND ur.group_mapping_uid != ''
+		`
+
+		var memberships []groupMembership
 		err := store.WithDbSession(ctx, func(sess *db.Session) error {
-			return sess.SQL(query).Find(&memberships)
+			return sess.SQL(query, orgId).Find(&memberships)
 		})
 
 		if err != nil {
 			return nil, err
 		}
 
-		tuples := make(map[string]map[string]*openfgav1.TupleKey)
+		return groupMembershipTuples(memberships), nil
+	}
+}
 
-		for _, m := range memberships {
-			tuple := &openfgav1.TupleKey{
-				User:   zanzana.NewTupleEntry(zanzana.TypeUser, m.UserUID, ""),
-				Object: zanzana.NewTupleEntry(zanzana.TypeTeam, m.TeamUID, ""),
-			}
+type groupMembership struct {
+	GroupMappingUID string `xorm:"group_mapping_uid"`
+	UserUID         string `xorm:"user_uid"`
+}
+
+// groupMembershipTuples translates group memberships into member tuples grouped by group.
+func groupMembershipTuples(memberships []groupMembership) map[string]map[string]*openfgav1.TupleKey {
+	tuples := make(map[string]map[string]*openfgav1.TupleKey)
+
+	for _, m := range memberships {
+		if m.GroupMappingUID == "" || m.UserUID == "" {
+			continue
+		}
 
-			// Admin permission is 4 and member 0
-			if m.Permission == 4 {
-				tuple.Relation = zanzana.RelationTeamAdmin
-			} else {
-				tuple.Relation = zanzana.RelationTeamMember
+		tuple := &openfgav1.TupleKey{
+			User:     zanzana.NewTupleEntry(zanzana.TypeUser, m.UserUID, ""),
+			Relation: zanzana.RelationTeamMember,
+			Object:   zanzana.NewTupleEntry(zanzana.TypeGroup, m.GroupMappingUID, ""),
+		}
+
+		if tuples[tuple.Object] == nil {
+			tuples[tuple.Object] = make(map[string]*openfgav1.TupleKey)
+		}
+
+		tuples[tuple.Object][tuple.String()] = tuple
+	}
+
+	return tuples
+}
+
+// groupRoleCollector collects the roles external identity provider groups are mapped to. Group
+// mappings are only stored on the roles of the users they assigned, so a mapping without synced
+// users is not collected. Basic roles are assigned through the org role and are never collected.
+func groupRoleCollector(store db.DB) legacyTupleCollector {
+	return func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		query := `
+			SELECT DISTINCT ur.group_mapping_uid, r.uid as role_uid
+			FROM user_role ur
+			INNER JOIN role r ON ur.role_id = r.id
+			WHERE ur.org_id = ? AND ur.group_mapping_uid != '' AND r.name NOT LIKE ?
+		`
+
+		var mappings []groupRoleMapping
+		err := store.WithDbSession(ctx, func(sess *db.Session) error {
+			return sess.SQL(query, orgId, zanzana.BasicRolePrefix+"%").Find(&mappings)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return groupRoleTuples(mappings), nil
+	}
+}
+
+type groupRoleMapping struct {
+	GroupMappingUID string `xorm:"group_mapping_uid"`
+	RoleUID         string `xorm:"role_uid"`
+}
+
+// groupRoleTuples translates group role mappings into assignee tuples on the role with the
+// members of the group as subject. A group mapped to multiple roles is an assignee of each.
+func groupRoleTuples(mappings []groupRoleMapping) map[string]map[string]*openfgav1.TupleKey {
+	tuples := make(map[string]map[string]*openfgav1.TupleKey)
+
+	for _, m := range mappings {
+		if m.GroupMappingUID == "" || m.RoleUID == "" {
+			continue
+		}
+
+		putTuple(tuples, &openfgav1.TupleKey{
+			User:     zanzana.NewTupleEntry(zanzana.TypeGroup, m.GroupMappingUID, zanzana.RelationTeamMember),
+			Relation: zanzana.RelationAssignee,
+			Object:   zanzana.NewTupleEntry(zanzana.TypeRole, m.RoleUID, ""),
+		})
+	}
+
+	return tuples
+}
+
+// orgMembershipCollector collects the implicit membership of every user of the org. Disabled
+// users are not members so their tuples are deleted.
+func orgMembershipCollector(store db.DB) legacyTupleCollector {
+	return func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		query := `
+			SELECT u.uid as user_uid, u.is_service_account, u.is_disabled
+			FROM org_user ou
+			INNER JOIN ` + store.GetDialect().Quote("user") + ` u ON ou.user_id = u.id
+			WHERE ou.org_id = ?
+		`
+
+		var memberships []orgMembership
+		err := store.WithDbSession(ctx, func(sess *db.Session) error {
+			return sess.SQL(query, orgId).Find(&memberships)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return orgMembershipTuples(orgId, memberships), nil
+	}
+}
+
+type orgMembership struct {
+	UserUID          string `xorm:"user_uid"`
+	IsServiceAccount bool   `xorm:"is_service_account"`
+	IsDisabled       bool   `xorm:"is_disabled"`
+}
+
+// orgMembershipTuples translates org users into member tuples on the org.
+func orgMembershipTuples(orgId int64, memberships []orgMembership) map[string]map[string]*openfgav1.TupleKey {
+	tuples := make(map[string]map[string]*openfgav1.TupleKey)
+	object := zanzana.NewTupleEntry(zanzana.TypeOrg, strconv.FormatInt(orgId, 10), "")
+
+	for _, m := range memberships {
+		if m.UserUID == "" || m.IsDisabled {
+			continue
+		}
+
+		putTuple(tuples, &openfgav1.TupleKey{
+			User:     zanzana.NewTupleEntry(userSubjectType(m.IsServiceAccount), m.UserUID, ""),
+			Relation: zanzana.RelationTeamMember,
+			Object:   object,
+		})
+	}
+
+	return tuples
+}
+
+// teamVisibilityCollector collects read access to teams granted to the members of other teams.
+// Legacy scopes team permissions by id, so they are joined with the team to get its uid.
+func teamVisibilityCollector(store db.DB, cfg *reconcileConfig) legacyTupleCollector {
+	return func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		ctx, span := tracer.Start(ctx, "accesscontrol.migrator.teamVisibilityCollector")
+		defer span.End()
+
+		grantsQuery := `
+			SELECT st.uid as subject_uid, t.uid as team_uid, p.action
+			FROM permission p
+			INNER JOIN role r ON p.role_id = r.id
+			INNER JOIN team_role tr ON r.id = tr.role_id
+			INNER JOIN team st ON tr.team_id = st.id
+			INNER JOIN team t ON p.scope = ` + store.GetDialect().Concat("'teams:id:'", "t.id") + ` AND t.org_id = r.org_id
+			WHERE r.name LIKE 'managed:%' AND r.org_id = ? AND p.action = ?
+		`
+		const teamsQuery = `
+			SELECT uid FROM team WHERE org_id = ?
+		`
+
+		var (
+			grants []teamVisibilityGrant
+			teams  []string
+		)
+		err := store.WithDbSession(ctx, func(sess *db.Session) error {
+			if err := sess.SQL(grantsQuery, orgId, "teams:read").Find(&grants); err != nil {
+				return err
 			}
+			return sess.SQL(teamsQuery, orgId).Find(&teams)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return teamVisibilityTuples(teams, grants, cfg.translationVersion, cfg.droppedTuples), nil
+	}
+}
+
+type teamVisibilityGrant struct {
+	SubjectUID string `xorm:"subject_uid"`
+	TeamUID    string `xorm:"team_uid"`
+	Action     string `xorm:"action"`
+}
+
+// teamVisibilityTuples translates grants into read tuples on the team with the members of the
+// subject team as subject. Every team is returned, also without grants, so read tuples of
+// revoked grants are deleted. Grants of a team on itself are skipped as members can always read
+// their team. Read access never makes the subject members of the team.
+func teamVisibilityTuples(teams []string, grants []teamVisibilityGrant, version zanzana.TranslationVersion, dropped DroppedTupleSink) map[string]map[string]*openfgav1.TupleKey {
+	tuples := make(map[string]map[string]*openfgav1.TupleKey, len(teams))
+	for _, uid := range teams {
+		tuples[zanzana.NewTupleEntry(zanzana.TypeTeam, uid, "")] = make(map[string]*openfgav1.TupleKey)
+	}
+
+	for _, g := range grants {
+		object := zanzana.NewTupleEntry(zanzana.TypeTeam, g.TeamUID, "")
+		subject := zanzana.NewTupleEntry(zanzana.TypeTeam, g.SubjectUID, zanzana.RelationTeamMember)
+		if g.SubjectUID == g.TeamUID {
+			dropped.drop(object, g.Action, subject, droppedSelfGrant)
+			continue
+		}
+
+		tuple, err := zanzana.TranslateResourcePermission(version, subject, g.Action, zanzana.KindTeams, g.TeamUID)
+		if err != nil {
+			dropped.drop(object, g.Action, subject, err.Error())
+			continue
+		}
+		putTuple(tuples, tuple)
+	}
+
+	return tuples
+}
+
+// publicDashboardCollector collects read access granted by shared public dashboards. Shares
+// that are revoked are not collected so their tuples are deleted.
+func publicDashboardCollector(store db.DB) legacyTupleCollector {
+	return func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		query := `
+			SELECT uid, dashboard_uid, is_enabled
+			FROM dashboard_public
+			WHERE org_id = ?
+		`
+
+		var shares []publicDashboardShare
+		err := store.WithDbSession(ctx, func(sess *db.Session) error {
+			return sess.SQL(query, orgId).Find(&shares)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return publicDashboardTuples(shares), nil
+	}
+}
+
+type publicDashboardShare struct {
+	UID          string `xorm:"uid"`
+	DashboardUID string `xorm:"dashboard_uid"`
+	IsEnabled    bool   `xorm:"is_enabled"`
+}
+
+// publicDashboardTuples translates enabled shares into public read tuples grouped by dashboard.
+// Shares are referenced by uid so the access token itself is never written to zanzana.
+func publicDashboardTuples(shares []publicDashboardShare) map[string]map[string]*openfgav1.TupleKey {
+	tuples := make(map[string]map[string]*openfgav1.TupleKey)
+
+	for _, s := range shares {
+		if !s.IsEnabled {
+			continue
+		}
+
+		putTuple(tuples, common.NewResourceTuple(
+			zanzana.NewTupleEntry(zanzana.TypePublicDashboard, s.UID, ""),
+			zanzana.RelationPublicRead,
+			dashboardalpha1.DashboardResourceInfo.GroupResource().Group,
+			dashboardalpha1.DashboardResourceInfo.GroupResource().Resource,
+			s.DashboardUID,
+		))
+	}
+
+	return tuples
+}
+
+// queryHistoryCollector collects the access users have to their own query history. Only users
+// that have saved queries in the org are collected.
+func queryHistoryCollector(store db.DB, cfg *reconcileConfig) legacyTupleCollector {
+	return func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		query := `
+			SELECT DISTINCT u.uid
+			FROM query_history qh
+			INNER JOIN ` + store.GetDialect().Quote("user") + ` u ON qh.created_by = u.id
+			WHERE qh.org_id = ?
+		`
+
+		var owners []string
+		err := store.WithDbSession(ctx, func(sess *db.Session) error {
+			return sess.SQL(query, orgId).Find(&owners)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return queryHistoryTuples(owners, cfg.translationVersion, cfg.droppedTuples), nil
+	}
+}
 
-			if tuples[tuple.Object] == nil {
-				tuples[tuple.Object] = make(map[string]*openfgav1.TupleKey)
+// queryHistoryActions are the actions owners have on their query history.
+var queryHistoryActions = []string{
+	zanzana.ActionQueryHistoryRead,
+	zanzana.ActionQueryHistoryWrite,
+	zanzana.ActionQueryHistoryDelete,
+}
+
+// queryHistoryTuples translates owners, identified by user uid, into tuples granting access to
+// their query history. Nothing is collected for versions that don't translate query history.
+func queryHistoryTuples(owners []string, version zanzana.TranslationVersion, dropped DroppedTupleSink) map[string]map[string]*openfgav1.TupleKey {
+	tuples := make(map[string]map[string]*openfgav1.TupleKey)
+
+	for _, uid := range owners {
+		subject := zanzana.NewTupleEntry(zanzana.TypeUser, uid, "")
+		for _, action := range queryHistoryActions {
+			tuple, err := zanzana.TranslateResourcePermission(version, subject, action, zanzana.KindQueryHistory, uid)
+			if err != nil {
+				dropped.drop(zanzana.KindQueryHistory+":"+uid, action, subject, err.Error())
+				continue
 			}
+			putTuple(tuples, tuple)
+		}
+	}
 
-			tuples[tuple.Object][tuple.String()] = tuple
+	return tuples
+}
+
+// basicRoleCollector collects what basic role users are assigned through their org role
+// together with the hierarchy of basic roles.
+func basicRoleCollector(store db.DB) legacyTupleCollector {
+	return func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		query := `
+			SELECT u.uid as user_uid, ou.role
+			FROM org_user ou
+			INNER JOIN ` + store.GetDialect().Quote("user") + ` u ON ou.user_id = u.id
+			WHERE ou.org_id = ?
+		`
+
+		var assignments []basicRoleAssignment
+		err := store.WithDbSession(ctx, func(sess *db.Session) error {
+			return sess.SQL(query, orgId).Find(&assignments)
+		})
+
+		if err != nil {
+			return nil, err
 		}
 
-		return tuples, nil
+		return basicRoleTuples(assignments), nil
+	}
+}
+
+type basicRoleAssignment struct {
+	UserUID string `xorm:"user_uid"`
+	Role    string `xorm:"role"`
+}
+
+// basicRoleTuples translates org roles into basic role assignments. Basic roles includes all lower
+// basic roles, e.g. Admin includes Editor that includes Viewer. Instead of assigning users to every
+// included role, each basic role is assigned to the assignees of the basic role directly above it.
+func basicRoleTuples(assignments []basicRoleAssignment) map[string]map[string]*openfgav1.TupleKey {
+	tuples := make(map[string]map[string]*openfgav1.TupleKey)
+
+	put := func(tuple *openfgav1.TupleKey) {
+		if tuples[tuple.Object] == nil {
+			tuples[tuple.Object] = make(map[string]*openfgav1.TupleKey)
+		}
+		tuples[tuple.Object][tupleKey(tuple)] = tuple
+	}
+
+	for _, role := range []identity.RoleType{identity.RoleViewer, identity.RoleEditor} {
+		// role is included in the role directly above it
+		parent := role.Parents()[0]
+		put(&openfgav1.TupleKey{
+			User:     zanzana.NewTupleEntry(zanzana.TypeRole, basicRoleUID(string(parent)), zanzana.RelationAssignee),
+			Relation: zanzana.RelationAssignee,
+			Object:   zanzana.NewTupleEntry(zanzana.TypeRole, basicRoleUID(string(role)), ""),
+		})
+	}
+
+	for _, a := range assignments {
+		if !identity.RoleType(a.Role).IsValid() || identity.RoleType(a.Role) == identity.RoleNone {
+			continue
+		}
+
+		put(&openfgav1.TupleKey{
+			User:     zanzana.NewTupleEntry(zanzana.TypeUser, a.UserUID, ""),
+			Relation: zanzana.RelationAssignee,
+			Object:   zanzana.NewTupleEntry(zanzana.TypeRole, basicRoleUID(a.Role), ""),
+		})
 	}
+
+	return tuples
+}
+
+// BasicRolePermissions returns the fixed permissions of every basic role keyed by org role.
+type BasicRolePermissions func() map[string][]accesscontrol.Permission
+
+// basicRolePermissionTuples translates permissions of basic roles into namespace tuples with
+// the assignees of the basic role as subject. Only permissions on all resources of a kind are
+// translated, permissions scoped to single resources are not part of basic roles.
+func basicRolePermissionTuples(permissions map[string][]accesscontrol.Permission, version zanzana.TranslationVersion, dropped DroppedTupleSink) map[string]map[string]*openfgav1.TupleKey {
+	tuples := make(map[string]map[string]*openfgav1.TupleKey)
+
+	for role, rolePermissions := range permissions {
+		if !identity.RoleType(role).IsValid() || identity.RoleType(role) == identity.RoleNone {
+			for _, p := range rolePermissions {
+				dropped.drop(p.Scope, p.Action, "", droppedUnsupportedSubject)
+			}
+			continue
+		}
+
+		subject := zanzana.NewTupleEntry(zanzana.TypeRole, basicRoleUID(role), zanzana.RelationAssignee)
+		for _, p := range rolePermissions {
+			kind, _, identifier := accesscontrol.SplitScope(p.Scope)
+			if kind == "" || kind == "*" || identifier != "*" {
+				dropped.drop(p.Scope, p.Action, subject, droppedNotAllResources)
+				continue
+			}
+
+			translated, err := zanzana.TranslateNamespacePermission(version, subject, p.Action, kind)
+			if err != nil {
+				dropped.drop(p.Scope, p.Action, subject, err.Error())
+				continue
+			}
+			for _, tuple := range translated {
+				putTuple(tuples, tuple)
+			}
+		}
+	}
+
+	return tuples
+}
+
+// basicRoleUID returns the uid of the basic role for an org role, e.g. basic_editor for Editor.
+func basicRoleUID(role string) string {
+	return zanzana.BasicRoleUIDPrefix + strings.ToLower(role)
 }
 
 // folderTreeCollector collects folder tree structure and writes it as relation tuples
@@ -68,124 +558,548 @@ func folderTreeCollector(store db.DB) legacyTupleCollector {
 		defer span.End()
 
 		const query = `
-			SELECT uid, parent_uid, org_id FROM folder
+			SELECT uid, parent_uid, org_id FROM folder WHERE org_id = ?
 		`
-		type folder struct {
-			OrgID     int64  `xorm:"org_id"`
-			FolderUID string `xorm:"uid"`
-			ParentUID string `xorm:"parent_uid"`
-		}
 
-		var folders []folder
+		var folders []folderRow
 		err := store.WithDbSession(ctx, func(sess *db.Session) error {
-			return sess.SQL(query).Find(&folders)
+			return sess.SQL(query, orgId).Find(&folders)
 		})
 
 		if err != nil {
 			return nil, err
 		}
 
-		tuples := make(map[string]map[string]*openfgav1.TupleKey)
+		return folderTreeTuples(folders), nil
+	}
+}
 
-		for _, f := range folders {
-			var tuple *openfgav1.TupleKey
-			if f.ParentUID == "" {
-				continue
-			}
+type folderRow struct {
+	OrgID     int64  `xorm:"org_id"`
+	FolderUID string `xorm:"uid"`
+	ParentUID string `xorm:"parent_uid"`
+}
 
-			tuple = &openfgav1.TupleKey{
-				Object:   zanzana.NewTupleEntry(common.TypeFolder, f.FolderUID, ""),
-				Relation: zanzana.RelationParent,
-				User:     zanzana.NewTupleEntry(common.TypeFolder, f.ParentUID, ""),
-			}
+// folderTreeTuples translates folders into parent tuples. Permissions granted on a folder are
+// inherited by subfolders through the parent relation in the schema, so only one tuple per
+// folder is needed no matter how deep the hierarchy is.
+func folderTreeTuples(folders []folderRow) map[string]map[string]*openfgav1.TupleKey {
+	tuples := make(map[string]map[string]*openfgav1.TupleKey)
 
-			if tuples[tuple.Object] == nil {
-				tuples[tuple.Object] = make(map[string]*openfgav1.TupleKey)
-			}
+	for _, f := range folders {
+		// Top level folders are at the root of the tree with the General folder, they are not
+		// children of it. Grants on the General folder only apply to resources without a folder.
+		if f.ParentUID == "" || f.ParentUID == common.GeneralFolderUID || f.FolderUID == common.GeneralFolderUID {
+			continue
+		}
 
-			tuples[tuple.Object][tuple.String()] = tuple
+		tuple := &openfgav1.TupleKey{
+			Object:   zanzana.NewTupleEntry(common.TypeFolder, f.FolderUID, ""),
+			Relation: zanzana.RelationParent,
+			User:     zanzana.NewTupleEntry(common.TypeFolder, f.ParentUID, ""),
 		}
 
-		return tuples, nil
+		if tuples[tuple.Object] == nil {
+			tuples[tuple.Object] = make(map[string]*openfgav1.TupleKey)
+		}
+
+		tuples[tuple.Object][tuple.String()] = tuple
 	}
+
+	return tuples
 }
 
 // managedPermissionsCollector collects managed permissions into provided tuple map.
 // It will only store actions that are supported by our schema. Managed permissions can
 // be directly mapped to user/team/role without having to write an intermediate role.
-func managedPermissionsCollector(store db.DB, kind string) legacyTupleCollector {
+// Permissions on all resources of kind are collected by namespacePermissionCollector.
+func managedPermissionsCollector(store db.DB, kind string, cfg *reconcileConfig) legacyTupleCollector {
+	cfg.namespaceKinds[kind] = struct{}{}
 	return func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
-		query := `
-			SELECT u.uid as user_uid, t.uid as team_uid, p.action, p.kind, p.identifier, r.org_id
-			FROM permission p
-			INNER JOIN role r ON p.role_id = r.id
-			LEFT JOIN user_role ur ON r.id = ur.role_id
-			LEFT JOIN ` + store.GetDialect().Quote("user") + ` u ON u.id = ur.user_id
-			LEFT JOIN team_role tr ON r.id = tr.role_id
-			LEFT JOIN team t ON tr.team_id = t.id
-			LEFT JOIN builtin_role br ON r.id  = br.role_id
-			WHERE r.name LIKE 'managed:%'
-			AND p.kind = ?
-		`
-		type Permission struct {
-			RoleName   string `xorm:"role_name"`
-			OrgID      int64  `xorm:"org_id"`
-			Action     string `xorm:"action"`
-			Kind       string
-			Identifier string
-			UserUID    string `xorm:"user_uid"`
-			TeamUID    string `xorm:"team_uid"`
-		}
+		filter, arg := managedPermissionsKindFilter(cfg.legacySchema, kind)
+		query := managedPermissionsQuery(store, cfg.legacySchema) + filter + " AND r.org_id = ?"
 
-		var permissions []Permission
+		var permissions []managedPermission
 		err := store.WithDbSession(ctx, func(sess *db.Session) error {
-			return sess.SQL(query, kind).Find(&permissions)
+			_, err := fetchRows(sess, store.GetDialect().DriverName(), cfg.fetchSize, &permissions, query, arg, orgId)
+			return err
 		})
 
 		if err != nil {
 			return nil, err
 		}
 
-		tuples := make(map[string]map[string]*openfgav1.TupleKey)
+		permissions = filterDeletedResources(permissions, cfg.includeDeletedResources, cfg.droppedTuples)
+		permissions = withoutWildcards(normalizeScopes(permissions))
+		permissions, err = resolveIdentifiers(ctx, orgId, permissions, cfg.identifierResolver)
+		if err != nil {
+			return nil, err
+		}
+		if kind == zanzana.KindFolders && cfg.silencePermissions {
+			permissions = silencePermissions(permissions)
+		}
+		return managedPermissionTuples(permissions, cfg.translationVersion, cfg.droppedTuples), nil
+	}
+}
 
-		for _, p := range permissions {
-			var subject string
-			if len(p.UserUID) > 0 {
-				subject = zanzana.NewTupleEntry(zanzana.TypeUser, p.UserUID, "")
-			} else if len(p.TeamUID) > 0 {
-				subject = zanzana.NewTupleEntry(zanzana.TypeTeam, p.TeamUID, "member")
-			} else {
-				// FIXME(kalleep): Unsuported role binding (org role). We need to have basic roles in place
-				continue
+// namespacePermissionCollector collects the tuples of namespace objects, which grant access to all
+// resources of a kind. Basic roles and managed permissions of several kinds grant access through
+// the same namespace objects, so they are collected by a single reconciler that owns them.
+// Otherwise reconcilers would delete the tuples written by each other on every run.
+func namespacePermissionCollector(store db.DB, cfg *reconcileConfig) legacyTupleCollector {
+	return func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		ctx, span := tracer.Start(ctx, "accesscontrol.migrator.namespacePermissionCollector")
+		defer span.End()
+
+		query := managedPermissionsQuery(store, cfg.legacySchema) + " AND r.org_id = ? AND p.scope LIKE ?"
+
+		var permissions []managedPermission
+		err := store.WithDbSession(ctx, func(sess *db.Session) error {
+			_, err := fetchRows(sess, store.GetDialect().DriverName(), cfg.fetchSize, &permissions, query, orgId, "%*")
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = namespacePermissions(normalizeScopes(permissions), cfg.namespaceKinds)
+		if cfg.silencePermissions {
+			permissions = silencePermissions(permissions)
+		}
+		tuples := managedPermissionTuples(permissions, cfg.translationVersion, cfg.droppedTuples)
+
+		if cfg.basicRolePermissions != nil {
+			for _, roleTuples := range basicRolePermissionTuples(cfg.basicRolePermissions(), cfg.translationVersion, cfg.droppedTuples) {
+				for _, tuple := range roleTuples {
+					putTuple(tuples, tuple)
+				}
 			}
+		}
+		return tuples, nil
+	}
+}
 
-			tuple, ok := zanzana.TranslateToResourceTuple(subject, p.Action, p.Kind, p.Identifier)
-			if !ok {
-				continue
+// withoutWildcards removes permissions on all resources of a kind, they are collected by
+// namespacePermissionCollector.
+func withoutWildcards(permissions []managedPermission) []managedPermission {
+	out := make([]managedPermission, 0, len(permissions))
+	for _, p := range permissions {
+		if p.Identifier != "*" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// namespacePermissions returns the permissions on all resources of one of kinds.
+func namespacePermissions(permissions []managedPermission, kinds map[string]struct{}) []managedPermission {
+	out := make([]managedPermission, 0, len(permissions))
+	for _, p := range permissions {
+		if _, ok := kinds[p.Kind]; ok && p.Identifier == "*" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// alertRuleCollector collects alert rule permissions granted on folders as tuples on every alert
+// rule in the folder or any of its subfolders.
+func alertRuleCollector(store db.DB, cfg *reconcileConfig) legacyTupleCollector {
+	return func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		ctx, span := tracer.Start(ctx, "accesscontrol.migrator.alertRuleCollector")
+		defer span.End()
+
+		filter, arg := managedPermissionsKindFilter(cfg.legacySchema, zanzana.KindFolders)
+		permissionsQuery := managedPermissionsQuery(store, cfg.legacySchema) + filter + " AND r.org_id = ? AND p.action LIKE ?"
+
+		const rulesQuery = `
+			SELECT uid, namespace_uid FROM alert_rule WHERE org_id = ?
+		`
+		const foldersQuery = `
+			SELECT uid, parent_uid, org_id FROM folder WHERE org_id = ?
+		`
+
+		var (
+			permissions []managedPermission
+			rules       []alertRuleRow
+			folders     []folderRow
+		)
+		err := store.WithDbSession(ctx, func(sess *db.Session) error {
+			if err := sess.SQL(permissionsQuery, arg, orgId, "alert.rules:%").Find(&permissions); err != nil {
+				return err
+			}
+			if err := sess.SQL(rulesQuery, orgId).Find(&rules); err != nil {
+				return err
 			}
+			return sess.SQL(foldersQuery, orgId).Find(&folders)
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = normalizeScopes(permissions)
+		permissions, err = resolveIdentifiers(ctx, orgId, permissions, cfg.identifierResolver)
+		if err != nil {
+			return nil, err
+		}
+		return alertRuleTuples(rules, folders, permissions, cfg.translationVersion, cfg.inheritanceProvenance, cfg.droppedTuples), nil
+	}
+}
+
+// InheritanceProvenance is called with every tuple collected from a permission granted on an
+// ancestor folder of its object, together with the uid of the folder it was inherited from. It
+// is only meant for debugging inheritance, the folder is not written to zanzana.
+type InheritanceProvenance func(tuple *openfgav1.TupleKey, folderUID string)
+
+type alertRuleRow struct {
+	UID       string `xorm:"uid"`
+	FolderUID string `xorm:"namespace_uid"`
+}
+
+// alertRuleTuples translates alert rule permissions granted on folders into tuples on the rules
+// they apply to. Permissions on a folder apply to rules in all of its subfolders. Actions that
+// don't apply to an existing rule, like alert.rules:create, are skipped. If provenance is set it
+// is called once per tuple with the closest folder granting it.
+func alertRuleTuples(
+	rules []alertRuleRow,
+	folders []folderRow,
+	permissions []managedPermission,
+	version zanzana.TranslationVersion,
+	provenance InheritanceProvenance,
+	dropped DroppedTupleSink,
+) map[string]map[string]*openfgav1.TupleKey {
+	tuples := make(map[string]map[string]*openfgav1.TupleKey)
+
+	parents := make(map[string]string, len(folders))
+	for _, f := range folders {
+		parents[f.FolderUID] = f.ParentUID
+	}
+
+	byFolder := make(map[string][]managedPermission)
+	for _, p := range permissions {
+		if p.Kind != zanzana.KindFolders {
+			continue
+		}
+		byFolder[p.Identifier] = append(byFolder[p.Identifier], p)
+	}
 
-			if tuples[tuple.Object] == nil {
-				tuples[tuple.Object] = make(map[string]*openfgav1.TupleKey)
+	for _, rule := range rules {
+		seen := make(map[string]struct{})
+		for folder := rule.FolderUID; folder != ""; folder = parents[folder] {
+			if _, ok := seen[folder]; ok {
+				break
 			}
+			seen[folder] = struct{}{}
 
-			// For resource actions on folders we need to merge the tuples into one with combined
-			// group_resources.
-			if zanzana.IsFolderResourceTuple(tuple) {
-				key := tupleStringWithoutCondition(tuple)
-				if t, ok := tuples[tuple.Object][key]; ok {
-					zanzana.MergeFolderResourceTuples(t, tuple)
-				} else {
-					tuples[tuple.Object][key] = tuple
+			for _, p := range byFolder[folder] {
+				subject, ok := managedPermissionSubject(p)
+				if !ok {
+					dropped.dropPermission(p, "", droppedUnsupportedSubject)
+					continue
 				}
 
+				tuple, err := zanzana.TranslateResourcePermission(version, subject, p.Action, zanzana.KindAlertRules, rule.UID)
+				if err != nil {
+					dropped.dropPermission(p, subject, err.Error())
+					continue
+				}
+				// Folders are walked from the rule upwards, the first grant is the closest one.
+				if _, ok := tuples[tuple.Object][tupleKey(tuple)]; !ok && provenance != nil {
+					provenance(tuple, folder)
+				}
+				putTuple(tuples, tuple)
+			}
+		}
+	}
+
+	return tuples
+}
+
+// normalizeScopes sets the identifier of every permission from its scope, so legacy scope
+// variants such as folders:abc and folders:uid:abc are translated into the same object.
+// Permissions read from a schema without kind get it from the scope as well. Permissions with
+// a scope that can't be normalized or is of another kind are left unchanged. Wildcard scopes,
+// e.g. datasources:*, get the wildcard as identifier.
+func normalizeScopes(permissions []managedPermission) []managedPermission {
+	out := make([]managedPermission, 0, len(permissions))
+	for _, p := range permissions {
+		if kind, identifier, ok := zanzana.NormalizeScope(p.Scope); ok && (p.Kind == "" || kind == p.Kind) {
+			p.Kind, p.Identifier = kind, identifier
+		} else if kind, _, identifier := accesscontrol.SplitScope(p.Scope); identifier == "*" && kind != "*" && (p.Kind == "" || kind == p.Kind) {
+			p.Kind, p.Identifier = kind, identifier
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// IdentifierResolver resolves the identifier of a permission of kind into the uid used for its
+// tuple, e.g. when the identifier is stored as a slug. It is called for every managed permission
+// before it is translated.
+type IdentifierResolver func(ctx context.Context, orgId int64, kind, identifier string) (string, error)
+
+// identityIdentifierResolver is the default resolver and returns identifiers unchanged.
+func identityIdentifierResolver(_ context.Context, _ int64, _, identifier string) (string, error) {
+	return identifier, nil
+}
+
+// resolveIdentifiers replaces the identifier of every permission with the one returned by resolver.
+func resolveIdentifiers(ctx context.Context, orgId int64, permissions []managedPermission, resolver IdentifierResolver) ([]managedPermission, error) {
+	out := make([]managedPermission, 0, len(permissions))
+	for _, p := range permissions {
+		identifier, err := resolver(ctx, orgId, p.Kind, p.Identifier)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve identifier %q of kind %s: %w", p.Identifier, p.Kind, err)
+		}
+		p.Identifier = identifier
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+type managedPermission struct {
+	RoleName    string `xorm:"role_name"`
+	OrgID       int64  `xorm:"org_id"`
+	Action      string `xorm:"action"`
+	Scope       string `xorm:"scope"`
+	Kind        string
+	Identifier  string
+	UserUID     string `xorm:"user_uid"`
+	TeamUID     string `xorm:"team_uid"`
+	BuiltinRole string `xorm:"builtin_role"`
+	// ResourceDeleted is set when the resource is deleted but retained so it can be restored.
+	ResourceDeleted bool `xorm:"resource_deleted"`
+	// IsServiceAccount is set when the permission is granted to a service account.
+	IsServiceAccount bool `xorm:"is_service_account"`
+}
+
+// silencePermissions translates silence actions granted on folders with the silence kind, they
+// are not part of the folder translation.
+func silencePermissions(permissions []managedPermission) []managedPermission {
+	out := make([]managedPermission, 0, len(permissions))
+	for _, p := range permissions {
+		if p.Kind == zanzana.KindFolders && strings.HasPrefix(p.Action, "alert.silences:") {
+			p.Kind = zanzana.KindSilences
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// filterDeletedResources removes permissions on resources that are deleted but retained unless
+// include is set. These should not grant access unless they are restored.
+func filterDeletedResources(permissions []managedPermission, include bool, dropped DroppedTupleSink) []managedPermission {
+	if include {
+		return permissions
+	}
+
+	out := make([]managedPermission, 0, len(permissions))
+	for _, p := range permissions {
+		if p.ResourceDeleted {
+			subject, _ := managedPermissionSubject(p)
+			dropped.dropPermission(p, subject, droppedResourceDeleted)
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// managedPermissionTuples translates managed permissions into tuples grouped by object.
+// Folder resource tuples for the same subject and folder are merged into one tuple no matter
+// in what order the rows are returned. Permissions are translated using the provided version.
+// When several managed roles grant different action sets to the same subject only the most
+// permissive one is kept.
+// Legacy permissions are allow-only, the permission table has no way to express a deny, so
+// every translated row is a grant.
+func managedPermissionTuples(permissions []managedPermission, version zanzana.TranslationVersion, dropped DroppedTupleSink) map[string]map[string]*openfgav1.TupleKey {
+	tuples := make(map[string]map[string]*openfgav1.TupleKey)
+
+	// actions is the number of folder resource actions before they are merged
+	var actions int
+	for _, p := range permissions {
+		subject, ok := managedPermissionSubject(p)
+		if !ok {
+			dropped.dropPermission(p, "", droppedUnsupportedSubject)
+			continue
+		}
+
+		// Scope templates are only filled in when a request is evaluated, the object depends on the
+		// request so they can't be expanded here. They are reported as unmigratable instead of
+		// being translated into a tuple on an object that doesn't exist.
+		if isScopeTemplate(p.Scope) || isScopeTemplate(p.Identifier) {
+			dropped.dropPermission(p, subject, droppedUnmigratableScopeTemplate)
+			continue
+		}
+
+		// Permissions on all resources of a kind are granted on the namespace like for basic roles.
+		if p.Identifier == "*" {
+			translated, err := zanzana.TranslateNamespacePermission(version, subject, p.Action, p.Kind)
+			if err != nil {
+				dropped.dropPermission(p, subject, err.Error())
 				continue
 			}
+			for _, tuple := range translated {
+				putTuple(tuples, tuple)
+			}
+			continue
+		}
 
-			tuples[tuple.Object][tuple.String()] = tuple
+		tuple, err := zanzana.TranslateResourcePermission(version, subject, p.Action, p.Kind, p.Identifier)
+		if err != nil {
+			dropped.dropPermission(p, subject, err.Error())
+			continue
 		}
 
-		return tuples, nil
+		if zanzana.IsFolderResourceTuple(tuple) {
+			actions++
+		}
+		putTuple(tuples, tuple)
 	}
+
+	resolveRelationSets(tuples)
+
+	m := initMetrics()
+	m.folderResourceActionsTotal.Add(float64(actions))
+	m.folderResourceTuplesTotal.Add(float64(countFolderResourceTuples(tuples)))
+
+	return tuples
+}
+
+// isScopeTemplate returns true if scope contains a template that is filled in from the request,
+// see accesscontrol.Parameter and accesscontrol.Field.
+func isScopeTemplate(scope string) bool {
+	return strings.Contains(scope, "{{")
+}
+
+// relationSetRank orders relation sets by how permissive they are. In the schema every set
+// includes the relations of the sets ranked below it.
+var relationSetRank = map[string]int{
+	zanzana.RelationSetView:  1,
+	zanzana.RelationSetEdit:  2,
+	zanzana.RelationSetAdmin: 3,
+}
+
+// resolveRelationSets removes relation sets of a subject on an object that are included by a
+// more permissive set granted to the same subject on the same object.
+func resolveRelationSets(tuples map[string]map[string]*openfgav1.TupleKey) {
+	for _, objectTuples := range tuples {
+		highest := make(map[string]int)
+		for _, t := range objectTuples {
+			if rank, ok := relationSetRank[t.Relation]; ok {
+				subject := normalizeSubject(t.User)
+				highest[subject] = max(highest[subject], rank)
+			}
+		}
+
+		for key, t := range objectTuples {
+			if rank, ok := relationSetRank[t.Relation]; ok && rank < highest[normalizeSubject(t.User)] {
+				delete(objectTuples, key)
+			}
+		}
+	}
+}
+
+func countFolderResourceTuples(tuples map[string]map[string]*openfgav1.TupleKey) int {
+	var count int
+	for _, object := range tuples {
+		for _, t := range object {
+			if zanzana.IsFolderResourceTuple(t) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// managedPermissionSubject returns the subject a managed permission is granted to. Permissions
+// granted to a team, including the ones applied by default when a team gets access to a folder,
+// are granted to the members of the team.
+func managedPermissionSubject(p managedPermission) (string, bool) {
+	if len(p.UserUID) > 0 {
+		return zanzana.NewTupleEntry(userSubjectType(p.IsServiceAccount), p.UserUID, ""), true
+	}
+
+	if len(p.TeamUID) > 0 {
+		return zanzana.NewTupleEntry(zanzana.TypeTeam, p.TeamUID, zanzana.RelationTeamMember), true
+	}
+
+	// Permissions granted to an org role are granted to the assignees of the basic role.
+	// Assignees of higher org roles are assignees through the basic role hierarchy.
+	if identity.RoleType(p.BuiltinRole).IsValid() {
+		return zanzana.NewTupleEntry(zanzana.TypeRole, basicRoleUID(p.BuiltinRole), zanzana.RelationAssignee), true
+	}
+
+	// FIXME(kalleep): Unsuported role binding (Grafana Admin).
+	return "", false
+}
+
+// putTuple stores tuple in tuples grouped by object. For resource actions on folders and
+// subresources we need to merge the tuples into one with combined condition.
+func putTuple(tuples map[string]map[string]*openfgav1.TupleKey, tuple *openfgav1.TupleKey) {
+	if tuples[tuple.Object] == nil {
+		tuples[tuple.Object] = make(map[string]*openfgav1.TupleKey)
+	}
+
+	key := tupleKey(tuple)
+	if isMergeableTuple(tuple) {
+		if t, ok := tuples[tuple.Object][key]; ok {
+			mergeTuples(t, tuple)
+		} else {
+			tuples[tuple.Object][key] = tuple
+		}
+		return
+	}
+
+	tuples[tuple.Object][key] = tuple
+}
+
+// tupleKey returns the key used to compare tuples collected from legacy and zanzana.
+// Tuples with a mutable condition are keyed without it and team subjects are always keyed
+// with the member relation so team:uid and team:uid#member are considered equal.
+func tupleKey(tuple *openfgav1.TupleKey) string {
+	normalized := &openfgav1.TupleKey{
+		User:      normalizeSubject(tuple.User),
+		Relation:  tuple.Relation,
+		Object:    tuple.Object,
+		Condition: tuple.Condition,
+	}
+
+	if isKeyedWithoutCondition(normalized) {
+		return tupleStringWithoutCondition(normalized)
+	}
+	return normalized.String()
+}
+
+// isKeyedWithoutCondition returns true for tuples where the condition can change without the
+// tuple changing, a changed condition is applied by replacing the stored tuple. Team memberships
+// are written without condition, they are keyed without so memberships stored with a condition
+// by older versions are replaced.
+func isKeyedWithoutCondition(t *openfgav1.TupleKey) bool {
+	return isMergeableTuple(t) || isTeamMembershipTuple(t)
+}
+
+// normalizeSubject adds the member relation to team subjects without a relation.
+func normalizeSubject(subject string) string {
+	if strings.HasPrefix(subject, zanzana.TypeTeam+":") && !strings.Contains(subject, "#") {
+		return subject + "#" + zanzana.RelationTeamMember
+	}
+	return subject
+}
+
+// isMergeableTuple returns true for tuples where all grants for the same subject and relation
+// are merged into one tuple with a combined condition.
+func isMergeableTuple(t *openfgav1.TupleKey) bool {
+	return zanzana.IsFolderResourceTuple(t) || zanzana.IsSubresourceTuple(t)
+}
+
+func mergeTuples(a, b *openfgav1.TupleKey) {
+	if zanzana.IsSubresourceTuple(a) {
+		zanzana.MergeSubresourceTuples(a, b)
+		return
+	}
+	zanzana.MergeFolderResourceTuples(a, b)
 }
 
 func tupleStringWithoutCondition(tuple *openfgav1.TupleKey) string {
@@ -196,56 +1110,84 @@ func tupleStringWithoutCondition(tuple *openfgav1.TupleKey) string {
 	return s
 }
 
-func zanzanaCollector(relations []string) zanzanaTupleCollector {
-	return func(ctx context.Context, client zanzana.Client, object string, namespace string) (map[string]*openfgav1.TupleKey, error) {
-		// list will use continuation token to collect all tuples for object and relation
-		list := func(relation string) ([]*openfgav1.Tuple, error) {
-			first, err := client.Read(ctx, &authzextv1.ReadRequest{
-				Namespace: namespace,
-				TupleKey: &authzextv1.ReadRequestTupleKey{
-					Object:   object,
-					Relation: relation,
-				},
-			})
+// LegacyCollector collects the tuples of a legacy permission source for org. It is used to
+// reconcile sources owned by other services, see WithLegacyCollector.
+//
+// User preferences are private to the user they belong to and can't be shared, access to them
+// is granted through org roles that are already reconciled. They have no permissions of their
+// own to collect, a collector should be registered if they become shareable. Query history is
+// owned by its creator and collected by queryHistoryCollector.
+type LegacyCollector func(ctx context.Context, orgId int64) ([]*openfgav1.TupleKey, error)
 
-			if err != nil {
-				return nil, err
-			}
+// externalCollector groups tuples collected by collector by object.
+func externalCollector(collector LegacyCollector) legacyTupleCollector {
+	return func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		collected, err := collector(ctx, orgId)
+		if err != nil {
+			return nil, err
+		}
+
+		tuples := make(map[string]map[string]*openfgav1.TupleKey)
+		for _, t := range collected {
+			putTuple(tuples, t)
+		}
+		return tuples, nil
+	}
+}
 
-			c := first.ContinuationToken
+// orphanCollector collects tuples with any of relations on resources permissions of kind are
+// translated into that are not part of legacy. It needs to read all tuples in the namespace so
+// it should only be used for resources where deleted objects leave tuples behind. Sweeps are
+// limited by the sweep interval, see WithOrphanSweepInterval.
+func orphanCollector(kind string, cfg *reconcileConfig, relations []string) orphanTupleCollector {
+	return func(ctx context.Context, client zanzana.Client, namespace string, legacy map[string]map[string]*openfgav1.TupleKey) ([]*openfgav1.TupleKey, error) {
+		prefixes := zanzana.ResourceObjectPrefixes(cfg.translationVersion, kind)
+		if len(prefixes) == 0 {
+			return nil, nil
+		}
 
-			for c != "" {
-				res, err := client.Read(ctx, &authzextv1.ReadRequest{
-					Namespace: namespace,
-					TupleKey: &authzextv1.ReadRequestTupleKey{
-						Object:   object,
-						Relation: relation,
-					},
-				})
-				if err != nil {
-					return nil, err
+		var orphans []*openfgav1.TupleKey
+		err := streamTuples(ctx, client, &authzextv1.ReadRequest{Namespace: namespace}, func(t *openfgav1.TupleKey) error {
+			if _, ok := legacy[t.Object]; ok {
+				return nil
+			}
+			if !slices.Contains(relations, t.Relation) {
+				return nil
+			}
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(t.Object, prefix) {
+					orphans = append(orphans, t)
+					return nil
 				}
-
-				c = res.ContinuationToken
-				first.Tuples = append(first.Tuples, res.Tuples...)
 			}
-
-			return common.ToOpenFGATuples(first.Tuples), nil
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
+		return orphans, nil
+	}
+}
 
+func zanzanaCollector(relations []string) zanzanaTupleCollector {
+	return func(ctx context.Context, client zanzana.Client, object string, namespace string) (map[string]*openfgav1.TupleKey, error) {
 		out := make(map[string]*openfgav1.TupleKey)
 		for _, r := range relations {
-			tuples, err := list(r)
+			req := &authzextv1.ReadRequest{
+				Namespace: namespace,
+				TupleKey: &authzextv1.ReadRequestTupleKey{
+					Object:   object,
+					Relation: r,
+				},
+			}
+
+			err := streamTuples(ctx, client, req, func(t *openfgav1.TupleKey) error {
+				out[tupleKey(t)] = t
+				return nil
+			})
 			if err != nil {
 				return nil, err
 			}
-			for _, t := range tuples {
-				if zanzana.IsFolderResourceTuple(t.Key) {
-					out[tupleStringWithoutCondition(t.Key)] = t.Key
-				} else {
-					out[t.Key.String()] = t.Key
-				}
-			}
 		}
 
 		return out, nil
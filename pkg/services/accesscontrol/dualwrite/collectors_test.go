@@ -0,0 +1,1238 @@
+package dualwrite
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/grafana/authlib/claims"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/accesscontrol"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+const (
+	dashboardGroup    = "dashboard.grafana.app"
+	dashboardResource = "dashboards"
+)
+
+func TestManagedPermissionTuples(t *testing.T) {
+	// rows for different folders and subjects are interleaved on purpose
+	permissions := []managedPermission{
+		{Action: "dashboards:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+		{Action: "dashboards:read", Kind: zanzana.KindFolders, Identifier: "f2", UserUID: "u1"},
+		{Action: "dashboards:read", Kind: zanzana.KindFolders, Identifier: "f1", TeamUID: "t1"},
+		{Action: "folders:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+		{Action: "dashboards:write", Kind: zanzana.KindFolders, Identifier: "f1", TeamUID: "t1"},
+		{Action: "dashboards:read", Kind: zanzana.KindFolders, Identifier: "f2", UserUID: "u2"},
+		{Action: "dashboards:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+	}
+
+	t.Run("should merge folder resource tuples for same subject and folder", func(t *testing.T) {
+		tuples := managedPermissionTuples(permissions, zanzana.TranslationLatest, nil)
+		require.Len(t, tuples, 2)
+
+		f1 := tuples["folder:f1"]
+		require.Len(t, f1, 4)
+		assertContainsTuple(t, f1, common.NewFolderResourceTuple("user:u1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"))
+		assertContainsTuple(t, f1, common.NewFolderResourceTuple("team:t1#member", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"))
+		assertContainsTuple(t, f1, common.NewFolderResourceTuple("team:t1#member", zanzana.RelationWrite, dashboardGroup, dashboardResource, "f1"))
+		assertContainsTuple(t, f1, common.NewFolderTuple("user:u1", zanzana.RelationRead, "f1"))
+
+		f2 := tuples["folder:f2"]
+		require.Len(t, f2, 2)
+		assertContainsTuple(t, f2, common.NewFolderResourceTuple("user:u1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f2"))
+		assertContainsTuple(t, f2, common.NewFolderResourceTuple("user:u2", zanzana.RelationRead, dashboardGroup, dashboardResource, "f2"))
+	})
+
+	t.Run("should produce the same tuples independent of row order", func(t *testing.T) {
+		reversed := make([]managedPermission, 0, len(permissions))
+		for i := len(permissions) - 1; i >= 0; i-- {
+			reversed = append(reversed, permissions[i])
+		}
+
+		expected := managedPermissionTuples(permissions, zanzana.TranslationLatest, nil)
+		actual := managedPermissionTuples(reversed, zanzana.TranslationLatest, nil)
+		require.Len(t, actual, len(expected))
+		for object, tuples := range expected {
+			require.Len(t, actual[object], len(tuples))
+			for key, tuple := range tuples {
+				assert.Equal(t, tuple.String(), actual[object][key].String())
+			}
+		}
+	})
+}
+
+func TestTeamMembershipTuple(t *testing.T) {
+	t.Run("should translate team member and admin", func(t *testing.T) {
+		assert.Equal(t,
+			common.NewTypedTuple(zanzana.TypeTeam, "user:u1", zanzana.RelationTeamMember, "t1").String(),
+			teamMembershipTuple(teamMembership{TeamUID: "t1", UserUID: "u1", Permission: 0}).String(),
+		)
+		assert.Equal(t,
+			common.NewTypedTuple(zanzana.TypeTeam, "user:u1", zanzana.RelationTeamAdmin, "t1").String(),
+			teamMembershipTuple(teamMembership{TeamUID: "t1", UserUID: "u1", Permission: 4}).String(),
+		)
+	})
+
+	t.Run("should translate service account membership with service account subject", func(t *testing.T) {
+		for _, permission := range []int{0, 4} {
+			tuple := teamMembershipTuple(teamMembership{TeamUID: "t1", UserUID: "sa1", IsServiceAccount: true, Permission: permission})
+			assert.Equal(t, common.NewTypedTuple(zanzana.TypeTeam, "service_account:sa1", zanzana.RelationTeamMember, "t1").String(), tuple.String())
+		}
+	})
+}
+
+func TestReportTeamMemberLastSeen(t *testing.T) {
+	lastSeen := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	memberships := []teamMembership{
+		{TeamUID: "t1", UserUID: "u1", LastSeenAt: lastSeen},
+		{TeamUID: "t1", UserUID: "sa1", IsServiceAccount: true, LastSeenAt: lastSeen},
+		// never seen
+		{TeamUID: "t1", UserUID: "u2"},
+	}
+
+	t.Run("should report last seen of members that have been seen", func(t *testing.T) {
+		var reported []TeamMemberLastSeen
+		reportTeamMemberLastSeen(memberships, func(seen TeamMemberLastSeen) {
+			reported = append(reported, seen)
+		})
+
+		assert.ElementsMatch(t, []TeamMemberLastSeen{
+			{Object: "team:t1", Relation: zanzana.RelationTeamMember, Subject: "user:u1", LastSeenAt: lastSeen},
+			{Object: "team:t1", Relation: zanzana.RelationTeamMember, Subject: "service_account:sa1", LastSeenAt: lastSeen},
+		}, reported)
+	})
+
+	t.Run("should write tuples without condition", func(t *testing.T) {
+		tuples := teamMembershipTuples(memberships)
+		require.Len(t, tuples["team:t1"], 3)
+		for _, tuple := range tuples["team:t1"] {
+			assert.Nil(t, tuple.Condition)
+		}
+	})
+}
+
+func TestGroupMembershipTuples(t *testing.T) {
+	tuples := groupMembershipTuples([]groupMembership{
+		{GroupMappingUID: "g1", UserUID: "u1"},
+		{GroupMappingUID: "g2", UserUID: "u1"},
+		{GroupMappingUID: "g2", UserUID: "u2"},
+		// roles not assigned through a group mapping
+		{UserUID: "u3"},
+	})
+
+	require.Len(t, tuples, 2)
+	require.Len(t, tuples["group:g1"], 1)
+	require.Len(t, tuples["group:g2"], 2)
+	assertContainsTuple(t, tuples["group:g1"], &openfgav1.TupleKey{User: "user:u1", Relation: zanzana.RelationTeamMember, Object: "group:g1"})
+	assertContainsTuple(t, tuples["group:g2"], &openfgav1.TupleKey{User: "user:u1", Relation: zanzana.RelationTeamMember, Object: "group:g2"})
+	assertContainsTuple(t, tuples["group:g2"], &openfgav1.TupleKey{User: "user:u2", Relation: zanzana.RelationTeamMember, Object: "group:g2"})
+}
+
+func TestGroupRoleTuples(t *testing.T) {
+	tuples := groupRoleTuples([]groupRoleMapping{
+		{GroupMappingUID: "g1", RoleUID: "r1"},
+		{GroupMappingUID: "g1", RoleUID: "r2"},
+		{GroupMappingUID: "g2", RoleUID: "r2"},
+		// roles not assigned through a group mapping
+		{RoleUID: "r3"},
+	})
+
+	require.Len(t, tuples, 2)
+	require.Len(t, tuples["role:r1"], 1)
+	require.Len(t, tuples["role:r2"], 2)
+	assertContainsTuple(t, tuples["role:r1"], &openfgav1.TupleKey{User: "group:g1#member", Relation: zanzana.RelationAssignee, Object: "role:r1"})
+	assertContainsTuple(t, tuples["role:r2"], &openfgav1.TupleKey{User: "group:g1#member", Relation: zanzana.RelationAssignee, Object: "role:r2"})
+	assertContainsTuple(t, tuples["role:r2"], &openfgav1.TupleKey{User: "group:g2#member", Relation: zanzana.RelationAssignee, Object: "role:r2"})
+}
+
+func TestOrgMembershipTuples(t *testing.T) {
+	tuples := orgMembershipTuples(2, []orgMembership{
+		{UserUID: "u1"},
+		{UserUID: "u2"},
+		{UserUID: "sa1", IsServiceAccount: true},
+		{UserUID: "u3", IsDisabled: true},
+	})
+
+	require.Len(t, tuples, 1)
+	require.Len(t, tuples["org:2"], 3)
+	assertContainsTuple(t, tuples["org:2"], &openfgav1.TupleKey{User: "user:u1", Relation: zanzana.RelationTeamMember, Object: "org:2"})
+	assertContainsTuple(t, tuples["org:2"], &openfgav1.TupleKey{User: "user:u2", Relation: zanzana.RelationTeamMember, Object: "org:2"})
+	assertContainsTuple(t, tuples["org:2"], &openfgav1.TupleKey{User: "service_account:sa1", Relation: zanzana.RelationTeamMember, Object: "org:2"})
+}
+
+func TestTupleKey(t *testing.T) {
+	t.Run("should match team subjects with and without member relation", func(t *testing.T) {
+		assert.Equal(t,
+			tupleKey(common.NewFolderTuple("team:t1#member", zanzana.RelationRead, "f1")),
+			tupleKey(common.NewFolderTuple("team:t1", zanzana.RelationRead, "f1")),
+		)
+		assert.Equal(t,
+			tupleKey(common.NewFolderResourceTuple("team:t1#member", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")),
+			tupleKey(common.NewFolderResourceTuple("team:t1", zanzana.RelationRead, "folder.grafana.app", "folders", "f1")),
+		)
+	})
+
+	t.Run("should not match different subjects", func(t *testing.T) {
+		assert.NotEqual(t,
+			tupleKey(common.NewFolderTuple("team:t1#admin", zanzana.RelationRead, "f1")),
+			tupleKey(common.NewFolderTuple("team:t1", zanzana.RelationRead, "f1")),
+		)
+		assert.NotEqual(t,
+			tupleKey(common.NewFolderTuple("user:t1", zanzana.RelationRead, "f1")),
+			tupleKey(common.NewFolderTuple("team:t1", zanzana.RelationRead, "f1")),
+		)
+	})
+}
+
+func TestBasicRoleTuples(t *testing.T) {
+	tuples := basicRoleTuples([]basicRoleAssignment{
+		{UserUID: "u1", Role: "Admin"},
+		{UserUID: "u2", Role: "Viewer"},
+		{UserUID: "u3", Role: "None"},
+	})
+
+	assignee := func(user, role string) *openfgav1.TupleKey {
+		return &openfgav1.TupleKey{User: user, Relation: zanzana.RelationAssignee, Object: "role:" + role}
+	}
+
+	require.Len(t, tuples, 3)
+	// Admin includes Editor that includes Viewer
+	assertContainsTuple(t, tuples["role:basic_viewer"], assignee("role:basic_editor#assignee", "basic_viewer"))
+	assertContainsTuple(t, tuples["role:basic_editor"], assignee("role:basic_admin#assignee", "basic_editor"))
+	assertContainsTuple(t, tuples["role:basic_admin"], assignee("user:u1", "basic_admin"))
+	assertContainsTuple(t, tuples["role:basic_viewer"], assignee("user:u2", "basic_viewer"))
+	assert.Len(t, tuples["role:basic_viewer"], 2)
+	assert.Len(t, tuples["role:basic_editor"], 1)
+	assert.Len(t, tuples["role:basic_admin"], 1)
+}
+
+func TestManagedPermissionTuples_BasicRoles(t *testing.T) {
+	tuples := managedPermissionTuples([]managedPermission{
+		{Action: "folders:read", Kind: zanzana.KindFolders, Identifier: "f1", BuiltinRole: "Viewer"},
+		{Action: "folders:write", Kind: zanzana.KindFolders, Identifier: "f1", BuiltinRole: "Editor"},
+		// not an org role
+		{Action: "folders:delete", Kind: zanzana.KindFolders, Identifier: "f1", BuiltinRole: "Grafana Admin"},
+	}, zanzana.TranslationLatest, nil)
+
+	// admins can read f1 through role:basic_admin#assignee -> role:basic_editor#assignee -> role:basic_viewer#assignee
+	require.Len(t, tuples["folder:f1"], 2)
+	assertContainsTuple(t, tuples["folder:f1"], common.NewFolderTuple("role:basic_viewer#assignee", zanzana.RelationRead, "f1"))
+	assertContainsTuple(t, tuples["folder:f1"], common.NewFolderTuple("role:basic_editor#assignee", zanzana.RelationWrite, "f1"))
+}
+
+func TestFolderTreeTuples(t *testing.T) {
+	// f1 -> f2 -> f3
+	tuples := folderTreeTuples([]folderRow{
+		{FolderUID: "f3", ParentUID: "f2"},
+		{FolderUID: "f1"},
+		{FolderUID: "f2", ParentUID: "f1"},
+	})
+
+	// grants on f1 reach f3 through the parent chain so no tuple is needed for the root
+	require.Len(t, tuples, 2)
+	require.Len(t, tuples["folder:f2"], 1)
+	require.Len(t, tuples["folder:f3"], 1)
+	assertContainsTuple(t, tuples["folder:f2"], &openfgav1.TupleKey{User: "folder:f1", Relation: zanzana.RelationParent, Object: "folder:f2"})
+	assertContainsTuple(t, tuples["folder:f3"], &openfgav1.TupleKey{User: "folder:f2", Relation: zanzana.RelationParent, Object: "folder:f3"})
+}
+
+func TestFolderTreeTuples_GeneralFolder(t *testing.T) {
+	tuples := folderTreeTuples([]folderRow{
+		{FolderUID: "general"},
+		{FolderUID: "f1", ParentUID: "general"},
+		{FolderUID: "f2", ParentUID: "f1"},
+		// the General folder is the root and never has a parent
+		{FolderUID: "general", ParentUID: "f2"},
+	})
+
+	require.Len(t, tuples, 1)
+	assertContainsTuple(t, tuples["folder:f2"], &openfgav1.TupleKey{User: "folder:f1", Relation: zanzana.RelationParent, Object: "folder:f2"})
+}
+
+func TestManagedPermissionTuples_GeneralFolder(t *testing.T) {
+	// dashboards without a folder are scoped to the General folder in legacy
+	tuples := managedPermissionTuples([]managedPermission{
+		{Action: "dashboards:read", Kind: zanzana.KindFolders, Identifier: "general", UserUID: "u1"},
+	}, zanzana.TranslationLatest, nil)
+
+	require.Len(t, tuples["folder:general"], 1)
+	assertContainsTuple(t, tuples["folder:general"], common.NewFolderResourceTuple("user:u1", zanzana.RelationRead, dashboardGroup, dashboardResource, "general"))
+}
+
+func TestManagedPermissionTuples_MergeMetrics(t *testing.T) {
+	m := initMetrics()
+	actionsBefore := testutil.ToFloat64(m.folderResourceActionsTotal)
+	tuplesBefore := testutil.ToFloat64(m.folderResourceTuplesTotal)
+
+	managedPermissionTuples([]managedPermission{
+		{Action: "dashboards:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+		{Action: "alert.rules:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+		{Action: "dashboards:write", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+		{Action: "alert.rules:write", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+		{Action: "dashboards:read", Kind: zanzana.KindFolders, Identifier: "f2", UserUID: "u1"},
+		{Action: "dashboards:read", Kind: zanzana.KindFolders, Identifier: "f2", TeamUID: "t1"},
+		// not a folder resource action
+		{Action: "folders:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+	}, zanzana.TranslationLatest, nil)
+
+	actions := testutil.ToFloat64(m.folderResourceActionsTotal) - actionsBefore
+	tuples := testutil.ToFloat64(m.folderResourceTuplesTotal) - tuplesBefore
+	assert.Equal(t, float64(6), actions)
+	assert.Equal(t, float64(4), tuples)
+	assert.InDelta(t, 4.0/6.0, tuples/actions, 0.001)
+}
+
+// assertContainsTuple asserts that tuples contains expected stored under its collector key
+func assertContainsTuple(t *testing.T, tuples map[string]*openfgav1.TupleKey, expected *openfgav1.TupleKey) {
+	t.Helper()
+
+	actual, ok := tuples[tupleKey(expected)]
+	require.True(t, ok, "missing tuple %s", expected.String())
+	assert.Equal(t, expected.String(), actual.String())
+}
+
+func TestManagedPermissionTuples_AlertRules(t *testing.T) {
+	t.Run("should translate recording rule permissions on folders", func(t *testing.T) {
+		// recording rules are alert rules and are granted through the same folder actions
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "alert.rules:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+			{Action: "dashboards:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+			{Action: "alert.rules:write", Kind: zanzana.KindFolders, Identifier: "f1", TeamUID: "t1"},
+		}, zanzana.TranslationLatest, nil)
+
+		require.Len(t, tuples["folder:f1"], 2)
+
+		read := common.NewFolderResourceTuple("user:u1", zanzana.RelationRead, "rules.alerting.grafana.app", "alertrules", "f1")
+		assert.Equal(t,
+			[]string{"dashboard.grafana.app/dashboards", "rules.alerting.grafana.app/alertrules", "rules.alerting.grafana.app/recordingrules"},
+			groupResources(tuples["folder:f1"][tupleStringWithoutCondition(read)]),
+		)
+
+		write := common.NewFolderResourceTuple("team:t1#member", zanzana.RelationWrite, "rules.alerting.grafana.app", "alertrules", "f1")
+		zanzana.MergeFolderResourceTuples(write, common.NewFolderResourceTuple("team:t1#member", zanzana.RelationWrite, "rules.alerting.grafana.app", "recordingrules", "f1"))
+		assertContainsTuple(t, tuples["folder:f1"], write)
+	})
+
+	t.Run("should not translate recording rule permissions before v7", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "alert.rules:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+		}, zanzana.TranslationV6, nil)
+
+		assertContainsTuple(t, tuples["folder:f1"], common.NewFolderResourceTuple("user:u1", zanzana.RelationRead, "rules.alerting.grafana.app", "alertrules", "f1"))
+	})
+
+	t.Run("should skip permissions for unsupported kinds", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "grafana-slo-app.slo:read", Kind: "slos", Identifier: "slo1", UserUID: "u1"},
+			{Action: "alert.rules:read", Kind: "slos", Identifier: "slo1", UserUID: "u1"},
+		}, zanzana.TranslationLatest, nil)
+		assert.Empty(t, tuples)
+	})
+}
+
+func TestManagedPermissionTuples_Silences(t *testing.T) {
+	permissions := []managedPermission{
+		{Action: "alert.silences:write", Kind: zanzana.KindFolders, Identifier: "f1", TeamUID: "t1"},
+		{Action: "dashboards:write", Kind: zanzana.KindFolders, Identifier: "f1", TeamUID: "t1"},
+	}
+
+	t.Run("should merge silence edit grants into folder resource tuples", func(t *testing.T) {
+		tuples := managedPermissionTuples(silencePermissions(permissions), zanzana.TranslationLatest, nil)
+
+		require.Len(t, tuples["folder:f1"], 1)
+		write := common.NewFolderResourceTuple("team:t1#member", zanzana.RelationWrite, "dashboard.grafana.app", "dashboards", "f1")
+		assert.ElementsMatch(t,
+			[]string{"dashboard.grafana.app/dashboards", "notifications.alerting.grafana.app/silences"},
+			groupResources(tuples["folder:f1"][tupleStringWithoutCondition(write)]),
+		)
+	})
+
+	t.Run("should skip silence grants unless enabled", func(t *testing.T) {
+		tuples := managedPermissionTuples(permissions, zanzana.TranslationLatest, nil)
+
+		write := common.NewFolderResourceTuple("team:t1#member", zanzana.RelationWrite, "dashboard.grafana.app", "dashboards", "f1")
+		assert.Equal(t, []string{"dashboard.grafana.app/dashboards"}, groupResources(tuples["folder:f1"][tupleStringWithoutCondition(write)]))
+	})
+
+	t.Run("should skip silence grants before v14", func(t *testing.T) {
+		tuples := managedPermissionTuples(silencePermissions(permissions[:1]), zanzana.TranslationV13, nil)
+		assert.Empty(t, tuples)
+	})
+}
+
+func TestIntegrationManagedPermissionsCollector_DashboardVersions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	sql := db.InitTestDB(t)
+	now := time.Now()
+
+	var dashboardID int64
+	saveVersion := func(sess *db.Session, version int) error {
+		if version == 1 {
+			if _, err := sess.Exec(
+				"INSERT INTO dashboard (uid, org_id, version, slug, title, data, created, updated) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+				"d1", 1, version, "d1", "d1", "{}", now, now,
+			); err != nil {
+				return err
+			}
+			if _, err := sess.SQL("SELECT id FROM dashboard WHERE uid = ?", "d1").Get(&dashboardID); err != nil {
+				return err
+			}
+		} else if _, err := sess.Exec("UPDATE dashboard SET version = ? WHERE id = ?", version, dashboardID); err != nil {
+			return err
+		}
+		_, err := sess.Exec(
+			"INSERT INTO dashboard_version (dashboard_id, parent_version, restored_from, version, created, created_by, message, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			dashboardID, version-1, 0, version, now, 1, "", "{}",
+		)
+		return err
+	}
+
+	permission := func(action string) *accesscontrol.Permission {
+		return &accesscontrol.Permission{
+			RoleID: 1, Action: action, Scope: "dashboards:uid:d1",
+			Kind: zanzana.KindDashboards, Attribute: "uid", Identifier: "d1",
+			Created: now, Updated: now,
+		}
+	}
+
+	err := sql.WithDbSession(context.Background(), func(sess *db.Session) error {
+		if err := saveVersion(sess, 1); err != nil {
+			return err
+		}
+		if _, err := sess.Insert(&accesscontrol.Role{ID: 1, OrgID: 1, UID: "managed_viewer", Name: "managed:builtins:viewer:permissions", Created: now, Updated: now}); err != nil {
+			return err
+		}
+		if _, err := sess.Insert(&accesscontrol.BuiltinRole{RoleID: 1, OrgID: 1, Role: "Viewer", Created: now, Updated: now}); err != nil {
+			return err
+		}
+		_, err := sess.Insert(permission("dashboards:write"))
+		return err
+	})
+	require.NoError(t, err)
+
+	// the write grant is removed in the next versions of the dashboard, older versions are retained
+	err = sql.WithDbSession(context.Background(), func(sess *db.Session) error {
+		if _, err := sess.Exec("DELETE FROM permission WHERE action = ?", "dashboards:write"); err != nil {
+			return err
+		}
+		if _, err := sess.Insert(permission("dashboards:read")); err != nil {
+			return err
+		}
+		for _, version := range []int{2, 3} {
+			if err := saveVersion(sess, version); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	tuples, err := managedPermissionsCollector(sql, zanzana.KindDashboards, newReconcileConfig())(context.Background(), 1)
+	require.NoError(t, err)
+
+	subject, _ := managedPermissionSubject(managedPermission{BuiltinRole: "Viewer"})
+	read, ok := zanzana.TranslateToResourceTuple(subject, "dashboards:read", zanzana.KindDashboards, "d1")
+	require.True(t, ok)
+
+	require.Len(t, tuples, 1)
+	require.Len(t, tuples[read.Object], 1)
+	assertContainsTuple(t, tuples[read.Object], read)
+}
+
+func TestIntegrationCollectors_OrgIsolation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	sql := db.InitTestDB(t)
+	now := time.Now()
+
+	// every org has a user in a team, a subfolder and a managed grant on it, named after the org
+	err := sql.WithDbSession(context.Background(), func(sess *db.Session) error {
+		for _, orgId := range []int64{1, 2} {
+			suffix := strconv.FormatInt(orgId, 10)
+			if _, err := sess.Exec(
+				"INSERT INTO "+sql.GetDialect().Quote("user")+" (id, uid, login, email, org_id, version, is_admin, created, updated) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+				orgId, "u"+suffix, "u"+suffix, "u"+suffix+"@example.com", orgId, 0, false, now, now,
+			); err != nil {
+				return err
+			}
+			if _, err := sess.Exec(
+				"INSERT INTO team (id, uid, name, org_id, created, updated) VALUES (?, ?, ?, ?, ?, ?)",
+				orgId, "t"+suffix, "t"+suffix, orgId, now, now,
+			); err != nil {
+				return err
+			}
+			if _, err := sess.Exec(
+				"INSERT INTO team_member (org_id, team_id, user_id, permission, created, updated) VALUES (?, ?, ?, ?, ?, ?)",
+				orgId, orgId, orgId, 0, now, now,
+			); err != nil {
+				return err
+			}
+			for _, folder := range []struct{ uid, parent string }{{"p" + suffix, ""}, {"f" + suffix, "p" + suffix}} {
+				if _, err := sess.Exec(
+					"INSERT INTO folder (uid, org_id, title, parent_uid, created, updated) VALUES (?, ?, ?, ?, ?, ?)",
+					folder.uid, orgId, folder.uid, folder.parent, now, now,
+				); err != nil {
+					return err
+				}
+			}
+			if _, err := sess.Insert(&accesscontrol.Role{ID: orgId, OrgID: orgId, UID: "managed_" + suffix, Name: "managed:users:" + suffix + ":permissions", Created: now, Updated: now}); err != nil {
+				return err
+			}
+			if _, err := sess.Insert(&accesscontrol.UserRole{RoleID: orgId, OrgID: orgId, UserID: orgId, Created: now}); err != nil {
+				return err
+			}
+			if _, err := sess.Insert(&accesscontrol.Permission{
+				RoleID: orgId, Action: "folders:read", Scope: "folders:uid:f" + suffix,
+				Kind: zanzana.KindFolders, Attribute: "uid", Identifier: "f" + suffix,
+				Created: now, Updated: now,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	collectors := map[string]legacyTupleCollector{
+		"team memberships":   teamMembershipCollector(sql, newReconcileConfig()),
+		"folder tree":        folderTreeCollector(sql),
+		"managed permission": managedPermissionsCollector(sql, zanzana.KindFolders, newReconcileConfig()),
+	}
+
+	for name, collect := range collectors {
+		t.Run("should only collect tuples of the org for "+name, func(t *testing.T) {
+			for _, orgId := range []int64{1, 2} {
+				suffix := strconv.FormatInt(orgId, 10)
+				tuples, err := collect(context.Background(), orgId)
+				require.NoError(t, err)
+				require.Len(t, tuples, 1)
+
+				for object, objectTuples := range tuples {
+					assert.True(t, strings.HasSuffix(object, suffix), object)
+					for _, tuple := range objectTuples {
+						assert.True(t, strings.HasSuffix(tuple.GetUser(), suffix), tuple.GetUser())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestManagedPermissionTuples_ScopeTemplates(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+	}{
+		{name: "url parameter", template: accesscontrol.Scope("folders", "uid", accesscontrol.Parameter(":uid"))},
+		{name: "request field", template: accesscontrol.Scope("folders", "uid", accesscontrol.Field("FolderUID"))},
+	}
+
+	for _, tt := range tests {
+		t.Run("should report "+tt.name+" templates as unmigratable", func(t *testing.T) {
+			var dropped []DroppedTuple
+			tuples := managedPermissionTuples(normalizeScopes([]managedPermission{
+				// the template of the role and a permission that was stored expanded
+				{Action: "folders:read", Scope: tt.template, UserUID: "u1"},
+				{Action: "folders:read", Scope: "folders:uid:f1", UserUID: "u1"},
+			}), zanzana.TranslationLatest, func(d DroppedTuple) {
+				dropped = append(dropped, d)
+			})
+
+			require.Len(t, tuples, 1)
+			require.Len(t, tuples["folder:f1"], 1)
+			assertContainsTuple(t, tuples["folder:f1"], common.NewFolderTuple("user:u1", zanzana.RelationRead, "f1"))
+
+			assert.Equal(t, []DroppedTuple{{
+				Object:   tt.template,
+				Relation: "folders:read",
+				Subject:  "user:u1",
+				Reason:   droppedUnmigratableScopeTemplate,
+			}}, dropped)
+		})
+	}
+}
+
+func TestManagedPermissionTuples_GrantsOnly(t *testing.T) {
+	// The permission table has no effect column, a deny could only be expressed through the
+	// action. Actions that aren't grants must never be translated into a tuple.
+	t.Run("should not translate deny-like actions", func(t *testing.T) {
+		permissions := []managedPermission{
+			{Action: "folders:deny", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+			{Action: "folders:read:deny", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+			{Action: "!dashboards:read", Kind: zanzana.KindDashboards, Identifier: "d1", UserUID: "u1"},
+			{Action: "dashboards:revoke", Kind: zanzana.KindDashboards, Identifier: "d1", TeamUID: "t1"},
+			{Action: "dashboards:deny", Kind: zanzana.KindDashboards, Identifier: "*", UserUID: "u1"},
+		}
+
+		var dropped []DroppedTuple
+		tuples := managedPermissionTuples(permissions, zanzana.TranslationLatest, func(d DroppedTuple) {
+			dropped = append(dropped, d)
+		})
+
+		assert.Empty(t, tuples)
+		require.Len(t, dropped, len(permissions))
+		for i, d := range dropped {
+			assert.Equal(t, permissions[i].Action, d.Relation)
+			assert.NotEmpty(t, d.Reason)
+		}
+	})
+
+	t.Run("should only write grant relations", func(t *testing.T) {
+		var permissions []managedPermission
+		for _, action := range []string{"folders:read", "folders:write", "folders:delete", "folders.permissions:write"} {
+			permissions = append(permissions, managedPermission{Action: action, Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"})
+		}
+		for _, action := range []string{"dashboards:read", "dashboards:write", "dashboards:delete", "dashboards.permissions:write"} {
+			permissions = append(permissions,
+				managedPermission{Action: action, Kind: zanzana.KindDashboards, Identifier: "d1", UserUID: "u1"},
+				managedPermission{Action: action, Kind: zanzana.KindDashboards, Identifier: "*", UserUID: "u1"},
+			)
+		}
+
+		tuples := managedPermissionTuples(permissions, zanzana.TranslationLatest, nil)
+		require.NotEmpty(t, tuples)
+		for _, objectTuples := range tuples {
+			for _, tuple := range objectTuples {
+				assert.True(t, zanzana.IsKnownRelation(tuple.GetRelation()), tuple.GetRelation())
+			}
+		}
+	})
+}
+
+func TestManagedPermissionTuples_TeamFolderPermissions(t *testing.T) {
+	t.Run("should translate default folder permissions of a team into member tuples", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{RoleName: "managed:teams:1:permissions", Action: "folders:read", Kind: zanzana.KindFolders, Identifier: "f1", TeamUID: "t1"},
+			{RoleName: "managed:teams:1:permissions", Action: "dashboards:read", Kind: zanzana.KindFolders, Identifier: "f1", TeamUID: "t1"},
+		}, zanzana.TranslationLatest, nil)
+
+		require.Len(t, tuples["folder:f1"], 2)
+		assertContainsTuple(t, tuples["folder:f1"], common.NewFolderTuple("team:t1#member", zanzana.RelationRead, "f1"))
+		assertContainsTuple(t, tuples["folder:f1"], common.NewFolderResourceTuple("team:t1#member", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"))
+	})
+
+	t.Run("should not produce tuples for a team without default folder permissions", func(t *testing.T) {
+		tuples := managedPermissionTuples(nil, zanzana.TranslationLatest, nil)
+		assert.NotNil(t, tuples)
+		assert.Empty(t, tuples)
+	})
+}
+
+func TestManagedPermissionTuples_ServiceAccounts(t *testing.T) {
+	t.Run("should write managed grants and memberships of a service account with the same subject", func(t *testing.T) {
+		membership := teamMembershipTuple(teamMembership{TeamUID: "t1", UserUID: "sa1", IsServiceAccount: true})
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "dashboards:read", Kind: zanzana.KindDashboards, Identifier: "d1", UserUID: "sa1", IsServiceAccount: true},
+		}, zanzana.TranslationLatest, nil)
+
+		read, ok := zanzana.TranslateToResourceTuple(membership.GetUser(), "dashboards:read", zanzana.KindDashboards, "d1")
+		require.True(t, ok)
+		require.Len(t, tuples[read.Object], 1)
+		assertContainsTuple(t, tuples[read.Object], read)
+	})
+
+	t.Run("should translate service account admin permissions granted to a team", func(t *testing.T) {
+		admin := []string{
+			"serviceaccounts:read",
+			"serviceaccounts:write",
+			"serviceaccounts:delete",
+			"serviceaccounts.permissions:read",
+			"serviceaccounts.permissions:write",
+		}
+
+		permissions := make([]managedPermission, 0, len(admin))
+		for _, action := range admin {
+			permissions = append(permissions, managedPermission{Action: action, Kind: zanzana.KindServiceAccounts, Identifier: "1", TeamUID: "t1"})
+		}
+
+		tuples := managedPermissionTuples(permissions, zanzana.TranslationLatest, nil)
+		require.Len(t, tuples, 1)
+
+		// managing permissions is translated into the admin set
+		object := "service_account:1"
+		relations := []string{zanzana.RelationRead, zanzana.RelationWrite, zanzana.RelationDelete, zanzana.RelationPermissionsRead, zanzana.RelationSetAdmin}
+		require.Len(t, tuples[object], len(relations))
+		for _, relation := range relations {
+			assertContainsTuple(t, tuples[object], common.NewTypedTuple(zanzana.TypeServiceAccount, "team:t1#member", relation, "1"))
+		}
+
+		tuples = managedPermissionTuples(permissions, zanzana.TranslationV14, nil)
+		assertContainsTuple(t, tuples[object], common.NewTypedTuple(zanzana.TypeServiceAccount, "team:t1#member", zanzana.RelationPermissionsWrite, "1"))
+	})
+
+	t.Run("should translate service account action sets", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "serviceaccounts:edit", Kind: zanzana.KindServiceAccounts, Identifier: "1", UserUID: "u1"},
+			{Action: "serviceaccounts:admin", Kind: zanzana.KindServiceAccounts, Identifier: "1", UserUID: "u2"},
+		}, zanzana.TranslationLatest, nil)
+
+		object := "service_account:1"
+		require.Len(t, tuples[object], 2)
+		assertContainsTuple(t, tuples[object], common.NewTypedTuple(zanzana.TypeServiceAccount, "user:u1", zanzana.RelationSetEdit, "1"))
+		assertContainsTuple(t, tuples[object], common.NewTypedTuple(zanzana.TypeServiceAccount, "user:u2", zanzana.RelationSetAdmin, "1"))
+
+		assert.Empty(t, managedPermissionTuples([]managedPermission{
+			{Action: "serviceaccounts:edit", Kind: zanzana.KindServiceAccounts, Identifier: "1", UserUID: "u1"},
+		}, zanzana.TranslationV14, nil))
+	})
+
+	t.Run("should not translate service account permissions before v3", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "serviceaccounts:read", Kind: zanzana.KindServiceAccounts, Identifier: "1", TeamUID: "t1"},
+		}, zanzana.TranslationV2, nil)
+		assert.Empty(t, tuples)
+	})
+}
+
+func TestManagedPermissionTuples_LibraryPanels(t *testing.T) {
+	t.Run("should translate library panel permissions on folders", func(t *testing.T) {
+		// library panels inherit permissions from the folder they are stored in
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "dashboards:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+			{Action: "library.panels:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+		}, zanzana.TranslationLatest, nil)
+
+		read := common.NewFolderResourceTuple("user:u1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")
+		require.Len(t, tuples["folder:f1"], 1)
+		assert.Equal(t,
+			[]string{"dashboard.grafana.app/dashboards", "dashboard.grafana.app/librarypanels"},
+			groupResources(tuples["folder:f1"][tupleStringWithoutCondition(read)]),
+		)
+	})
+
+	t.Run("should translate permissions granted on a library panel", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "library.panels:write", Kind: zanzana.KindLibraryPanels, Identifier: "lp1", TeamUID: "t1"},
+		}, zanzana.TranslationLatest, nil)
+
+		object := "resource:dashboard.grafana.app/librarypanels/lp1"
+		require.Len(t, tuples[object], 1)
+		assertContainsTuple(t, tuples[object], common.NewResourceTuple("team:t1#member", zanzana.RelationWrite, "dashboard.grafana.app", "librarypanels", "lp1"))
+	})
+
+	t.Run("should not translate library panel permissions before v5", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "library.panels:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+			{Action: "library.panels:read", Kind: zanzana.KindLibraryPanels, Identifier: "lp1", UserUID: "u1"},
+		}, zanzana.TranslationV4, nil)
+		assert.Empty(t, tuples)
+	})
+}
+
+func TestManagedPermissionTuples_DeletedResources(t *testing.T) {
+	permissions := []managedPermission{
+		{Action: "dashboards:read", Kind: zanzana.KindDashboards, Identifier: "d1", UserUID: "u1"},
+		{Action: "dashboards:read", Kind: zanzana.KindDashboards, Identifier: "d2", UserUID: "u1", ResourceDeleted: true},
+	}
+
+	t.Run("should exclude permissions on deleted dashboards by default", func(t *testing.T) {
+		cfg := newReconcileConfig()
+		tuples := managedPermissionTuples(filterDeletedResources(permissions, cfg.includeDeletedResources, nil), cfg.translationVersion, nil)
+		require.Len(t, tuples, 1)
+		assert.Contains(t, tuples, "resource:dashboard.grafana.app/dashboards/d1")
+	})
+
+	t.Run("should include permissions on deleted dashboards when enabled", func(t *testing.T) {
+		r := NewZanzanaReconciler(newFakeZanzanaClient(), nil, nil, WithDeletedResourcePermissions())
+		tuples := managedPermissionTuples(filterDeletedResources(permissions, r.cfg.includeDeletedResources, nil), r.cfg.translationVersion, nil)
+		require.Len(t, tuples, 2)
+		assertContainsTuple(t, tuples["resource:dashboard.grafana.app/dashboards/d2"], common.NewResourceTuple("user:u1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d2"))
+	})
+}
+
+func TestManagedPermissionTuples_ActionSets(t *testing.T) {
+	t.Run("should keep most permissive action set of a subject on a folder", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "folders:view", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+			{Action: "folders:edit", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+			{Action: "folders:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+		}, zanzana.TranslationLatest, nil)
+
+		require.Len(t, tuples["folder:f1"], 2)
+		assertContainsTuple(t, tuples["folder:f1"], common.NewFolderTuple("user:u1", zanzana.RelationSetEdit, "f1"))
+		assertContainsTuple(t, tuples["folder:f1"], common.NewFolderTuple("user:u1", zanzana.RelationRead, "f1"))
+	})
+
+	t.Run("should resolve action sets in any order", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "dashboards:admin", Kind: zanzana.KindDashboards, Identifier: "d1", TeamUID: "t1"},
+			{Action: "dashboards:view", Kind: zanzana.KindDashboards, Identifier: "d1", TeamUID: "t1"},
+			{Action: "dashboards:edit", Kind: zanzana.KindDashboards, Identifier: "d1", TeamUID: "t1"},
+		}, zanzana.TranslationLatest, nil)
+
+		object := "resource:dashboard.grafana.app/dashboards/d1"
+		require.Len(t, tuples[object], 1)
+		assertContainsTuple(t, tuples[object], common.NewResourceTuple("team:t1#member", zanzana.RelationSetAdmin, dashboardGroup, dashboardResource, "d1"))
+	})
+
+	t.Run("should keep action sets of different subjects", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "folders:view", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+			{Action: "folders:edit", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u2"},
+		}, zanzana.TranslationLatest, nil)
+
+		require.Len(t, tuples["folder:f1"], 2)
+		assertContainsTuple(t, tuples["folder:f1"], common.NewFolderTuple("user:u1", zanzana.RelationSetView, "f1"))
+		assertContainsTuple(t, tuples["folder:f1"], common.NewFolderTuple("user:u2", zanzana.RelationSetEdit, "f1"))
+	})
+
+	t.Run("should not translate action sets before v6", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "folders:edit", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+		}, zanzana.TranslationV5, nil)
+		assert.Empty(t, tuples)
+	})
+}
+
+func TestManagedPermissionTuples_TranslationVersion(t *testing.T) {
+	permissions := []managedPermission{
+		{Action: "dashboards:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+		{Action: "alert.rules:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+	}
+	read := common.NewFolderResourceTuple("user:u1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")
+
+	t.Run("should use translation of pinned version", func(t *testing.T) {
+		// alert rule permissions are not translated in v1
+		tuples := managedPermissionTuples(permissions, zanzana.TranslationV1, nil)
+		require.Len(t, tuples["folder:f1"], 1)
+		assert.Equal(t, []string{"dashboard.grafana.app/dashboards"}, groupResources(tuples["folder:f1"][tupleStringWithoutCondition(read)]))
+	})
+
+	t.Run("should use latest translation by default", func(t *testing.T) {
+		tuples := managedPermissionTuples(permissions, newReconcileConfig().translationVersion, nil)
+		require.Len(t, tuples["folder:f1"], 1)
+		assert.Equal(t,
+			[]string{"dashboard.grafana.app/dashboards", "rules.alerting.grafana.app/alertrules", "rules.alerting.grafana.app/recordingrules"},
+			groupResources(tuples["folder:f1"][tupleStringWithoutCondition(read)]),
+		)
+	})
+
+	t.Run("should skip permissions for unknown version", func(t *testing.T) {
+		tuples := managedPermissionTuples(permissions, zanzana.TranslationVersion(0), nil)
+		assert.Empty(t, tuples)
+	})
+}
+
+func TestManagedPermissionTuples_Panels(t *testing.T) {
+	t.Run("should translate panel permissions into merged subresource tuples on the dashboard", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "panels:read", Kind: zanzana.KindPanels, Identifier: "d1/2", UserUID: "u1"},
+			{Action: "panels:write", Kind: zanzana.KindPanels, Identifier: "d1/2", TeamUID: "t1"},
+			{Action: "panels:read", Kind: zanzana.KindPanels, Identifier: "d1/1", UserUID: "u1"},
+		}, zanzana.TranslationLatest, nil)
+
+		object := "resource:dashboard.grafana.app/dashboards/d1"
+		require.Len(t, tuples, 1)
+		require.Len(t, tuples[object], 2)
+
+		read := common.NewSubresourceTuple("user:u1", zanzana.RelationSubresourceRead, dashboardGroup, dashboardResource, "d1", "1")
+		assert.Equal(t, []string{"1", "2"}, subresources(tuples[object][tupleStringWithoutCondition(read)]))
+		assertContainsTuple(t, tuples[object], common.NewSubresourceTuple("team:t1#member", zanzana.RelationSubresourceWrite, dashboardGroup, dashboardResource, "d1", "2"))
+	})
+
+	t.Run("should skip panel permissions without panel id", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "panels:read", Kind: zanzana.KindPanels, Identifier: "d1", UserUID: "u1"},
+		}, zanzana.TranslationLatest, nil)
+		assert.Empty(t, tuples)
+	})
+}
+
+func TestManagedPermissionTuples_PluginPages(t *testing.T) {
+	t.Run("should translate page access into subresource tuples on the plugin", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "plugins.app:access", Kind: zanzana.KindPlugins, Identifier: "grafana-oncall-app/alert-groups", UserUID: "u1"},
+			{Action: "plugins.app:access", Kind: zanzana.KindPlugins, Identifier: "grafana-oncall-app/schedules", UserUID: "u1"},
+		}, zanzana.TranslationLatest, nil)
+
+		object := "resource:plugins.grafana.app/apps/grafana-oncall-app"
+		require.Len(t, tuples, 1)
+		require.Len(t, tuples[object], 1)
+
+		access := common.NewSubresourceTuple("user:u1", zanzana.RelationSubresourceRead, "plugins.grafana.app", "apps", "grafana-oncall-app", "alert-groups")
+		assert.Equal(t, []string{"alert-groups", "schedules"}, subresources(tuples[object][tupleStringWithoutCondition(access)]))
+	})
+
+	t.Run("should skip access to the whole plugin", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "plugins.app:access", Kind: zanzana.KindPlugins, Identifier: "grafana-oncall-app", UserUID: "u1"},
+		}, zanzana.TranslationLatest, nil)
+		assert.Empty(t, tuples)
+	})
+
+	t.Run("should not translate page access before v12", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "plugins.app:access", Kind: zanzana.KindPlugins, Identifier: "grafana-oncall-app/alert-groups", UserUID: "u1"},
+		}, zanzana.TranslationV11, nil)
+		assert.Empty(t, tuples)
+	})
+}
+
+func subresources(t *openfgav1.TupleKey) []string {
+	var out []string
+	for _, v := range t.GetCondition().GetContext().GetFields()["subresources"].GetListValue().GetValues() {
+		out = append(out, v.GetStringValue())
+	}
+	return out
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	// rows written before scopes were split store the whole scope suffix as identifier
+	permissions := normalizeScopes([]managedPermission{
+		{Action: "folders:read", Scope: "folders:uid:f1", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+		{Action: "folders:read", Scope: "folders:f1", Kind: zanzana.KindFolders, Identifier: "", UserUID: "u2"},
+		{Action: "folders:read", Scope: "folders:*", Kind: zanzana.KindFolders, Identifier: "*", UserUID: "u3"},
+	})
+
+	assert.Equal(t, "f1", permissions[0].Identifier)
+	assert.Equal(t, "f1", permissions[1].Identifier)
+	assert.Equal(t, "*", permissions[2].Identifier)
+
+	tuples := managedPermissionTuples(permissions, zanzana.TranslationLatest, nil)
+	assertContainsTuple(t, tuples["folder:f1"], common.NewFolderTuple("user:u1", zanzana.RelationRead, "f1"))
+	assertContainsTuple(t, tuples["folder:f1"], common.NewFolderTuple("user:u2", zanzana.RelationRead, "f1"))
+}
+
+func TestResolveIdentifiers(t *testing.T) {
+	permissions := []managedPermission{
+		{Action: "dashboards:read", Kind: zanzana.KindDashboards, Identifier: "my-dashboard", UserUID: "u1"},
+	}
+
+	t.Run("should keep identifiers by default", func(t *testing.T) {
+		resolved, err := resolveIdentifiers(context.Background(), 1, permissions, newReconcileConfig().identifierResolver)
+		require.NoError(t, err)
+		assert.Equal(t, permissions, resolved)
+	})
+
+	t.Run("should translate resolved identifier", func(t *testing.T) {
+		r := NewZanzanaReconciler(newFakeZanzanaClient(), nil, nil, WithIdentifierResolver(func(_ context.Context, orgId int64, kind, identifier string) (string, error) {
+			if kind == zanzana.KindDashboards && identifier == "my-dashboard" {
+				return "d1", nil
+			}
+			return identifier, nil
+		}))
+
+		resolved, err := resolveIdentifiers(context.Background(), 1, permissions, r.cfg.identifierResolver)
+		require.NoError(t, err)
+
+		tuples := managedPermissionTuples(resolved, r.cfg.translationVersion, nil)
+		require.Len(t, tuples, 1)
+		assertContainsTuple(t, tuples["resource:dashboard.grafana.app/dashboards/d1"], common.NewResourceTuple("user:u1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d1"))
+		// the legacy rows should not be modified
+		assert.Equal(t, "my-dashboard", permissions[0].Identifier)
+	})
+
+	t.Run("should return resolver errors", func(t *testing.T) {
+		_, err := resolveIdentifiers(context.Background(), 1, permissions, func(context.Context, int64, string, string) (string, error) {
+			return "", errors.New("not found")
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestPublicDashboardTuples(t *testing.T) {
+	shares := []publicDashboardShare{
+		{UID: "p1", DashboardUID: "d1", IsEnabled: true},
+		{UID: "p2", DashboardUID: "d1", IsEnabled: false},
+	}
+
+	active := common.NewResourceTuple("public_dashboard:p1", zanzana.RelationPublicRead, dashboardGroup, dashboardResource, "d1")
+	revoked := common.NewResourceTuple("public_dashboard:p2", zanzana.RelationPublicRead, dashboardGroup, dashboardResource, "d1")
+
+	t.Run("should only translate active shares", func(t *testing.T) {
+		tuples := publicDashboardTuples(shares)
+		require.Len(t, tuples, 1)
+		require.Len(t, tuples[active.Object], 1)
+		assertContainsTuple(t, tuples[active.Object], active)
+	})
+
+	t.Run("should delete tuples of revoked shares", func(t *testing.T) {
+		const namespace = "default"
+
+		client := newFakeZanzanaClient()
+		client.seed(namespace, revoked)
+
+		legacy := func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+			return publicDashboardTuples(shares), nil
+		}
+		r := newResourceReconciler("public dashboards", legacy, zanzanaCollector([]string{zanzana.RelationPublicRead}), client)
+
+		report, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Writes)
+		assert.Equal(t, 1, report.Deletes)
+
+		stored := client.stored(namespace)
+		require.Len(t, stored, 1)
+		assert.Equal(t, active.GetUser(), stored[0].GetUser())
+	})
+}
+
+func TestQueryHistoryTuples(t *testing.T) {
+	t.Run("should grant owners access to their own query history", func(t *testing.T) {
+		tuples := queryHistoryTuples([]string{"u1", "u2"}, zanzana.TranslationLatest, nil)
+		require.Len(t, tuples, 2)
+
+		object := "resource:queryhistory.grafana.app/queryhistory/u1"
+		require.Len(t, tuples[object], 3)
+		for _, relation := range []string{zanzana.RelationRead, zanzana.RelationWrite, zanzana.RelationDelete} {
+			assertContainsTuple(t, tuples[object], common.NewResourceTuple("user:u1", relation, "queryhistory.grafana.app", "queryhistory", "u1"))
+		}
+	})
+
+	t.Run("should not collect anything for versions without query history", func(t *testing.T) {
+		assert.Empty(t, queryHistoryTuples([]string{"u1"}, zanzana.TranslationV7, nil))
+	})
+}
+
+func TestTeamVisibilityTuples(t *testing.T) {
+	teams := []string{"t1", "t2", "t3"}
+
+	t.Run("should grant members of a team read access to another team", func(t *testing.T) {
+		tuples := teamVisibilityTuples(teams, []teamVisibilityGrant{
+			{SubjectUID: "t2", TeamUID: "t1", Action: "teams:read"},
+			// grants on the own team and unsupported actions are skipped
+			{SubjectUID: "t3", TeamUID: "t3", Action: "teams:read"},
+			{SubjectUID: "t3", TeamUID: "t1", Action: "teams:write"},
+		}, zanzana.TranslationLatest, nil)
+
+		require.Len(t, tuples, 3)
+		require.Len(t, tuples["team:t1"], 1)
+		assertContainsTuple(t, tuples["team:t1"], &openfgav1.TupleKey{
+			User:     "team:t2#member",
+			Relation: zanzana.RelationRead,
+			Object:   "team:t1",
+		})
+		// teams without grants are collected so revoked grants are deleted
+		assert.Empty(t, tuples["team:t2"])
+		assert.Empty(t, tuples["team:t3"])
+	})
+
+	t.Run("should not collect grants for versions without team visibility", func(t *testing.T) {
+		tuples := teamVisibilityTuples(teams, []teamVisibilityGrant{
+			{SubjectUID: "t2", TeamUID: "t1", Action: "teams:read"},
+		}, zanzana.TranslationV12, nil)
+		assert.Empty(t, tuples["team:t1"])
+	})
+}
+
+func TestAlertRuleTuples(t *testing.T) {
+	rules := []alertRuleRow{
+		{UID: "r1", FolderUID: "child"},
+		{UID: "r2", FolderUID: "other"},
+	}
+	folders := []folderRow{
+		{FolderUID: "root"},
+		{FolderUID: "child", ParentUID: "root"},
+		{FolderUID: "other"},
+	}
+	permissions := []managedPermission{
+		{Action: "alert.rules:read", Kind: zanzana.KindFolders, Identifier: "root", TeamUID: "t1"},
+		{Action: "alert.rules:write", Kind: zanzana.KindFolders, Identifier: "child", UserUID: "u1"},
+		{Action: "alert.rules:create", Kind: zanzana.KindFolders, Identifier: "child", UserUID: "u1"},
+	}
+
+	t.Run("should apply folder permissions to rules in the folder and its subfolders", func(t *testing.T) {
+		tuples := alertRuleTuples(rules, folders, permissions, zanzana.TranslationLatest, nil, nil)
+		require.Len(t, tuples, 1)
+
+		object := "resource:rules.alerting.grafana.app/alertrules/r1"
+		require.Len(t, tuples[object], 2)
+		assertContainsTuple(t, tuples[object], common.NewResourceTuple("team:t1#member", zanzana.RelationRead, "rules.alerting.grafana.app", "alertrules", "r1"))
+		assertContainsTuple(t, tuples[object], common.NewResourceTuple("user:u1", zanzana.RelationWrite, "rules.alerting.grafana.app", "alertrules", "r1"))
+	})
+
+	t.Run("should not collect anything for versions without alert rules", func(t *testing.T) {
+		assert.Empty(t, alertRuleTuples(rules, folders, permissions, zanzana.TranslationV8, nil, nil))
+	})
+
+	t.Run("should report the folder every tuple was inherited from", func(t *testing.T) {
+		// the read grant is repeated on child, it is inherited from the closest folder
+		permissions := append(slices.Clone(permissions),
+			managedPermission{Action: "alert.rules:read", Kind: zanzana.KindFolders, Identifier: "child", UserUID: "u2"},
+			managedPermission{Action: "alert.rules:read", Kind: zanzana.KindFolders, Identifier: "root", UserUID: "u2"},
+		)
+
+		inherited := make(map[string]string)
+		tuples := alertRuleTuples(rules, folders, permissions, zanzana.TranslationLatest, func(tuple *openfgav1.TupleKey, folderUID string) {
+			_, ok := inherited[tuple.String()]
+			assert.False(t, ok, "tuple reported more than once: %s", tuple.String())
+			inherited[tuple.String()] = folderUID
+		}, nil)
+
+		object := "resource:rules.alerting.grafana.app/alertrules/r1"
+		require.Len(t, tuples[object], 3)
+		assert.Equal(t, map[string]string{
+			common.NewResourceTuple("team:t1#member", zanzana.RelationRead, "rules.alerting.grafana.app", "alertrules", "r1").String(): "root",
+			common.NewResourceTuple("user:u1", zanzana.RelationWrite, "rules.alerting.grafana.app", "alertrules", "r1").String():       "child",
+			common.NewResourceTuple("user:u2", zanzana.RelationRead, "rules.alerting.grafana.app", "alertrules", "r1").String():        "child",
+		}, inherited)
+	})
+}
+
+func TestManagedPermissionTuples_Datasources(t *testing.T) {
+	t.Run("should translate grant on all datasources into a namespace tuple", func(t *testing.T) {
+		tuples := managedPermissionTuples(normalizeScopes([]managedPermission{
+			{Action: "datasources:query", Scope: "datasources:*", UserUID: "u1"},
+			{Action: "datasources:query", Scope: "datasources:uid:ds1", TeamUID: "t1"},
+		}), zanzana.TranslationLatest, nil)
+		require.Len(t, tuples, 2)
+
+		namespace := common.NewNamespaceResourceTuple("user:u1", zanzana.RelationRead, "datasource.grafana.app", "datasources")
+		require.Len(t, tuples[namespace.Object], 1)
+		assertContainsTuple(t, tuples[namespace.Object], namespace)
+
+		single := common.NewResourceTuple("team:t1#member", zanzana.RelationRead, "datasource.grafana.app", "datasources", "ds1")
+		assertContainsTuple(t, tuples[single.Object], single)
+	})
+
+	t.Run("should not translate wildcard into a tuple on a datasource named *", func(t *testing.T) {
+		tuples := managedPermissionTuples([]managedPermission{
+			{Action: "datasources:query", Scope: "datasources:*", Kind: zanzana.KindDatasources, Identifier: "*", UserUID: "u1"},
+		}, zanzana.TranslationLatest, nil)
+		assert.NotContains(t, tuples, "resource:datasource.grafana.app/datasources/*")
+		assert.Contains(t, tuples, "namespace:datasource.grafana.app/datasources")
+	})
+}
+
+func TestManagedPermissionTuples_PermissionsWrite(t *testing.T) {
+	tuples := managedPermissionTuples([]managedPermission{
+		{Action: "folders:view", Kind: zanzana.KindFolders, Identifier: "f1", TeamUID: "t1"},
+		{Action: "folders.permissions:write", Kind: zanzana.KindFolders, Identifier: "f1", TeamUID: "t1"},
+		{Action: "folders.permissions:read", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+		{Action: "dashboards.permissions:write", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u2"},
+	}, zanzana.TranslationLatest, nil)
+
+	// managing permissions is admin-equivalent and includes the view set of the same team
+	require.Len(t, tuples["folder:f1"], 3)
+	assertContainsTuple(t, tuples["folder:f1"], common.NewFolderTuple("team:t1#member", zanzana.RelationSetAdmin, "f1"))
+	assertContainsTuple(t, tuples["folder:f1"], common.NewFolderTuple("user:u1", zanzana.RelationPermissionsRead, "f1"))
+	// managing permissions of dashboards in a folder is admin-equivalent on the dashboards in it,
+	// the same as managing permissions of a single dashboard
+	assertContainsTuple(t, tuples["folder:f1"], common.NewFolderResourceTuple("user:u2", zanzana.RelationSetAdmin, dashboardGroup, dashboardResource, "f1"))
+
+	tuples = managedPermissionTuples([]managedPermission{
+		{Action: "dashboards.permissions:write", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u2"},
+	}, zanzana.TranslationV10, nil)
+	require.Len(t, tuples["folder:f1"], 1)
+	assertContainsTuple(t, tuples["folder:f1"], common.NewFolderResourceTuple("user:u2", zanzana.RelationPermissionsWrite, dashboardGroup, dashboardResource, "f1"))
+}
+
+func TestBasicRolePermissionTuples(t *testing.T) {
+	permissions := map[string][]accesscontrol.Permission{
+		"Viewer": {
+			{Action: "dashboards:read", Scope: "dashboards:*"},
+			{Action: "dashboards:read", Scope: "folders:*"},
+			{Action: "folders:read", Scope: "folders:*"},
+			// scoped to a single resource
+			{Action: "dashboards:read", Scope: "folders:uid:f1"},
+			// no kind
+			{Action: "teams:create"},
+		},
+		"None": {
+			{Action: "dashboards:read", Scope: "dashboards:*"},
+		},
+	}
+
+	tuples := basicRolePermissionTuples(permissions, zanzana.TranslationLatest, nil)
+	require.Len(t, tuples, 2)
+
+	dashboards := tuples["namespace:dashboard.grafana.app/dashboards"]
+	require.Len(t, dashboards, 1)
+	assertContainsTuple(t, dashboards, common.NewNamespaceResourceTuple("role:basic_viewer#assignee", zanzana.RelationRead, dashboardGroup, dashboardResource))
+
+	folders := tuples["namespace:folder.grafana.app/folders"]
+	require.Len(t, folders, 1)
+	assertContainsTuple(t, folders, common.NewNamespaceResourceTuple("role:basic_viewer#assignee", zanzana.RelationRead, "folder.grafana.app", "folders"))
+}
+
+func TestNamespacePermissions(t *testing.T) {
+	permissions := []managedPermission{
+		{Action: "dashboards:read", Kind: zanzana.KindDashboards, Identifier: "*", RoleName: "managed:builtins:editor:permissions"},
+		{Action: "dashboards:read", Kind: zanzana.KindDashboards, Identifier: "d1", RoleName: "managed:builtins:editor:permissions"},
+		{Action: "teams:read", Kind: zanzana.KindTeams, Identifier: "*", RoleName: "managed:builtins:editor:permissions"},
+	}
+
+	t.Run("should only keep wildcards of the given kinds", func(t *testing.T) {
+		out := namespacePermissions(permissions, map[string]struct{}{zanzana.KindDashboards: {}})
+		require.Len(t, out, 1)
+		assert.Equal(t, permissions[0], out[0])
+	})
+
+	t.Run("should drop wildcards from managed permissions", func(t *testing.T) {
+		out := withoutWildcards(permissions)
+		require.Len(t, out, 1)
+		assert.Equal(t, permissions[1], out[0])
+	})
+}
+
+func TestIntegrationNamespacePermissionCollector_Stable(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	sql := db.InitTestDB(t)
+	now := time.Now()
+
+	err := sql.WithDbSession(context.Background(), func(sess *db.Session) error {
+		if _, err := sess.Insert(&accesscontrol.Role{ID: 1, OrgID: 1, UID: "managed_editor", Name: "managed:builtins:editor:permissions", Created: now, Updated: now}); err != nil {
+			return err
+		}
+		if _, err := sess.Insert(&accesscontrol.BuiltinRole{RoleID: 1, OrgID: 1, Role: "Editor", Created: now, Updated: now}); err != nil {
+			return err
+		}
+		_, err := sess.Insert(&accesscontrol.Permission{
+			RoleID: 1, Action: "dashboards:read", Scope: "dashboards:*",
+			Kind: zanzana.KindDashboards, Attribute: "uid", Identifier: "*",
+			Created: now, Updated: now,
+		})
+		return err
+	})
+	require.NoError(t, err)
+
+	namespace := claims.OrgNamespaceFormatter(1)
+	client := newFakeZanzanaClient()
+	r := NewZanzanaReconciler(client, sql, nil, WithBasicRolePermissions(func() map[string][]accesscontrol.Permission {
+		return map[string][]accesscontrol.Permission{
+			"Viewer": {{Action: "dashboards:read", Scope: "dashboards:*"}},
+		}
+	}))
+	// the managed permission reconcilers and the namespace reconciler all see namespace grants
+	r.reconcilers = slices.DeleteFunc(r.reconcilers, func(rr resourceReconciler) bool {
+		return !strings.HasPrefix(rr.name, "managed ") && rr.name != "namespace permissions"
+	})
+
+	r.reconcileNamespace(context.Background(), namespace)
+	writes := len(client.writes)
+
+	stored := map[string]*openfgav1.TupleKey{}
+	for _, tuple := range client.stored(namespace) {
+		if tuple.GetObject() == "namespace:dashboard.grafana.app/dashboards" {
+			stored[tupleKey(tuple)] = tuple
+		}
+	}
+	require.Len(t, stored, 2)
+	assertContainsTuple(t, stored, common.NewNamespaceResourceTuple("role:basic_editor#assignee", zanzana.RelationRead, dashboardGroup, dashboardResource))
+	assertContainsTuple(t, stored, common.NewNamespaceResourceTuple("role:basic_viewer#assignee", zanzana.RelationRead, dashboardGroup, dashboardResource))
+
+	// a second run finds nothing to change
+	r.reconcileNamespace(context.Background(), namespace)
+	assert.Equal(t, writes, len(client.writes))
+}
@@ -0,0 +1,74 @@
+package dualwrite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+)
+
+// collectorColumns are the columns selected by legacy collectors grouped by table for the latest
+// legacy schema, see legacySchemaColumns. Keep this in sync with the queries used by the collectors,
+// TestCollectorColumns fails when a collector query uses a column that is not listed.
+var collectorColumns = map[string][]string{
+	"team":             {"id", "uid", "org_id"},
+	"team_member":      {"team_id", "user_id", "permission", "org_id"},
+	"user":             {"id", "uid", "is_service_account", "is_disabled", "last_seen_at"},
+	"folder":           {"uid", "parent_uid", "org_id"},
+	"permission":       {"role_id", "action", "scope", "kind", "identifier"},
+	"role":             {"id", "uid", "name", "org_id"},
+	"user_role":        {"role_id", "user_id", "org_id", "group_mapping_uid"},
+	"team_role":        {"role_id", "team_id"},
+	"builtin_role":     {"role_id", "role"},
+	"org_user":         {"user_id", "org_id", "role"},
+	"dashboard":        {"uid", "org_id", "deleted"},
+	"dashboard_public": {"uid", "dashboard_uid", "org_id", "is_enabled"},
+	"alert_rule":       {"uid", "namespace_uid", "org_id"},
+	"query_history":    {"created_by", "org_id"},
+}
+
+// columnLister returns the columns of table.
+type columnLister func(table string) ([]string, error)
+
+func storeColumnLister(store db.DB) columnLister {
+	return func(table string) ([]string, error) {
+		columns, _, err := store.GetEngine().Dialect().GetColumns(table)
+		return columns, err
+	}
+}
+
+// validateColumns verifies that all required columns exist. Collectors scan rows into structs
+// and would silently produce empty values for a missing column, so we fail before collecting.
+func validateColumns(required map[string][]string, list columnLister) error {
+	tables := make([]string, 0, len(required))
+	for table := range required {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	for _, table := range tables {
+		columns, err := list(table)
+		if err != nil {
+			return fmt.Errorf("failed to list columns of table %s: %w", table, err)
+		}
+
+		existing := make(map[string]struct{}, len(columns))
+		for _, c := range columns {
+			existing[strings.ToLower(c)] = struct{}{}
+		}
+
+		var missing []string
+		for _, c := range required[table] {
+			if _, ok := existing[c]; !ok {
+				missing = append(missing, c)
+			}
+		}
+
+		if len(missing) > 0 {
+			return fmt.Errorf("table %s is missing columns required for reconciliation: %s", table, strings.Join(missing, ", "))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package dualwrite
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateColumns(t *testing.T) {
+	schema := func(tables map[string][]string) columnLister {
+		return func(table string) ([]string, error) {
+			return tables[table], nil
+		}
+	}
+
+	t.Run("should pass when all required columns exist", func(t *testing.T) {
+		tables := make(map[string][]string, len(collectorColumns))
+		for table, columns := range collectorColumns {
+			// extra columns should be ignored
+			tables[table] = append([]string{"created"}, columns...)
+		}
+		require.NoError(t, validateColumns(collectorColumns, schema(tables)))
+	})
+
+	t.Run("should fail when a required column is missing", func(t *testing.T) {
+		err := validateColumns(map[string][]string{
+			"folder": {"uid", "parent_uid", "org_id"},
+		}, schema(map[string][]string{
+			"folder": {"id", "uid", "org_id"},
+		}))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "table folder")
+		assert.Contains(t, err.Error(), "parent_uid")
+	})
+
+	t.Run("should fail when table is missing", func(t *testing.T) {
+		err := validateColumns(map[string][]string{
+			"team_role": {"role_id", "team_id"},
+		}, schema(map[string][]string{}))
+		require.ErrorContains(t, err, "role_id, team_id")
+	})
+
+	t.Run("should fail when columns cannot be listed", func(t *testing.T) {
+		err := validateColumns(map[string][]string{
+			"role": {"id"},
+		}, func(table string) ([]string, error) {
+			return nil, errors.New("boom")
+		})
+		require.ErrorContains(t, err, "failed to list columns of table role")
+	})
+}
+
+// collectorSources are the files holding the queries of the legacy collectors.
+var collectorSources = []string{"collectors.go", "legacyschema.go"}
+
+func TestCollectorColumns(t *testing.T) {
+	var queries []string
+	fset := token.NewFileSet()
+	for _, name := range collectorSources {
+		file, err := parser.ParseFile(fset, name, nil, 0)
+		require.NoError(t, err)
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n.(type) {
+			case *ast.BasicLit, *ast.BinaryExpr:
+				if text := sqlText(n.(ast.Expr)); strings.Contains(text, "SELECT") && strings.Contains(text, "FROM") {
+					queries = append(queries, text)
+				}
+				return false
+			}
+			return true
+		})
+	}
+	require.NotEmpty(t, queries)
+
+	for _, query := range queries {
+		for _, c := range queryColumns(query) {
+			table, column, _ := strings.Cut(c, ".")
+			assert.Truef(t, slices.Contains(collectorColumns[table], column), "column %s is used by a collector but not listed in collectorColumns, query:\n%s", c, query)
+		}
+	}
+}
+
+// sqlText evaluates a string expression. Quoted identifiers are replaced by the identifier and
+// everything else that can't be evaluated with a space.
+func sqlText(e ast.Expr) string {
+	switch e := e.(type) {
+	case *ast.BasicLit:
+		if e.Kind == token.STRING {
+			if s, err := strconv.Unquote(e.Value); err == nil {
+				return s
+			}
+		}
+	case *ast.BinaryExpr:
+		if e.Op == token.ADD {
+			return sqlText(e.X) + sqlText(e.Y)
+		}
+	case *ast.ParenExpr:
+		return sqlText(e.X)
+	case *ast.CallExpr:
+		if sel, ok := e.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Quote" && len(e.Args) == 1 {
+			return sqlText(e.Args[0])
+		}
+	}
+	return " "
+}
+
+var (
+	sqlLiteralRegex   = regexp.MustCompile(`'[^']*'`)
+	sqlTableRegex     = regexp.MustCompile(`\b(?:FROM|JOIN)\s+(\w+)(?:\s+(\w+))?`)
+	sqlQualifiedRegex = regexp.MustCompile(`\b([a-z_]+)\.([a-z_]+)\b`)
+	sqlConditionRegex = regexp.MustCompile(`(?:^|[^.\w])([a-z_]+)\s*(?:=|!=|<>|>|<|\sIS\s|\sIN\s|\sLIKE\s)`)
+	sqlKeywords       = []string{"WHERE", "INNER", "LEFT", "RIGHT", "JOIN", "ON", "ORDER", "GROUP", "LIMIT", "UNION"}
+)
+
+// queryColumns returns the columns used by query as table.column. Unqualified columns are only
+// resolved for queries reading a single table.
+func queryColumns(query string) []string {
+	query = sqlLiteralRegex.ReplaceAllString(query, "''")
+
+	aliases := map[string]string{}
+	tables := map[string]struct{}{}
+	for _, m := range sqlTableRegex.FindAllStringSubmatch(query, -1) {
+		tables[m[1]] = struct{}{}
+		aliases[m[1]] = m[1]
+		if m[2] != "" && !slices.Contains(sqlKeywords, strings.ToUpper(m[2])) {
+			aliases[m[2]] = m[1]
+		}
+	}
+
+	var columns []string
+	for _, m := range sqlQualifiedRegex.FindAllStringSubmatch(query, -1) {
+		if table, ok := aliases[m[1]]; ok {
+			columns = append(columns, table+"."+m[2])
+		}
+	}
+
+	if len(tables) != 1 {
+		return columns
+	}
+
+	var table string
+	for t := range tables {
+		table = t
+	}
+
+	selected, rest, _ := strings.Cut(query[strings.Index(query, "SELECT")+len("SELECT"):], "FROM")
+	for _, item := range strings.Split(selected, ",") {
+		item = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(item), "DISTINCT "))
+		item, _, _ = strings.Cut(item, " as ")
+		if item == "" || strings.ContainsAny(item, "().'* ") {
+			continue
+		}
+		columns = append(columns, table+"."+item)
+	}
+
+	if _, where, ok := strings.Cut(rest, "WHERE"); ok {
+		for _, m := range sqlConditionRegex.FindAllStringSubmatch(where, -1) {
+			columns = append(columns, table+"."+m[1])
+		}
+	}
+
+	return columns
+}
@@ -0,0 +1,55 @@
+package dualwrite
+
+import (
+	"strings"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+)
+
+// CompareStrategy selects the key tuples collected from legacy and zanzana are compared by.
+type CompareStrategy int
+
+const (
+	// CompareDefault keys tuples the way collectors do, see tupleKey. Tuples with a mutable
+	// condition are keyed without it and a changed condition is applied as an update.
+	CompareDefault CompareStrategy = iota
+	// CompareStrict keys every tuple with its condition and its subject as written, so team:uid
+	// and team:uid#member differ and a tuple with a changed condition is rewritten.
+	CompareStrict
+	// CompareLenient keys every tuple without its condition and without the relation of its
+	// subject. Changed conditions are ignored.
+	CompareLenient
+)
+
+// key returns the key of t for the strategy.
+func (s CompareStrategy) key(t *openfgav1.TupleKey) string {
+	switch s {
+	case CompareStrict:
+		return t.String()
+	case CompareLenient:
+		subject, _, _ := strings.Cut(t.User, "#")
+		return tupleStringWithoutCondition(&openfgav1.TupleKey{User: subject, Relation: t.Relation, Object: t.Object})
+	default:
+		return tupleKey(t)
+	}
+}
+
+// rekey returns tuples keyed by the strategy. Tuples are returned as is for the default
+// strategy as collectors already key them that way.
+func (s CompareStrategy) rekey(tuples map[string]*openfgav1.TupleKey) map[string]*openfgav1.TupleKey {
+	if s == CompareDefault {
+		return tuples
+	}
+
+	out := make(map[string]*openfgav1.TupleKey, len(tuples))
+	for _, t := range tuples {
+		out[s.key(t)] = t
+	}
+	return out
+}
+
+// comparesCondition returns true if tuples with the same key must also have the same condition.
+// The strict strategy keys tuples with their condition and the lenient one ignores it.
+func (s CompareStrategy) comparesCondition(t *openfgav1.TupleKey) bool {
+	return s == CompareDefault && isKeyedWithoutCondition(t)
+}
@@ -0,0 +1,65 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestCompareStrategy(t *testing.T) {
+	const namespace = "default"
+
+	// the team tuple is stored without the member relation and the folder resource tuple
+	// with a condition that changed in legacy since
+	stored := []*openfgav1.TupleKey{
+		common.NewFolderTuple("team:t1", zanzana.RelationRead, "f1"),
+		common.NewFolderResourceTuple("user:1", zanzana.RelationRead, "folder.grafana.app", "folders", "f1"),
+	}
+	legacy := staticCollector(
+		common.NewFolderTuple("team:t1#member", zanzana.RelationRead, "f1"),
+		common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"),
+	)
+
+	dryRun := func(t *testing.T, strategy CompareStrategy) *ReconcileResult {
+		t.Helper()
+		client := newFakeZanzanaClient()
+		client.seed(namespace, stored...)
+
+		r := newResourceReconciler("test", legacy, zanzanaCollector(zanzana.FolderRelations), client)
+		r.cfg.compareStrategy = strategy
+		result, err := r.dryRun(context.Background(), namespace)
+		require.NoError(t, err)
+		return result
+	}
+
+	t.Run("should update changed conditions by default", func(t *testing.T) {
+		result := dryRun(t, CompareDefault)
+		require.Len(t, result.Additions, 1)
+		assert.Equal(t, "user:1", result.Additions[0].User)
+		assert.Len(t, result.Updates, 1)
+		assert.Empty(t, result.Deletions)
+	})
+
+	t.Run("should compare subjects as written when strict", func(t *testing.T) {
+		result := dryRun(t, CompareStrict)
+		require.Len(t, result.Additions, 2)
+		assert.ElementsMatch(t, []string{"team:t1#member", "user:1"}, []string{result.Additions[0].User, result.Additions[1].User})
+		require.Len(t, result.Deletions, 1)
+		assert.Equal(t, "team:t1", result.Deletions[0].User)
+		require.Len(t, result.Updates, 1)
+		assert.Equal(t, "user:1", result.Updates[0].User)
+	})
+
+	t.Run("should ignore conditions and subject relations when lenient", func(t *testing.T) {
+		result := dryRun(t, CompareLenient)
+		assert.Empty(t, result.Additions)
+		assert.Empty(t, result.Deletions)
+		assert.Empty(t, result.Updates)
+	})
+}
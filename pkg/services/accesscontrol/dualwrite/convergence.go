@@ -0,0 +1,129 @@
+package dualwrite
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/grafana/authlib/claims"
+
+	"github.com/grafana/grafana/pkg/infra/kvstore"
+)
+
+const (
+	// convergenceKVNamespace is the kvstore namespace convergence state is persisted in.
+	convergenceKVNamespace = "zanzana.reconciler.convergence"
+	convergenceKVKey       = "state"
+)
+
+// ConvergenceState is the convergence of the tuples of a namespace with legacy.
+type ConvergenceState struct {
+	// ConvergedAt is when the namespace was first reconciled without changes.
+	ConvergedAt time.Time `json:"convergedAt,omitempty"`
+	// DriftedRuns is the number of complete runs that made changes before it converged.
+	DriftedRuns int `json:"driftedRuns"`
+}
+
+// Converged returns true if the namespace has converged once.
+func (s ConvergenceState) Converged() bool {
+	return !s.ConvergedAt.IsZero()
+}
+
+// ConvergenceStore persists the convergence state of namespaces so the first-ever convergence is
+// detected once, no matter how often or on which instance reconciliation runs.
+type ConvergenceStore interface {
+	GetConvergence(ctx context.Context, namespace string) (ConvergenceState, bool, error)
+	SaveConvergence(ctx context.Context, namespace string, state ConvergenceState) error
+}
+
+var _ ConvergenceStore = (*KVConvergenceStore)(nil)
+
+// KVConvergenceStore persists convergence state in the kvstore, one entry per org.
+type KVConvergenceStore struct {
+	kv kvstore.KVStore
+}
+
+func NewKVConvergenceStore(kv kvstore.KVStore) *KVConvergenceStore {
+	return &KVConvergenceStore{kv: kv}
+}
+
+func (s *KVConvergenceStore) GetConvergence(ctx context.Context, namespace string) (ConvergenceState, bool, error) {
+	info, err := claims.ParseNamespace(namespace)
+	if err != nil {
+		return ConvergenceState{}, false, err
+	}
+
+	value, ok, err := s.kv.Get(ctx, info.OrgID, convergenceKVNamespace, convergenceKVKey)
+	if err != nil || !ok {
+		return ConvergenceState{}, false, err
+	}
+
+	var state ConvergenceState
+	if err := json.Unmarshal([]byte(value), &state); err != nil {
+		return ConvergenceState{}, false, err
+	}
+	return state, true, nil
+}
+
+func (s *KVConvergenceStore) SaveConvergence(ctx context.Context, namespace string, state ConvergenceState) error {
+	info, err := claims.ParseNamespace(namespace)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return s.kv.Set(ctx, info.OrgID, convergenceKVNamespace, convergenceKVKey, string(value))
+}
+
+// memConvergenceStore keeps convergence state in memory, it is used unless a store is set with
+// WithConvergenceStore and starts over on every restart.
+type memConvergenceStore struct {
+	mu     sync.Mutex
+	states map[string]ConvergenceState
+}
+
+func newMemConvergenceStore() *memConvergenceStore {
+	return &memConvergenceStore{states: make(map[string]ConvergenceState)}
+}
+
+func (s *memConvergenceStore) GetConvergence(_ context.Context, namespace string) (ConvergenceState, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[namespace]
+	return state, ok, nil
+}
+
+func (s *memConvergenceStore) SaveConvergence(_ context.Context, namespace string, state ConvergenceState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[namespace] = state
+	return nil
+}
+
+// observeConvergence records the number of changes a complete reconciliation of namespace made.
+// It returns the new state and true only the first time namespace is reconciled without changes,
+// including when it had no drift to begin with.
+func observeConvergence(ctx context.Context, store ConvergenceStore, namespace string, changes int, now time.Time) (ConvergenceState, bool, error) {
+	state, _, err := store.GetConvergence(ctx, namespace)
+	if err != nil {
+		return ConvergenceState{}, false, err
+	}
+	if state.Converged() {
+		return state, false, nil
+	}
+
+	if changes > 0 {
+		state.DriftedRuns++
+		return state, false, store.SaveConvergence(ctx, namespace, state)
+	}
+
+	state.ConvergedAt = now
+	if err := store.SaveConvergence(ctx, namespace, state); err != nil {
+		return ConvergenceState{}, false, err
+	}
+	return state, true, nil
+}
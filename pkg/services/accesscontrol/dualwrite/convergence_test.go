@@ -0,0 +1,98 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/authlib/claims"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/kvstore"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestObserveConvergence(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	namespace := claims.OrgNamespaceFormatter(2)
+
+	observe := func(t *testing.T, store ConvergenceStore, namespace string, changes int) bool {
+		t.Helper()
+		_, converged, err := observeConvergence(ctx, store, namespace, changes, now)
+		require.NoError(t, err)
+		return converged
+	}
+
+	t.Run("should fire once when drift is resolved", func(t *testing.T) {
+		store := NewKVConvergenceStore(kvstore.NewFakeKVStore())
+		assert.False(t, observe(t, store, namespace, 3))
+		assert.False(t, observe(t, store, namespace, 1))
+		assert.True(t, observe(t, store, namespace, 0))
+		assert.False(t, observe(t, store, namespace, 0))
+
+		// drift after converging should not fire again
+		assert.False(t, observe(t, store, namespace, 2))
+		assert.False(t, observe(t, store, namespace, 0))
+
+		state, ok, err := store.GetConvergence(ctx, namespace)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.True(t, now.Equal(state.ConvergedAt))
+		assert.Equal(t, 2, state.DriftedRuns)
+	})
+
+	t.Run("should fire for a namespace converged on its first run", func(t *testing.T) {
+		store := NewKVConvergenceStore(kvstore.NewFakeKVStore())
+		assert.True(t, observe(t, store, namespace, 0))
+		assert.False(t, observe(t, store, namespace, 0))
+	})
+
+	t.Run("should keep state across stores sharing the kvstore", func(t *testing.T) {
+		kv := kvstore.NewFakeKVStore()
+		assert.False(t, observe(t, NewKVConvergenceStore(kv), namespace, 1))
+		assert.True(t, observe(t, NewKVConvergenceStore(kv), namespace, 0))
+		// a restarted or other instance doesn't fire again
+		assert.False(t, observe(t, NewKVConvergenceStore(kv), namespace, 0))
+	})
+
+	t.Run("should track namespaces separately", func(t *testing.T) {
+		store := NewKVConvergenceStore(kvstore.NewFakeKVStore())
+		other := claims.OrgNamespaceFormatter(3)
+		assert.False(t, observe(t, store, namespace, 1))
+		assert.True(t, observe(t, store, other, 0))
+		assert.True(t, observe(t, store, namespace, 0))
+	})
+}
+
+func TestReconcileNamespace_Convergence(t *testing.T) {
+	namespace := claims.OrgNamespaceFormatter(42)
+	clk := clock.NewMock()
+	store := NewKVConvergenceStore(kvstore.NewFakeKVStore())
+
+	client := newFakeZanzanaClient()
+	r := NewZanzanaReconciler(client, nil, nil, WithConvergenceStore(store), WithClock(clk))
+	r.reconcilers = []resourceReconciler{
+		newResourceReconciler("test", staticCollector(common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")), zanzanaCollector(zanzana.FolderRelations), client),
+	}
+	for i := range r.reconcilers {
+		r.reconcilers[i].cfg = r.cfg
+	}
+
+	// first run writes the missing tuple
+	r.reconcileNamespace(context.Background(), namespace)
+	state, _, err := store.GetConvergence(context.Background(), namespace)
+	require.NoError(t, err)
+	assert.False(t, state.Converged())
+	assert.Equal(t, 1, state.DriftedRuns)
+
+	// second run has nothing to change
+	r.reconcileNamespace(context.Background(), namespace)
+	state, _, err = store.GetConvergence(context.Background(), namespace)
+	require.NoError(t, err)
+	assert.True(t, state.Converged())
+	assert.True(t, clk.Now().Equal(state.ConvergedAt))
+}
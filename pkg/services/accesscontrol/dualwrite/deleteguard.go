@@ -0,0 +1,115 @@
+package dualwrite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+)
+
+// errMassDeletion is returned by reconcilers aborted because they would delete a larger fraction
+// of the stored tuples of an object type than allowed. This is likely caused by a bug or data
+// loss in legacy and should be investigated before deletes are applied.
+var errMassDeletion = errors.New("mass deletion")
+
+// objectChanges are the changes needed to reconcile the stored tuples of a single object.
+type objectChanges struct {
+	writes  []*openfgav1.TupleKey
+	deletes []*openfgav1.TupleKeyWithoutCondition
+	updates []*openfgav1.TupleKeyWithoutCondition
+	// restores are the stored tuples of updates, they are written back if an update fails.
+	restores []*openfgav1.TupleKey
+	// stored is the number of tuples of the object read from zanzana.
+	stored int
+}
+
+// reconcilePlan holds the changes of a run computed before any of them is applied, so the run
+// can be aborted before it deletes too many tuples.
+type reconcilePlan struct {
+	changes map[string]*objectChanges
+	orphans []*openfgav1.TupleKeyWithoutCondition
+	// result holds the deletions and stored tuples of the plan, see checkDeleteFraction.
+	result ReconcileResult
+}
+
+// objectChanges returns the planned changes of object, or nil if there is no plan.
+func (p *reconcilePlan) objectChanges(object string) *objectChanges {
+	if p == nil {
+		return nil
+	}
+	return p.changes[object]
+}
+
+// planChanges computes the changes of objects and the orphaned tuples to delete without applying
+// them. Changes made in zanzana after an object is planned are corrected by the next run.
+func (r resourceReconciler) planChanges(
+	ctx context.Context,
+	namespace string,
+	objects []string,
+	res map[string]map[string]*openfgav1.TupleKey,
+	report *ReconcileReport,
+	sweep bool,
+) (*reconcilePlan, error) {
+	plan := &reconcilePlan{changes: make(map[string]*objectChanges, len(objects))}
+	for _, object := range objects {
+		changes, err := r.computeChanges(ctx, namespace, object, res[object], report)
+		if err != nil {
+			return nil, err
+		}
+		plan.changes[object] = changes
+		plan.result.countStored(object, changes.stored)
+		plan.result.Deletions = append(plan.result.Deletions, changes.deletes...)
+	}
+
+	if sweep || r.tracksObjects() {
+		orphans, err := r.orphanDeletes(ctx, namespace, res, report, sweep)
+		if err != nil {
+			return nil, err
+		}
+		for _, tuple := range orphans {
+			plan.result.countStored(tuple.Object, 1)
+		}
+		plan.orphans = orphans
+		plan.result.Deletions = append(plan.result.Deletions, orphans...)
+	}
+	return plan, nil
+}
+
+// checkDeleteFraction compares the deletions of result with the tuples stored per object type.
+// Tuples replaced by an updated condition are not counted as they are written again.
+func checkDeleteFraction(result *ReconcileResult, maxFraction float64) error {
+	deletes := make(map[string]int)
+	for _, t := range result.Deletions {
+		objectType, _, _ := strings.Cut(t.GetObject(), ":")
+		deletes[objectType]++
+	}
+
+	objectTypes := make([]string, 0, len(deletes))
+	for objectType := range deletes {
+		objectTypes = append(objectTypes, objectType)
+	}
+	slices.Sort(objectTypes)
+
+	for _, objectType := range objectTypes {
+		stored := result.stored[objectType]
+		if stored == 0 {
+			continue
+		}
+		if fraction := float64(deletes[objectType]) / float64(stored); fraction > maxFraction {
+			return fmt.Errorf("%w: would delete %d of %d %s tuples", errMassDeletion, deletes[objectType], stored, objectType)
+		}
+	}
+	return nil
+}
+
+// countStored adds n tuples of object read from zanzana to the stored tuples of its object type.
+func (r *ReconcileResult) countStored(object string, n int) {
+	if r.stored == nil {
+		r.stored = make(map[string]int)
+	}
+	objectType, _, _ := strings.Cut(object, ":")
+	r.stored[objectType] += n
+}
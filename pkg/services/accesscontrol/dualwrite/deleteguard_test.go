@@ -0,0 +1,120 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestResourceReconciler_MaxDeleteFraction(t *testing.T) {
+	const namespace = "default"
+
+	seed := func(client *fakeZanzanaClient) {
+		client.seed(namespace,
+			common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("user:2", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("user:3", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("user:4", zanzana.RelationRead, "f1"),
+		)
+	}
+
+	t.Run("should abort without changes when too many tuples would be deleted", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		seed(client)
+
+		// only one of four tuples is still in legacy, a new one is added
+		legacy := staticCollector(
+			common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("user:5", zanzana.RelationRead, "f1"),
+		)
+		r := newResourceReconciler("test", legacy, zanzanaCollector(zanzana.FolderRelations), client)
+		r.cfg.maxDeleteFraction = 0.5
+
+		_, err := r.reconcile(context.Background(), namespace)
+		require.ErrorIs(t, err, errMassDeletion)
+		assert.Contains(t, err.Error(), "would delete 3 of 4 folder tuples")
+		assert.Empty(t, client.writes)
+		assert.Len(t, client.stored(namespace), 4)
+	})
+
+	t.Run("should apply changes when deletes are within the fraction", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		seed(client)
+
+		legacy := staticCollector(
+			common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("user:2", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("user:3", zanzana.RelationRead, "f1"),
+		)
+		r := newResourceReconciler("test", legacy, zanzanaCollector(zanzana.FolderRelations), client)
+		r.cfg.maxDeleteFraction = 0.5
+
+		report, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Deletes)
+		assert.Len(t, client.stored(namespace), 3)
+	})
+
+	t.Run("should count tuples of orphaned objects", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		client.seed(namespace,
+			common.NewResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d1"),
+			common.NewResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d2"),
+			common.NewResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d3"),
+		)
+
+		// d2 and d3 have been deleted
+		cfg := newReconcileConfig()
+		legacy := staticCollector(common.NewResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d1"))
+		r := newResourceReconciler("test", legacy, zanzanaCollector(zanzana.ResourceRelations), client).
+			withOrphans(orphanCollector(zanzana.KindDashboards, cfg, zanzana.ResourceRelations))
+		r.cfg.maxDeleteFraction = 0.5
+
+		_, err := r.reconcile(context.Background(), namespace)
+		require.ErrorIs(t, err, errMassDeletion)
+		assert.Len(t, client.stored(namespace), 3)
+	})
+
+	t.Run("should collect legacy and zanzana tuples once", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		seed(client)
+
+		collected := 0
+		legacy := func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+			collected++
+			return staticCollector(common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"))(ctx, orgId)
+		}
+		read := 0
+		stored := func(ctx context.Context, client zanzana.Client, object, namespace string) (map[string]*openfgav1.TupleKey, error) {
+			read++
+			return zanzanaCollector(zanzana.FolderRelations)(ctx, client, object, namespace)
+		}
+		r := newResourceReconciler("test", legacy, stored, client)
+		r.cfg.maxDeleteFraction = 0.8
+
+		report, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 3, report.Deletes)
+		assert.Len(t, client.stored(namespace), 1)
+		assert.Equal(t, 1, collected)
+		assert.Equal(t, 1, read)
+	})
+
+	t.Run("should not guard deletes when disabled", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		seed(client)
+
+		legacy := staticCollector(common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"))
+		r := newResourceReconciler("test", legacy, zanzanaCollector(zanzana.FolderRelations), client)
+		report, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 3, report.Deletes)
+		assert.Len(t, client.stored(namespace), 1)
+	})
+}
@@ -0,0 +1,70 @@
+package dualwrite
+
+import (
+	"sort"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+)
+
+// LegacyOnlyTuples returns tuples that exist in legacy but not in zanzana, e.g. what has not been
+// migrated yet. Tuples are expected to be grouped by object and keyed the same way the collectors do.
+// For folder resource and subresource tuples only the part of the condition missing in zanzana is returned.
+func LegacyOnlyTuples(legacy, zanzanaTuples map[string]map[string]*openfgav1.TupleKey) []*openfgav1.TupleKey {
+	var out []*openfgav1.TupleKey
+	for object, tuples := range legacy {
+		for key, t := range tuples {
+			stored, ok := zanzanaTuples[object][key]
+			if !ok {
+				out = append(out, t)
+				continue
+			}
+
+			if !isMergeableTuple(t) {
+				continue
+			}
+
+			if missing := missingConditionValues(t, stored); len(missing) > 0 {
+				partial := proto.Clone(t).(*openfgav1.TupleKey)
+				partial.Condition.Context.Fields[mergedConditionField(t)] = structpb.NewListValue(&structpb.ListValue{Values: missing})
+				out = append(out, partial)
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].String() < out[j].String()
+	})
+
+	return out
+}
+
+// mergedConditionField returns the condition field holding the merged values of a mergeable tuple.
+func mergedConditionField(t *openfgav1.TupleKey) string {
+	if zanzana.IsSubresourceTuple(t) {
+		return "subresources"
+	}
+	return "group_resources"
+}
+
+// missingConditionValues returns merged condition values of want that are not present in have.
+func missingConditionValues(want, have *openfgav1.TupleKey) []*structpb.Value {
+	field := mergedConditionField(want)
+
+	existing := make(map[string]struct{})
+	for _, v := range have.GetCondition().GetContext().GetFields()[field].GetListValue().GetValues() {
+		existing[v.GetStringValue()] = struct{}{}
+	}
+
+	var missing []*structpb.Value
+	for _, v := range want.GetCondition().GetContext().GetFields()[field].GetListValue().GetValues() {
+		if _, ok := existing[v.GetStringValue()]; !ok {
+			missing = append(missing, v)
+		}
+	}
+
+	return missing
+}
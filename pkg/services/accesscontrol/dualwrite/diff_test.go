@@ -0,0 +1,56 @@
+package dualwrite
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestLegacyOnlyTuples(t *testing.T) {
+	migrated := common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")
+	notMigrated := common.NewFolderTuple("user:2", zanzana.RelationRead, "f1")
+
+	legacy := MergeImported(nil, []*openfgav1.TupleKey{
+		migrated,
+		notMigrated,
+		common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"),
+		common.NewFolderResourceTuple("user:1", zanzana.RelationRead, "rules.alerting.grafana.app", "alertrules", "f1"),
+		common.NewFolderResourceTuple("user:1", zanzana.RelationWrite, dashboardGroup, dashboardResource, "f1"),
+	})
+
+	stored := MergeImported(nil, []*openfgav1.TupleKey{
+		migrated,
+		common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"),
+		common.NewFolderResourceTuple("user:1", zanzana.RelationWrite, dashboardGroup, dashboardResource, "f1"),
+		common.NewFolderTuple("user:3", zanzana.RelationRead, "f1"),
+	})
+
+	tuples := LegacyOnlyTuples(legacy, stored)
+	require.Len(t, tuples, 2)
+
+	var partial *openfgav1.TupleKey
+	for _, tuple := range tuples {
+		if zanzana.IsFolderResourceTuple(tuple) {
+			partial = tuple
+			continue
+		}
+		assert.Equal(t, notMigrated.String(), tuple.String())
+	}
+
+	require.NotNil(t, partial)
+	assert.Equal(t, zanzana.RelationFolderResourceRead, partial.Relation)
+	// only the group resource not yet in zanzana should be reported
+	assert.Equal(t, []string{"rules.alerting.grafana.app/alertrules"}, groupResources(partial))
+
+	// legacy tuples should not be modified
+	for _, tuple := range legacy["folder:f1"] {
+		if tuple.Relation == zanzana.RelationFolderResourceRead {
+			assert.Len(t, groupResources(tuple), 2)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package dualwrite
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+const (
+	// droppedResourceDeleted is used for permissions on resources that are deleted but retained.
+	droppedResourceDeleted = "resource deleted"
+	// droppedSelfGrant is used for grants of a team on itself, members can always read their team.
+	droppedSelfGrant = "self grant"
+	// droppedNotAllResources is used for basic role permissions not granted on all resources of a kind.
+	droppedNotAllResources = "not granted on all resources"
+	// droppedUnmigratableScopeTemplate is used for permissions with a scope template. Templates
+	// are filled in from the request when a permission is evaluated, there is no object to
+	// write a tuple for so they can't be migrated.
+	droppedUnmigratableScopeTemplate = "unmigratable scope template"
+	// droppedRelationNotAllowed is used for tuples with a relation excluded by a relation allow list.
+	droppedRelationNotAllowed = "relation not allowed"
+)
+
+// DroppedTuple is a tuple that was collected but not reconciled, or a legacy permission that
+// could not be translated into one. For permissions Object is the legacy scope and Relation the
+// legacy action, Subject is empty if it could not be resolved.
+type DroppedTuple struct {
+	Object   string `json:"object"`
+	Relation string `json:"relation"`
+	Subject  string `json:"subject,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// DroppedTupleSink receives every dropped tuple. Orgs are reconciled concurrently so it must be
+// safe for concurrent use.
+type DroppedTupleSink func(dropped DroppedTuple)
+
+// NewNDJSONDroppedTupleSink returns a sink writing every dropped tuple as a line of JSON to w.
+// Write errors are ignored, the sink is informational.
+func NewNDJSONDroppedTupleSink(w io.Writer) DroppedTupleSink {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(dropped DroppedTuple) {
+		mu.Lock()
+		defer mu.Unlock()
+		_ = enc.Encode(dropped)
+	}
+}
+
+// drop records a dropped tuple, nothing is recorded if s is nil.
+func (s DroppedTupleSink) drop(object, relation, subject, reason string) {
+	if s == nil {
+		return
+	}
+	s(DroppedTuple{Object: object, Relation: relation, Subject: subject, Reason: reason})
+}
+
+// dropPermission records a managed permission that was not translated.
+func (s DroppedTupleSink) dropPermission(p managedPermission, subject, reason string) {
+	s.drop(p.Scope, p.Action, subject, reason)
+}
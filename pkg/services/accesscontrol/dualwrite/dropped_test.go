@@ -0,0 +1,103 @@
+package dualwrite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/accesscontrol"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestDroppedTupleSink(t *testing.T) {
+	var dropped []DroppedTuple
+	sink := DroppedTupleSink(func(d DroppedTuple) {
+		dropped = append(dropped, d)
+	})
+
+	reasons := func() []string {
+		out := make([]string, 0, len(dropped))
+		for _, d := range dropped {
+			out = append(out, d.Reason)
+		}
+		return out
+	}
+
+	t.Run("should record dropped managed permissions", func(t *testing.T) {
+		dropped = nil
+		permissions := filterDeletedResources([]managedPermission{
+			{Action: "dashboards:read", Scope: "dashboards:uid:d1", Kind: zanzana.KindDashboards, Identifier: "d1", UserUID: "u1", ResourceDeleted: true},
+			{Action: "dashboards:read", Scope: "dashboards:uid:d2", Kind: zanzana.KindDashboards, Identifier: "d2", BuiltinRole: "Grafana Admin"},
+			{Action: "grafana-slo-app.slo:read", Scope: "slos:uid:s1", Kind: "slos", Identifier: "s1", UserUID: "u1"},
+			{Action: "dashboards:explode", Scope: "dashboards:uid:d3", Kind: zanzana.KindDashboards, Identifier: "d3", UserUID: "u1"},
+		}, false, sink)
+		tuples := managedPermissionTuples(permissions, zanzana.TranslationLatest, sink)
+
+		assert.Empty(t, tuples)
+		assert.Equal(t, []string{
+			droppedResourceDeleted,
+			droppedUnsupportedSubject,
+			zanzana.ErrUnsupportedKind.Error(),
+			zanzana.ErrUnsupportedAction.Error(),
+		}, reasons())
+		assert.Equal(t, DroppedTuple{Object: "dashboards:uid:d1", Relation: "dashboards:read", Subject: "user:u1", Reason: droppedResourceDeleted}, dropped[0])
+	})
+
+	t.Run("should record dropped team visibility grants", func(t *testing.T) {
+		dropped = nil
+		teamVisibilityTuples([]string{"t1"}, []teamVisibilityGrant{
+			{SubjectUID: "t1", TeamUID: "t1", Action: "teams:read"},
+		}, zanzana.TranslationLatest, sink)
+
+		require.Len(t, dropped, 1)
+		assert.Equal(t, DroppedTuple{Object: "team:t1", Relation: "teams:read", Subject: "team:t1#member", Reason: droppedSelfGrant}, dropped[0])
+	})
+
+	t.Run("should record dropped basic role permissions", func(t *testing.T) {
+		dropped = nil
+		basicRolePermissionTuples(map[string][]accesscontrol.Permission{
+			"Viewer": {{Action: "dashboards:read", Scope: "dashboards:uid:d1"}},
+		}, zanzana.TranslationLatest, sink)
+
+		assert.Equal(t, []string{droppedNotAllResources}, reasons())
+	})
+
+	t.Run("should record tuples with relations that are not allowed", func(t *testing.T) {
+		dropped = nil
+		client := newFakeZanzanaClient()
+		r := newResourceReconciler("test", staticCollector(common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")), zanzanaCollector(zanzana.FolderRelations), client)
+		r.cfg.relationAllowLists[zanzana.TypeFolder] = map[string]struct{}{zanzana.RelationParent: {}}
+		r.cfg.droppedTuples = sink
+
+		_, err := r.reconcile(context.Background(), "default")
+		require.NoError(t, err)
+		assert.Equal(t, []DroppedTuple{{Object: "folder:f1", Relation: zanzana.RelationRead, Subject: "user:1", Reason: droppedRelationNotAllowed}}, dropped)
+	})
+
+	t.Run("should write dropped tuples as ndjson", func(t *testing.T) {
+		var buf bytes.Buffer
+		ndjson := NewNDJSONDroppedTupleSink(&buf)
+		ndjson.drop("folder:f1", zanzana.RelationRead, "user:1", droppedRelationNotAllowed)
+		ndjson.drop("team:t1", "teams:read", "team:t1#member", droppedSelfGrant)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 2)
+
+		var d DroppedTuple
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &d))
+		assert.Equal(t, DroppedTuple{Object: "team:t1", Relation: "teams:read", Subject: "team:t1#member", Reason: droppedSelfGrant}, d)
+	})
+
+	t.Run("should not record without a sink", func(t *testing.T) {
+		var sink DroppedTupleSink
+		assert.NotPanics(t, func() {
+			sink.drop("folder:f1", zanzana.RelationRead, "user:1", droppedRelationNotAllowed)
+		})
+	})
+}
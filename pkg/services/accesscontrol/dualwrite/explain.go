@@ -0,0 +1,128 @@
+package dualwrite
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+)
+
+// ErrUnsupportedTupleSource is returned when a tuple is not collected from team memberships or managed permissions.
+var ErrUnsupportedTupleSource = errors.New("tuple source can't be explained")
+
+// TupleSource is a legacy row a tuple was collected from.
+type TupleSource struct {
+	// Table is the table the row was read from.
+	Table string
+	// Row holds the columns of the row that were used to build the tuple.
+	Row map[string]string
+}
+
+// ExplainTuple looks up the legacy rows of org that tuple was collected from. Folder resource and
+// subresource tuples are merged from several rows so more than one source can be returned.
+// No sources are returned if tuple is not backed by any row, e.g. when it is stale.
+func ExplainTuple(ctx context.Context, store db.DB, orgId int64, tuple *openfgav1.TupleKey) ([]TupleSource, error) {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.ExplainTuple")
+	defer span.End()
+
+	if isTeamMembershipTuple(tuple) {
+		query := `
+			SELECT t.uid as team_uid, u.uid as user_uid, u.is_service_account, tm.permission
+			FROM team_member tm
+			INNER JOIN team t ON tm.team_id = t.id
+			INNER JOIN ` + store.GetDialect().Quote("user") + ` u ON tm.user_id = u.id
+			WHERE t.org_id = ? AND t.uid = ?
+		`
+
+		var memberships []teamMembership
+		err := store.WithDbSession(ctx, func(sess *db.Session) error {
+			return sess.SQL(query, orgId, strings.TrimPrefix(tuple.Object, zanzana.TypeTeam+":")).Find(&memberships)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return explainTeamMemberships(memberships, tuple), nil
+	}
+
+	if strings.HasPrefix(tuple.Object, zanzana.TypeTeam+":") {
+		return nil, ErrUnsupportedTupleSource
+	}
+
+	version, err := detectLegacySchema(storeColumnLister(store))
+	if err != nil {
+		return nil, err
+	}
+
+	query := managedPermissionsQuery(store, version) + `
+		AND r.org_id = ?
+	`
+
+	var permissions []managedPermission
+	err = store.WithDbSession(ctx, func(sess *db.Session) error {
+		return sess.SQL(query, orgId).Find(&permissions)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return explainManagedPermissions(normalizeScopes(permissions), tuple, zanzana.TranslationLatest), nil
+}
+
+func isTeamMembershipTuple(tuple *openfgav1.TupleKey) bool {
+	return strings.HasPrefix(tuple.Object, zanzana.TypeTeam+":") &&
+		(tuple.Relation == zanzana.RelationTeamMember || tuple.Relation == zanzana.RelationTeamAdmin)
+}
+
+// explainTeamMemberships returns the memberships that are translated into tuple.
+func explainTeamMemberships(memberships []teamMembership, tuple *openfgav1.TupleKey) []TupleSource {
+	var sources []TupleSource
+	for _, m := range memberships {
+		if tupleKey(teamMembershipTuple(m)) != tupleKey(tuple) {
+			continue
+		}
+
+		sources = append(sources, TupleSource{
+			Table: "team_member",
+			Row: map[string]string{
+				"team_uid":           m.TeamUID,
+				"user_uid":           m.UserUID,
+				"is_service_account": strconv.FormatBool(m.IsServiceAccount),
+				"permission":         strconv.Itoa(m.Permission),
+			},
+		})
+	}
+	return sources
+}
+
+// explainManagedPermissions returns the permissions that are translated into tuple. Conditions
+// are not compared as permissions merged into the same tuple only differ in their condition.
+func explainManagedPermissions(permissions []managedPermission, tuple *openfgav1.TupleKey, version zanzana.TranslationVersion) []TupleSource {
+	var sources []TupleSource
+	for i, entry := range auditManagedPermissions(permissions, version) {
+		if entry.Tuple == nil || tupleKey(entry.Tuple) != tupleKey(tuple) {
+			continue
+		}
+
+		p := permissions[i]
+		sources = append(sources, TupleSource{
+			Table: "permission",
+			Row: map[string]string{
+				"role_name":          p.RoleName,
+				"action":             p.Action,
+				"kind":               p.Kind,
+				"identifier":         p.Identifier,
+				"user_uid":           p.UserUID,
+				"is_service_account": strconv.FormatBool(p.IsServiceAccount),
+				"team_uid":           p.TeamUID,
+				"builtin_role":       p.BuiltinRole,
+			},
+		})
+	}
+	return sources
+}
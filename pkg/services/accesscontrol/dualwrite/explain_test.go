@@ -0,0 +1,73 @@
+package dualwrite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestExplainTeamMemberships(t *testing.T) {
+	memberships := []teamMembership{
+		{TeamUID: "t1", UserUID: "u1", Permission: 0},
+		{TeamUID: "t1", UserUID: "u2", Permission: 4},
+	}
+
+	t.Run("should return membership row of member tuple", func(t *testing.T) {
+		sources := explainTeamMemberships(memberships, common.NewTypedTuple(zanzana.TypeTeam, "user:u1", zanzana.RelationTeamMember, "t1"))
+		require.Len(t, sources, 1)
+		assert.Equal(t, TupleSource{
+			Table: "team_member",
+			Row:   map[string]string{"team_uid": "t1", "user_uid": "u1", "is_service_account": "false", "permission": "0"},
+		}, sources[0])
+	})
+
+	t.Run("should return membership row of admin tuple", func(t *testing.T) {
+		sources := explainTeamMemberships(memberships, common.NewTypedTuple(zanzana.TypeTeam, "user:u2", zanzana.RelationTeamAdmin, "t1"))
+		require.Len(t, sources, 1)
+		assert.Equal(t, "4", sources[0].Row["permission"])
+	})
+
+	t.Run("should not return anything for stale tuple", func(t *testing.T) {
+		sources := explainTeamMemberships(memberships, common.NewTypedTuple(zanzana.TypeTeam, "user:u2", zanzana.RelationTeamMember, "t1"))
+		assert.Empty(t, sources)
+	})
+}
+
+func TestExplainManagedPermissions(t *testing.T) {
+	permissions := []managedPermission{
+		{RoleName: "managed:users:1:permissions", Action: "dashboards:read", Kind: zanzana.KindDashboards, Identifier: "d1", UserUID: "u1"},
+		{RoleName: "managed:teams:1:permissions", Action: "dashboards:read", Kind: zanzana.KindFolders, Identifier: "f1", TeamUID: "t1"},
+		{RoleName: "managed:teams:1:permissions", Action: "alert.rules:read", Kind: zanzana.KindFolders, Identifier: "f1", TeamUID: "t1"},
+		{RoleName: "managed:teams:1:permissions", Action: "folders:read", Kind: zanzana.KindFolders, Identifier: "f1", TeamUID: "t1"},
+	}
+
+	t.Run("should return permission row of resource tuple", func(t *testing.T) {
+		tuple := common.NewResourceTuple("user:u1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d1")
+		sources := explainManagedPermissions(permissions, tuple, zanzana.TranslationLatest)
+		require.Len(t, sources, 1)
+		assert.Equal(t, "permission", sources[0].Table)
+		assert.Equal(t, "managed:users:1:permissions", sources[0].Row["role_name"])
+		assert.Equal(t, "dashboards:read", sources[0].Row["action"])
+		assert.Equal(t, "d1", sources[0].Row["identifier"])
+	})
+
+	t.Run("should return every permission row merged into folder resource tuple", func(t *testing.T) {
+		tuple := common.NewFolderResourceTuple("team:t1#member", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")
+		sources := explainManagedPermissions(permissions, tuple, zanzana.TranslationLatest)
+
+		actions := make([]string, 0, len(sources))
+		for _, s := range sources {
+			actions = append(actions, s.Row["action"])
+		}
+		assert.ElementsMatch(t, []string{"dashboards:read", "alert.rules:read"}, actions)
+	})
+
+	t.Run("should not return anything for stale tuple", func(t *testing.T) {
+		tuple := common.NewResourceTuple("user:u2", zanzana.RelationRead, dashboardGroup, dashboardResource, "d1")
+		assert.Empty(t, explainManagedPermissions(permissions, tuple, zanzana.TranslationLatest))
+	})
+}
@@ -0,0 +1,49 @@
+package dualwrite
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+// fetchCursor is the name of the cursor rows are fetched from, a session runs one query at a time.
+const fetchCursor = "zanzana_collect"
+
+// supportsFetchSize returns true for dialects where rows can be fetched in batches of a given
+// size. Other drivers either stream rows on their own or run in-process.
+func supportsFetchSize(driver string) bool {
+	return driver == migrator.Postgres
+}
+
+// fetchRows runs query and appends all rows to dest. When fetchSize is set and supported by the
+// driver, rows are fetched through a cursor fetchSize rows per round trip, otherwise they are
+// read with a single query. The session must be transactional for cursors to be used. Returns
+// the number of round trips made.
+func fetchRows(sess *db.Session, driver string, fetchSize int, dest any, query string, args ...any) (int, error) {
+	if fetchSize <= 0 || !supportsFetchSize(driver) {
+		return 1, sess.SQL(query, args...).Find(dest)
+	}
+
+	if _, err := sess.Exec(append([]any{"DECLARE " + fetchCursor + " NO SCROLL CURSOR FOR " + query}, args...)...); err != nil {
+		return 0, err
+	}
+
+	rows := reflect.ValueOf(dest).Elem()
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM %s", fetchSize, fetchCursor)
+	trips := 0
+	for {
+		n := rows.Len()
+		if err := sess.SQL(fetch).Find(dest); err != nil {
+			return trips, err
+		}
+		trips++
+		if rows.Len()-n < fetchSize {
+			break
+		}
+	}
+
+	_, err := sess.Exec("CLOSE " + fetchCursor)
+	return trips, err
+}
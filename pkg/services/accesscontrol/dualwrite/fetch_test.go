@@ -0,0 +1,85 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+func TestSupportsFetchSize(t *testing.T) {
+	assert.True(t, supportsFetchSize(migrator.Postgres))
+	assert.False(t, supportsFetchSize(migrator.MySQL))
+	assert.False(t, supportsFetchSize(migrator.SQLite))
+}
+
+func TestIntegrationFetchRows(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	sql := db.InitTestDB(t)
+	err := sql.WithDbSession(context.Background(), func(sess *db.Session) error {
+		for i := int64(1); i <= 5; i++ {
+			if _, err := sess.Exec(
+				"INSERT INTO team_member (org_id, team_id, user_id, created, updated) VALUES (?, ?, ?, ?, ?)",
+				1, 1, i, time.Now(), time.Now(),
+			); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	driver := sql.GetDialect().DriverName()
+	query := "SELECT user_id FROM team_member WHERE org_id = ? ORDER BY user_id"
+
+	fetch := func(t *testing.T, fetchSize int) ([]int64, int) {
+		t.Helper()
+		cfg := newReconcileConfig()
+		cfg.fetchSize = fetchSize
+		store := newReadOnlyStore(sql, cfg)
+
+		var ids []int64
+		var trips int
+		err := store.WithDbSession(context.Background(), func(sess *db.Session) error {
+			var err error
+			trips, err = fetchRows(sess, driver, fetchSize, &ids, query, 1)
+			return err
+		})
+		require.NoError(t, err)
+		return ids, trips
+	}
+
+	t.Run("should read all rows at once without fetch size", func(t *testing.T) {
+		ids, trips := fetch(t, 0)
+		assert.Equal(t, []int64{1, 2, 3, 4, 5}, ids)
+		assert.Equal(t, 1, trips)
+	})
+
+	t.Run("should apply fetch size where supported", func(t *testing.T) {
+		ids, trips := fetch(t, 2)
+		assert.Equal(t, []int64{1, 2, 3, 4, 5}, ids)
+		if supportsFetchSize(driver) {
+			assert.Equal(t, 3, trips)
+		} else {
+			assert.Equal(t, 1, trips)
+		}
+	})
+
+	t.Run("should fetch a final empty batch when rows are a multiple of the fetch size", func(t *testing.T) {
+		ids, trips := fetch(t, 5)
+		assert.Equal(t, []int64{1, 2, 3, 4, 5}, ids)
+		if supportsFetchSize(driver) {
+			assert.Equal(t, 2, trips)
+		} else {
+			assert.Equal(t, 1, trips)
+		}
+	})
+}
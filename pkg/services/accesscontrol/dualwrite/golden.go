@@ -0,0 +1,126 @@
+package dualwrite
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// GoldenDelta holds the differences between the tuples collected for an org and a golden
+// fixture of expected tuples. Tuples with a different condition are both missing and unexpected.
+type GoldenDelta struct {
+	// Missing are tuples of the fixture that were not collected.
+	Missing []*openfgav1.TupleKey
+	// Unexpected are collected tuples that are not in the fixture.
+	Unexpected []*openfgav1.TupleKey
+}
+
+// Empty returns true if the collected tuples match the fixture.
+func (d *GoldenDelta) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Unexpected) == 0
+}
+
+// LoadGoldenFixture decodes a golden fixture, a JSON array of tuples encoded like the tuples of
+// a ReconcileResult.
+func LoadGoldenFixture(r io.Reader) ([]*openfgav1.TupleKey, error) {
+	var in []tupleJSON
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return nil, err
+	}
+
+	tuples := make([]*openfgav1.TupleKey, 0, len(in))
+	for _, t := range in {
+		tuple, err := t.tupleKey()
+		if err != nil {
+			return nil, err
+		}
+		tuples = append(tuples, tuple)
+	}
+	return tuples, nil
+}
+
+// WriteGoldenFixture encodes tuples as a golden fixture. Tuples are sorted so fixtures of the
+// same dataset are identical.
+func WriteGoldenFixture(w io.Writer, tuples []*openfgav1.TupleKey) error {
+	out := make([]tupleJSON, 0, len(tuples))
+	for _, t := range tuples {
+		out = append(out, newTupleJSON(t))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Object != out[j].Object {
+			return out[i].Object < out[j].Object
+		}
+		if out[i].Relation != out[j].Relation {
+			return out[i].Relation < out[j].Relation
+		}
+		return out[i].Subject < out[j].Subject
+	})
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// VerifyGoldenFixture runs the legacy collectors of all reconcilers for org and compares the
+// collected tuples with golden. It is used for regression testing against a seeded dataset,
+// nothing is read from or written to zanzana.
+func (r *ZanzanaReconciler) VerifyGoldenFixture(ctx context.Context, orgId int64, golden []*openfgav1.TupleKey) (*GoldenDelta, error) {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.VerifyGoldenFixture")
+	defer span.End()
+
+	collected := make(map[string]map[string]*openfgav1.TupleKey)
+	for _, reconciler := range r.reconcilers {
+		tuples, err := reconciler.legacy(ctx, orgId)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range tuples {
+			for _, t := range object {
+				putTuple(collected, t)
+			}
+		}
+	}
+
+	return compareGolden(collected, golden), nil
+}
+
+// compareGolden returns the tuples of golden missing from collected and the collected tuples
+// not in golden, both sorted.
+func compareGolden(collected map[string]map[string]*openfgav1.TupleKey, golden []*openfgav1.TupleKey) *GoldenDelta {
+	delta := &GoldenDelta{}
+
+	expected := make(map[string]map[string]*openfgav1.TupleKey)
+	for _, t := range golden {
+		putTuple(expected, t)
+	}
+
+	for object, tuples := range expected {
+		for key, t := range tuples {
+			actual, ok := collected[object][key]
+			if !ok || !proto.Equal(t.GetCondition(), actual.GetCondition()) {
+				delta.Missing = append(delta.Missing, t)
+			}
+		}
+	}
+
+	for object, tuples := range collected {
+		for key, t := range tuples {
+			want, ok := expected[object][key]
+			if !ok || !proto.Equal(t.GetCondition(), want.GetCondition()) {
+				delta.Unexpected = append(delta.Unexpected, t)
+			}
+		}
+	}
+
+	sort.Slice(delta.Missing, func(i, j int) bool {
+		return delta.Missing[i].String() < delta.Missing[j].String()
+	})
+	sort.Slice(delta.Unexpected, func(i, j int) bool {
+		return delta.Unexpected[i].String() < delta.Unexpected[j].String()
+	})
+	return delta
+}
@@ -0,0 +1,84 @@
+package dualwrite
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestVerifyGoldenFixture(t *testing.T) {
+	fixture, err := os.Open("testdata/golden_tuples.json")
+	require.NoError(t, err)
+	defer func() { _ = fixture.Close() }()
+
+	golden, err := LoadGoldenFixture(fixture)
+	require.NoError(t, err)
+	require.Len(t, golden, 4)
+
+	newReconciler := func(folders ...*openfgav1.TupleKey) *ZanzanaReconciler {
+		return &ZanzanaReconciler{
+			log: log.NewNopLogger(),
+			cfg: newReconcileConfig(),
+			reconcilers: []resourceReconciler{
+				newResourceReconciler("team memberships", staticCollector(
+					teamMembershipTuple(teamMembership{TeamUID: "t1", UserUID: "u1"}),
+				), nil, nil),
+				newResourceReconciler("folders", staticCollector(folders...), nil, nil),
+			},
+		}
+	}
+
+	t.Run("should pass for a matching dataset", func(t *testing.T) {
+		r := newReconciler(
+			common.NewFolderParentTuple("f2", "f1"),
+			common.NewFolderTuple("user:u1", zanzana.RelationRead, "f1"),
+			common.NewFolderResourceTuple("team:t1#member", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"),
+		)
+
+		delta, err := r.VerifyGoldenFixture(context.Background(), 1, golden)
+		require.NoError(t, err)
+		assert.True(t, delta.Empty())
+	})
+
+	t.Run("should report the delta of a modified dataset", func(t *testing.T) {
+		r := newReconciler(
+			common.NewFolderParentTuple("f2", "f1"),
+			common.NewFolderTuple("user:u2", zanzana.RelationRead, "f1"),
+			// the team can read library panels as well
+			common.NewFolderResourceTuple("team:t1#member", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"),
+			common.NewFolderResourceTuple("team:t1#member", zanzana.RelationRead, dashboardGroup, "librarypanels", "f1"),
+		)
+
+		delta, err := r.VerifyGoldenFixture(context.Background(), 1, golden)
+		require.NoError(t, err)
+		assert.False(t, delta.Empty())
+
+		require.Len(t, delta.Missing, 2)
+		require.Len(t, delta.Unexpected, 2)
+		assert.ElementsMatch(t, []string{"user:u1", "team:t1#member"}, []string{delta.Missing[0].GetUser(), delta.Missing[1].GetUser()})
+		assert.ElementsMatch(t, []string{"user:u2", "team:t1#member"}, []string{delta.Unexpected[0].GetUser(), delta.Unexpected[1].GetUser()})
+	})
+
+	t.Run("should write a fixture that loads back", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteGoldenFixture(&buf, golden))
+
+		loaded, err := LoadGoldenFixture(&buf)
+		require.NoError(t, err)
+
+		delta := compareGolden(map[string]map[string]*openfgav1.TupleKey{}, loaded)
+		assert.Len(t, delta.Missing, len(golden))
+		for i := range golden {
+			assert.Equal(t, golden[i].String(), loaded[i].String())
+		}
+	})
+}
@@ -0,0 +1,95 @@
+package dualwrite
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana/pkg/infra/kvstore"
+)
+
+// historyKVNamespace is the kvstore namespace reconciliation history is persisted in.
+const historyKVNamespace = "zanzana.reconciler.history"
+
+// ReconcileRun is the summary of a reconciliation run of an org.
+type ReconcileRun struct {
+	// Timestamp is when the run started.
+	Timestamp time.Time `json:"timestamp"`
+	OrgID     int64     `json:"orgId"`
+	// SnapshotID is the snapshot id of the run, see ContextWithSnapshotID.
+	SnapshotID string `json:"snapshotId,omitempty"`
+	// Writes, Deletes and Updates are the changes applied by all reconcilers.
+	Writes  int `json:"writes"`
+	Deletes int `json:"deletes"`
+	Updates int `json:"updates"`
+	// Failed is the number of reconcilers that failed.
+	Failed int `json:"failed"`
+	// Halted is set when the run was stopped by a retry or time budget before all reconcilers ran.
+	Halted   bool          `json:"halted"`
+	Duration time.Duration `json:"duration"`
+}
+
+// ReconcileHistoryStore persists the summary of every reconciliation run for audit history.
+type ReconcileHistoryStore interface {
+	SaveRun(ctx context.Context, run ReconcileRun) error
+	// Runs returns up to limit runs of org, newest first. All runs are returned if limit is 0.
+	Runs(ctx context.Context, orgId int64, limit int) ([]ReconcileRun, error)
+}
+
+var _ ReconcileHistoryStore = (*KVHistoryStore)(nil)
+
+// KVHistoryStore persists runs in the kvstore, one entry per org and run keyed by when it started.
+type KVHistoryStore struct {
+	kv kvstore.KVStore
+}
+
+func NewKVHistoryStore(kv kvstore.KVStore) *KVHistoryStore {
+	return &KVHistoryStore{kv: kv}
+}
+
+func (s *KVHistoryStore) SaveRun(ctx context.Context, run ReconcileRun) error {
+	value, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+
+	return s.kv.Set(ctx, run.OrgID, historyKVNamespace, historyKey(run.Timestamp), string(value))
+}
+
+func (s *KVHistoryStore) Runs(ctx context.Context, orgId int64, limit int) ([]ReconcileRun, error) {
+	keys, err := s.kv.Keys(ctx, orgId, historyKVNamespace, "")
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Key > keys[j].Key
+	})
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	out := make([]ReconcileRun, 0, len(keys))
+	for _, key := range keys {
+		value, ok, err := s.kv.Get(ctx, orgId, historyKVNamespace, key.Key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		var run ReconcileRun
+		if err := json.Unmarshal([]byte(value), &run); err != nil {
+			return nil, err
+		}
+		out = append(out, run)
+	}
+	return out, nil
+}
+
+// historyKey formats timestamp so keys sort in the order runs started.
+func historyKey(timestamp time.Time) string {
+	return timestamp.UTC().Format("20060102T150405.000000000Z")
+}
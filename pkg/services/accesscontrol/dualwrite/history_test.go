@@ -0,0 +1,89 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/grafana/authlib/claims"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/kvstore"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestKVHistoryStore(t *testing.T) {
+	store := NewKVHistoryStore(kvstore.NewFakeKVStore())
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, store.SaveRun(context.Background(), ReconcileRun{Timestamp: start.Add(time.Duration(i) * time.Hour), OrgID: 2, Writes: i}))
+	}
+	require.NoError(t, store.SaveRun(context.Background(), ReconcileRun{Timestamp: start, OrgID: 3}))
+
+	runs, err := store.Runs(context.Background(), 2, 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 3)
+	assert.Equal(t, []int{2, 1, 0}, []int{runs[0].Writes, runs[1].Writes, runs[2].Writes})
+
+	runs, err = store.Runs(context.Background(), 2, 1)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.True(t, start.Add(2*time.Hour).Equal(runs[0].Timestamp))
+}
+
+func TestReconcileHistory(t *testing.T) {
+	const snapshotID = "history"
+	namespace := claims.OrgNamespaceFormatter(2)
+	tuple := common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")
+
+	client := newFakeZanzanaClient()
+	client.seed(namespace, common.NewFolderTuple("user:2", zanzana.RelationRead, "f1"))
+
+	store := NewKVHistoryStore(kvstore.NewFakeKVStore())
+	r := NewZanzanaReconciler(client, nil, nil, WithHistoryStore(store))
+	rr := newResourceReconciler("test", staticCollector(tuple), zanzanaCollector(zanzana.FolderRelations), client)
+	rr.cfg = r.cfg
+	r.reconcilers = []resourceReconciler{rr}
+
+	before := time.Now()
+	r.reconcileNamespace(ContextWithSnapshotID(context.Background(), snapshotID), namespace)
+
+	runs, err := store.Runs(context.Background(), 2, 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+
+	run := runs[0]
+	assert.Equal(t, int64(2), run.OrgID)
+	assert.Equal(t, snapshotID, run.SnapshotID)
+	assert.Equal(t, 1, run.Writes)
+	assert.Equal(t, 1, run.Deletes)
+	assert.Zero(t, run.Failed)
+	assert.False(t, run.Halted)
+	assert.False(t, run.Timestamp.Before(before.Truncate(time.Second)))
+}
+
+func TestReconcileHistory_Duration(t *testing.T) {
+	namespace := claims.OrgNamespaceFormatter(2)
+
+	clk := clock.NewMock()
+	clk.Set(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	client := &slowZanzanaClient{fakeZanzanaClient: newFakeZanzanaClient(), latency: time.Minute, clock: clk}
+
+	store := NewKVHistoryStore(kvstore.NewFakeKVStore())
+	r := NewZanzanaReconciler(client, nil, nil, WithHistoryStore(store), WithClock(clk))
+	rr := newResourceReconciler("test", staticCollector(common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")), zanzanaCollector(zanzana.FolderRelations), client)
+	rr.cfg = r.cfg
+	r.reconcilers = []resourceReconciler{rr}
+
+	r.reconcileNamespace(context.Background(), namespace)
+
+	runs, err := store.Runs(context.Background(), 2, 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), runs[0].Timestamp.UTC())
+	assert.Equal(t, time.Minute, runs[0].Duration)
+}
@@ -0,0 +1,124 @@
+package dualwrite
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"slices"
+
+	"github.com/grafana/authlib/claims"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/grafana/grafana/pkg/infra/kvstore"
+)
+
+// idempotencyKVNamespace is the kvstore namespace idempotency keys are persisted in.
+const idempotencyKVNamespace = "zanzana.reconciler.idempotency"
+
+// IdempotencyStore persists the idempotency key of the last tuple set applied to an object, so
+// retried reconciliations can skip objects that were already applied.
+type IdempotencyStore interface {
+	// GetIdempotencyKey returns the key last saved for object by reconciler name in namespace.
+	GetIdempotencyKey(ctx context.Context, name, namespace, object string) (string, bool, error)
+	SaveIdempotencyKey(ctx context.Context, name, namespace, object, key string) error
+	DeleteIdempotencyKey(ctx context.Context, name, namespace, object string) error
+}
+
+var _ IdempotencyStore = (*KVIdempotencyStore)(nil)
+
+// KVIdempotencyStore persists idempotency keys in the kvstore, one entry per org, reconciler and object.
+type KVIdempotencyStore struct {
+	kv kvstore.KVStore
+}
+
+func NewKVIdempotencyStore(kv kvstore.KVStore) *KVIdempotencyStore {
+	return &KVIdempotencyStore{kv: kv}
+}
+
+func (s *KVIdempotencyStore) GetIdempotencyKey(ctx context.Context, name, namespace, object string) (string, bool, error) {
+	info, err := claims.ParseNamespace(namespace)
+	if err != nil {
+		return "", false, err
+	}
+	return s.kv.Get(ctx, info.OrgID, idempotencyKVNamespace, name+"/"+object)
+}
+
+func (s *KVIdempotencyStore) SaveIdempotencyKey(ctx context.Context, name, namespace, object, key string) error {
+	info, err := claims.ParseNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	return s.kv.Set(ctx, info.OrgID, idempotencyKVNamespace, name+"/"+object, key)
+}
+
+func (s *KVIdempotencyStore) DeleteIdempotencyKey(ctx context.Context, name, namespace, object string) error {
+	info, err := claims.ParseNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	return s.kv.Del(ctx, info.OrgID, idempotencyKVNamespace, name+"/"+object)
+}
+
+// idempotencyKey hashes the tuple set collected from legacy for an object. Tuples are hashed
+// including their conditions and in a stable order, so the key only changes with the tuples.
+func idempotencyKey(tuples map[string]*openfgav1.TupleKey) (string, error) {
+	encoded := make([][]byte, 0, len(tuples))
+	for _, t := range tuples {
+		b, err := proto.MarshalOptions{Deterministic: true}.Marshal(t)
+		if err != nil {
+			return "", err
+		}
+		encoded = append(encoded, b)
+	}
+	slices.SortFunc(encoded, bytes.Compare)
+
+	h := sha256.New()
+	for _, b := range encoded {
+		// Tuples are length prefixed so different sets can't hash the same.
+		h.Write(binary.AppendUvarint(nil, uint64(len(b))))
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// snapshotIdempotencyKey scopes key to the snapshot of ctx, so keys saved by earlier runs are
+// never consulted by a run of another snapshot.
+func snapshotIdempotencyKey(ctx context.Context, key string) string {
+	return SnapshotIDFromContext(ctx) + "/" + key
+}
+
+// isApplied returns true if the tuple set with key was the last one applied to object by a run
+// of the same snapshot. Failing to read the key is treated as not applied so the object is
+// reconciled.
+func (r resourceReconciler) isApplied(ctx context.Context, namespace, object, key string) bool {
+	applied, ok, err := r.cfg.idempotencyStore.GetIdempotencyKey(ctx, r.name, namespace, object)
+	return err == nil && ok && applied == snapshotIdempotencyKey(ctx, key)
+}
+
+// markApplied saves key as the last tuple set applied to object by the snapshot of ctx. It is
+// recorded in the rollback journal of ctx so it is cleared if the run is rolled back.
+func (r resourceReconciler) markApplied(ctx context.Context, namespace, object, key string) {
+	// Keys only let retries skip work so failing to persist one should not fail the run.
+	if err := r.cfg.idempotencyStore.SaveIdempotencyKey(ctx, r.name, namespace, object, snapshotIdempotencyKey(ctx, key)); err != nil {
+		return
+	}
+	if journal := rollbackJournalFromContext(ctx); journal != nil {
+		journal.applied(r.name, object)
+	}
+}
+
+// clearIdempotencyKeys deletes the idempotency keys saved by the run of journal, so objects
+// whose changes were rolled back are reconciled again when the run is retried.
+func clearIdempotencyKeys(ctx context.Context, store IdempotencyStore, namespace string, journal *rollbackJournal) error {
+	var errs []error
+	for _, a := range journal.appliedObjects() {
+		if err := store.DeleteIdempotencyKey(ctx, a.name, namespace, a.object); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,145 @@
+package dualwrite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/grafana/authlib/claims"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/kvstore"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	a := common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")
+	b := common.NewFolderResourceTuple("user:2", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")
+
+	key, err := idempotencyKey(map[string]*openfgav1.TupleKey{"a": a, "b": b})
+	require.NoError(t, err)
+
+	t.Run("should not depend on the order of tuples", func(t *testing.T) {
+		other, err := idempotencyKey(map[string]*openfgav1.TupleKey{"x": b, "y": a})
+		require.NoError(t, err)
+		assert.Equal(t, key, other)
+	})
+
+	t.Run("should change with conditions", func(t *testing.T) {
+		c := common.NewFolderResourceTuple("user:2", zanzana.RelationRead, dashboardGroup, "librarypanels", "f1")
+		other, err := idempotencyKey(map[string]*openfgav1.TupleKey{"a": a, "b": c})
+		require.NoError(t, err)
+		assert.NotEqual(t, key, other)
+	})
+}
+
+func TestResourceReconciler_IdempotencyStore(t *testing.T) {
+	namespace := claims.OrgNamespaceFormatter(1)
+	ctx := ContextWithSnapshotID(context.Background(), "snapshot-1")
+
+	client := newFakeZanzanaClient()
+	legacy := staticCollector(
+		common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+		common.NewFolderTuple("user:1", zanzana.RelationRead, "f2"),
+	)
+	r := newResourceReconciler("test", legacy, zanzanaCollector(zanzana.FolderRelations), client)
+	r.cfg.idempotencyStore = NewKVIdempotencyStore(kvstore.NewFakeKVStore())
+
+	report, err := r.reconcile(ctx, namespace)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Writes)
+	assert.Equal(t, 0, report.Skipped)
+
+	t.Run("should skip a retried object with an unchanged tuple set", func(t *testing.T) {
+		writes := len(client.writes)
+
+		report, err := r.reconcile(ctx, namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.Skipped)
+		assert.Equal(t, 0, report.Writes)
+		assert.Len(t, client.writes, writes)
+	})
+
+	t.Run("should reconcile an object when its tuple set changes", func(t *testing.T) {
+		r.legacy = staticCollector(
+			common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("user:1", zanzana.RelationRead, "f2"),
+			common.NewFolderTuple("user:2", zanzana.RelationRead, "f2"),
+		)
+
+		report, err := r.reconcile(ctx, namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Skipped)
+		assert.Equal(t, 1, report.Writes)
+		assert.Len(t, client.stored(namespace), 3)
+	})
+
+	// drift made directly in zanzana
+	drift := func(t *testing.T) {
+		t.Helper()
+		require.NoError(t, client.Write(context.Background(), &authzextv1.WriteRequest{
+			Namespace: namespace,
+			Deletes: &authzextv1.WriteRequestDeletes{TupleKeys: common.ToAuthzExtTupleKeysWithoutCondition([]*openfgav1.TupleKeyWithoutCondition{
+				{User: "user:1", Relation: zanzana.RelationRead, Object: "folder:f1"},
+			})},
+		}))
+	}
+
+	t.Run("should not skip objects in a run of another snapshot", func(t *testing.T) {
+		drift(t)
+
+		report, err := r.reconcile(ContextWithSnapshotID(context.Background(), "snapshot-2"), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 0, report.Skipped)
+		assert.Equal(t, 1, report.Writes)
+		assert.Len(t, client.stored(namespace), 3)
+	})
+
+	t.Run("should not skip objects in a run without snapshot", func(t *testing.T) {
+		drift(t)
+
+		report, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 0, report.Skipped)
+		assert.Equal(t, 1, report.Writes)
+		assert.Len(t, client.stored(namespace), 3)
+	})
+}
+
+func TestReconcileNamespace_IdempotencyKeysRolledBack(t *testing.T) {
+	namespace := claims.OrgNamespaceFormatter(1)
+	ctx := ContextWithSnapshotID(context.Background(), "snapshot-1")
+
+	client := newFakeZanzanaClient()
+	store := NewKVIdempotencyStore(kvstore.NewFakeKVStore())
+
+	failing := func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		return nil, errors.New("failed to collect")
+	}
+
+	r := NewZanzanaReconciler(client, nil, nil, WithRollbackOnFailure(), WithIdempotencyStore(store))
+	r.reconcilers = []resourceReconciler{
+		newResourceReconciler("first", staticCollector(common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")), zanzanaCollector(zanzana.FolderRelations), client),
+		newResourceReconciler("second", failing, zanzanaCollector(zanzana.FolderRelations), client),
+	}
+	for i := range r.reconcilers {
+		r.reconcilers[i].cfg = r.cfg
+		r.reconcilers[i].client = newJournalClient(client)
+	}
+
+	r.reconcileNamespace(ctx, namespace)
+	assert.Empty(t, client.stored(namespace))
+
+	_, ok, err := store.GetIdempotencyKey(ctx, "first", namespace, "folder:f1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// the retry applies the object again
+	r.reconcilers = r.reconcilers[:1]
+	r.reconcileNamespace(ctx, namespace)
+	assert.Len(t, client.stored(namespace), 1)
+}
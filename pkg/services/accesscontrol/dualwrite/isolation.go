@@ -0,0 +1,164 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/authlib/claims"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	dashboardalpha1 "github.com/grafana/grafana/pkg/apis/dashboard/v0alpha1"
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+// ForeignReference is a tuple referencing an entity that doesn't belong to the org of the
+// namespace the tuple is stored in.
+type ForeignReference struct {
+	Tuple *openfgav1.TupleKey
+	// Entity is the referenced entity, e.g. user:u1.
+	Entity string
+}
+
+// orgEntities holds the identifiers of all entities belonging to an org, e.g. user:u1 or
+// resource:dashboard.grafana.app/dashboards/d1. Only entities with a prefix in prefixes are
+// verified, references to other entities such as basic roles are shared by all orgs.
+type orgEntities struct {
+	prefixes []string
+	entities map[string]struct{}
+}
+
+func newOrgEntities() *orgEntities {
+	return &orgEntities{entities: make(map[string]struct{})}
+}
+
+func (e *orgEntities) add(prefix string, ids ...string) {
+	e.prefixes = append(e.prefixes, prefix)
+	for _, id := range ids {
+		e.entities[prefix+id] = struct{}{}
+	}
+}
+
+// foreign returns true if entity is verified and doesn't belong to the org.
+func (e *orgEntities) foreign(entity string) bool {
+	for _, prefix := range e.prefixes {
+		if strings.HasPrefix(entity, prefix) {
+			_, ok := e.entities[entity]
+			return !ok
+		}
+	}
+	return false
+}
+
+// VerifyOrgIsolation reads every tuple in namespace and reports the ones referencing users,
+// teams, folders, service accounts, dashboards, library panels or public dashboards of another org.
+func (r *ZanzanaReconciler) VerifyOrgIsolation(ctx context.Context, namespace string) ([]ForeignReference, error) {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.VerifyOrgIsolation")
+	defer span.End()
+
+	info, err := claims.ParseNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	entities, err := collectOrgEntities(ctx, r.store, info.OrgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect entities of org %d: %w", info.OrgID, err)
+	}
+
+	return findForeignReferences(ctx, r.client, namespace, entities)
+}
+
+func collectOrgEntities(ctx context.Context, store db.DB, orgId int64) (*orgEntities, error) {
+	entities := newOrgEntities()
+	err := store.WithDbSession(ctx, func(sess *db.Session) error {
+		var users []string
+		query := `SELECT u.uid FROM org_user ou INNER JOIN ` + store.GetDialect().Quote("user") + ` u ON ou.user_id = u.id WHERE ou.org_id = ?`
+		if err := sess.SQL(query, orgId).Find(&users); err != nil {
+			return err
+		}
+		entities.add(common.NewTypedIdent(common.TypeUser, ""), users...)
+
+		var teams []string
+		if err := sess.SQL("SELECT uid FROM team WHERE org_id = ?", orgId).Find(&teams); err != nil {
+			return err
+		}
+		entities.add(common.NewTypedIdent(common.TypeTeam, ""), teams...)
+
+		var folders []string
+		if err := sess.SQL("SELECT uid FROM folder WHERE org_id = ?", orgId).Find(&folders); err != nil {
+			return err
+		}
+		entities.add(common.NewFolderIdent(""), folders...)
+
+		// Service accounts are referenced by id in permissions and by uid as team members
+		var serviceAccounts []struct {
+			ID  int64  `xorm:"id"`
+			UID string `xorm:"uid"`
+		}
+		query = `SELECT id, uid FROM ` + store.GetDialect().Quote("user") + ` WHERE org_id = ? AND is_service_account = ?`
+		if err := sess.SQL(query, orgId, store.GetDialect().BooleanStr(true)).Find(&serviceAccounts); err != nil {
+			return err
+		}
+		ids := make([]string, 0, 2*len(serviceAccounts))
+		for _, sa := range serviceAccounts {
+			ids = append(ids, strconv.FormatInt(sa.ID, 10), sa.UID)
+		}
+		entities.add(common.NewTypedIdent(common.TypeServiceAccount, ""), ids...)
+
+		var dashboards []string
+		query = `SELECT uid FROM dashboard WHERE org_id = ? AND is_folder = ?`
+		if err := sess.SQL(query, orgId, store.GetDialect().BooleanStr(false)).Find(&dashboards); err != nil {
+			return err
+		}
+		dashboard := dashboardalpha1.DashboardResourceInfo.GroupResource()
+		entities.add(common.NewResourceIdent(dashboard.Group, dashboard.Resource, ""), dashboards...)
+
+		var libraryPanels []string
+		if err := sess.SQL("SELECT uid FROM library_element WHERE org_id = ?", orgId).Find(&libraryPanels); err != nil {
+			return err
+		}
+		libraryPanel := dashboardalpha1.LibraryPanelResourceInfo.GroupResource()
+		entities.add(common.NewResourceIdent(libraryPanel.Group, libraryPanel.Resource, ""), libraryPanels...)
+
+		var publicDashboards []string
+		if err := sess.SQL("SELECT uid FROM dashboard_public WHERE org_id = ?", orgId).Find(&publicDashboards); err != nil {
+			return err
+		}
+		entities.add(common.NewTypedIdent(common.TypePublicDashboard, ""), publicDashboards...)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entities, nil
+}
+
+// findForeignReferences streams all tuples in namespace and returns a reference for every
+// subject or object not belonging to entities.
+func findForeignReferences(ctx context.Context, client zanzana.Client, namespace string, entities *orgEntities) ([]ForeignReference, error) {
+	var refs []ForeignReference
+	err := streamTuples(ctx, client, &authzextv1.ReadRequest{Namespace: namespace}, func(t *openfgav1.TupleKey) error {
+		for _, entity := range []string{t.GetObject(), tupleEntity(t.GetUser())} {
+			if entities.foreign(entity) {
+				refs = append(refs, ForeignReference{Tuple: t, Entity: entity})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+// tupleEntity strips the relation from a subject, e.g. team:t1#member becomes team:t1.
+func tupleEntity(subject string) string {
+	entity, _, _ := strings.Cut(subject, "#")
+	return entity
+}
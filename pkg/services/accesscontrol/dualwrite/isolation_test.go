@@ -0,0 +1,61 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestFindForeignReferences(t *testing.T) {
+	const namespace = "default"
+
+	entities := newOrgEntities()
+	entities.add("user:", "u1")
+	entities.add("team:", "t1")
+	entities.add("folder:", "f1", "f2")
+	entities.add(common.NewResourceIdent(dashboardGroup, dashboardResource, ""), "d1")
+
+	t.Run("should not report tuples referencing entities of the org", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		client.seed(namespace,
+			common.NewFolderTuple("user:u1", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("team:t1#member", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("role:basic_viewer#assignee", zanzana.RelationRead, "f1"),
+			common.NewFolderParentTuple("f2", "f1"),
+			common.NewResourceTuple("user:u1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d1"),
+		)
+
+		refs, err := findForeignReferences(context.Background(), client, namespace, entities)
+		require.NoError(t, err)
+		assert.Empty(t, refs)
+	})
+
+	t.Run("should report tuples referencing entities of another org", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		client.seed(namespace,
+			common.NewFolderTuple("user:u1", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("team:t2#member", zanzana.RelationRead, "f1"),
+			common.NewFolderParentTuple("f3", "f1"),
+			common.NewResourceTuple("user:u2", zanzana.RelationRead, dashboardGroup, dashboardResource, "d2"),
+		)
+
+		refs, err := findForeignReferences(context.Background(), client, namespace, entities)
+		require.NoError(t, err)
+
+		foreign := make([]string, 0, len(refs))
+		for _, ref := range refs {
+			foreign = append(foreign, ref.Entity)
+		}
+		assert.ElementsMatch(t, []string{
+			"team:t2",
+			"folder:f3",
+			"resource:dashboard.grafana.app/dashboards/d2",
+			"user:u2",
+		}, foreign)
+	})
+}
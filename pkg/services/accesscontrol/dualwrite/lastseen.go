@@ -0,0 +1,39 @@
+package dualwrite
+
+import "time"
+
+// TeamMemberLastSeen is when the subject of a team membership tuple was last seen. It is kept
+// outside of the tuples so it doesn't affect authorization and members being seen doesn't
+// rewrite their tuples.
+type TeamMemberLastSeen struct {
+	Object     string    `json:"object"`
+	Relation   string    `json:"relation"`
+	Subject    string    `json:"subject"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// TeamMemberLastSeenSink receives when every member of a team was last seen, e.g. so dormant
+// access can be detected. Orgs are reconciled concurrently so it must be safe for concurrent use.
+type TeamMemberLastSeenSink func(seen TeamMemberLastSeen)
+
+// reportTeamMemberLastSeen reports when the subject of every membership was last seen to sink.
+// Members that have never been seen are not reported, nothing is reported if sink is nil.
+func reportTeamMemberLastSeen(memberships []teamMembership, sink TeamMemberLastSeenSink) {
+	if sink == nil {
+		return
+	}
+
+	for _, m := range memberships {
+		if m.LastSeenAt.IsZero() {
+			continue
+		}
+
+		tuple := teamMembershipTuple(m)
+		sink(TeamMemberLastSeen{
+			Object:     tuple.Object,
+			Relation:   tuple.Relation,
+			Subject:    tuple.User,
+			LastSeenAt: m.LastSeenAt.UTC(),
+		})
+	}
+}
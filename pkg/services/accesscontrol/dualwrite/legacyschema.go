@@ -0,0 +1,101 @@
+package dualwrite
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+)
+
+// legacySchemaVersion is the shape of the legacy access control tables collectors read from.
+// Instances in the middle of an upgrade can still use the previous shape.
+type legacySchemaVersion int
+
+const (
+	// legacySchemaV1 stores permissions with their scope only.
+	legacySchemaV1 legacySchemaVersion = iota + 1
+	// legacySchemaV2 also stores the scope of permissions split into kind, attribute and identifier.
+	legacySchemaV2
+
+	legacySchemaLatest = legacySchemaV2
+)
+
+// legacySchemaColumns returns the columns collectors require for version.
+func legacySchemaColumns(version legacySchemaVersion) map[string][]string {
+	columns := maps.Clone(collectorColumns)
+	if version == legacySchemaV1 {
+		columns["permission"] = []string{"role_id", "action", "scope"}
+	}
+	return columns
+}
+
+// detectLegacySchema returns the version of the legacy schema based on the columns of the permission table.
+func detectLegacySchema(list columnLister) (legacySchemaVersion, error) {
+	columns, err := list("permission")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list columns of table permission: %w", err)
+	}
+
+	for i, c := range columns {
+		columns[i] = strings.ToLower(c)
+	}
+	if slices.Contains(columns, "kind") && slices.Contains(columns, "identifier") {
+		return legacySchemaV2, nil
+	}
+	return legacySchemaV1, nil
+}
+
+// validateLegacySchema detects the version of the legacy schema and verifies that all columns
+// required by collectors for that version exist.
+func validateLegacySchema(list columnLister) (legacySchemaVersion, error) {
+	version, err := detectLegacySchema(list)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := validateColumns(legacySchemaColumns(version), list); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// managedPermissionsQuery selects all managed permissions with the user, service account or team
+// they are granted to.
+// Permissions on dashboards that are deleted but retained so they can be restored are marked.
+// Managed permissions are not versioned with dashboards, only the current dashboard row is
+// joined so saving or restoring a dashboard version never brings back permissions removed since.
+// Kind and identifier are selected empty for schemas that don't store them, they are set from
+// the scope by normalizeScopes.
+func managedPermissionsQuery(store db.DB, version legacySchemaVersion) string {
+	columns := "p.kind, p.identifier"
+	dashboardJoin := "p.kind = '" + zanzana.KindDashboards + "' AND d.uid = p.identifier"
+	if version == legacySchemaV1 {
+		columns = "'' as kind, '' as identifier"
+		dashboardJoin = "p.scope = " + store.GetDialect().Concat("'"+zanzana.KindDashboards+":uid:'", "d.uid")
+	}
+
+	return `
+		SELECT r.name as role_name, u.uid as user_uid, u.is_service_account, t.uid as team_uid, br.role as builtin_role, p.action, p.scope, ` + columns + `, r.org_id,
+			CASE WHEN d.deleted IS NULL THEN 0 ELSE 1 END as resource_deleted
+		FROM permission p
+		INNER JOIN role r ON p.role_id = r.id
+		LEFT JOIN user_role ur ON r.id = ur.role_id
+		LEFT JOIN ` + store.GetDialect().Quote("user") + ` u ON u.id = ur.user_id
+		LEFT JOIN team_role tr ON r.id = tr.role_id
+		LEFT JOIN team t ON tr.team_id = t.id
+		LEFT JOIN builtin_role br ON r.id  = br.role_id
+		LEFT JOIN dashboard d ON ` + dashboardJoin + ` AND d.org_id = r.org_id
+		WHERE r.name LIKE 'managed:%'
+	`
+}
+
+// managedPermissionsKindFilter returns the condition and argument selecting permissions of kind.
+func managedPermissionsKindFilter(version legacySchemaVersion, kind string) (string, any) {
+	if version == legacySchemaV1 {
+		return "AND p.scope LIKE ?", kind + ":%"
+	}
+	return "AND p.kind = ?", kind
+}
@@ -0,0 +1,74 @@
+package dualwrite
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+)
+
+func TestDetectLegacySchema(t *testing.T) {
+	schema := func(version legacySchemaVersion) columnLister {
+		return func(table string) ([]string, error) {
+			return legacySchemaColumns(version)[table], nil
+		}
+	}
+
+	for _, version := range []legacySchemaVersion{legacySchemaV1, legacySchemaV2} {
+		detected, err := validateLegacySchema(schema(version))
+		require.NoError(t, err)
+		assert.Equal(t, version, detected)
+	}
+
+	t.Run("should fail when a column required by the detected version is missing", func(t *testing.T) {
+		_, err := validateLegacySchema(func(table string) ([]string, error) {
+			if table == "permission" {
+				return []string{"role_id", "action"}, nil
+			}
+			return collectorColumns[table], nil
+		})
+		require.ErrorContains(t, err, "scope")
+	})
+}
+
+func TestManagedPermissionTuples_LegacySchemaVersions(t *testing.T) {
+	// the same permissions as they are read from each schema version
+	permissions := map[legacySchemaVersion][]managedPermission{
+		legacySchemaV1: {
+			{Action: "folders:read", Scope: "folders:uid:f1", UserUID: "u1"},
+			{Action: "dashboards:write", Scope: "dashboards:uid:d1", TeamUID: "t1"},
+			{Action: "dashboards:read", Scope: "folders:uid:f1", BuiltinRole: "Viewer"},
+		},
+		legacySchemaV2: {
+			{Action: "folders:read", Scope: "folders:uid:f1", Kind: zanzana.KindFolders, Identifier: "f1", UserUID: "u1"},
+			{Action: "dashboards:write", Scope: "dashboards:uid:d1", Kind: zanzana.KindDashboards, Identifier: "d1", TeamUID: "t1"},
+			{Action: "dashboards:read", Scope: "folders:uid:f1", Kind: zanzana.KindFolders, Identifier: "f1", BuiltinRole: "Viewer"},
+		},
+	}
+
+	expected := managedPermissionTuples(normalizeScopes(permissions[legacySchemaLatest]), zanzana.TranslationLatest, nil)
+	require.Len(t, expected, 2)
+
+	for version, rows := range permissions {
+		actual := managedPermissionTuples(normalizeScopes(rows), zanzana.TranslationLatest, nil)
+		require.Len(t, actual, len(expected), "version %d", version)
+		for object, tuples := range expected {
+			require.Len(t, actual[object], len(tuples), "version %d", version)
+			for key, tuple := range tuples {
+				assert.Equal(t, tuple.String(), actual[object][key].String(), "version %d", version)
+			}
+		}
+	}
+}
+
+func TestManagedPermissionsKindFilter(t *testing.T) {
+	filter, arg := managedPermissionsKindFilter(legacySchemaV1, zanzana.KindFolders)
+	assert.Equal(t, "AND p.scope LIKE ?", filter)
+	assert.Equal(t, "folders:%", arg)
+
+	filter, arg = managedPermissionsKindFilter(legacySchemaV2, zanzana.KindFolders)
+	assert.Equal(t, "AND p.kind = ?", filter)
+	assert.Equal(t, "folders", arg)
+}
@@ -0,0 +1,141 @@
+package dualwrite
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestKeyedMutex(t *testing.T) {
+	t.Run("should not interleave goroutines locking the same key", func(t *testing.T) {
+		m := newKeyedMutex()
+
+		var (
+			wg      sync.WaitGroup
+			running atomic.Int32
+			peak    atomic.Int32
+		)
+
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := m.withLock(context.Background(), "default/folder:f1", func(ctx context.Context) error {
+					n := running.Add(1)
+					if n > peak.Load() {
+						peak.Store(n)
+					}
+					time.Sleep(time.Millisecond)
+					running.Add(-1)
+					return nil
+				})
+				assert.NoError(t, err)
+			}()
+		}
+
+		wg.Wait()
+		assert.Equal(t, int32(1), peak.Load())
+		assert.Empty(t, m.locks)
+	})
+
+	t.Run("should not block goroutines locking different keys", func(t *testing.T) {
+		m := newKeyedMutex()
+		locked := make(chan struct{})
+		release := make(chan struct{})
+
+		go func() {
+			_ = m.withLock(context.Background(), "default/folder:f1", func(ctx context.Context) error {
+				close(locked)
+				<-release
+				return nil
+			})
+		}()
+		<-locked
+		defer close(release)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		err := m.withLock(ctx, "default/folder:f2", func(ctx context.Context) error { return nil })
+		require.NoError(t, err)
+	})
+
+	t.Run("should stop waiting when context is cancelled", func(t *testing.T) {
+		m := newKeyedMutex()
+		locked := make(chan struct{})
+		release := make(chan struct{})
+
+		go func() {
+			_ = m.withLock(context.Background(), "default/folder:f1", func(ctx context.Context) error {
+				close(locked)
+				<-release
+				return nil
+			})
+		}()
+		<-locked
+		defer close(release)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		called := false
+		err := m.withLock(ctx, "default/folder:f1", func(ctx context.Context) error {
+			called = true
+			return nil
+		})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.False(t, called)
+	})
+}
+
+func TestResourceReconciler_ObjectLocking(t *testing.T) {
+	const namespace = "default"
+
+	client := newFakeZanzanaClient()
+	locker := newKeyedMutex()
+
+	// Without locking both reconcilers read the object before either writes to it and
+	// the tuples of both end up stored.
+	read := zanzanaCollector(zanzana.FolderRelations)
+	collector := func(ctx context.Context, client zanzana.Client, object string, namespace string) (map[string]*openfgav1.TupleKey, error) {
+		tuples, err := read(ctx, client, object, namespace)
+		time.Sleep(10 * time.Millisecond)
+		return tuples, err
+	}
+
+	newReconciler := func(subject string) resourceReconciler {
+		r := newResourceReconciler("test", staticCollector(
+			common.NewFolderTuple(subject, zanzana.RelationRead, "f1"),
+		), collector, client)
+		r.locker = locker
+		return r
+	}
+
+	var wg sync.WaitGroup
+	for _, subject := range []string{"user:1", "user:2"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := newReconciler(subject).reconcile(context.Background(), namespace)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, client.stored(namespace), 1, "reconcilers should not interleave on the same object")
+}
+
+func TestServerLockName(t *testing.T) {
+	name := serverLockName(objectLockKey("default", "resource:dashboard.grafana.app/dashboards/"+strings.Repeat("a", 200)))
+	assert.LessOrEqual(t, len(name), 100)
+	assert.NotEqual(t, serverLockName("default/folder:f1"), serverLockName("default/folder:f2"))
+}
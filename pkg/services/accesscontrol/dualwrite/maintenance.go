@@ -0,0 +1,41 @@
+package dualwrite
+
+import "time"
+
+// MaintenanceWindow is a daily window in which stale tuples may be deleted.
+type MaintenanceWindow struct {
+	// Start is when the window opens, as the time since midnight.
+	Start time.Duration
+	// Duration is how long the window stays open, it may extend past midnight.
+	Duration time.Duration
+	// Location is the time zone of Start, UTC if nil.
+	Location *time.Location
+}
+
+// Contains returns true if t is within the window.
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	if w.Duration >= 24*time.Hour {
+		return true
+	}
+
+	loc := w.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	sinceMidnight := t.Sub(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc))
+
+	// A window extending past midnight is open until its end on the following day.
+	for _, offset := range []time.Duration{sinceMidnight, sinceMidnight + 24*time.Hour} {
+		if offset >= w.Start && offset < w.Start+w.Duration {
+			return true
+		}
+	}
+	return false
+}
+
+// deletesDeferred returns true if deletes should not be applied as the current time is outside
+// the maintenance window.
+func (c *reconcileConfig) deletesDeferred() bool {
+	return c.maintenanceWindow != nil && !c.maintenanceWindow.Contains(c.clock.Now())
+}
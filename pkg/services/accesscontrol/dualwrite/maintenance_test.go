@@ -0,0 +1,132 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestMaintenanceWindow_Contains(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2024, 1, 1, hour, min, 0, 0, time.UTC)
+	}
+
+	t.Run("should contain times within the window", func(t *testing.T) {
+		w := MaintenanceWindow{Start: 2 * time.Hour, Duration: 2 * time.Hour}
+		assert.False(t, w.Contains(at(1, 59)))
+		assert.True(t, w.Contains(at(2, 0)))
+		assert.True(t, w.Contains(at(3, 59)))
+		assert.False(t, w.Contains(at(4, 0)))
+	})
+
+	t.Run("should contain times of a window extending past midnight", func(t *testing.T) {
+		w := MaintenanceWindow{Start: 22 * time.Hour, Duration: 4 * time.Hour}
+		assert.False(t, w.Contains(at(21, 0)))
+		assert.True(t, w.Contains(at(23, 0)))
+		assert.True(t, w.Contains(at(1, 0)))
+		assert.False(t, w.Contains(at(2, 0)))
+	})
+
+	t.Run("should use the location of the window", func(t *testing.T) {
+		w := MaintenanceWindow{Start: 2 * time.Hour, Duration: time.Hour, Location: time.FixedZone("UTC+2", 2*60*60)}
+		assert.True(t, w.Contains(at(0, 30)))
+		assert.False(t, w.Contains(at(2, 30)))
+	})
+}
+
+func TestResourceReconciler_MaintenanceWindow(t *testing.T) {
+	const namespace = "default"
+
+	reconcile := func(t *testing.T, now time.Time) (*fakeZanzanaClient, *ReconcileReport) {
+		t.Helper()
+
+		client := newFakeZanzanaClient()
+		client.seed(namespace,
+			common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("user:2", zanzana.RelationRead, "f1"),
+		)
+
+		// user:2 was removed and user:3 added in legacy
+		legacy := staticCollector(
+			common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("user:3", zanzana.RelationRead, "f1"),
+		)
+		r := newResourceReconciler("test", legacy, zanzanaCollector(zanzana.FolderRelations), client)
+		r.cfg.maintenanceWindow = &MaintenanceWindow{Start: 2 * time.Hour, Duration: 2 * time.Hour}
+		clk := clock.NewMock()
+		clk.Set(now)
+		r.cfg.clock = clk
+
+		report, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		return client, report
+	}
+
+	t.Run("should defer deletes outside the window", func(t *testing.T) {
+		client, report := reconcile(t, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+		assert.Equal(t, 1, report.Writes)
+		assert.Equal(t, 0, report.Deletes)
+		assert.Equal(t, 1, report.DeferredDeletes)
+		assert.Len(t, client.stored(namespace), 3)
+	})
+
+	t.Run("should apply deletes inside the window", func(t *testing.T) {
+		client, report := reconcile(t, time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC))
+		assert.Equal(t, 1, report.Writes)
+		assert.Equal(t, 1, report.Deletes)
+		assert.Equal(t, 0, report.DeferredDeletes)
+		assert.Len(t, client.stored(namespace), 2)
+	})
+
+	t.Run("should apply deferred deletes once the clock enters the window", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		client.seed(namespace, common.NewFolderTuple("user:2", zanzana.RelationRead, "f1"))
+
+		legacy := staticCollector(common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"))
+		r := newResourceReconciler("test", legacy, zanzanaCollector(zanzana.FolderRelations), client)
+		r.cfg.maintenanceWindow = &MaintenanceWindow{Start: 2 * time.Hour, Duration: 2 * time.Hour}
+		clk := clock.NewMock()
+		clk.Set(time.Date(2024, 1, 1, 1, 59, 0, 0, time.UTC))
+		r.cfg.clock = clk
+
+		report, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.DeferredDeletes)
+		assert.Len(t, client.stored(namespace), 2)
+
+		clk.Add(time.Minute)
+		report, err = r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Deletes)
+		assert.Len(t, client.stored(namespace), 1)
+	})
+
+	t.Run("should defer deletes of orphaned objects outside the window", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		client.seed(namespace,
+			common.NewResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d1"),
+			common.NewResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d2"),
+		)
+
+		cfg := newReconcileConfig()
+		legacy := staticCollector(common.NewResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d1"))
+		r := newResourceReconciler("test", legacy, zanzanaCollector(zanzana.ResourceRelations), client).
+			withOrphans(orphanCollector(zanzana.KindDashboards, cfg, zanzana.ResourceRelations))
+		r.cfg.maintenanceWindow = &MaintenanceWindow{Start: 2 * time.Hour, Duration: 2 * time.Hour}
+		clk := clock.NewMock()
+		clk.Set(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+		r.cfg.clock = clk
+
+		report, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.DeferredDeletes)
+		assert.Len(t, client.stored(namespace), 2)
+	})
+}
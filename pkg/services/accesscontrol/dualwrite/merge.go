@@ -0,0 +1,57 @@
+package dualwrite
+
+import (
+	"context"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// MergeImported merges a flat slice of imported tuples into existing tuples grouped by object.
+// Folder resource tuples already present for the same subject and relation are merged into one
+// tuple with the union of their group_resources, the same goes for subresource tuples.
+// Imported tuples are never modified.
+func MergeImported(existing map[string]map[string]*openfgav1.TupleKey, imported []*openfgav1.TupleKey) map[string]map[string]*openfgav1.TupleKey {
+	if existing == nil {
+		existing = make(map[string]map[string]*openfgav1.TupleKey)
+	}
+
+	for _, t := range imported {
+		if isMergeableTuple(t) {
+			// Mergeable tuples can be merged with later tuples so we store a copy
+			// to not modify the imported snapshot.
+			t = proto.Clone(t).(*openfgav1.TupleKey)
+		}
+		putTuple(existing, t)
+	}
+
+	return existing
+}
+
+// mergeCollectors returns a legacy collector combining the output of collectors. Identical
+// tuples are only kept once and folder resource and subresource tuples for the same subject
+// and relation are merged into one tuple with a combined condition, so a single reconciler
+// can be fed by collectors with overlapping output.
+func mergeCollectors(collectors ...legacyTupleCollector) legacyTupleCollector {
+	return func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		merged := make(map[string]map[string]*openfgav1.TupleKey)
+		for _, collector := range collectors {
+			tuples, err := collector(ctx, orgId)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, objectTuples := range tuples {
+				for _, t := range objectTuples {
+					if isMergeableTuple(t) {
+						// Tuples are merged in place so we store a copy to not modify
+						// the output of the collector.
+						t = proto.Clone(t).(*openfgav1.TupleKey)
+					}
+					putTuple(merged, t)
+				}
+			}
+		}
+		return merged, nil
+	}
+}
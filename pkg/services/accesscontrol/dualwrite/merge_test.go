@@ -0,0 +1,94 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestMergeImported(t *testing.T) {
+	t.Run("should union group resources of overlapping folder resource tuples", func(t *testing.T) {
+		existing := map[string]map[string]*openfgav1.TupleKey{}
+		putTuple(existing, common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"))
+		putTuple(existing, common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"))
+
+		importedTuple := common.NewFolderResourceTuple("user:1", zanzana.RelationRead, "alerting.grafana.app", "rules", "f1")
+		imported := []*openfgav1.TupleKey{
+			importedTuple,
+			common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"),
+			common.NewFolderTuple("user:2", zanzana.RelationRead, "f2"),
+		}
+
+		merged := MergeImported(existing, imported)
+		require.Len(t, merged, 2)
+		require.Len(t, merged["folder:f1"], 2)
+		require.Len(t, merged["folder:f2"], 1)
+
+		key := tupleStringWithoutCondition(importedTuple)
+		assert.Equal(t, []string{"alerting.grafana.app/rules", "dashboard.grafana.app/dashboards"}, groupResources(merged["folder:f1"][key]))
+
+		// imported tuples should not be modified
+		assert.Equal(t, []string{"alerting.grafana.app/rules"}, groupResources(importedTuple))
+	})
+
+	t.Run("should merge overlapping imported tuples into a new map", func(t *testing.T) {
+		merged := MergeImported(nil, []*openfgav1.TupleKey{
+			common.NewFolderResourceTuple("user:1", zanzana.RelationRead, "alerting.grafana.app", "rules", "f1"),
+			common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"),
+		})
+
+		require.Len(t, merged["folder:f1"], 1)
+		for _, tuple := range merged["folder:f1"] {
+			assert.Equal(t, []string{"alerting.grafana.app/rules", "dashboard.grafana.app/dashboards"}, groupResources(tuple))
+		}
+	})
+}
+
+func groupResources(t *openfgav1.TupleKey) []string {
+	var out []string
+	for _, v := range t.GetCondition().GetContext().GetFields()["group_resources"].GetListValue().GetValues() {
+		out = append(out, v.GetStringValue())
+	}
+	return out
+}
+
+func TestMergeCollectors(t *testing.T) {
+	const namespace = "default"
+
+	managed := common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")
+	acl := common.NewFolderResourceTuple("user:1", zanzana.RelationRead, "alerting.grafana.app", "rules", "f1")
+	shared := common.NewFolderTuple("team:t1#member", zanzana.RelationRead, "f1")
+
+	collector := mergeCollectors(
+		staticCollector(managed, shared),
+		staticCollector(acl, common.NewFolderTuple("team:t1", zanzana.RelationRead, "f1")),
+	)
+
+	tuples, err := collector(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, tuples["folder:f1"], 2)
+
+	merged := tuples["folder:f1"][tupleKey(managed)]
+	require.NotNil(t, merged)
+	assert.Equal(t, []string{"alerting.grafana.app/rules", "dashboard.grafana.app/dashboards"}, groupResources(merged))
+
+	// output of the collectors should not be modified
+	assert.Equal(t, []string{"dashboard.grafana.app/dashboards"}, groupResources(managed))
+	assert.Equal(t, []string{"alerting.grafana.app/rules"}, groupResources(acl))
+
+	t.Run("should write each tuple once", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		r := newResourceReconciler("test", collector, zanzanaCollector(zanzana.FolderRelations), client)
+
+		report, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.Writes)
+		assert.Len(t, client.stored(namespace), 2)
+	})
+}
@@ -0,0 +1,80 @@
+package dualwrite
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/grafana/grafana/pkg/infra/metrics/metricutil"
+)
+
+const (
+	metricsSubSystem = "authz"
+	metricsNamespace = "grafana"
+)
+
+type dualwriteMetrics struct {
+	// shadowCheckTotal counts shadow checks by result (match, mismatch, error or skipped)
+	shadowCheckTotal *prometheus.CounterVec
+	// folderResourceActionsTotal counts folder resource actions collected before they are merged
+	folderResourceActionsTotal prometheus.Counter
+	// folderResourceTuplesTotal counts folder resource tuples after merging
+	folderResourceTuplesTotal prometheus.Counter
+	// snapshotInfo is set for the snapshot id of the last run started with one
+	snapshotInfo *prometheus.GaugeVec
+	// massDeletionAbortedTotal counts reconcilers aborted because they would delete too many tuples
+	massDeletionAbortedTotal *prometheus.CounterVec
+}
+
+var (
+	metricsOnce sync.Once
+	metrics     *dualwriteMetrics
+)
+
+// TODO: use prometheus.Registerer
+func initMetrics() *dualwriteMetrics {
+	metricsOnce.Do(func() {
+		metrics = &dualwriteMetrics{
+			shadowCheckTotal: metricutil.NewCounterVecStartingAtZero(
+				prometheus.CounterOpts{
+					Name:      "zanzana_shadow_check_total",
+					Help:      "Number of zanzana shadow checks compared with legacy decisions by result (match, mismatch, error or skipped)",
+					Namespace: metricsNamespace,
+					Subsystem: metricsSubSystem,
+				}, []string{"result"}, map[string][]string{"result": {shadowResultMatch, shadowResultMismatch, shadowResultError, shadowResultSkipped}}),
+			folderResourceActionsTotal: prometheus.NewCounter(prometheus.CounterOpts{
+				Name:      "zanzana_folder_resource_actions_total",
+				Help:      "Number of collected folder resource actions before merging",
+				Namespace: metricsNamespace,
+				Subsystem: metricsSubSystem,
+			}),
+			folderResourceTuplesTotal: prometheus.NewCounter(prometheus.CounterOpts{
+				Name:      "zanzana_folder_resource_tuples_total",
+				Help:      "Number of folder resource tuples the collected actions were merged into",
+				Namespace: metricsNamespace,
+				Subsystem: metricsSubSystem,
+			}),
+			snapshotInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name:      "zanzana_reconciler_snapshot_info",
+				Help:      "Set to 1 for the snapshot id of the last reconciliation run started with one",
+				Namespace: metricsNamespace,
+				Subsystem: metricsSubSystem,
+			}, []string{"snapshot_id"}),
+			massDeletionAbortedTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name:      "zanzana_reconciler_mass_deletion_aborted_total",
+				Help:      "Number of reconciliations aborted because they would delete too many tuples of an object type",
+				Namespace: metricsNamespace,
+				Subsystem: metricsSubSystem,
+			}, []string{"reconciler"}),
+		}
+
+		prometheus.MustRegister(
+			metrics.shadowCheckTotal,
+			metrics.folderResourceActionsTotal,
+			metrics.folderResourceTuplesTotal,
+			metrics.snapshotInfo,
+			metrics.massDeletionAbortedTotal,
+		)
+	})
+	return metrics
+}
@@ -0,0 +1,115 @@
+package dualwrite
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sort"
+
+	"github.com/grafana/authlib/claims"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/grafana/grafana/pkg/infra/kvstore"
+)
+
+// objectSetKVNamespace is the kvstore namespace object sets are persisted in.
+const objectSetKVNamespace = "zanzana.reconciler.objects"
+
+// ObjectSetStore persists the objects collected from legacy by the last run of a reconciler, so
+// tuples of objects deleted in legacy can be found without reading all of zanzana.
+type ObjectSetStore interface {
+	// GetObjects returns the objects last saved for reconciler name in namespace.
+	GetObjects(ctx context.Context, name, namespace string) ([]string, bool, error)
+	SaveObjects(ctx context.Context, name, namespace string, objects []string) error
+}
+
+var _ ObjectSetStore = (*KVObjectSetStore)(nil)
+
+// KVObjectSetStore persists object sets in the kvstore, one entry per org and reconciler.
+type KVObjectSetStore struct {
+	kv kvstore.KVStore
+}
+
+func NewKVObjectSetStore(kv kvstore.KVStore) *KVObjectSetStore {
+	return &KVObjectSetStore{kv: kv}
+}
+
+func (s *KVObjectSetStore) GetObjects(ctx context.Context, name, namespace string) ([]string, bool, error) {
+	info, err := claims.ParseNamespace(namespace)
+	if err != nil {
+		return nil, false, err
+	}
+
+	value, ok, err := s.kv.Get(ctx, info.OrgID, objectSetKVNamespace, name)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	var objects []string
+	if err := json.Unmarshal([]byte(value), &objects); err != nil {
+		return nil, false, err
+	}
+	return objects, true, nil
+}
+
+func (s *KVObjectSetStore) SaveObjects(ctx context.Context, name, namespace string, objects []string) error {
+	info, err := claims.ParseNamespace(namespace)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(objects)
+	if err != nil {
+		return err
+	}
+
+	return s.kv.Set(ctx, info.OrgID, objectSetKVNamespace, name, string(value))
+}
+
+// tracksObjects returns true if the objects of every run are saved to find deleted objects.
+func (r resourceReconciler) tracksObjects() bool {
+	return r.trackObjects && r.cfg.objectSetStore != nil
+}
+
+// deletedObjectTuples returns the stored tuples of objects collected by the last run that are
+// no longer in legacy. Only these objects are read from zanzana. Nothing is returned for the
+// first run or if the last objects can't be read.
+func (r resourceReconciler) deletedObjectTuples(ctx context.Context, namespace string, legacy map[string]map[string]*openfgav1.TupleKey) ([]*openfgav1.TupleKey, error) {
+	previous, ok, err := r.cfg.objectSetStore.GetObjects(ctx, r.name, namespace)
+	if err != nil || !ok {
+		return nil, nil
+	}
+
+	var out []*openfgav1.TupleKey
+	for _, object := range previous {
+		if _, ok := legacy[object]; ok {
+			continue
+		}
+
+		stored, err := r.zanzana(ctx, r.client, object, namespace)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range stored {
+			out = append(out, t)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].String() < out[j].String()
+	})
+	return out, nil
+}
+
+// saveObjects saves the objects collected from legacy by this run.
+func (r resourceReconciler) saveObjects(ctx context.Context, namespace string, legacy map[string]map[string]*openfgav1.TupleKey) {
+	objects := make([]string, 0, len(legacy))
+	for object := range legacy {
+		objects = append(objects, object)
+	}
+	slices.Sort(objects)
+
+	// Failing to save only means objects added by this run are missed if they are deleted
+	// before the next save, it should not fail the run.
+	_ = r.cfg.objectSetStore.SaveObjects(ctx, r.name, namespace, objects)
+}
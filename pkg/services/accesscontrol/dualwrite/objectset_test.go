@@ -0,0 +1,77 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+
+	"github.com/grafana/authlib/claims"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/kvstore"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestKVObjectSetStore(t *testing.T) {
+	store := NewKVObjectSetStore(kvstore.NewFakeKVStore())
+	namespace := claims.OrgNamespaceFormatter(1)
+
+	_, ok, err := store.GetObjects(context.Background(), "test", namespace)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, store.SaveObjects(context.Background(), "test", namespace, []string{"folder:f1", "folder:f2"}))
+	objects, ok, err := store.GetObjects(context.Background(), "test", namespace)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"folder:f1", "folder:f2"}, objects)
+}
+
+func TestResourceReconciler_ObjectTracking(t *testing.T) {
+	namespace := claims.OrgNamespaceFormatter(1)
+
+	client := newFakeZanzanaClient()
+	// f3 was never collected, its tuple is not owned by the reconciler
+	client.seed(namespace, common.NewFolderTuple("user:3", zanzana.RelationRead, "f3"))
+
+	r := newResourceReconciler("test", staticCollector(
+		common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+		common.NewFolderTuple("user:1", zanzana.RelationRead, "f2"),
+		common.NewFolderTuple("user:2", zanzana.RelationRead, "f2"),
+	), zanzanaCollector(zanzana.FolderRelations), client).withObjectTracking()
+	r.cfg.objectSetStore = NewKVObjectSetStore(kvstore.NewFakeKVStore())
+
+	report, err := r.reconcile(context.Background(), namespace)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Writes)
+	assert.Equal(t, 0, report.Deletes)
+
+	// f2 is deleted in legacy
+	r.legacy = staticCollector(common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"))
+
+	t.Run("should only target tuples of objects gone since the last run", func(t *testing.T) {
+		result, err := r.dryRun(context.Background(), namespace)
+		require.NoError(t, err)
+		require.Len(t, result.Deletions, 2)
+		for _, tuple := range result.Deletions {
+			assert.Equal(t, "folder:f2", tuple.Object)
+		}
+	})
+
+	t.Run("should delete tuples of objects gone since the last run", func(t *testing.T) {
+		report, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.Deletes)
+
+		stored := client.stored(namespace)
+		require.Len(t, stored, 2)
+		assert.Equal(t, "folder:f1", stored[0].Object)
+		assert.Equal(t, "folder:f3", stored[1].Object)
+
+		// f2 is not in the saved objects anymore, nothing is deleted again
+		report, err = r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 0, report.Deletes)
+	})
+}
@@ -0,0 +1,225 @@
+package dualwrite
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/grafana/authlib/claims"
+
+	"github.com/grafana/grafana/pkg/infra/kvstore"
+)
+
+// progressKVNamespace is the kvstore namespace progress is persisted in.
+const progressKVNamespace = "zanzana.reconciler.progress"
+
+// ReconcileProgress is the progress of a single reconciler in a namespace.
+type ReconcileProgress struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	// SnapshotID is the snapshot id of the run, see ContextWithSnapshotID.
+	SnapshotID string `json:"snapshotId,omitempty"`
+	// Processed is the number of objects reconciled so far.
+	Processed int `json:"processed"`
+	// Total is the number of objects collected from legacy.
+	Total int `json:"total"`
+	// Cursor is the last object reconciled by a run that was halted.
+	Cursor string `json:"cursor,omitempty"`
+	// Halted is set if the last run was halted, the next run resumes from its checkpoints.
+	Halted bool `json:"halted,omitempty"`
+	// Checkpoints are the last objects reconciled of every object type by a run that was halted.
+	// The next run skips objects of a type up to and including its checkpoint.
+	Checkpoints []ObjectTypeCheckpoint `json:"checkpoints,omitempty"`
+}
+
+// ObjectTypeCheckpoint is the last object of a type reconciled by a halted run. Objects are
+// reconciled in order so all objects of the type up to LastKey were reconciled.
+type ObjectTypeCheckpoint struct {
+	ObjectType string `json:"objectType"`
+	LastKey    string `json:"lastKey"`
+}
+
+// ProgressStore persists reconciliation progress so it can be polled while a reconciliation is
+// running and halted runs can be resumed.
+type ProgressStore interface {
+	SaveProgress(ctx context.Context, progress ReconcileProgress) error
+	// GetProgress returns the last persisted progress of reconciler name in namespace.
+	GetProgress(ctx context.Context, name, namespace string) (ReconcileProgress, bool, error)
+}
+
+var _ ProgressStore = (*KVProgressStore)(nil)
+
+// KVProgressStore persists progress in the kvstore, one entry per org and reconciler.
+type KVProgressStore struct {
+	kv kvstore.KVStore
+}
+
+func NewKVProgressStore(kv kvstore.KVStore) *KVProgressStore {
+	return &KVProgressStore{kv: kv}
+}
+
+func (s *KVProgressStore) SaveProgress(ctx context.Context, progress ReconcileProgress) error {
+	info, err := claims.ParseNamespace(progress.Namespace)
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+
+	return s.kv.Set(ctx, info.OrgID, progressKVNamespace, progress.Name, string(value))
+}
+
+func (s *KVProgressStore) GetProgress(ctx context.Context, name, namespace string) (ReconcileProgress, bool, error) {
+	info, err := claims.ParseNamespace(namespace)
+	if err != nil {
+		return ReconcileProgress{}, false, err
+	}
+
+	value, ok, err := s.kv.Get(ctx, info.OrgID, progressKVNamespace, name)
+	if err != nil || !ok {
+		return ReconcileProgress{}, false, err
+	}
+
+	var progress ReconcileProgress
+	if err := json.Unmarshal([]byte(value), &progress); err != nil {
+		return ReconcileProgress{}, false, err
+	}
+	return progress, true, nil
+}
+
+// Progress returns the last persisted progress of every reconciler for org, sorted by name.
+func (s *KVProgressStore) Progress(ctx context.Context, orgId int64) ([]ReconcileProgress, error) {
+	keys, err := s.kv.Keys(ctx, orgId, progressKVNamespace, "")
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]ReconcileProgress, 0, len(keys))
+	for _, key := range keys {
+		value, ok, err := s.kv.Get(ctx, orgId, progressKVNamespace, key.Key)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		var progress ReconcileProgress
+		if err := json.Unmarshal([]byte(value), &progress); err != nil {
+			return nil, err
+		}
+		out = append(out, progress)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
+
+// progressTracker persists progress of a reconciliation run every interval objects.
+type progressTracker struct {
+	store    ProgressStore
+	interval int
+	progress ReconcileProgress
+	// cursor is the last object reconciled, it is only persisted when the run is halted.
+	cursor string
+	// checkpoints are the last object reconciled by object type, they are only persisted when
+	// the run is halted.
+	checkpoints map[string]string
+}
+
+// newProgressTracker returns a tracker for a run over total objects, it is nil if store is nil.
+func newProgressTracker(store ProgressStore, interval int, name, namespace, snapshotID string, total int) *progressTracker {
+	if store == nil {
+		return nil
+	}
+	if interval < 1 {
+		interval = 1
+	}
+	return &progressTracker{
+		store:       store,
+		interval:    interval,
+		progress:    ReconcileProgress{Name: name, Namespace: namespace, SnapshotID: snapshotID, Total: total},
+		checkpoints: make(map[string]string),
+	}
+}
+
+// resumeCheckpoints returns the checkpoints of the last run by object type if it was halted.
+func (t *progressTracker) resumeCheckpoints(ctx context.Context) map[string]string {
+	if t == nil {
+		return nil
+	}
+
+	last, ok, err := t.store.GetProgress(ctx, t.progress.Name, t.progress.Namespace)
+	if err != nil || !ok || !last.Halted {
+		return nil
+	}
+
+	checkpoints := make(map[string]string, len(last.Checkpoints))
+	for _, c := range last.Checkpoints {
+		checkpoints[c.ObjectType] = c.LastKey
+	}
+	return checkpoints
+}
+
+// resume continues the progress of a halted run that reconciled objects up to checkpoints.
+func (t *progressTracker) resume(checkpoints map[string]string, processed int) {
+	if t == nil {
+		return
+	}
+	for objectType, key := range checkpoints {
+		t.checkpoints[objectType] = key
+	}
+	t.progress.Processed = processed
+}
+
+// start persists that the run has started.
+func (t *progressTracker) start(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	t.save(ctx)
+}
+
+// processed records that object was reconciled and persists the progress every interval
+// objects and once all objects are reconciled.
+func (t *progressTracker) processed(ctx context.Context, object string) {
+	if t == nil {
+		return
+	}
+
+	t.cursor = object
+	objectType, _, _ := strings.Cut(object, ":")
+	t.checkpoints[objectType] = object
+	t.progress.Processed++
+	if t.progress.Processed%t.interval == 0 || t.progress.Processed == t.progress.Total {
+		t.save(ctx)
+	}
+}
+
+// halt persists the progress with checkpoints so the next run resumes where this one stopped.
+func (t *progressTracker) halt(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	t.progress.Cursor = t.cursor
+	t.progress.Halted = true
+	t.progress.Checkpoints = make([]ObjectTypeCheckpoint, 0, len(t.checkpoints))
+	for objectType, key := range t.checkpoints {
+		t.progress.Checkpoints = append(t.progress.Checkpoints, ObjectTypeCheckpoint{ObjectType: objectType, LastKey: key})
+	}
+	sort.Slice(t.progress.Checkpoints, func(i, j int) bool {
+		return t.progress.Checkpoints[i].ObjectType < t.progress.Checkpoints[j].ObjectType
+	})
+	t.save(ctx)
+}
+
+func (t *progressTracker) save(ctx context.Context) {
+	// Progress is only informational so failing to persist it should not fail the run.
+	_ = t.store.SaveProgress(ctx, t.progress)
+}
@@ -0,0 +1,203 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/grafana/authlib/claims"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/kvstore"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+type recordingProgressStore struct {
+	saved []ReconcileProgress
+}
+
+func (s *recordingProgressStore) SaveProgress(ctx context.Context, progress ReconcileProgress) error {
+	s.saved = append(s.saved, progress)
+	return nil
+}
+
+func (s *recordingProgressStore) GetProgress(ctx context.Context, name, namespace string) (ReconcileProgress, bool, error) {
+	for i := len(s.saved) - 1; i >= 0; i-- {
+		if s.saved[i].Name == name && s.saved[i].Namespace == namespace {
+			return s.saved[i], true, nil
+		}
+	}
+	return ReconcileProgress{}, false, nil
+}
+
+func TestResourceReconciler_Progress(t *testing.T) {
+	const namespace = "default"
+
+	tuples := make([]*openfgav1.TupleKey, 0, 5)
+	for i := 0; i < 5; i++ {
+		tuples = append(tuples, common.NewFolderTuple("user:1", zanzana.RelationRead, fmt.Sprintf("f%d", i)))
+	}
+
+	t.Run("should persist progress every interval objects", func(t *testing.T) {
+		store := &recordingProgressStore{}
+		r := newResourceReconciler("test", staticCollector(tuples...), zanzanaCollector(zanzana.FolderRelations), newFakeZanzanaClient())
+		r.cfg.progressStore = store
+		r.cfg.progressInterval = 2
+
+		_, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+
+		processed := make([]int, 0, len(store.saved))
+		for _, p := range store.saved {
+			assert.Equal(t, "test", p.Name)
+			assert.Equal(t, namespace, p.Namespace)
+			assert.Equal(t, 5, p.Total)
+			processed = append(processed, p.Processed)
+		}
+		assert.Equal(t, []int{0, 2, 4, 5}, processed)
+	})
+
+	t.Run("should not persist progress of dry-run", func(t *testing.T) {
+		store := &recordingProgressStore{}
+		r := newResourceReconciler("test", staticCollector(tuples...), zanzanaCollector(zanzana.FolderRelations), newFakeZanzanaClient())
+		r.cfg.progressStore = store
+
+		_, err := r.dryRun(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Empty(t, store.saved)
+	})
+}
+
+func TestResourceReconciler_ResumeObjectTypeCheckpoints(t *testing.T) {
+	namespace := claims.OrgNamespaceFormatter(1)
+
+	legacy := staticCollector(
+		common.NewFolderTuple("user:1", zanzana.RelationRead, "f0"),
+		common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+		common.NewFolderTuple("user:1", zanzana.RelationRead, "f2"),
+		common.NewFolderTuple("user:1", zanzana.RelationRead, "f3"),
+		teamMemberTuple("user:1", "t1"),
+		teamMemberTuple("user:1", "t2"),
+		// added after the run was halted
+		teamMemberTuple("user:1", "t3"),
+	)
+
+	// the halted run reconciled teams up to t2 and was interrupted after folder f1
+	halted := ReconcileProgress{
+		Name:      "test",
+		Namespace: namespace,
+		Halted:    true,
+		Checkpoints: []ObjectTypeCheckpoint{
+			{ObjectType: "folder", LastKey: "folder:f1"},
+			{ObjectType: "team", LastKey: "team:t2"},
+		},
+	}
+
+	t.Run("should resume every object type after its checkpoint", func(t *testing.T) {
+		store := &recordingProgressStore{saved: []ReconcileProgress{halted}}
+		client := newFakeZanzanaClient()
+		r := newResourceReconciler("test", legacy, zanzanaCollector([]string{zanzana.RelationRead, zanzana.RelationTeamMember}), client)
+		r.cfg.progressStore = store
+
+		_, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+
+		objects := make([]string, 0)
+		for _, tuple := range client.stored(namespace) {
+			objects = append(objects, tuple.Object)
+		}
+		assert.ElementsMatch(t, []string{"folder:f2", "folder:f3", "team:t3"}, objects)
+
+		last := store.saved[len(store.saved)-1]
+		assert.False(t, last.Halted)
+		assert.Equal(t, 7, last.Processed)
+	})
+
+	t.Run("should persist checkpoints by object type when halted", func(t *testing.T) {
+		store := &recordingProgressStore{}
+		progress := newProgressTracker(store, 1, "test", namespace, "", 7)
+		progress.processed(context.Background(), "folder:f0")
+		progress.processed(context.Background(), "team:t1")
+		progress.processed(context.Background(), "team:t2")
+		progress.halt(context.Background())
+
+		last := store.saved[len(store.saved)-1]
+		assert.True(t, last.Halted)
+		assert.Equal(t, []ObjectTypeCheckpoint{
+			{ObjectType: "folder", LastKey: "folder:f0"},
+			{ObjectType: "team", LastKey: "team:t2"},
+		}, last.Checkpoints)
+	})
+}
+
+func TestZanzanaReconciler_ResumeHaltedReconciler(t *testing.T) {
+	namespace := claims.OrgNamespaceFormatter(1)
+
+	// teams completed in the halted run, folders was interrupted after f1
+	store := &recordingProgressStore{saved: []ReconcileProgress{
+		{Name: "teams", Namespace: namespace, Processed: 1, Total: 1},
+		{Name: "folders", Namespace: namespace, Processed: 2, Total: 3, Halted: true, Checkpoints: []ObjectTypeCheckpoint{
+			{ObjectType: "folder", LastKey: "folder:f1"},
+		}},
+	}}
+
+	client := newFakeZanzanaClient()
+	r := NewZanzanaReconciler(client, nil, nil, WithProgressStore(store, 1))
+	r.reconcilers = []resourceReconciler{
+		newResourceReconciler("teams", staticCollector(
+			teamMemberTuple("user:1", "t1"),
+		), zanzanaCollector([]string{zanzana.RelationTeamMember}), client),
+		newResourceReconciler("folders", staticCollector(
+			common.NewFolderTuple("user:1", zanzana.RelationRead, "f0"),
+			common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("user:1", zanzana.RelationRead, "f2"),
+		), zanzanaCollector(zanzana.FolderRelations), client),
+	}
+	for i := range r.reconcilers {
+		r.reconcilers[i].cfg = r.cfg
+	}
+
+	r.reconcileNamespace(context.Background(), namespace)
+
+	// teams are not reconciled again and folders resume after f1
+	stored := client.stored(namespace)
+	require.Len(t, stored, 1)
+	assert.Equal(t, "folder:f2", stored[0].Object)
+
+	t.Run("should run all reconcilers once the halted run is completed", func(t *testing.T) {
+		r.reconcileNamespace(context.Background(), namespace)
+		assert.Len(t, client.stored(namespace), 4)
+	})
+}
+
+func teamMemberTuple(subject, team string) *openfgav1.TupleKey {
+	return &openfgav1.TupleKey{User: subject, Relation: zanzana.RelationTeamMember, Object: zanzana.NewTupleEntry(zanzana.TypeTeam, team, "")}
+}
+
+func TestKVProgressStore(t *testing.T) {
+	store := NewKVProgressStore(kvstore.NewFakeKVStore())
+
+	require.NoError(t, store.SaveProgress(context.Background(), ReconcileProgress{Name: "b", Namespace: "org-2", Processed: 1, Total: 2}))
+	require.NoError(t, store.SaveProgress(context.Background(), ReconcileProgress{Name: "a", Namespace: "org-2", Processed: 1, Total: 3}))
+	require.NoError(t, store.SaveProgress(context.Background(), ReconcileProgress{Name: "a", Namespace: "org-2", Processed: 2, Total: 3}))
+	require.NoError(t, store.SaveProgress(context.Background(), ReconcileProgress{Name: "a", Namespace: "org-3", Processed: 1, Total: 1}))
+
+	progress, err := store.Progress(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, []ReconcileProgress{
+		{Name: "a", Namespace: "org-2", Processed: 2, Total: 3},
+		{Name: "b", Namespace: "org-2", Processed: 1, Total: 2},
+	}, progress)
+
+	last, ok, err := store.GetProgress(context.Background(), "a", "org-3")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, ReconcileProgress{Name: "a", Namespace: "org-3", Processed: 1, Total: 1}, last)
+
+	_, ok, err = store.GetProgress(context.Background(), "c", "org-2")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
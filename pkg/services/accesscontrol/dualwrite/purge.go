@@ -0,0 +1,93 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/authlib/claims"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+// PurgeTeams deletes all tuples of teams that were deleted from org: their memberships and every
+// tuple granted to their members. The namespace is read once for all teams and tuples are deleted
+// in batches, so deleting many teams at once doesn't cause a purge per team. Teams that still
+// exist in legacy are skipped. It returns the number of tuples deleted.
+func PurgeTeams(ctx context.Context, store db.DB, client zanzana.Client, orgId int64, teamUIDs []string) (int, error) {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.PurgeTeams")
+	defer span.End()
+
+	if len(teamUIDs) == 0 {
+		return 0, nil
+	}
+
+	var existing []string
+	err := store.WithDbSession(ctx, func(sess *db.Session) error {
+		return sess.Table("team").Where("org_id = ?", orgId).In("uid", teamUIDs).Cols("uid").Find(&existing)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read teams: %w", err)
+	}
+
+	deleted := make(map[string]struct{}, len(teamUIDs))
+	for _, uid := range teamUIDs {
+		deleted[uid] = struct{}{}
+	}
+	for _, uid := range existing {
+		delete(deleted, uid)
+	}
+
+	return purgeTeamTuples(ctx, client, claims.OrgNamespaceFormatter(orgId), deleted)
+}
+
+// purgeTeamTuples reads all tuples in namespace once and deletes the ones of teams.
+func purgeTeamTuples(ctx context.Context, client zanzana.Client, namespace string, teams map[string]struct{}) (int, error) {
+	if len(teams) == 0 {
+		return 0, nil
+	}
+
+	var deletes []*openfgav1.TupleKeyWithoutCondition
+	err := streamTuples(ctx, client, &authzextv1.ReadRequest{Namespace: namespace}, func(t *openfgav1.TupleKey) error {
+		if isTeamTuple(t, teams) {
+			deletes = append(deletes, &openfgav1.TupleKeyWithoutCondition{User: t.User, Relation: t.Relation, Object: t.Object})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to read tuples: %w", err)
+	}
+
+	err = batch(deletes, maxWriteSize, func(items []*openfgav1.TupleKeyWithoutCondition) error {
+		return client.Write(ctx, &authzextv1.WriteRequest{
+			Namespace: namespace,
+			Deletes:   &authzextv1.WriteRequestDeletes{TupleKeys: common.ToAuthzExtTupleKeysWithoutCondition(items)},
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete tuples: %w", err)
+	}
+	return len(deletes), nil
+}
+
+// isTeamTuple returns true if t is on one of teams or granted to one of them.
+func isTeamTuple(t *openfgav1.TupleKey, teams map[string]struct{}) bool {
+	prefix := zanzana.TypeTeam + ":"
+	if uid, ok := strings.CutPrefix(t.Object, prefix); ok {
+		if _, ok := teams[uid]; ok {
+			return true
+		}
+	}
+
+	if subject, ok := strings.CutPrefix(t.User, prefix); ok {
+		uid, _, _ := strings.Cut(subject, "#")
+		if _, ok := teams[uid]; ok {
+			return true
+		}
+	}
+	return false
+}
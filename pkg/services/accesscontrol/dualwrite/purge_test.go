@@ -0,0 +1,59 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestPurgeTeamTuples(t *testing.T) {
+	const (
+		namespace = "org-1"
+		teams     = 3
+		members   = 40
+	)
+
+	client := newFakeZanzanaClient()
+	client.pageSize = 50
+
+	var purged int
+	for i := 0; i < teams; i++ {
+		team := fmt.Sprintf("t%d", i)
+		for j := 0; j < members; j++ {
+			client.seed(namespace, &openfgav1.TupleKey{Object: "team:" + team, Relation: zanzana.RelationTeamMember, User: fmt.Sprintf("user:%d", j)})
+		}
+		client.seed(namespace, common.NewFolderTuple("team:"+team+"#member", zanzana.RelationRead, "f1"))
+		client.seed(namespace, common.NewResourceTuple("team:"+team+"#member", zanzana.RelationWrite, dashboardGroup, dashboardResource, "d1"))
+		purged += members + 2
+	}
+
+	kept := []*openfgav1.TupleKey{
+		{Object: "team:remaining", Relation: zanzana.RelationTeamMember, User: "user:1"},
+		common.NewFolderTuple("team:remaining#member", zanzana.RelationRead, "f1"),
+		common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+	}
+	client.seed(namespace, kept...)
+
+	deleted, err := purgeTeamTuples(context.Background(), client, namespace, map[string]struct{}{"t0": {}, "t1": {}, "t2": {}})
+	require.NoError(t, err)
+	assert.Equal(t, purged, deleted)
+
+	// deletes of all teams are sent together in full batches
+	require.Len(t, client.writes, (purged+maxWriteSize-1)/maxWriteSize)
+	for _, w := range client.writes[:len(client.writes)-1] {
+		assert.Len(t, w.GetDeletes().GetTupleKeys(), maxWriteSize)
+	}
+
+	stored := client.stored(namespace)
+	require.Len(t, stored, len(kept))
+	for _, tuple := range kept {
+		assert.Contains(t, stored, tuple)
+	}
+}
@@ -0,0 +1,82 @@
+package dualwrite
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"golang.org/x/time/rate"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+// adaptiveRate limits the rate of writes to zanzana based on observed latency. The rate is
+// halved every time a write is slower than threshold and recovers by a tenth of the max rate for
+// every write faster than it, so a slow backend is backed off quickly and recovered gradually.
+type adaptiveRate struct {
+	mu        sync.Mutex
+	limiter   *rate.Limiter
+	min       rate.Limit
+	max       rate.Limit
+	threshold time.Duration
+}
+
+// newAdaptiveRate creates a rate starting at maxRate writes per second that never drops below minRate.
+func newAdaptiveRate(maxRate, minRate float64, threshold time.Duration) *adaptiveRate {
+	if minRate > maxRate {
+		minRate = maxRate
+	}
+	return &adaptiveRate{
+		limiter:   rate.NewLimiter(rate.Limit(maxRate), 1),
+		min:       rate.Limit(minRate),
+		max:       rate.Limit(maxRate),
+		threshold: threshold,
+	}
+}
+
+func (a *adaptiveRate) wait(ctx context.Context) error {
+	return a.limiter.Wait(ctx)
+}
+
+// observe adapts the rate to the latency of a write.
+func (a *adaptiveRate) observe(latency time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	limit := a.limiter.Limit()
+	if latency > a.threshold {
+		limit = max(limit/2, a.min)
+	} else {
+		limit = min(limit+a.max/10, a.max)
+	}
+	a.limiter.SetLimit(limit)
+}
+
+// limit returns the current number of writes allowed per second.
+func (a *adaptiveRate) limit() float64 {
+	return float64(a.limiter.Limit())
+}
+
+// rateClient limits writes made to zanzana to an adaptive rate.
+type rateClient struct {
+	zanzana.Client
+	rate  *adaptiveRate
+	clock clock.Clock
+}
+
+func newRateClient(client zanzana.Client, rate *adaptiveRate, clk clock.Clock) *rateClient {
+	return &rateClient{Client: client, rate: rate, clock: clk}
+}
+
+func (c *rateClient) Write(ctx context.Context, req *authzextv1.WriteRequest) error {
+	if err := c.rate.wait(ctx); err != nil {
+		return err
+	}
+
+	start := c.clock.Now()
+	err := c.Client.Write(ctx, req)
+	c.rate.observe(c.clock.Since(start))
+	return err
+}
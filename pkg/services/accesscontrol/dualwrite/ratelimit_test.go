@@ -0,0 +1,75 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+func TestAdaptiveRate(t *testing.T) {
+	const threshold = 100 * time.Millisecond
+
+	t.Run("should reduce rate as latency rises and recover as it drops", func(t *testing.T) {
+		r := newAdaptiveRate(100, 10, threshold)
+		assert.Equal(t, float64(100), r.limit())
+
+		r.observe(50 * time.Millisecond)
+		assert.Equal(t, float64(100), r.limit())
+
+		r.observe(200 * time.Millisecond)
+		assert.Equal(t, float64(50), r.limit())
+		r.observe(300 * time.Millisecond)
+		assert.Equal(t, float64(25), r.limit())
+
+		r.observe(50 * time.Millisecond)
+		assert.Equal(t, float64(35), r.limit())
+		for i := 0; i < 10; i++ {
+			r.observe(10 * time.Millisecond)
+		}
+		assert.Equal(t, float64(100), r.limit())
+	})
+
+	t.Run("should not reduce rate below min", func(t *testing.T) {
+		r := newAdaptiveRate(100, 10, threshold)
+		for i := 0; i < 10; i++ {
+			r.observe(time.Second)
+		}
+		assert.Equal(t, float64(10), r.limit())
+	})
+}
+
+func TestRateClient(t *testing.T) {
+	const namespace = "default"
+
+	fake := newFakeZanzanaClient()
+	clk := clock.NewMock()
+	slow := &slowZanzanaClient{fakeZanzanaClient: fake, latency: 20 * time.Millisecond, clock: clk}
+	rate := newAdaptiveRate(1000, 1, 10*time.Millisecond)
+	client := newRateClient(slow, rate, clk)
+
+	write := func() {
+		err := client.Write(context.Background(), &authzextv1.WriteRequest{
+			Namespace: namespace,
+			Writes: &authzextv1.WriteRequestWrites{
+				TupleKeys: common.ToAuthzExtTupleKeys([]*openfgav1.TupleKey{common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")}),
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	write()
+	assert.Equal(t, float64(500), rate.limit())
+
+	slow.latency = 0
+	write()
+	assert.Equal(t, float64(600), rate.limit())
+}
@@ -0,0 +1,89 @@
+package dualwrite
+
+import (
+	"context"
+	"errors"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/sqlstore"
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+// errReadOnlyRollback is returned to roll back read-only sessions, it is never returned to callers.
+var errReadOnlyRollback = errors.New("rollback read-only session")
+
+var _ db.DB = (*readOnlyStore)(nil)
+
+// readOnlyStore runs sessions in a read-only transaction when read-only collection is enabled,
+// so a collector can't modify legacy data by mistake. Writes fail on dialects supporting
+// read-only transactions, every transaction is rolled back so writes are never persisted on
+// the others. Sessions are also transactional when a fetch size is set, as rows are then
+// fetched through cursors.
+type readOnlyStore struct {
+	db.DB
+	cfg *reconcileConfig
+}
+
+func newReadOnlyStore(store db.DB, cfg *reconcileConfig) db.DB {
+	if store == nil {
+		return nil
+	}
+	return &readOnlyStore{DB: store, cfg: cfg}
+}
+
+func (s *readOnlyStore) WithDbSession(ctx context.Context, callback sqlstore.DBTransactionFunc) error {
+	if !s.cfg.readOnlyCollection {
+		if s.cfg.fetchSize > 0 && supportsFetchSize(s.GetDialect().DriverName()) {
+			return s.DB.WithTransactionalDbSession(ctx, callback)
+		}
+		return s.DB.WithDbSession(ctx, callback)
+	}
+	return s.withReadOnlySession(ctx, callback)
+}
+
+func (s *readOnlyStore) WithTransactionalDbSession(ctx context.Context, callback sqlstore.DBTransactionFunc) error {
+	if !s.cfg.readOnlyCollection {
+		return s.DB.WithTransactionalDbSession(ctx, callback)
+	}
+	return s.withReadOnlySession(ctx, callback)
+}
+
+func (s *readOnlyStore) withReadOnlySession(ctx context.Context, callback sqlstore.DBTransactionFunc) error {
+	var err error
+	txErr := s.DB.WithTransactionalDbSession(ctx, func(sess *db.Session) error {
+		reset, setErr := setReadOnly(sess, s.GetDialect().DriverName())
+		if setErr != nil {
+			return setErr
+		}
+		defer reset()
+
+		err = callback(sess)
+		return errReadOnlyRollback
+	})
+
+	if err != nil {
+		return err
+	}
+	if txErr != nil && !errors.Is(txErr, errReadOnlyRollback) {
+		return txErr
+	}
+	return nil
+}
+
+// setReadOnly makes the transaction of sess read-only if supported by the dialect. The returned
+// function restores the connection for settings that outlive the transaction.
+func setReadOnly(sess *db.Session, driver string) (func(), error) {
+	switch driver {
+	case migrator.Postgres:
+		_, err := sess.Exec("SET TRANSACTION READ ONLY")
+		return func() {}, err
+	case migrator.SQLite:
+		if _, err := sess.Exec("PRAGMA query_only = ON"); err != nil {
+			return nil, err
+		}
+		return func() { _, _ = sess.Exec("PRAGMA query_only = OFF") }, nil
+	default:
+		// MySQL only allows making a transaction read-only before it is started.
+		return func() {}, nil
+	}
+}
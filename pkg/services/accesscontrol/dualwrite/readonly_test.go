@@ -0,0 +1,88 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+func TestIntegrationReadOnlyStore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	sql := db.InitTestDB(t)
+	cfg := newReconcileConfig()
+	store := newReadOnlyStore(sql, cfg)
+
+	insertMember := func(sess *db.Session, userID int64) error {
+		_, err := sess.Exec(
+			"INSERT INTO team_member (org_id, team_id, user_id, created, updated) VALUES (?, ?, ?, ?, ?)",
+			1, 1, userID, time.Now(), time.Now(),
+		)
+		return err
+	}
+
+	countMembers := func(t *testing.T) int64 {
+		t.Helper()
+		var count int64
+		err := sql.WithDbSession(context.Background(), func(sess *db.Session) error {
+			_, err := sess.SQL("SELECT COUNT(*) FROM team_member").Get(&count)
+			return err
+		})
+		require.NoError(t, err)
+		return count
+	}
+
+	t.Run("should allow writes when disabled", func(t *testing.T) {
+		err := store.WithDbSession(context.Background(), func(sess *db.Session) error {
+			return insertMember(sess, 1)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), countMembers(t))
+	})
+
+	cfg.readOnlyCollection = true
+
+	t.Run("should fail writes when enabled", func(t *testing.T) {
+		for _, run := range []func(context.Context, func(*db.Session) error) error{
+			func(ctx context.Context, fn func(*db.Session) error) error { return store.WithDbSession(ctx, fn) },
+			func(ctx context.Context, fn func(*db.Session) error) error {
+				return store.WithTransactionalDbSession(ctx, fn)
+			},
+		} {
+			err := run(context.Background(), func(sess *db.Session) error {
+				return insertMember(sess, 2)
+			})
+			switch sql.GetDialect().DriverName() {
+			case migrator.Postgres, migrator.SQLite:
+				assert.Error(t, err)
+			}
+			assert.Equal(t, int64(1), countMembers(t))
+		}
+	})
+
+	t.Run("should allow reads when enabled", func(t *testing.T) {
+		var count int64
+		err := store.WithDbSession(context.Background(), func(sess *db.Session) error {
+			_, err := sess.SQL("SELECT COUNT(*) FROM team_member").Get(&count)
+			return err
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("should allow writes after read-only session", func(t *testing.T) {
+		err := sql.WithDbSession(context.Background(), func(sess *db.Session) error {
+			return insertMember(sess, 3)
+		})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), countMembers(t))
+	})
+}
@@ -2,11 +2,17 @@ package dualwrite
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/grafana/authlib/claims"
 	openfgav1 "github.com/openfga/api/proto/openfga/v1"
 	"go.opentelemetry.io/otel"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 
 	"github.com/grafana/grafana/pkg/infra/db"
 	"github.com/grafana/grafana/pkg/infra/log"
@@ -16,6 +22,16 @@ import (
 
 var tracer = otel.Tracer("github.com/grafana/grafana/pkg/accesscontrol/migrator")
 
+const (
+	// reconciliationLockName is the server lock held while reconciling so instances never
+	// reconcile at the same time.
+	reconciliationLockName = "zanzana-reconciliation"
+	// reconciliationLockMaxInterval is how long a lock is held before it's considered dead.
+	// Every holder must use the same interval, a shorter one would take over a running
+	// full reconciliation.
+	reconciliationLockMaxInterval = 10 * time.Hour
+)
+
 // A TupleCollector is responsible to build and store [openfgav1.TupleKey] into provided tuple map.
 // They key used should be a unique group key for the collector so we can skip over an already synced group.
 type TupleCollector func(ctx context.Context, namespace string, tuples map[string][]*openfgav1.TupleKey) error
@@ -31,41 +47,568 @@ type ZanzanaReconciler struct {
 	// reconcilers are migrations that tries to reconcile the state of grafana db to zanzana store.
 	// These are run periodically to try to maintain a consistent state.
 	reconcilers []resourceReconciler
+	// cfg is shared by all reconcilers
+	cfg *reconcileConfig
+	// orgConcurrency is the maximum number of orgs reconciled at the same time.
+	orgConcurrency int
+	// locker is shared by all reconcilers so an object is never reconciled concurrently.
+	locker objectLocker
+	// shadow compares legacy decisions with zanzana, it is nil unless enabled with WithShadowChecks.
+	shadow *ShadowChecker
+	// tupleChecker is used by verifications that check relations on objects that are not resources.
+	tupleChecker zanzana.TupleChecker
+}
+
+type ReconcilerOption func(r *ZanzanaReconciler)
+
+// WithPanelPermissions enables reconciliation of permissions scoped to panels within dashboards.
+// They are written as subresource tuples on the dashboard.
+func WithPanelPermissions() ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.reconcilers = append(r.reconcilers, newResourceReconciler(
+			"managed panel permissions",
+			managedPermissionsCollector(r.store, zanzana.KindPanels, r.cfg),
+			zanzanaCollector(zanzana.SubresourceRelations),
+			r.client,
+		))
+	}
+}
+
+// WithPluginPagePermissions enables reconciliation of access granted to single pages of app
+// plugins. They are written as subresource tuples on the plugin.
+func WithPluginPagePermissions() ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.reconcilers = append(r.reconcilers, newResourceReconciler(
+			"managed plugin page permissions",
+			managedPermissionsCollector(r.store, zanzana.KindPlugins, r.cfg),
+			zanzanaCollector(zanzana.SubresourceRelations),
+			r.client,
+		))
+	}
+}
+
+// WithGroupRoleMappings enables reconciliation of the roles external identity provider groups
+// are mapped to. Members of the group are written as assignees of every role it is mapped to.
+func WithGroupRoleMappings() ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.reconcilers = append(r.reconcilers, newResourceReconciler(
+			"group role mappings",
+			groupRoleCollector(r.store),
+			zanzanaCollector([]string{zanzana.RelationAssignee}),
+			r.client,
+		))
+	}
+}
+
+// WithOrgMemberships enables reconciliation of the implicit membership of every org user in the
+// org. No relation of the schema grants access through org members yet, so the tuples are only
+// written when enabled by whoever depends on them.
+func WithOrgMemberships() ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.reconcilers = append(r.reconcilers, newResourceReconciler(
+			"org memberships",
+			orgMembershipCollector(r.store),
+			zanzanaCollector([]string{zanzana.RelationTeamMember}),
+			r.client,
+		))
+	}
+}
+
+// WithTeamVisibilityPermissions enables reconciliation of read access to teams granted to the
+// members of other teams. Only read tuples are written, team membership is left to the team
+// memberships reconciler.
+func WithTeamVisibilityPermissions() ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.reconcilers = append(r.reconcilers, newResourceReconciler(
+			"team visibility",
+			teamVisibilityCollector(r.store, r.cfg),
+			zanzanaCollector([]string{zanzana.RelationRead}),
+			r.client,
+		))
+	}
+}
+
+// WithAlertRulePermissions enables reconciliation of alert rule permissions granted on folders
+// as tuples on every alert rule within the folder and its subfolders.
+func WithAlertRulePermissions() ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		relations := []string{zanzana.RelationRead, zanzana.RelationWrite, zanzana.RelationDelete}
+		r.reconcilers = append(r.reconcilers, newResourceReconciler(
+			"alert rule permissions",
+			alertRuleCollector(r.store, r.cfg),
+			zanzanaCollector(relations),
+			r.client,
+		).withOrphans(orphanCollector(zanzana.KindAlertRules, r.cfg, relations)))
+	}
+}
+
+// WithInheritanceProvenance calls fn with every tuple collected from a permission granted on an
+// ancestor folder and the folder it was inherited from. Currently only alert rule permissions are
+// collected this way, see WithAlertRulePermissions.
+func WithInheritanceProvenance(fn InheritanceProvenance) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.inheritanceProvenance = fn
+	}
+}
+
+// WithDroppedTupleSink records every tuple or legacy permission that is collected but not
+// reconciled with the reason it was dropped, e.g. to NewNDJSONDroppedTupleSink.
+func WithDroppedTupleSink(sink DroppedTupleSink) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.droppedTuples = sink
+	}
+}
+
+// WithCompareStrategy selects how strictly tuples collected from legacy are compared with the
+// ones stored in zanzana, see CompareStrategy.
+func WithCompareStrategy(strategy CompareStrategy) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.compareStrategy = strategy
+	}
+}
+
+// WithCheckSampling makes semantic verification check only rate of the tuples, e.g. 0.01 checks
+// 1% of them. Every run checks a different sample, see WithCheckSamplingSeed to make it
+// reproducible.
+func WithCheckSampling(rate float64) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.checkSampling.rate = rate
+	}
+}
+
+// WithCheckSamplingSeed selects the sample of WithCheckSampling with seed instead of a seed
+// derived from the start of each run, so runs with the same seed and tuples check the same ones.
+// It's meant to reproduce a failed verification.
+func WithCheckSamplingSeed(seed int64) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.checkSampling.seed = seed
+		r.cfg.checkSampling.fixedSeed = true
+	}
+}
+
+// WithSilencePermissions enables reconciliation of alerting silence permissions granted on
+// folders. They are written to the folder resource tuples of the managed folder permissions.
+func WithSilencePermissions() ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.silencePermissions = true
+	}
+}
+
+// WithDatasourcePermissions enables reconciliation of managed datasource permissions. Permissions
+// on all datasources are written as namespace tuples.
+func WithDatasourcePermissions() ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.reconcilers = append(r.reconcilers, newResourceReconciler(
+			"managed datasource permissions",
+			managedPermissionsCollector(r.store, zanzana.KindDatasources, r.cfg),
+			zanzanaCollector(zanzana.ResourceRelations),
+			r.client,
+		).withKinds(zanzana.KindDatasources))
+	}
+}
+
+// WithQueryHistoryPermissions enables reconciliation of the access users have to their own query
+// history. Query history has no permissions in legacy, so owners are granted the implied actions.
+func WithQueryHistoryPermissions() ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		relations := []string{zanzana.RelationRead, zanzana.RelationWrite, zanzana.RelationDelete}
+		r.reconcilers = append(r.reconcilers, newResourceReconciler(
+			"query history permissions",
+			queryHistoryCollector(r.store, r.cfg),
+			zanzanaCollector(relations),
+			r.client,
+		).withOrphans(orphanCollector(zanzana.KindQueryHistory, r.cfg, relations)))
+	}
+}
+
+// WithDeleteExclusions configures relations that are managed by other systems. Tuples with
+// these relations are never removed by stale deletion even if they don't exist in legacy.
+func WithDeleteExclusions(relations ...string) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		for _, relation := range relations {
+			r.cfg.deleteExclusions[relation] = struct{}{}
+		}
+	}
+}
+
+// WithRelationAllowList restricts reconciliation of objects of objectType to tuples with one of
+// relations, e.g. only parent for folders. Tuples with other relations are neither written nor
+// deleted, which allows relations to be rolled out one at a time. Can be set once per object type.
+func WithRelationAllowList(objectType string, relations ...string) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		allowed := make(map[string]struct{}, len(relations))
+		for _, relation := range relations {
+			allowed[relation] = struct{}{}
+		}
+		r.cfg.relationAllowLists[objectType] = allowed
+	}
+}
+
+// WithMaxDeleteFraction aborts a reconciler before it applies any change if it would delete more
+// than fraction of the stored tuples of an object type, e.g. 0.5 for half of them. Deleting that
+// many tuples is likely caused by a bug or data loss in legacy. The changes of all objects are then
+// computed before the first one is applied.
+func WithMaxDeleteFraction(fraction float64) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.maxDeleteFraction = fraction
+	}
+}
+
+// WithClock sets the clock used for run timestamps, time budgets and the maintenance window.
+func WithClock(clk clock.Clock) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.clock = clk
+	}
+}
+
+// WithShadowChecks compares decisions made by access clients wrapped with AccessClient
+// against zanzana so divergence can be found before zanzana is used for authorization.
+func WithShadowChecks() ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.shadow = NewShadowChecker(r.client)
+	}
+}
+
+// WithTupleChecker sets the checker used by verifications that check relations on objects that
+// are not exposed as resources, e.g. VerifyTeamAdminMembership. The client is used if it
+// implements zanzana.TupleChecker.
+func WithTupleChecker(checker zanzana.TupleChecker) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.tupleChecker = checker
+	}
+}
+
+// WithOrphanSweepInterval sets how often reconcilers read the whole namespace to delete tuples of
+// objects that are gone from legacy, e.g. permissions of deleted dashboards. Defaults to an hour,
+// 0 sweeps on every run.
+func WithOrphanSweepInterval(interval time.Duration) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.orphanSweeps = newSweepSchedule(interval)
+	}
+}
+
+// WithMaintenanceWindow only deletes stale tuples within window. Outside of it missing tuples are
+// still written, but deletes are only reported and deferred until a reconciliation runs inside it.
+func WithMaintenanceWindow(window MaintenanceWindow) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.maintenanceWindow = &window
+	}
 }
 
-func NewZanzanaReconciler(client zanzana.Client, store db.DB, lock *serverlock.ServerLockService) *ZanzanaReconciler {
-	return &ZanzanaReconciler{
-		client: client,
-		lock:   lock,
-		log:    log.New("zanzana.reconciler"),
-		store:  store,
+// WithRollbackOnFailure gives reconciliation of a namespace all-or-nothing semantics. Changes are
+// tracked while reconcilers run and if one of them fails or the run is cancelled, the remaining
+// reconcilers are skipped and all changes are reversed to restore the state before the run.
+// Every deleted tuple is read before it is deleted so it can be restored with its condition.
+func WithRollbackOnFailure() ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.rollbackOnFailure = true
+	}
+}
+
+// WithRetryBudget enables retries of failed reads and writes. The budget is shared by all calls
+// made by the reconciler and allows a burst of retries that is refilled by one retry every refill.
+func WithRetryBudget(retries int, refill time.Duration) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.retryBudget = newRetryBudget(retries, refill)
+	}
+}
+
+// WithRunRetryBudget limits the total number of retries of a single reconciliation run across
+// all orgs and reconcilers. Once exhausted failed calls are no longer retried and the run is
+// stopped, so a degraded zanzana server can't cause a storm of retries. It takes precedence
+// over WithRetryBudget.
+func WithRunRetryBudget(retries int) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.runRetries = retries
+	}
+}
+
+// WithOrgConcurrency sets how many orgs are reconciled in parallel. Every org runs all
+// collectors so this caps the number of concurrent database queries. Defaults to 1.
+func WithOrgConcurrency(n int) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.orgConcurrency = n
+	}
+}
+
+// WithObjectServerLock locks every reconciled object using the server lock so reconcilers
+// running in different instances don't interleave. Objects are always locked within a process.
+func WithObjectServerLock() ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		if r.lock != nil {
+			r.locker = newServerObjectLocker(r.lock, newKeyedMutex())
+		}
+	}
+}
+
+// WithDeletedResourcePermissions collects permissions on dashboards that are deleted but retained
+// so they can be restored. By default these are excluded so they don't grant access.
+func WithDeletedResourcePermissions() ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.includeDeletedResources = true
+	}
+}
+
+// WithIdentifierResolver sets the resolver used to normalize permission identifiers into uids
+// before they are translated into tuples. Identifiers are used as is by default.
+func WithIdentifierResolver(resolver IdentifierResolver) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.identifierResolver = resolver
+	}
+}
+
+// WithProgressStore persists the progress of every reconciler to store each time interval
+// objects have been reconciled, e.g. so it can be displayed while a migration is running.
+func WithProgressStore(store ProgressStore, interval int) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.progressStore = store
+		r.cfg.progressInterval = interval
+	}
+}
+
+// WithIdempotencyStore saves an idempotency key derived from the legacy tuples of every object
+// once they are applied. Keys are scoped to the snapshot id of the run, see ContextWithSnapshotID,
+// and retries of the same snapshot skip objects whose tuples have not changed since. Runs without
+// snapshot id, e.g. periodic ones, don't use keys so drift in zanzana is always repaired. Keys of a
+// rolled back run are cleared.
+func WithIdempotencyStore(store IdempotencyStore) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.idempotencyStore = store
+	}
+}
+
+// WithObjectSetStore saves the folders and teams collected by every run in store. Tuples of
+// folders and teams that are gone from legacy since the last run are deleted by reading only
+// their tuples, instead of all tuples of the namespace.
+func WithObjectSetStore(store ObjectSetStore) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.objectSetStore = store
+	}
+}
+
+// WithConvergenceStore persists the convergence state of every org in store, so the first time an
+// org is reconciled without changes is logged once across restarts and instances.
+func WithConvergenceStore(store ConvergenceStore) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.convergenceStore = store
+	}
+}
+
+// WithHistoryStore persists the summary of every reconciliation run of an org in store.
+func WithHistoryStore(store ReconcileHistoryStore) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.historyStore = store
+	}
+}
+
+// WithReadOnlyCollection runs every legacy read in a read-only transaction that is always
+// rolled back, so a faulty collector can't modify legacy data. Writes fail on Postgres and
+// SQLite, on other dialects they are discarded.
+func WithReadOnlyCollection() ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.readOnlyCollection = true
+	}
+}
+
+// WithFetchSize fetches legacy rows of large collections n rows per round trip instead of all at
+// once. It is only applied on Postgres, where rows are fetched through a cursor, other drivers
+// read all rows with a single query.
+func WithFetchSize(n int) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.fetchSize = n
+	}
+}
+
+// WithTeamMemberLastSeen reports when members of teams were last seen to sink every time team
+// memberships are reconciled so dormant access can be detected. It is not written to zanzana.
+func WithTeamMemberLastSeen(sink TeamMemberLastSeenSink) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.teamMemberLastSeen = sink
+	}
+}
+
+// WithTimeBudget halts reconciliation runs that take longer than budget. Reconcilers stop between
+// objects and, if a progress store is set with WithProgressStore, checkpoint the last reconciled
+// object so the next run resumes after it.
+func WithTimeBudget(budget time.Duration) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.timeBudget = budget
+	}
+}
+
+// WithAdaptiveWriteRate limits writes to zanzana to maxRate writes per second. The rate is reduced
+// when a write takes longer than threshold, down to minRate, and recovers as latency drops.
+func WithAdaptiveWriteRate(maxRate, minRate float64, threshold time.Duration) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.writeRate = newAdaptiveRate(maxRate, minRate, threshold)
+	}
+}
+
+// WithReportWebhook posts the report of every completed reconciliation as JSON to url. Requests
+// time out after timeout and are retried up to retries times, failing to deliver a report
+// doesn't fail the reconciliation.
+func WithReportWebhook(url string, timeout time.Duration, retries int) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.reportWebhook = newReportWebhook(url, timeout, retries)
+	}
+}
+
+// WithInFlightWindow bounds the number of reads and writes to zanzana in flight at the same time
+// to n, combined for all reconcilers and orgs.
+func WithInFlightWindow(n int) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.inFlightWindow = semaphore.NewWeighted(int64(n))
+	}
+}
+
+// WithBasicRolePermissions reconciles the fixed permissions of basic roles returned by
+// permissions. They are read on every reconciliation so roles registered after the
+// reconciler is created are included. They are reconciled with the namespace permissions.
+func WithBasicRolePermissions(permissions BasicRolePermissions) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.basicRolePermissions = permissions
+	}
+}
+
+// WithLegacyCollector reconciles tuples collected by collector under name. Stored tuples with
+// any of relations on the collected objects that are not collected are deleted.
+func WithLegacyCollector(name string, collector LegacyCollector, relations []string) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.reconcilers = append(r.reconcilers, newResourceReconciler(
+			name,
+			externalCollector(collector),
+			zanzanaCollector(relations),
+			r.client,
+		))
+	}
+}
+
+// WithTranslationVersion pins the version used to translate legacy permissions into tuples.
+// By default the latest version is used.
+func WithTranslationVersion(version zanzana.TranslationVersion) ReconcilerOption {
+	return func(r *ZanzanaReconciler) {
+		r.cfg.translationVersion = version
+	}
+}
+
+func NewZanzanaReconciler(client zanzana.Client, store db.DB, lock *serverlock.ServerLockService, opts ...ReconcilerOption) *ZanzanaReconciler {
+	cfg := newReconcileConfig()
+	// The store is wrapped before options are applied, it reads cfg on every session.
+	store = newReadOnlyStore(store, cfg)
+	r := &ZanzanaReconciler{
+		client:         client,
+		lock:           lock,
+		log:            log.New("zanzana.reconciler"),
+		store:          store,
+		cfg:            cfg,
+		orgConcurrency: 1,
+		locker:         newKeyedMutex(),
 		reconcilers: []resourceReconciler{
 			newResourceReconciler(
 				"team memberships",
-				teamMembershipCollector(store),
+				teamMembershipCollector(store, cfg),
 				zanzanaCollector([]string{zanzana.RelationTeamMember, zanzana.RelationTeamAdmin}),
 				client,
+			).withObjectTracking().withKinds(zanzana.KindTeams),
+			newResourceReconciler(
+				"group memberships",
+				groupMembershipCollector(store),
+				zanzanaCollector([]string{zanzana.RelationTeamMember}),
+				client,
+			),
+			newResourceReconciler(
+				"basic roles",
+				basicRoleCollector(store),
+				zanzanaCollector([]string{zanzana.RelationAssignee}),
+				client,
 			),
 			newResourceReconciler(
 				"folder tree",
 				folderTreeCollector(store),
 				zanzanaCollector([]string{zanzana.RelationParent}),
 				client,
-			),
+			).withObjectTracking().withKinds(zanzana.KindFolders),
 			newResourceReconciler(
 				"managed folder permissions",
-				managedPermissionsCollector(store, zanzana.KindFolders),
+				managedPermissionsCollector(store, zanzana.KindFolders, cfg),
 				zanzanaCollector(zanzana.FolderRelations),
 				client,
-			),
+			).withObjectTracking().withKinds(zanzana.KindFolders),
 			newResourceReconciler(
 				"managed dashboard permissions",
-				managedPermissionsCollector(store, zanzana.KindDashboards),
+				managedPermissionsCollector(store, zanzana.KindDashboards, cfg),
+				zanzanaCollector(zanzana.ResourceRelations),
+				client,
+			).withOrphans(orphanCollector(zanzana.KindDashboards, cfg, zanzana.ResourceRelations)).withKinds(zanzana.KindDashboards),
+			newResourceReconciler(
+				"public dashboards",
+				publicDashboardCollector(store),
+				zanzanaCollector([]string{zanzana.RelationPublicRead}),
+				client,
+			).withOrphans(orphanCollector(zanzana.KindDashboards, cfg, []string{zanzana.RelationPublicRead})),
+			newResourceReconciler(
+				"managed service account permissions",
+				managedPermissionsCollector(store, zanzana.KindServiceAccounts, cfg),
+				zanzanaCollector(zanzana.ServiceAccountRelations),
+				client,
+			).withKinds(zanzana.KindServiceAccounts),
+			newResourceReconciler(
+				"managed library panel permissions",
+				managedPermissionsCollector(store, zanzana.KindLibraryPanels, cfg),
+				zanzanaCollector(zanzana.ResourceRelations),
+				client,
+			).withKinds(zanzana.KindLibraryPanels),
+			// Namespace objects are owned by a single reconciler, it collects permissions on all
+			// resources of the kinds of every managed permission reconciler and basic roles.
+			newResourceReconciler(
+				"namespace permissions",
+				namespacePermissionCollector(store, cfg),
 				zanzanaCollector(zanzana.ResourceRelations),
 				client,
 			),
+			// Stars are not reconciled. Starring a dashboard grants no access and folders can't
+			// be starred, deployments giving stars any meaning can use WithLegacyCollector.
+			// Cloud migration sessions and snapshots have no permissions of their own either,
+			// they are restricted to org admins which are reconciled through basic roles.
 		},
 	}
+
+	for _, o := range opts {
+		o(r)
+	}
+
+	for i := range r.reconcilers {
+		r.reconcilers[i].cfg = r.cfg
+		r.reconcilers[i].locker = r.locker
+		if r.cfg.inFlightWindow != nil {
+			r.reconcilers[i].client = newWindowClient(r.reconcilers[i].client, r.cfg.inFlightWindow)
+		}
+		if r.cfg.writeRate != nil {
+			r.reconcilers[i].client = newRateClient(r.reconcilers[i].client, r.cfg.writeRate, r.cfg.clock)
+		}
+		if r.cfg.retryBudget != nil || r.cfg.runRetries > 0 {
+			r.reconcilers[i].client = newRetryClient(r.reconcilers[i].client, r.cfg.retryBudget)
+		}
+		if r.cfg.rollbackOnFailure {
+			r.reconcilers[i].client = newJournalClient(r.reconcilers[i].client)
+		}
+	}
+
+	return r
+}
+
+// detectLegacySchema validates the legacy schema and adapts collectors to its version.
+func (r *ZanzanaReconciler) detectLegacySchema() error {
+	version, err := validateLegacySchema(storeColumnLister(r.store))
+	if err != nil {
+		return err
+	}
+
+	if version != legacySchemaLatest {
+		r.log.Info("Collecting from previous legacy schema", "version", version)
+	}
+	r.cfg.legacySchema = version
+	return nil
 }
 
 // Sync runs all collectors and tries to write all collected tuples.
@@ -75,21 +618,67 @@ func (r *ZanzanaReconciler) Sync(ctx context.Context) error {
 	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.Sync")
 	defer span.End()
 
+	if err := r.detectLegacySchema(); err != nil {
+		return err
+	}
+
 	r.reconcile(ctx)
 
 	return nil
 }
 
+// DryRun computes the changes all reconcilers would make for namespace without applying them.
+func (r *ZanzanaReconciler) DryRun(ctx context.Context, namespace string) (*ReconcileResult, error) {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.DryRun")
+	defer span.End()
+
+	return r.dryRun(ctx, namespace, nil)
+}
+
+// DryRunWithValidation computes the changes like DryRun and validates every collected tuple
+// against the zanzana schema in the same pass. Tuples not allowed by the schema are returned
+// as violations of the result so both drift and model mismatches can be reviewed before
+// applying.
+func (r *ZanzanaReconciler) DryRunWithValidation(ctx context.Context, namespace string) (*ReconcileResult, error) {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.DryRunWithValidation")
+	defer span.End()
+
+	validator, err := loadSchemaValidator()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema: %w", err)
+	}
+
+	return r.dryRun(ctx, namespace, validator)
+}
+
+func (r *ZanzanaReconciler) dryRun(ctx context.Context, namespace string, validator *schemaValidator) (*ReconcileResult, error) {
+	result := &ReconcileResult{SnapshotID: SnapshotIDFromContext(ctx)}
+	for _, reconciler := range r.reconcilers {
+		res, err := reconciler.validatedDryRun(ctx, namespace, validator)
+		if err != nil {
+			return nil, err
+		}
+		result.merge(res)
+	}
+
+	result.sort()
+	return result, nil
+}
+
 // Reconcile schedules as job that will run and reconcile resources between
 // legacy access control and zanzana.
 func (r *ZanzanaReconciler) Reconcile(ctx context.Context) error {
+	if err := r.detectLegacySchema(); err != nil {
+		return err
+	}
+
 	// FIXME: try to reconcile at start whenever we have moved all syncs to reconcilers
 	// r.reconcile(ctx)
 
 	// FIXME:
 	// 1. We should be a bit graceful about reconciliations so we are not hammering dbs
 	// 2. We should be able to configure reconciliation interval
-	ticker := time.NewTicker(1 * time.Hour)
+	ticker := r.cfg.clock.Ticker(1 * time.Hour)
 	for {
 		select {
 		case <-ticker.C:
@@ -101,34 +690,286 @@ func (r *ZanzanaReconciler) Reconcile(ctx context.Context) error {
 }
 
 func (r *ZanzanaReconciler) reconcile(ctx context.Context) {
-	run := func(ctx context.Context, namespace string) {
-		now := time.Now()
-		for _, reconciler := range r.reconcilers {
-			if err := reconciler.reconcile(ctx, namespace); err != nil {
-				r.log.Warn("Failed to perform reconciliation for resource", "err", err)
+	orgIds, err := r.getOrgs(ctx)
+	if err != nil {
+		return
+	}
+
+	runAll := func(ctx context.Context) {
+		ctx = r.withRunBudgets(ctx)
+		observeSnapshot(ctx)
+		forEachOrg(ctx, orgIds, r.orgConcurrency, func(ctx context.Context, orgId int64) {
+			r.reconcileNamespace(ctx, claims.OrgNamespaceFormatter(orgId))
+		})
+	}
+
+	if r.lock == nil {
+		runAll(ctx)
+		return
+	}
+
+	// We ignore the error for now
+	_ = r.lock.LockExecuteAndRelease(ctx, reconciliationLockName, reconciliationLockMaxInterval, runAll)
+}
+
+// MigrateOrgRange reconciles every org with an id between fromOrg and toOrg, inclusive, so orgs
+// can be migrated in stages. Ids in the range without an org are skipped. The ids of the
+// reconciled orgs are returned.
+func (r *ZanzanaReconciler) MigrateOrgRange(ctx context.Context, fromOrg, toOrg int64) ([]int64, error) {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.MigrateOrgRange")
+	defer span.End()
+
+	if fromOrg > toOrg {
+		return nil, fmt.Errorf("invalid org range %d-%d", fromOrg, toOrg)
+	}
+
+	orgIds, err := r.getOrgs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orgIds = orgsInRange(orgIds, fromOrg, toOrg)
+
+	if r.lock == nil {
+		r.migrateOrgs(ctx, orgIds)
+		return orgIds, nil
+	}
+
+	err = r.lock.LockExecuteAndRelease(ctx, reconciliationLockName, reconciliationLockMaxInterval, func(ctx context.Context) {
+		r.migrateOrgs(ctx, orgIds)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return orgIds, nil
+}
+
+func (r *ZanzanaReconciler) migrateOrgs(ctx context.Context, orgIds []int64) {
+	ctx = r.withRunBudgets(ctx)
+	observeSnapshot(ctx)
+	forEachOrg(ctx, orgIds, r.orgConcurrency, func(ctx context.Context, orgId int64) {
+		r.reconcileNamespace(ctx, claims.OrgNamespaceFormatter(orgId))
+	})
+}
+
+// orgsInRange returns the sorted ids of orgIds between fromOrg and toOrg, inclusive.
+func orgsInRange(orgIds []int64, fromOrg, toOrg int64) []int64 {
+	out := make([]int64, 0, len(orgIds))
+	for _, id := range orgIds {
+		if id >= fromOrg && id <= toOrg {
+			out = append(out, id)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// reconcileNamespace runs all reconcilers for namespace. It stops early once the retry budget
+// of the run is exhausted.
+func (r *ZanzanaReconciler) reconcileNamespace(ctx context.Context, namespace string) {
+	now := r.cfg.clock.Now()
+	budget := runRetryBudgetFromContext(ctx)
+	timeBudget := timeBudgetFromContext(ctx)
+
+	run := ReconcileRun{Timestamp: now, SnapshotID: SnapshotIDFromContext(ctx)}
+	defer func() {
+		r.saveRun(ctx, namespace, run)
+	}()
+
+	var journal *rollbackJournal
+	if r.cfg.rollbackOnFailure {
+		journal = newRollbackJournal()
+		ctx = withRollbackJournal(ctx, journal)
+	}
+
+	// Reconcilers before the one a halted run stopped in were completed by it and are skipped.
+	resume := r.resumeIndex(ctx, namespace)
+	if resume > 0 {
+		r.log.Info("Resuming halted reconciliation", snapshotLogArgs(ctx, "namespace", namespace, "name", r.reconcilers[resume].name)...)
+	}
+
+	// complete is unset if any reconciler failed or was skipped, changes are then unknown.
+	complete := resume == 0
+	var changes int
+	for _, reconciler := range r.reconcilers[resume:] {
+		if budget.isExhausted() {
+			r.log.Warn("Retry budget exhausted, stopping reconciliation", snapshotLogArgs(ctx, "namespace", namespace)...)
+			run.Halted = true
+			r.haltBefore(ctx, namespace, reconciler)
+			return
+		}
+		if timeBudget.isExceeded() {
+			r.log.Info("Time budget exceeded, stopping reconciliation", snapshotLogArgs(ctx, "namespace", namespace)...)
+			run.Halted = true
+			r.haltBefore(ctx, namespace, reconciler)
+			return
+		}
+
+		report, err := reconciler.reconcile(ctx, namespace)
+		if errors.Is(err, errTimeBudgetExceeded) {
+			r.log.Info("Time budget exceeded, halted reconciliation", snapshotLogArgs(ctx, "name", reconciler.name, "namespace", namespace)...)
+			run.Halted = true
+			return
+		}
+		if errors.Is(err, errMassDeletion) {
+			complete = false
+			run.Failed++
+			initMetrics().massDeletionAbortedTotal.WithLabelValues(reconciler.name).Inc()
+			r.log.Error("Aborted reconciliation that would delete too many tuples", snapshotLogArgs(ctx, "name", reconciler.name, "namespace", namespace, "err", err)...)
+			if journal != nil {
+				r.rollback(ctx, namespace, journal)
+				return
+			}
+			continue
+		}
+		if err != nil {
+			complete = false
+			run.Failed++
+			r.log.Warn("Failed to perform reconciliation for resource", snapshotLogArgs(ctx, "err", err)...)
+			if journal != nil {
+				r.rollback(ctx, namespace, journal)
+				return
+			}
+			continue
+		}
+		changes += report.Writes + report.Deletes
+		run.Writes += report.Writes
+		run.Deletes += report.Deletes
+		run.Updates += report.Updates
+		r.log.Debug(
+			"Reconciled resource",
+			snapshotLogArgs(ctx,
+				"name", report.Name,
+				"namespace", report.Namespace,
+				"writes", report.Writes,
+				"deletes", report.Deletes,
+				"deferredDeletes", report.DeferredDeletes,
+				"elapsed", report.Total,
+				"legacyCollection", report.Phases.LegacyCollection,
+				"zanzanaRead", report.Phases.ZanzanaRead,
+				"diff", report.Phases.Diff,
+				"write", report.Phases.Write,
+				"delete", report.Phases.Delete,
+			)...,
+		)
+
+		if r.cfg.reportWebhook != nil {
+			if err := r.cfg.reportWebhook.send(ctx, report); err != nil {
+				r.log.Warn("Failed to send reconcile report to webhook", snapshotLogArgs(ctx, "name", report.Name, "namespace", report.Namespace, "err", err)...)
 			}
 		}
-		r.log.Debug("Finished reconciliation", "elapsed", time.Since(now))
 	}
 
-	orgIds, err := r.getOrgs(ctx)
+	if complete {
+		r.observeConvergence(ctx, namespace, changes)
+	}
+	r.log.Debug("Finished reconciliation", snapshotLogArgs(ctx, "namespace", namespace, "elapsed", r.cfg.clock.Since(now))...)
+}
+
+// resumeIndex returns the index of the reconciler the last run of namespace was halted in, or 0
+// if it was not halted. Reconcilers run in order, so all reconcilers before it were completed.
+func (r *ZanzanaReconciler) resumeIndex(ctx context.Context, namespace string) int {
+	if r.cfg.progressStore == nil {
+		return 0
+	}
+	for i, reconciler := range r.reconcilers {
+		last, ok, err := r.cfg.progressStore.GetProgress(ctx, reconciler.name, namespace)
+		if err == nil && ok && last.Halted {
+			return i
+		}
+	}
+	return 0
+}
+
+// haltBefore marks reconciler as halted before it started, so the next run resumes with it.
+// Checkpoints of an earlier halted run of the reconciler are kept.
+func (r *ZanzanaReconciler) haltBefore(ctx context.Context, namespace string, reconciler resourceReconciler) {
+	progress := newProgressTracker(r.cfg.progressStore, r.cfg.progressInterval, reconciler.name, namespace, SnapshotIDFromContext(ctx), 0)
+	progress.resume(progress.resumeCheckpoints(ctx), 0)
+	progress.halt(ctx)
+}
+
+// saveRun persists the summary of a run of namespace if a history store is configured.
+func (r *ZanzanaReconciler) saveRun(ctx context.Context, namespace string, run ReconcileRun) {
+	if r.cfg.historyStore == nil {
+		return
+	}
+
+	info, err := claims.ParseNamespace(namespace)
 	if err != nil {
 		return
 	}
 
-	for _, orgId := range orgIds {
-		ns := claims.OrgNamespaceFormatter(orgId)
+	run.OrgID = info.OrgID
+	run.Duration = r.cfg.clock.Since(run.Timestamp)
+	if err := r.cfg.historyStore.SaveRun(ctx, run); err != nil {
+		r.log.Warn("Failed to save reconciliation history", snapshotLogArgs(ctx, "namespace", namespace, "err", err)...)
+	}
+}
 
-		if r.lock == nil {
-			run(ctx, ns)
-			return
+// rollback reverses the changes recorded in journal. It runs even if ctx is cancelled, as the
+// run may have failed because of it.
+func (r *ZanzanaReconciler) rollback(ctx context.Context, namespace string, journal *rollbackJournal) {
+	ctx = context.WithoutCancel(ctx)
+	// Keys are cleared first, a retry then reconciles objects even if reversing their tuples fails.
+	if r.cfg.idempotencyStore != nil {
+		if err := clearIdempotencyKeys(ctx, r.cfg.idempotencyStore, namespace, journal); err != nil {
+			r.log.Warn("Failed to clear idempotency keys of rolled back reconciliation", snapshotLogArgs(ctx, "namespace", namespace, "err", err)...)
 		}
+	}
+	if err := journal.rollback(ctx, r.client, namespace); err != nil {
+		r.log.Error("Failed to roll back reconciliation", snapshotLogArgs(ctx, "namespace", namespace, "err", err)...)
+		return
+	}
+	r.log.Info("Rolled back reconciliation", snapshotLogArgs(ctx, "namespace", namespace)...)
+}
 
-		// We ignore the error for now
-		_ = r.lock.LockExecuteAndRelease(ctx, "zanzana-reconciliation", 10*time.Hour, func(ctx context.Context) {
-			run(ctx, ns)
+// observeConvergence logs the first time namespace is reconciled without changes.
+func (r *ZanzanaReconciler) observeConvergence(ctx context.Context, namespace string, changes int) {
+	state, converged, err := observeConvergence(ctx, r.cfg.convergenceStore, namespace, changes, r.cfg.clock.Now())
+	if err != nil {
+		r.log.Warn("Failed to observe convergence", snapshotLogArgs(ctx, "namespace", namespace, "err", err)...)
+		return
+	}
+	if converged {
+		r.log.Info("Namespace converged", snapshotLogArgs(ctx, "namespace", namespace, "driftedRuns", state.DriftedRuns)...)
+	}
+}
+
+// withRunBudgets returns a context with the retry and time budgets of a single run.
+func (r *ZanzanaReconciler) withRunBudgets(ctx context.Context) context.Context {
+	ctx = r.withRunRetryBudget(ctx)
+	if r.cfg.timeBudget <= 0 {
+		return ctx
+	}
+	return withTimeBudget(ctx, newTimeBudget(r.cfg.clock, r.cfg.timeBudget))
+}
+
+// withRunRetryBudget returns a context with a new retry budget for a reconciliation run if enabled.
+func (r *ZanzanaReconciler) withRunRetryBudget(ctx context.Context) context.Context {
+	if r.cfg.runRetries <= 0 {
+		return ctx
+	}
+	return withRunRetryBudget(ctx, newRunRetryBudget(r.cfg.runRetries))
+}
+
+// forEachOrg calls fn for every org with at most concurrency orgs running at the same time.
+// Orgs are flat and every org is reconciled into its own namespace store, grants never apply
+// across orgs so orgs can be reconciled independently.
+func forEachOrg(ctx context.Context, orgIds []int64, concurrency int, fn func(ctx context.Context, orgId int64)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for _, orgId := range orgIds {
+		g.Go(func() error {
+			fn(ctx, orgId)
+			return nil
 		})
 	}
+
+	_ = g.Wait()
 }
 
 func (r *ZanzanaReconciler) getOrgs(ctx context.Context) ([]int64, error) {
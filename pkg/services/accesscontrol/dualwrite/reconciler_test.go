@@ -0,0 +1,154 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/grafana/authlib/claims"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestNewZanzanaReconciler(t *testing.T) {
+	names := func(r *ZanzanaReconciler) []string {
+		out := make([]string, 0, len(r.reconcilers))
+		for _, rr := range r.reconcilers {
+			out = append(out, rr.name)
+		}
+		return out
+	}
+
+	t.Run("should not reconcile panel permissions by default", func(t *testing.T) {
+		r := NewZanzanaReconciler(newFakeZanzanaClient(), nil, nil)
+		assert.NotContains(t, names(r), "managed panel permissions")
+	})
+
+	t.Run("should reconcile panel permissions when enabled", func(t *testing.T) {
+		r := NewZanzanaReconciler(newFakeZanzanaClient(), nil, nil, WithPanelPermissions())
+		assert.Contains(t, names(r), "managed panel permissions")
+	})
+
+	t.Run("should only reconcile query history permissions when enabled", func(t *testing.T) {
+		r := NewZanzanaReconciler(newFakeZanzanaClient(), nil, nil)
+		assert.NotContains(t, names(r), "query history permissions")
+
+		r = NewZanzanaReconciler(newFakeZanzanaClient(), nil, nil, WithQueryHistoryPermissions())
+		assert.Contains(t, names(r), "query history permissions")
+	})
+
+	t.Run("should only reconcile org memberships when enabled", func(t *testing.T) {
+		r := NewZanzanaReconciler(newFakeZanzanaClient(), nil, nil)
+		assert.NotContains(t, names(r), "org memberships")
+
+		r = NewZanzanaReconciler(newFakeZanzanaClient(), nil, nil, WithOrgMemberships())
+		assert.Contains(t, names(r), "org memberships")
+	})
+
+	t.Run("should reconcile tuples of registered legacy collector", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		namespace := claims.OrgNamespaceFormatter(1)
+		stale := common.NewResourceTuple("user:2", zanzana.RelationRead, "example.grafana.app", "items", "i1")
+		client.seed(namespace, stale)
+
+		tuple := common.NewResourceTuple("user:1", zanzana.RelationRead, "example.grafana.app", "items", "i1")
+		r := NewZanzanaReconciler(client, nil, nil, WithLegacyCollector("items", func(ctx context.Context, orgId int64) ([]*openfgav1.TupleKey, error) {
+			return []*openfgav1.TupleKey{tuple}, nil
+		}, zanzana.ResourceRelations))
+		require.Contains(t, names(r), "items")
+
+		for _, rr := range r.reconcilers {
+			if rr.name != "items" {
+				continue
+			}
+			_, err := rr.reconcile(context.Background(), namespace)
+			require.NoError(t, err)
+		}
+
+		stored := client.stored(namespace)
+		require.Len(t, stored, 1)
+		assert.Equal(t, tuple.String(), stored[0].String())
+	})
+
+	t.Run("should share delete exclusions with all reconcilers", func(t *testing.T) {
+		r := NewZanzanaReconciler(newFakeZanzanaClient(), nil, nil, WithPanelPermissions(), WithDeleteExclusions("custom"))
+		for _, rr := range r.reconcilers {
+			assert.True(t, rr.cfg.isDeleteExcluded("custom"), rr.name)
+		}
+	})
+
+	t.Run("should only restrict allow-listed object types", func(t *testing.T) {
+		r := NewZanzanaReconciler(newFakeZanzanaClient(), nil, nil, WithRelationAllowList(zanzana.TypeFolder, zanzana.RelationParent))
+		assert.True(t, r.cfg.isRelationAllowed("folder:f1", zanzana.RelationParent))
+		assert.False(t, r.cfg.isRelationAllowed("folder:f1", zanzana.RelationRead))
+		assert.True(t, r.cfg.isRelationAllowed("resource:dashboard.grafana.app/dashboards/d1", zanzana.RelationRead))
+	})
+}
+
+func TestForEachOrg(t *testing.T) {
+	orgIds := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	for _, concurrency := range []int{0, 1, 3} {
+		t.Run(fmt.Sprintf("should run at most %d orgs concurrently", concurrency), func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				running int
+				peak    int
+				visited []int64
+			)
+
+			forEachOrg(context.Background(), orgIds, concurrency, func(ctx context.Context, orgId int64) {
+				mu.Lock()
+				running++
+				peak = max(peak, running)
+				visited = append(visited, orgId)
+				mu.Unlock()
+
+				time.Sleep(5 * time.Millisecond)
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+			})
+
+			assert.ElementsMatch(t, orgIds, visited)
+			assert.LessOrEqual(t, peak, max(concurrency, 1))
+			if concurrency > 1 {
+				assert.Greater(t, peak, 1, "orgs should run in parallel")
+			}
+		})
+	}
+}
+
+func TestOrgsInRange(t *testing.T) {
+	orgIds := []int64{9, 1, 4, 2, 7}
+
+	assert.Equal(t, []int64{2, 4, 7}, orgsInRange(orgIds, 2, 8))
+	assert.Equal(t, []int64{1, 2, 4, 7, 9}, orgsInRange(orgIds, 1, 1000))
+	assert.Empty(t, orgsInRange(orgIds, 5, 6))
+}
+
+func TestMigrateOrgs(t *testing.T) {
+	client := newFakeZanzanaClient()
+	tuple := common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")
+
+	r := NewZanzanaReconciler(client, nil, nil)
+	r.reconcilers = []resourceReconciler{
+		newResourceReconciler("test", staticCollector(tuple), zanzanaCollector(zanzana.FolderRelations), client),
+	}
+
+	// org 3 is missing from the range
+	r.migrateOrgs(context.Background(), orgsInRange([]int64{1, 2, 4, 5}, 2, 4))
+
+	assert.Empty(t, client.stored(claims.OrgNamespaceFormatter(1)))
+	assert.Len(t, client.stored(claims.OrgNamespaceFormatter(2)), 1)
+	assert.Empty(t, client.stored(claims.OrgNamespaceFormatter(3)))
+	assert.Len(t, client.stored(claims.OrgNamespaceFormatter(4)), 1)
+	assert.Empty(t, client.stored(claims.OrgNamespaceFormatter(5)))
+}
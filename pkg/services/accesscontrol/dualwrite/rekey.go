@@ -0,0 +1,72 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/benbjohnson/clock"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+// userObjectTypes are all object types that can have a user as subject.
+var userObjectTypes = []string{
+	zanzana.TypeFolder,
+	zanzana.TypeResource,
+	zanzana.TypeTeam,
+	zanzana.TypeRole,
+	zanzana.TypeGroup,
+	zanzana.TypeServiceAccount,
+	zanzana.TypeNamespace,
+}
+
+// RekeyUser moves all tuples of a user whose uid changed from oldUID to newUID. Tuples for the
+// old uid are deleted and written for the new uid with the same relation, object and condition.
+func (r *ZanzanaReconciler) RekeyUser(ctx context.Context, namespace, oldUID, newUID string) error {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.RekeyUser")
+	defer span.End()
+
+	return rekeyUser(ctx, r.cfg.clock, r.client, namespace, oldUID, newUID)
+}
+
+func rekeyUser(ctx context.Context, clk clock.Clock, client zanzana.Client, namespace, oldUID, newUID string) error {
+	oldUser := zanzana.NewTupleEntry(zanzana.TypeUser, oldUID, "")
+	newUser := zanzana.NewTupleEntry(zanzana.TypeUser, newUID, "")
+
+	var (
+		writes  []*openfgav1.TupleKey
+		deletes []*openfgav1.TupleKeyWithoutCondition
+	)
+
+	for _, typ := range userObjectTypes {
+		req := &authzextv1.ReadRequest{
+			Namespace: namespace,
+			TupleKey: &authzextv1.ReadRequestTupleKey{
+				User:   oldUser,
+				Object: typ + ":",
+			},
+		}
+
+		err := streamTuples(ctx, client, req, func(t *openfgav1.TupleKey) error {
+			deletes = append(deletes, &openfgav1.TupleKeyWithoutCondition{
+				User:     t.User,
+				Relation: t.Relation,
+				Object:   t.Object,
+			})
+			writes = append(writes, &openfgav1.TupleKey{
+				User:      newUser,
+				Relation:  t.Relation,
+				Object:    t.Object,
+				Condition: t.Condition,
+			})
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read tuples of %s: %w", oldUser, err)
+		}
+	}
+
+	return applyChanges(ctx, clk, client, namespace, writes, deletes, nil, nil, &PhaseDurations{})
+}
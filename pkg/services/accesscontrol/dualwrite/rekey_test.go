@@ -0,0 +1,48 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestRekeyUser(t *testing.T) {
+	const namespace = "default"
+
+	client := newFakeZanzanaClient()
+	client.pageSize = 2
+
+	tuplesFor := func(user string) []*openfgav1.TupleKey {
+		return []*openfgav1.TupleKey{
+			common.NewFolderTuple(user, zanzana.RelationRead, "f1"),
+			common.NewFolderResourceTuple(user, zanzana.RelationWrite, dashboardGroup, dashboardResource, "f1"),
+			common.NewResourceTuple(user, zanzana.RelationRead, dashboardGroup, dashboardResource, "d1"),
+			{User: user, Relation: zanzana.RelationTeamMember, Object: "team:t1"},
+			{User: user, Relation: zanzana.RelationAssignee, Object: "role:basic_viewer"},
+		}
+	}
+
+	other := common.NewFolderTuple("user:other", zanzana.RelationRead, "f1")
+	client.seed(namespace, append(tuplesFor("user:old"), other)...)
+
+	require.NoError(t, rekeyUser(context.Background(), clock.New(), client, namespace, "old", "new"))
+
+	expected := []string{other.String()}
+	for _, tuple := range tuplesFor("user:new") {
+		expected = append(expected, tuple.String())
+	}
+
+	stored := make([]string, 0)
+	for _, tuple := range client.stored(namespace) {
+		stored = append(stored, tuple.String())
+	}
+	// relations, objects and conditions are kept and no tuple for the old uid is left
+	assert.ElementsMatch(t, expected, stored)
+}
@@ -0,0 +1,54 @@
+package dualwrite
+
+import (
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// ReconcileReport summarizes a single reconciliation of one resource within a namespace.
+type ReconcileReport struct {
+	Name      string
+	Namespace string
+	// SnapshotID is the snapshot id of the run, see ContextWithSnapshotID.
+	SnapshotID string
+	// Writes is the number of tuples written, including tuples with updated conditions.
+	Writes int
+	// Deletes is the number of stale tuples deleted.
+	Deletes int
+	// Updates is the number of tuples that were rewritten with an updated condition.
+	Updates int
+	// DeferredDeletes is the number of stale tuples not deleted as the reconciliation ran
+	// outside the maintenance window.
+	DeferredDeletes int
+	// Skipped is the number of objects not reconciled as their tuples were already applied.
+	Skipped int
+	// Total is the wall-clock time of the whole reconciliation.
+	Total time.Duration
+	// Phases is the wall-clock time spent in each phase of the reconciliation.
+	Phases PhaseDurations
+}
+
+// PhaseDurations is the wall-clock time spent in each phase of a reconciliation.
+type PhaseDurations struct {
+	LegacyCollection time.Duration
+	ZanzanaRead      time.Duration
+	Diff             time.Duration
+	// Write is the time spent writing tuples. When writes and deletes for an object are
+	// sent in a single request the whole request is accounted as write.
+	Write  time.Duration
+	Delete time.Duration
+}
+
+// Sum returns the combined duration of all phases.
+func (p PhaseDurations) Sum() time.Duration {
+	return p.LegacyCollection + p.ZanzanaRead + p.Diff + p.Write + p.Delete
+}
+
+// timed runs fn and adds the time it took according to clk to d.
+func timed(clk clock.Clock, d *time.Duration, fn func() error) error {
+	start := clk.Now()
+	err := fn()
+	*d += clk.Since(start)
+	return err
+}
@@ -0,0 +1,72 @@
+package dualwrite
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+func TestResourceReconciler_Report(t *testing.T) {
+	const (
+		namespace = "default"
+		delay     = 5 * time.Millisecond
+	)
+
+	client := &slowClient{fakeZanzanaClient: newFakeZanzanaClient(), delay: delay}
+	// more than max write size so writes and deletes are sent in separate batches
+	stale := make([]*openfgav1.TupleKey, 0, maxWriteSize)
+	for i := 0; i < maxWriteSize; i++ {
+		stale = append(stale, common.NewFolderTuple("user:stale"+strconv.Itoa(i), zanzana.RelationRead, "f1"))
+	}
+	client.seed(namespace, stale...)
+
+	legacy := staticCollector(common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"))
+	slowLegacy := func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		time.Sleep(delay)
+		return legacy(ctx, orgId)
+	}
+
+	r := newResourceReconciler("test", slowLegacy, zanzanaCollector([]string{zanzana.RelationRead}), client)
+	report, err := r.reconcile(context.Background(), namespace)
+	require.NoError(t, err)
+
+	assert.Equal(t, "test", report.Name)
+	assert.Equal(t, namespace, report.Namespace)
+	assert.Equal(t, 1, report.Writes)
+	assert.Equal(t, maxWriteSize, report.Deletes)
+
+	assert.GreaterOrEqual(t, report.Phases.LegacyCollection, delay)
+	assert.GreaterOrEqual(t, report.Phases.ZanzanaRead, delay)
+	assert.Positive(t, report.Phases.Diff)
+	assert.GreaterOrEqual(t, report.Phases.Write, delay)
+	assert.GreaterOrEqual(t, report.Phases.Delete, delay)
+
+	// phases should account for roughly all of the time spent
+	assert.LessOrEqual(t, report.Phases.Sum(), report.Total)
+	assert.InDelta(t, report.Total, report.Phases.Sum(), float64(delay))
+}
+
+// slowClient delays every read and write by delay.
+type slowClient struct {
+	*fakeZanzanaClient
+	delay time.Duration
+}
+
+func (c *slowClient) Read(ctx context.Context, req *authzextv1.ReadRequest) (*authzextv1.ReadResponse, error) {
+	time.Sleep(c.delay)
+	return c.fakeZanzanaClient.Read(ctx, req)
+}
+
+func (c *slowClient) Write(ctx context.Context, req *authzextv1.WriteRequest) error {
+	time.Sleep(c.delay)
+	return c.fakeZanzanaClient.Write(ctx, req)
+}
@@ -2,120 +2,722 @@ package dualwrite
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/grafana/authlib/claims"
 	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/grafana/grafana/pkg/services/authz/zanzana"
 	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
 	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
 )
 
+// maxWriteSize is the maximum number of tuples zanzana accepts in a single write request
+const maxWriteSize = 100
+
 // legacyTupleCollector collects tuples groupd by object and tupleKey
 type legacyTupleCollector func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error)
 
 // zanzanaTupleCollector collects tuples from zanzana for given object
 type zanzanaTupleCollector func(ctx context.Context, client zanzana.Client, object string, namespace string) (map[string]*openfgav1.TupleKey, error)
 
+// orphanTupleCollector collects tuples from zanzana for objects that no longer exist in legacy, e.g. deleted resources.
+type orphanTupleCollector func(ctx context.Context, client zanzana.Client, namespace string, legacy map[string]map[string]*openfgav1.TupleKey) ([]*openfgav1.TupleKey, error)
+
+// reconcileConfig holds settings shared by all resource reconcilers.
+type reconcileConfig struct {
+	// deleteExclusions are relations that should never be removed by stale deletion.
+	deleteExclusions map[string]struct{}
+	// relationAllowLists restricts the relations written and deleted per object type. Object
+	// types without an allow-list are not restricted.
+	relationAllowLists map[string]map[string]struct{}
+	// retryBudget is shared by all reads and writes, if nil calls are not retried.
+	retryBudget *retryBudget
+	// runRetries is the number of retries allowed for a single reconciliation run, 0 disables it.
+	runRetries int
+	// translationVersion is the version used to translate legacy permissions into tuples.
+	translationVersion zanzana.TranslationVersion
+	// includeDeletedResources collects permissions on resources that are deleted but retained.
+	includeDeletedResources bool
+	// identifierResolver normalizes permission identifiers into uids before translation.
+	identifierResolver IdentifierResolver
+	// progressStore persists the progress of reconciliation runs, if nil progress is not tracked.
+	progressStore ProgressStore
+	// progressInterval is the number of objects reconciled between persisting progress.
+	progressInterval int
+	// teamMemberLastSeen receives when team members were last seen, if nil it is not read.
+	teamMemberLastSeen TeamMemberLastSeenSink
+	// timeBudget is the wall-clock time a reconciliation run may take, 0 disables it.
+	timeBudget time.Duration
+	// writeRate limits writes to zanzana based on their latency, if nil writes are not limited.
+	writeRate *adaptiveRate
+	// legacySchema is the version of the legacy schema collectors query.
+	legacySchema legacySchemaVersion
+	// readOnlyCollection runs legacy reads in read-only transactions that are rolled back.
+	readOnlyCollection bool
+	// reportWebhook receives the report of every completed reconciliation, if nil reports are not sent.
+	reportWebhook *reportWebhook
+	// inFlightWindow bounds concurrent reads and writes to zanzana, if nil they are not bounded.
+	inFlightWindow *semaphore.Weighted
+	// historyStore persists the summary of every run, if nil history is not kept.
+	historyStore ReconcileHistoryStore
+	// convergenceStore persists when namespaces converged, it is kept in memory unless set.
+	convergenceStore ConvergenceStore
+	// maxDeleteFraction aborts reconcilers deleting more than this fraction of the stored tuples
+	// of an object type, 0 disables the guard.
+	maxDeleteFraction float64
+	// rollbackOnFailure reverses all changes of a namespace run when any of its reconcilers fails.
+	rollbackOnFailure bool
+	// fetchSize is the number of legacy rows fetched per round trip where supported, 0 fetches all at once.
+	fetchSize int
+	// maintenanceWindow is when deletes are applied, if nil they are always applied.
+	maintenanceWindow *MaintenanceWindow
+	// inheritanceProvenance receives the folder every inherited tuple was collected from, if nil
+	// provenance is not tracked.
+	inheritanceProvenance InheritanceProvenance
+	// objectSetStore persists the objects of the last run of reconcilers tracking objects, if nil
+	// objects are not tracked.
+	objectSetStore ObjectSetStore
+	// idempotencyStore persists the tuple set last applied to every object, if nil objects are
+	// always reconciled.
+	idempotencyStore IdempotencyStore
+	// silencePermissions translates silence actions granted on folders into folder resource tuples.
+	silencePermissions bool
+	// compareStrategy selects the key tuples are compared by when diffing an object.
+	compareStrategy CompareStrategy
+	// droppedTuples receives every tuple that is dropped, if nil drops are not recorded.
+	droppedTuples DroppedTupleSink
+	// checkSampling selects the tuples checked by semantic verification.
+	checkSampling checkSampling
+	// orphanSweeps limits how often reconcilers sweep tuples of objects that are gone from legacy.
+	orphanSweeps *sweepSchedule
+	// clock is the source of the current time, a mock clock is used in tests.
+	clock clock.Clock
+	// namespaceKinds are the kinds of managed permissions that are reconciled. Their permissions
+	// on all resources of the kind are collected by namespacePermissionCollector.
+	namespaceKinds map[string]struct{}
+	// basicRolePermissions returns the fixed permissions of basic roles, if nil they are not
+	// reconciled. They are collected by namespacePermissionCollector.
+	basicRolePermissions BasicRolePermissions
+}
+
+func newReconcileConfig() *reconcileConfig {
+	return &reconcileConfig{
+		deleteExclusions:   make(map[string]struct{}),
+		relationAllowLists: make(map[string]map[string]struct{}),
+		translationVersion: zanzana.TranslationLatest,
+		identifierResolver: identityIdentifierResolver,
+		legacySchema:       legacySchemaLatest,
+		orphanSweeps:       newSweepSchedule(defaultOrphanSweepInterval),
+		clock:              clock.New(),
+		namespaceKinds:     make(map[string]struct{}),
+		convergenceStore:   newMemConvergenceStore(),
+	}
+}
+
+// isDeleteExcluded returns true for relations that should never be deleted. Unknown relations
+// are always excluded as they are written by a different version, see VerifyKnownRelations.
+func (c *reconcileConfig) isDeleteExcluded(relation string) bool {
+	if !zanzana.IsKnownRelation(relation) {
+		return true
+	}
+	_, ok := c.deleteExclusions[relation]
+	return ok
+}
+
+// isRelationAllowed returns true if tuples with relation may be written to and deleted from
+// object, based on the allow-list of the object type.
+func (c *reconcileConfig) isRelationAllowed(object, relation string) bool {
+	objectType, _, _ := strings.Cut(object, ":")
+	allowed, ok := c.relationAllowLists[objectType]
+	if !ok {
+		return true
+	}
+	_, ok = allowed[relation]
+	return ok
+}
+
 type resourceReconciler struct {
 	name    string
 	legacy  legacyTupleCollector
 	zanzana zanzanaTupleCollector
-	client  zanzana.Client
+	// orphans is optional and used to remove tuples for objects that are gone from legacy.
+	// Stale deletion only covers objects returned by the legacy collector.
+	orphans orphanTupleCollector
+	// trackObjects saves the objects of every run so tuples of objects deleted in legacy can be
+	// removed, see ObjectSetStore.
+	trackObjects bool
+	// kinds are the legacy kinds whose objects are owned by the reconciler. Only reconcilers
+	// with kinds take part in incremental reconciliation of changed objects.
+	kinds  []string
+	client zanzana.Client
+	cfg    *reconcileConfig
+	// locker serializes reconciliation of the same object
+	locker objectLocker
 }
 
 func newResourceReconciler(name string, legacy legacyTupleCollector, zanzana zanzanaTupleCollector, client zanzana.Client) resourceReconciler {
-	return resourceReconciler{name, legacy, zanzana, client}
+	return resourceReconciler{
+		name:    name,
+		legacy:  legacy,
+		zanzana: zanzana,
+		client:  client,
+		cfg:     newReconcileConfig(),
+		locker:  newKeyedMutex(),
+	}
+}
+
+// withOrphans returns a copy of the reconciler that also deletes tuples collected by orphans.
+func (r resourceReconciler) withOrphans(orphans orphanTupleCollector) resourceReconciler {
+	r.orphans = orphans
+	return r
+}
+
+// withObjectTracking returns a copy of the reconciler that deletes tuples of objects collected by
+// the last run that are gone from legacy. It only has an effect with an object set store.
+func (r resourceReconciler) withObjectTracking() resourceReconciler {
+	r.trackObjects = true
+	return r
+}
+
+// withKinds returns a copy of the reconciler that owns objects of the given legacy kinds.
+func (r resourceReconciler) withKinds(kinds ...string) resourceReconciler {
+	r.kinds = kinds
+	return r
+}
+
+// owns returns true if objects of kind are managed by the reconciler.
+func (r resourceReconciler) owns(kind string) bool {
+	return slices.Contains(r.kinds, kind)
 }
 
-func (r resourceReconciler) reconcile(ctx context.Context, namespace string) error {
+func (r resourceReconciler) reconcile(ctx context.Context, namespace string) (*ReconcileReport, error) {
+	return r.run(ctx, namespace, nil, nil)
+}
+
+// dryRun computes the changes a reconciliation would make without applying them.
+func (r resourceReconciler) dryRun(ctx context.Context, namespace string) (*ReconcileResult, error) {
+	return r.validatedDryRun(ctx, namespace, nil)
+}
+
+// validatedDryRun is like dryRun but also adds collected tuples not allowed by validator to
+// the result's violations. Validation is skipped if validator is nil.
+func (r resourceReconciler) validatedDryRun(ctx context.Context, namespace string, validator *schemaValidator) (*ReconcileResult, error) {
+	result := &ReconcileResult{SnapshotID: SnapshotIDFromContext(ctx)}
+	if _, err := r.run(ctx, namespace, result, validator); err != nil {
+		return nil, err
+	}
+	result.sort()
+	return result, nil
+}
+
+// reconcileObjects reconciles only the given objects in namespace. Objects missing from legacy
+// have all their stored tuples removed.
+func (r resourceReconciler) reconcileObjects(ctx context.Context, namespace string, objects []string) (*ReconcileReport, error) {
+	report := &ReconcileReport{Name: r.name, Namespace: namespace, SnapshotID: SnapshotIDFromContext(ctx)}
+	start := r.cfg.clock.Now()
+	defer func() {
+		report.Total = r.cfg.clock.Since(start)
+	}()
+
 	info, err := claims.ParseNamespace(namespace)
 	if err != nil {
+		return report, err
+	}
+
+	var res map[string]map[string]*openfgav1.TupleKey
+	err = timed(r.cfg.clock, &report.Phases.LegacyCollection, func() (err error) {
+		res, err = r.legacy(ctx, info.OrgID)
 		return err
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to collect legacy tuples for %s: %w", r.name, err)
+	}
+
+	for _, object := range objects {
+		if err := r.reconcileObject(ctx, namespace, object, res[object], report, nil, nil); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// run reconciles all objects in namespace. If result is set the changes are only added
+// to it and nothing is written to zanzana. If validator is set as well, every collected tuple
+// is validated and violations are added to result.
+func (r resourceReconciler) run(ctx context.Context, namespace string, result *ReconcileResult, validator *schemaValidator) (*ReconcileReport, error) {
+	report := &ReconcileReport{Name: r.name, Namespace: namespace, SnapshotID: SnapshotIDFromContext(ctx)}
+	start := r.cfg.clock.Now()
+	defer func() {
+		report.Total = r.cfg.clock.Since(start)
+	}()
+
+	info, err := claims.ParseNamespace(namespace)
+	if err != nil {
+		return report, err
 	}
 
 	// 1. Fetch grafana resources stored in grafana db.
-	res, err := r.legacy(ctx, info.OrgID)
+	var res map[string]map[string]*openfgav1.TupleKey
+	err = timed(r.cfg.clock, &report.Phases.LegacyCollection, func() (err error) {
+		res, err = r.legacy(ctx, info.OrgID)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to collect legacy tuples for %s: %w", r.name, err)
+		return report, fmt.Errorf("failed to collect legacy tuples for %s: %w", r.name, err)
 	}
 
+	// Progress and time budget are only tracked for runs that apply changes.
 	var (
-		writes  = []*openfgav1.TupleKey{}
-		deletes = []*openfgav1.TupleKeyWithoutCondition{}
+		progress *progressTracker
+		budget   *timeBudget
 	)
+	if result == nil {
+		progress = newProgressTracker(r.cfg.progressStore, r.cfg.progressInterval, r.name, namespace, report.SnapshotID, len(res))
+		budget = timeBudgetFromContext(ctx)
+	}
+
+	// Objects are reconciled in order so a halted run can be resumed after the checkpoint of every
+	// object type.
+	objects := make([]string, 0, len(res))
+	for object := range res {
+		objects = append(objects, object)
+	}
+	slices.Sort(objects)
+
+	// Objects of a type up to its checkpoint were reconciled by the halted run.
+	if checkpoints := progress.resumeCheckpoints(ctx); checkpoints != nil {
+		remaining := make([]string, 0, len(objects))
+		for _, object := range objects {
+			objectType, _, _ := strings.Cut(object, ":")
+			if last, ok := checkpoints[objectType]; ok && object <= last {
+				continue
+			}
+			remaining = append(remaining, object)
+		}
+		progress.resume(checkpoints, len(objects)-len(remaining))
+		objects = remaining
+	}
+
+	// Orphans are always swept for dry runs, otherwise at most once every sweep interval.
+	sweepKey, now := r.name+"/"+namespace, r.cfg.clock.Now()
+	sweep := r.orphans != nil && (result != nil || r.cfg.orphanSweeps.due(sweepKey, now))
+
+	// With a max delete fraction the changes of all objects are computed before any is applied.
+	var plan *reconcilePlan
+	if result == nil && r.cfg.maxDeleteFraction > 0 {
+		if plan, err = r.planChanges(ctx, namespace, objects, res, report, sweep); err != nil {
+			return report, err
+		}
+		if err := checkDeleteFraction(&plan.result, r.cfg.maxDeleteFraction); err != nil {
+			return report, err
+		}
+	}
+	progress.start(ctx)
+
+	for _, object := range objects {
+		if budget.isExceeded() {
+			progress.halt(ctx)
+			return report, errTimeBudgetExceeded
+		}
+
+		tuples := res[object]
+		if result != nil && validator != nil {
+			for _, t := range tuples {
+				if v := validator.validate(t); v != nil {
+					result.Violations = append(result.Violations, *v)
+				}
+			}
+		}
+
+		if err := r.reconcileObject(ctx, namespace, object, tuples, report, result, plan.objectChanges(object)); err != nil {
+			return report, err
+		}
+		progress.processed(ctx, object)
+	}
+
+	if !sweep && !r.tracksObjects() {
+		return report, nil
+	}
 
-	for object, tuples := range res {
-		// 2. Fetch all tuples for given object.
-		// Due to limitations in open fga api we need to collect tuples per object
-		zanzanaTuples, err := r.zanzana(ctx, r.client, object, namespace)
+	// 6. Remove tuples for objects that no longer exist in grafana db.
+	var deletes []*openfgav1.TupleKeyWithoutCondition
+	if plan != nil {
+		deletes = plan.orphans
+	} else if deletes, err = r.orphanDeletes(ctx, namespace, res, report, sweep); err != nil {
+		return report, err
+	}
+
+	if result != nil {
+		for _, tuple := range deletes {
+			result.countStored(tuple.Object, 1)
+		}
+		result.Deletions = append(result.Deletions, deletes...)
+	} else if r.cfg.deletesDeferred() {
+		report.DeferredDeletes += len(deletes)
+		deletes = nil
+	} else if err := applyChanges(ctx, r.cfg.clock, r.client, namespace, nil, deletes, nil, nil, &report.Phases); err != nil {
+		return report, err
+	} else {
+		if sweep {
+			r.cfg.orphanSweeps.swept(sweepKey, now)
+		}
+		if r.tracksObjects() {
+			r.saveObjects(ctx, namespace, res)
+		}
+	}
+	report.Deletes += len(deletes)
+
+	return report, nil
+}
+
+// orphanDeletes collects the tuples of objects that no longer exist in legacy. Orphans are only
+// swept if sweep is set, tuples of deleted objects are collected if the reconciler tracks objects.
+func (r resourceReconciler) orphanDeletes(
+	ctx context.Context,
+	namespace string,
+	res map[string]map[string]*openfgav1.TupleKey,
+	report *ReconcileReport,
+	sweep bool,
+) ([]*openfgav1.TupleKeyWithoutCondition, error) {
+	var orphans []*openfgav1.TupleKey
+	err := timed(r.cfg.clock, &report.Phases.ZanzanaRead, func() (err error) {
+		if sweep {
+			if orphans, err = r.orphans(ctx, r.client, namespace, res); err != nil {
+				return err
+			}
+		}
+		if r.tracksObjects() {
+			deleted, err := r.deletedObjectTuples(ctx, namespace, res)
+			if err != nil {
+				return err
+			}
+			orphans = append(orphans, deleted...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect orphaned tuples for %s: %w", r.name, err)
+	}
+
+	deletes := make([]*openfgav1.TupleKeyWithoutCondition, 0, len(orphans))
+	for _, tuple := range orphans {
+		if r.cfg.isDeleteExcluded(tuple.Relation) || !r.cfg.isRelationAllowed(tuple.Object, tuple.Relation) {
+			continue
+		}
+		deletes = append(deletes, &openfgav1.TupleKeyWithoutCondition{
+			User:     tuple.User,
+			Relation: tuple.Relation,
+			Object:   tuple.Object,
+		})
+	}
+	return deletes, nil
+}
+
+// reconcileObject diffs the legacy tuples of a single object against the ones stored in zanzana
+// and applies the changes. An object without legacy tuples has all its stored tuples removed.
+// The object is locked for the whole sequence so concurrent reconcilers don't interleave.
+// With an idempotency store, objects whose tuples were already applied by a run of the same
+// snapshot are skipped. If planned is set the changes computed for the object by planChanges are
+// applied instead.
+func (r resourceReconciler) reconcileObject(
+	ctx context.Context,
+	namespace, object string,
+	tuples map[string]*openfgav1.TupleKey,
+	report *ReconcileReport,
+	result *ReconcileResult,
+	planned *objectChanges,
+) error {
+	return r.locker.withLock(ctx, objectLockKey(namespace, object), func(ctx context.Context) error {
+		if r.cfg.idempotencyStore == nil || result != nil || SnapshotIDFromContext(ctx) == "" {
+			return r.diffObject(ctx, namespace, object, tuples, report, result, planned)
+		}
+
+		key, err := idempotencyKey(tuples)
 		if err != nil {
-			return fmt.Errorf("failed to collect zanzanaa tuples for %s: %w", r.name, err)
+			return err
+		}
+		if r.isApplied(ctx, namespace, object, key) {
+			report.Skipped++
+			return nil
+		}
+
+		deferred := report.DeferredDeletes
+		if err := r.diffObject(ctx, namespace, object, tuples, report, result, planned); err != nil {
+			return err
+		}
+		// Objects with deferred deletes are not fully applied and must be reconciled again.
+		if report.DeferredDeletes == deferred {
+			r.markApplied(ctx, namespace, object, key)
+		}
+		return nil
+	})
+}
+
+// diffObject applies the changes needed to reconcile the stored tuples of object with the legacy
+// ones, or adds them to result if set. Planned changes are applied without reading zanzana again.
+func (r resourceReconciler) diffObject(
+	ctx context.Context,
+	namespace, object string,
+	tuples map[string]*openfgav1.TupleKey,
+	report *ReconcileReport,
+	result *ReconcileResult,
+	planned *objectChanges,
+) error {
+	changes := planned
+	if changes == nil {
+		var err error
+		if changes, err = r.computeChanges(ctx, namespace, object, tuples, report); err != nil {
+			return err
+		}
+	}
+
+	if result != nil {
+		result.countStored(object, changes.stored)
+		result.Additions = append(result.Additions, changes.writes...)
+		result.Deletions = append(result.Deletions, changes.deletes...)
+		result.Updates = append(result.Updates, changes.updates...)
+	} else {
+		// Outside the maintenance window stale tuples are only reported.
+		if r.cfg.deletesDeferred() {
+			report.DeferredDeletes += len(changes.deletes)
+			changes.deletes = nil
+		}
+		if err := applyChanges(ctx, r.cfg.clock, r.client, namespace, changes.writes, changes.deletes, changes.updates, changes.restores, &report.Phases); err != nil {
+			return err
 		}
+	}
+
+	report.Writes += len(changes.writes)
+	report.Deletes += len(changes.deletes)
+	report.Updates += len(changes.updates)
+
+	return nil
+}
+
+// computeChanges diffs the legacy tuples of object against the ones stored in zanzana.
+func (r resourceReconciler) computeChanges(
+	ctx context.Context,
+	namespace, object string,
+	tuples map[string]*openfgav1.TupleKey,
+	report *ReconcileReport,
+) (*objectChanges, error) {
+	// 2. Fetch all tuples for given object.
+	// Due to limitations in open fga api we need to collect tuples per object
+	var zanzanaTuples map[string]*openfgav1.TupleKey
+	err := timed(r.cfg.clock, &report.Phases.ZanzanaRead, func() (err error) {
+		zanzanaTuples, err = r.zanzana(ctx, r.client, object, namespace)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect zanzanaa tuples for %s: %w", r.name, err)
+	}
+
+	var (
+		writes   = []*openfgav1.TupleKey{}
+		deletes  = []*openfgav1.TupleKeyWithoutCondition{}
+		updates  = []*openfgav1.TupleKeyWithoutCondition{}
+		restores = []*openfgav1.TupleKey{}
+	)
+
+	_ = timed(r.cfg.clock, &report.Phases.Diff, func() error {
+		tuples, zanzanaTuples := r.cfg.compareStrategy.rekey(tuples), r.cfg.compareStrategy.rekey(zanzanaTuples)
 
 		// 3. Check if tuples from grafana db exists in zanzana and if not add them to writes
 		for key, t := range tuples {
+			if !r.cfg.isRelationAllowed(t.Object, t.Relation) {
+				r.cfg.droppedTuples.drop(t.Object, t.Relation, t.User, droppedRelationNotAllowed)
+				continue
+			}
+
 			stored, ok := zanzanaTuples[key]
 			if !ok {
 				writes = append(writes, t)
 				continue
 			}
 
-			// 4. For folder resource tuples we also need to compare the stored group_resources
-			if zanzana.IsFolderResourceTuple(t) && t.String() != stored.String() {
-				deletes = append(deletes, &openfgav1.TupleKeyWithoutCondition{
-					User:     t.User,
-					Relation: t.Relation,
-					Object:   t.Object,
+			// 4. For tuples keyed without condition we also need to compare the stored condition.
+			// The stored tuple is deleted as its subject can differ from the legacy one, see tupleKey.
+			if r.cfg.compareStrategy.comparesCondition(t) && !proto.Equal(t.GetCondition(), stored.GetCondition()) {
+				updates = append(updates, &openfgav1.TupleKeyWithoutCondition{
+					User:     stored.User,
+					Relation: stored.Relation,
+					Object:   stored.Object,
 				})
+				restores = append(restores, stored)
 
 				writes = append(writes, t)
 			}
 		}
 
+		// Tuples keyed with their condition are written again when it changed, see CompareStrict.
+		written := make(map[string]struct{}, len(writes))
+		for _, t := range writes {
+			written[tupleStringWithoutCondition(t)] = struct{}{}
+		}
+
 		// 5. Check if tuple from zanzana don't exists in grafana db, if not add them to deletes.
+		// Relations managed by other systems or not allowed for the object type are never deleted.
 		for key, tuple := range zanzanaTuples {
+			if r.cfg.isDeleteExcluded(tuple.Relation) || !r.cfg.isRelationAllowed(tuple.Object, tuple.Relation) {
+				continue
+			}
+
 			_, ok := tuples[key]
 			if !ok {
-				deletes = append(deletes, &openfgav1.TupleKeyWithoutCondition{
+				deleted := &openfgav1.TupleKeyWithoutCondition{
 					User:     tuple.User,
 					Relation: tuple.Relation,
 					Object:   tuple.Object,
-				})
+				}
+				// Zanzana rejects deleting and writing the same tuple in one request, it is
+				// updated instead.
+				if _, ok := written[tupleStringWithoutCondition(tuple)]; ok {
+					updates = append(updates, deleted)
+					restores = append(restores, tuple)
+					continue
+				}
+				deletes = append(deletes, deleted)
 			}
 		}
-	}
+		return nil
+	})
+
+	return &objectChanges{writes: writes, deletes: deletes, updates: updates, restores: restores, stored: len(zanzanaTuples)}, nil
+}
+
+// applyChanges writes and deletes tuples for a single object. Writes, deletes and the deletes of
+// updated tuples are sent in one request so zanzana applies them atomically. Zanzana rejects
+// requests that both deletes and writes the same tuple so tuples with updated conditions are
+// rewritten in the request that directly follows, restores are the stored tuples of updates
+// written back if that fails. If the changes don't fit into one request they are split into
+// batches where all writes are sent before any tuple is deleted. Time spent is recorded in phases.
+func applyChanges(
+	ctx context.Context,
+	clk clock.Clock,
+	client zanzana.Client,
+	namespace string,
+	writes []*openfgav1.TupleKey,
+	deletes, updates []*openfgav1.TupleKeyWithoutCondition,
+	restores []*openfgav1.TupleKey,
+	phases *PhaseDurations,
+) error {
+	writes, rewrites := splitRewrites(writes, updates)
+	deletes = append(deletes[:len(deletes):len(deletes)], updates...)
 
 	if len(writes) == 0 && len(deletes) == 0 {
 		return nil
 	}
 
-	if len(deletes) > 0 {
-		err := batch(deletes, 100, func(items []*openfgav1.TupleKeyWithoutCondition) error {
-			return r.client.Write(ctx, &authzextv1.WriteRequest{
+	if len(writes)+len(deletes) <= maxWriteSize {
+		req := &authzextv1.WriteRequest{Namespace: namespace}
+		phase := &phases.Delete
+		if len(writes) > 0 {
+			req.Writes = &authzextv1.WriteRequestWrites{TupleKeys: common.ToAuthzExtTupleKeys(writes)}
+			phase = &phases.Write
+		}
+		if len(deletes) > 0 {
+			req.Deletes = &authzextv1.WriteRequestDeletes{TupleKeys: common.ToAuthzExtTupleKeysWithoutCondition(deletes)}
+		}
+		if err := timed(clk, phase, func() error {
+			return client.Write(ctx, req)
+		}); err != nil {
+			return err
+		}
+		return rewriteTuples(ctx, clk, client, namespace, rewrites, restores, phases)
+	}
+
+	// Too many changes to fit into a single request so we fallback to batches. Writes goes
+	// first so access is never lost in between batches.
+	if err := writeTuples(ctx, clk, client, namespace, writes, phases); err != nil {
+		return err
+	}
+
+	if err := timed(clk, &phases.Delete, func() error {
+		return batch(deletes, maxWriteSize, func(items []*openfgav1.TupleKeyWithoutCondition) error {
+			return client.Write(ctx, &authzextv1.WriteRequest{
 				Namespace: namespace,
 				Deletes:   &authzextv1.WriteRequestDeletes{TupleKeys: common.ToAuthzExtTupleKeysWithoutCondition(items)},
 			})
 		})
+	}); err != nil {
+		return err
+	}
 
-		if err != nil {
-			return err
+	return rewriteTuples(ctx, clk, client, namespace, rewrites, restores, phases)
+}
+
+// rewriteTuples writes tuples that were deleted to update their condition. When a batch fails the
+// stored tuples of it and of all following batches are restored, so a failed update never
+// removes access until the next run.
+func rewriteTuples(ctx context.Context, clk clock.Clock, client zanzana.Client, namespace string, rewrites, restores []*openfgav1.TupleKey, phases *PhaseDurations) error {
+	stored := make(map[string]*openfgav1.TupleKey, len(restores))
+	for _, t := range restores {
+		stored[tupleStringWithoutCondition(t)] = t
+	}
+
+	for start := 0; start < len(rewrites); start += maxWriteSize {
+		err := writeTuples(ctx, clk, client, namespace, rewrites[start:min(start+maxWriteSize, len(rewrites))], phases)
+		if err == nil {
+			continue
+		}
+
+		pending := make([]*openfgav1.TupleKey, 0, len(rewrites)-start)
+		for _, t := range rewrites[start:] {
+			if s, ok := stored[tupleStringWithoutCondition(t)]; ok {
+				pending = append(pending, s)
+			}
 		}
+		// The rewrite can fail because ctx is done, the stored tuples are restored regardless.
+		if restoreErr := writeTuples(context.WithoutCancel(ctx), clk, client, namespace, pending, phases); restoreErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to restore updated tuples: %w", restoreErr))
+		}
+		return err
 	}
+	return nil
+}
 
-	if len(writes) > 0 {
-		err := batch(writes, 100, func(items []*openfgav1.TupleKey) error {
-			return r.client.Write(ctx, &authzextv1.WriteRequest{
+func writeTuples(ctx context.Context, clk clock.Clock, client zanzana.Client, namespace string, tuples []*openfgav1.TupleKey, phases *PhaseDurations) error {
+	if len(tuples) == 0 {
+		return nil
+	}
+	return timed(clk, &phases.Write, func() error {
+		return batch(tuples, maxWriteSize, func(items []*openfgav1.TupleKey) error {
+			return client.Write(ctx, &authzextv1.WriteRequest{
 				Namespace: namespace,
 				Writes:    &authzextv1.WriteRequestWrites{TupleKeys: common.ToAuthzExtTupleKeys(items)},
 			})
 		})
+	})
+}
 
-		if err != nil {
-			return err
-		}
+// splitRewrites separates writes of tuples that are updated from the rest of the writes.
+func splitRewrites(writes []*openfgav1.TupleKey, updates []*openfgav1.TupleKeyWithoutCondition) ([]*openfgav1.TupleKey, []*openfgav1.TupleKey) {
+	if len(updates) == 0 {
+		return writes, nil
 	}
 
-	return nil
+	updated := make(map[string]struct{}, len(updates))
+	for _, u := range updates {
+		updated[tupleStringWithoutCondition(&openfgav1.TupleKey{User: u.GetUser(), Relation: u.GetRelation(), Object: u.GetObject()})] = struct{}{}
+	}
+
+	rest := make([]*openfgav1.TupleKey, 0, len(writes))
+	var rewrites []*openfgav1.TupleKey
+	for _, w := range writes {
+		if _, ok := updated[tupleStringWithoutCondition(w)]; ok {
+			rewrites = append(rewrites, w)
+			continue
+		}
+		rest = append(rest, w)
+	}
+	return rest, rewrites
 }
@@ -0,0 +1,304 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/benbjohnson/clock"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+func TestResourceReconciler_Reconcile(t *testing.T) {
+	const namespace = "default"
+
+	t.Run("should send writes and deletes for an object in a single request", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		client.seed(namespace, common.NewFolderTuple("user:2", zanzana.RelationRead, "f1"))
+
+		expected := common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")
+		r := newResourceReconciler("test", staticCollector(expected), zanzanaCollector(zanzana.FolderRelations), client)
+		_, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+
+		require.Len(t, client.writes, 1)
+		req := client.writes[0]
+		require.Len(t, req.GetWrites().GetTupleKeys(), 1)
+		require.Len(t, req.GetDeletes().GetTupleKeys(), 1)
+		assert.Equal(t, "user:1", req.GetWrites().GetTupleKeys()[0].GetUser())
+		assert.Equal(t, "user:2", req.GetDeletes().GetTupleKeys()[0].GetUser())
+
+		stored := client.stored(namespace)
+		require.Len(t, stored, 1)
+		assert.Equal(t, expected.String(), stored[0].String())
+	})
+
+	t.Run("should delete folder resource tuples with updated condition before writing them", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		client.seed(namespace, common.NewFolderResourceTuple("user:1", zanzana.RelationRead, "folder.grafana.app", "folders", "f1"))
+
+		expected := common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")
+		r := newResourceReconciler("test", staticCollector(expected), zanzanaCollector(zanzana.FolderRelations), client)
+		_, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+
+		require.Len(t, client.writes, 2)
+		assert.Len(t, client.writes[0].GetDeletes().GetTupleKeys(), 1)
+		assert.Len(t, client.writes[1].GetWrites().GetTupleKeys(), 1)
+
+		stored := client.stored(namespace)
+		require.Len(t, stored, 1)
+		assert.Equal(t, expected.String(), stored[0].String())
+	})
+
+	t.Run("should replace team membership tuples stored with a condition", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		client.seed(namespace, withLastSeenCondition(teamMembershipTuple(teamMembership{TeamUID: "t1", UserUID: "u1"})))
+
+		expected := teamMembershipTuple(teamMembership{TeamUID: "t1", UserUID: "u1"})
+		r := newResourceReconciler("test", staticCollector(expected), zanzanaCollector([]string{zanzana.RelationTeamMember}), client)
+		_, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+
+		require.Len(t, client.writes, 2)
+		assert.Len(t, client.writes[0].GetDeletes().GetTupleKeys(), 1)
+		assert.Len(t, client.writes[1].GetWrites().GetTupleKeys(), 1)
+
+		stored := client.stored(namespace)
+		require.Len(t, stored, 1)
+		assert.Equal(t, expected.String(), stored[0].String())
+	})
+
+	t.Run("should delete updated tuples in the same request as other changes", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		client.seed(namespace,
+			common.NewFolderResourceTuple("user:1", zanzana.RelationRead, "folder.grafana.app", "folders", "f1"),
+			common.NewFolderTuple("user:2", zanzana.RelationRead, "f1"),
+		)
+
+		updated := common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")
+		added := common.NewFolderTuple("user:3", zanzana.RelationRead, "f1")
+		r := newResourceReconciler("test", staticCollector(updated, added), zanzanaCollector(zanzana.FolderRelations), client)
+		_, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+
+		require.Len(t, client.writes, 2)
+		assert.Equal(t, []string{"user:3"}, writeUsers(client.writes[0]))
+		assert.ElementsMatch(t, []string{"user:1", "user:2"}, deleteUsers(client.writes[0]))
+		assert.Equal(t, []string{"user:1"}, writeUsers(client.writes[1]))
+		assert.Empty(t, deleteUsers(client.writes[1]))
+
+		assert.ElementsMatch(t, tupleStrings(updated, added), tupleStrings(client.stored(namespace)...))
+	})
+
+	t.Run("should restore updated tuples when the rewrite fails", func(t *testing.T) {
+		stored := common.NewFolderResourceTuple("user:1", zanzana.RelationRead, "folder.grafana.app", "folders", "f1")
+		fake := newFakeZanzanaClient()
+		fake.seed(namespace, stored)
+		// the delete succeeds, the rewrite in the next request fails
+		client := &failingWriteClient{fakeZanzanaClient: fake, failing: 2}
+
+		updated := common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")
+		r := newResourceReconciler("test", staticCollector(updated), zanzanaCollector(zanzana.FolderRelations), client)
+		_, err := r.reconcile(context.Background(), namespace)
+		require.ErrorIs(t, err, errUnavailable)
+
+		// the subject keeps the access it had before the update
+		assert.Equal(t, tupleStrings(stored), tupleStrings(fake.stored(namespace)...))
+	})
+
+	t.Run("should write before deleting when changes are split into batches", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		stale := common.NewFolderTuple("user:stale", zanzana.RelationRead, "f1")
+		client.seed(namespace, stale)
+
+		writes := make([]*openfgav1.TupleKey, 0, maxWriteSize+1)
+		for i := 0; i <= maxWriteSize; i++ {
+			writes = append(writes, common.NewFolderTuple(fmt.Sprintf("user:%d", i), zanzana.RelationRead, "f1"))
+		}
+		deletes := []*openfgav1.TupleKeyWithoutCondition{{User: stale.User, Relation: stale.Relation, Object: stale.Object}}
+
+		require.NoError(t, applyChanges(context.Background(), clock.New(), client, namespace, writes, deletes, nil, nil, &PhaseDurations{}))
+
+		require.Len(t, client.writes, 3)
+		assert.Len(t, writeUsers(client.writes[0]), maxWriteSize)
+		assert.Len(t, writeUsers(client.writes[1]), 1)
+		assert.Equal(t, []string{"user:stale"}, deleteUsers(client.writes[2]))
+		assert.Empty(t, writeUsers(client.writes[2]))
+		assert.Len(t, client.stored(namespace), maxWriteSize+1)
+	})
+
+	t.Run("should not delete tuples with excluded relations", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		excluded := common.NewFolderTuple("user:3", zanzana.RelationWrite, "f1")
+		client.seed(namespace, common.NewFolderTuple("user:2", zanzana.RelationRead, "f1"), excluded)
+
+		expected := common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")
+		r := newResourceReconciler("test", staticCollector(expected), zanzanaCollector(zanzana.FolderRelations), client)
+		r.cfg.deleteExclusions[zanzana.RelationWrite] = struct{}{}
+		_, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+
+		stored := client.stored(namespace)
+		require.Len(t, stored, 2)
+		assert.ElementsMatch(t, []string{expected.String(), excluded.String()}, []string{stored[0].String(), stored[1].String()})
+	})
+
+	t.Run("should only write and delete allow-listed relations", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		staleParent := common.NewFolderParentTuple("f1", "f3")
+		staleRead := common.NewFolderTuple("user:2", zanzana.RelationRead, "f1")
+		client.seed(namespace, staleParent, staleRead)
+
+		parent := common.NewFolderParentTuple("f1", "f2")
+		read := common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")
+		relations := []string{zanzana.RelationParent, zanzana.RelationRead}
+		r := newResourceReconciler("test", staticCollector(parent, read), zanzanaCollector(relations), client)
+		r.cfg.relationAllowLists[zanzana.TypeFolder] = map[string]struct{}{zanzana.RelationParent: {}}
+		report, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Writes)
+		assert.Equal(t, 1, report.Deletes)
+
+		stored := client.stored(namespace)
+		require.Len(t, stored, 2)
+		assert.ElementsMatch(t, []string{parent.String(), staleRead.String()}, []string{stored[0].String(), stored[1].String()})
+	})
+
+	t.Run("should remove tuples of deleted dashboards including annotations", func(t *testing.T) {
+		cfg := newReconcileConfig()
+		client := newFakeZanzanaClient()
+		client.seed(namespace,
+			common.NewResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d1"),
+			common.NewResourceTuple("user:1", zanzana.RelationRead, "annotation.grafana.app", "annotations", "d1"),
+			common.NewResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d2"),
+			common.NewResourceTuple("user:1", zanzana.RelationRead, "annotation.grafana.app", "annotations", "d2"),
+			// managed by other reconcilers
+			common.NewSubresourceTuple("user:1", zanzana.RelationSubresourceRead, dashboardGroup, dashboardResource, "d1", "1"),
+			common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+		)
+
+		// d1 has been deleted
+		legacy := permissionCollector(cfg.translationVersion,
+			managedPermission{Action: "dashboards:read", Kind: zanzana.KindDashboards, Identifier: "d2", UserUID: "1"},
+			managedPermission{Action: "annotations:read", Kind: zanzana.KindDashboards, Identifier: "d2", UserUID: "1"},
+		)
+
+		r := newResourceReconciler("test", legacy, zanzanaCollector(zanzana.ResourceRelations), client).
+			withOrphans(orphanCollector(zanzana.KindDashboards, cfg, zanzana.ResourceRelations))
+		report, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 2, report.Deletes)
+
+		stored := make([]string, 0)
+		for _, tuple := range client.stored(namespace) {
+			stored = append(stored, tuple.GetObject()+"#"+tuple.GetRelation())
+		}
+		assert.ElementsMatch(t, []string{
+			"resource:annotation.grafana.app/annotations/d2#read",
+			"resource:dashboard.grafana.app/dashboards/d2#read",
+			"resource:dashboard.grafana.app/dashboards/d1#subresource_read",
+			"folder:f1#read",
+		}, stored)
+	})
+
+	t.Run("should consider team subjects with and without member relation equal", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		client.seed(namespace,
+			common.NewFolderTuple("team:t1", zanzana.RelationRead, "f1"),
+			common.NewFolderResourceTuple("team:t1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"),
+		)
+
+		r := newResourceReconciler("test", staticCollector(
+			common.NewFolderTuple("team:t1#member", zanzana.RelationRead, "f1"),
+			common.NewFolderResourceTuple("team:t1#member", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"),
+		), zanzanaCollector(zanzana.FolderRelations), client)
+		_, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Empty(t, client.writes)
+	})
+
+	t.Run("should not write anything when in sync", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		tuple := common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")
+		client.seed(namespace, tuple)
+
+		r := newResourceReconciler("test", staticCollector(tuple), zanzanaCollector(zanzana.FolderRelations), client)
+		_, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Empty(t, client.writes)
+	})
+}
+
+// permissionCollector returns a legacy collector that always returns the translated managed permissions.
+func permissionCollector(version zanzana.TranslationVersion, permissions ...managedPermission) legacyTupleCollector {
+	return func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		return managedPermissionTuples(permissions, version, nil), nil
+	}
+}
+
+// staticCollector returns a legacy collector that always returns tuples grouped by object
+// using the same keys as the real collectors.
+func staticCollector(tuples ...*openfgav1.TupleKey) legacyTupleCollector {
+	return func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		out := make(map[string]map[string]*openfgav1.TupleKey)
+		for _, t := range tuples {
+			putTuple(out, t)
+		}
+		return out, nil
+	}
+}
+
+func writeUsers(req *authzextv1.WriteRequest) []string {
+	var out []string
+	for _, t := range req.GetWrites().GetTupleKeys() {
+		out = append(out, t.GetUser())
+	}
+	return out
+}
+
+func deleteUsers(req *authzextv1.WriteRequest) []string {
+	var out []string
+	for _, t := range req.GetDeletes().GetTupleKeys() {
+		out = append(out, t.GetUser())
+	}
+	return out
+}
+
+// withLastSeenCondition returns a copy of tuple with the last seen condition team memberships were
+// written with by older versions.
+func withLastSeenCondition(tuple *openfgav1.TupleKey) *openfgav1.TupleKey {
+	tuple = proto.Clone(tuple).(*openfgav1.TupleKey)
+	tuple.Condition = &openfgav1.RelationshipCondition{
+		Name: "last_seen",
+		Context: &structpb.Struct{
+			Fields: map[string]*structpb.Value{
+				"last_seen_at": structpb.NewStringValue("2024-05-01T12:00:00Z"),
+			},
+		},
+	}
+	return tuple
+}
+
+// failingWriteClient fails the write request with the given number, counting from 1.
+type failingWriteClient struct {
+	*fakeZanzanaClient
+	failing int
+	calls   int
+}
+
+func (c *failingWriteClient) Write(ctx context.Context, req *authzextv1.WriteRequest) error {
+	c.calls++
+	if c.calls == c.failing {
+		return errUnavailable
+	}
+	return c.fakeZanzanaClient.Write(ctx, req)
+}
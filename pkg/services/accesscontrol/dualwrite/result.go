@@ -0,0 +1,170 @@
+package dualwrite
+
+import (
+	"encoding/json"
+	"sort"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ReconcileResult holds the changes a dry-run reconciliation would make.
+type ReconcileResult struct {
+	// SnapshotID is the snapshot id of the run, see ContextWithSnapshotID.
+	SnapshotID string
+	// Additions are tuples that would be written. Tuples with an updated condition are
+	// included with the new condition.
+	Additions []*openfgav1.TupleKey
+	// Deletions are stale tuples that would be deleted, including tuples of objects that no
+	// longer exist in legacy.
+	Deletions []*openfgav1.TupleKeyWithoutCondition
+	// Updates are stored tuples that would be deleted to be replaced by an addition with an
+	// updated condition.
+	Updates []*openfgav1.TupleKeyWithoutCondition
+	// Violations are collected tuples not allowed by the zanzana schema. Only set when the
+	// dry-run validates tuples.
+	Violations []SchemaViolation
+
+	// stored counts tuples read from zanzana per object type, see checkDeleteFraction.
+	stored map[string]int
+}
+
+type resultJSON struct {
+	SnapshotID string          `json:"snapshotId,omitempty"`
+	Additions  []tupleJSON     `json:"additions"`
+	Deletions  []tupleJSON     `json:"deletions"`
+	Updates    []tupleJSON     `json:"updates,omitempty"`
+	Violations []violationJSON `json:"violations,omitempty"`
+}
+
+type tupleJSON struct {
+	Object    string         `json:"object"`
+	Relation  string         `json:"relation"`
+	Subject   string         `json:"subject"`
+	Condition *conditionJSON `json:"condition,omitempty"`
+}
+
+type violationJSON struct {
+	tupleJSON
+	Reason string `json:"reason"`
+}
+
+type conditionJSON struct {
+	Name    string         `json:"name"`
+	Context map[string]any `json:"context,omitempty"`
+}
+
+// MarshalJSON encodes the result so it can be parsed by external tooling.
+func (r ReconcileResult) MarshalJSON() ([]byte, error) {
+	out := resultJSON{
+		SnapshotID: r.SnapshotID,
+		Additions:  make([]tupleJSON, 0, len(r.Additions)),
+		Deletions:  make([]tupleJSON, 0, len(r.Deletions)),
+	}
+
+	for _, t := range r.Additions {
+		out.Additions = append(out.Additions, newTupleJSON(t))
+	}
+
+	for _, t := range r.Deletions {
+		out.Deletions = append(out.Deletions, tupleJSON{Object: t.GetObject(), Relation: t.GetRelation(), Subject: t.GetUser()})
+	}
+
+	for _, t := range r.Updates {
+		out.Updates = append(out.Updates, tupleJSON{Object: t.GetObject(), Relation: t.GetRelation(), Subject: t.GetUser()})
+	}
+
+	for _, v := range r.Violations {
+		out.Violations = append(out.Violations, violationJSON{tupleJSON: newTupleJSON(v.Tuple), Reason: v.Reason})
+	}
+
+	return json.Marshal(out)
+}
+
+func newTupleJSON(t *openfgav1.TupleKey) tupleJSON {
+	tuple := tupleJSON{Object: t.GetObject(), Relation: t.GetRelation(), Subject: t.GetUser()}
+	if c := t.GetCondition(); c != nil {
+		tuple.Condition = &conditionJSON{Name: c.GetName(), Context: c.GetContext().AsMap()}
+	}
+	return tuple
+}
+
+// UnmarshalJSON decodes a result encoded with MarshalJSON.
+func (r *ReconcileResult) UnmarshalJSON(data []byte) error {
+	var in resultJSON
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	r.SnapshotID = in.SnapshotID
+	r.Additions = make([]*openfgav1.TupleKey, 0, len(in.Additions))
+	for _, t := range in.Additions {
+		tuple, err := t.tupleKey()
+		if err != nil {
+			return err
+		}
+		r.Additions = append(r.Additions, tuple)
+	}
+
+	r.Deletions = make([]*openfgav1.TupleKeyWithoutCondition, 0, len(in.Deletions))
+	for _, t := range in.Deletions {
+		r.Deletions = append(r.Deletions, &openfgav1.TupleKeyWithoutCondition{Object: t.Object, Relation: t.Relation, User: t.Subject})
+	}
+
+	r.Updates = nil
+	for _, t := range in.Updates {
+		r.Updates = append(r.Updates, &openfgav1.TupleKeyWithoutCondition{Object: t.Object, Relation: t.Relation, User: t.Subject})
+	}
+
+	r.Violations = nil
+	for _, v := range in.Violations {
+		tuple, err := v.tupleKey()
+		if err != nil {
+			return err
+		}
+		r.Violations = append(r.Violations, SchemaViolation{Tuple: tuple, Reason: v.Reason})
+	}
+
+	return nil
+}
+
+func (t tupleJSON) tupleKey() (*openfgav1.TupleKey, error) {
+	tuple := &openfgav1.TupleKey{Object: t.Object, Relation: t.Relation, User: t.Subject}
+	if t.Condition != nil {
+		tuple.Condition = &openfgav1.RelationshipCondition{Name: t.Condition.Name}
+		if t.Condition.Context != nil {
+			ctx, err := structpb.NewStruct(t.Condition.Context)
+			if err != nil {
+				return nil, err
+			}
+			tuple.Condition.Context = ctx
+		}
+	}
+	return tuple, nil
+}
+
+func (r *ReconcileResult) merge(other *ReconcileResult) {
+	if r.SnapshotID == "" {
+		r.SnapshotID = other.SnapshotID
+	}
+	r.Additions = append(r.Additions, other.Additions...)
+	r.Deletions = append(r.Deletions, other.Deletions...)
+	r.Updates = append(r.Updates, other.Updates...)
+	r.Violations = append(r.Violations, other.Violations...)
+}
+
+// sort orders changes so the result is stable between runs.
+func (r *ReconcileResult) sort() {
+	sort.Slice(r.Additions, func(i, j int) bool {
+		return r.Additions[i].String() < r.Additions[j].String()
+	})
+	sort.Slice(r.Deletions, func(i, j int) bool {
+		return r.Deletions[i].String() < r.Deletions[j].String()
+	})
+	sort.Slice(r.Updates, func(i, j int) bool {
+		return r.Updates[i].String() < r.Updates[j].String()
+	})
+	sort.Slice(r.Violations, func(i, j int) bool {
+		return r.Violations[i].Tuple.String() < r.Violations[j].Tuple.String()
+	})
+}
@@ -0,0 +1,134 @@
+package dualwrite
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestResourceReconciler_DryRun(t *testing.T) {
+	const namespace = "default"
+
+	client := newFakeZanzanaClient()
+	stale := common.NewFolderTuple("user:2", zanzana.RelationRead, "f1")
+	client.seed(namespace, stale)
+
+	expected := common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")
+	r := newResourceReconciler("test", staticCollector(expected), zanzanaCollector(zanzana.FolderRelations), client)
+
+	result, err := r.dryRun(context.Background(), namespace)
+	require.NoError(t, err)
+
+	require.Len(t, result.Additions, 1)
+	assert.Equal(t, expected.String(), result.Additions[0].String())
+	require.Len(t, result.Deletions, 1)
+	assert.Equal(t, stale.GetUser(), result.Deletions[0].GetUser())
+
+	// nothing should be applied
+	assert.Empty(t, client.writes)
+}
+
+func TestResourceReconciler_DryRun_WouldDelete(t *testing.T) {
+	const namespace = "default"
+
+	member := &openfgav1.TupleKey{Object: "team:t1", Relation: zanzana.RelationTeamMember, User: "user:1"}
+	stale := &openfgav1.TupleKey{Object: "team:t1", Relation: zanzana.RelationTeamMember, User: "user:2"}
+	orphan := common.NewResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "deleted")
+	legacy := common.NewResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d1")
+
+	client := newFakeZanzanaClient()
+	client.seed(namespace, withLastSeenCondition(member), stale, orphan)
+
+	cfg := newReconcileConfig()
+	teams := newResourceReconciler("teams", staticCollector(member), zanzanaCollector([]string{zanzana.RelationTeamMember}), client)
+	teams.cfg = cfg
+	dashboards := newResourceReconciler("dashboards", staticCollector(legacy), zanzanaCollector(zanzana.ResourceRelations), client).
+		withOrphans(orphanCollector(zanzana.KindDashboards, cfg, zanzana.ResourceRelations))
+	dashboards.cfg = cfg
+
+	result := &ReconcileResult{}
+	for _, r := range []resourceReconciler{teams, dashboards} {
+		res, err := r.dryRun(context.Background(), namespace)
+		require.NoError(t, err)
+		result.merge(res)
+	}
+	result.sort()
+
+	deletions := make([]string, 0, len(result.Deletions))
+	for _, d := range result.Deletions {
+		deletions = append(deletions, d.GetObject()+"#"+d.GetRelation()+"@"+d.GetUser())
+	}
+	assert.ElementsMatch(t, []string{
+		stale.Object + "#" + stale.Relation + "@" + stale.User,
+		orphan.Object + "#" + orphan.Relation + "@" + orphan.User,
+	}, deletions)
+
+	require.Len(t, result.Updates, 1)
+	assert.Equal(t, member.User, result.Updates[0].GetUser())
+	require.Len(t, result.Additions, 2)
+
+	// nothing should be applied
+	assert.Empty(t, client.writes)
+	assert.Len(t, client.stored(namespace), 3)
+}
+
+func TestReconcileResult_JSON(t *testing.T) {
+	result := ReconcileResult{
+		Additions: []*openfgav1.TupleKey{
+			common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+			common.NewFolderResourceTuple("team:t1#member", zanzana.RelationWrite, dashboardGroup, dashboardResource, "f1"),
+			common.NewSubresourceTuple("user:1", zanzana.RelationSubresourceRead, dashboardGroup, dashboardResource, "d1", "2"),
+		},
+		Deletions: []*openfgav1.TupleKeyWithoutCondition{
+			{User: "user:2", Relation: zanzana.RelationRead, Object: "folder:f1"},
+		},
+	}
+
+	t.Run("should encode object, relation, subject and condition", func(t *testing.T) {
+		data, err := json.Marshal(result)
+		require.NoError(t, err)
+
+		var raw struct {
+			Additions []map[string]any `json:"additions"`
+			Deletions []map[string]any `json:"deletions"`
+		}
+		require.NoError(t, json.Unmarshal(data, &raw))
+		require.Len(t, raw.Additions, 3)
+		require.Len(t, raw.Deletions, 1)
+
+		assert.Equal(t, "folder:f1", raw.Additions[0]["object"])
+		assert.Equal(t, zanzana.RelationRead, raw.Additions[0]["relation"])
+		assert.Equal(t, "user:1", raw.Additions[0]["subject"])
+		assert.NotContains(t, raw.Additions[0], "condition")
+		assert.Contains(t, raw.Additions[1], "condition")
+		assert.Equal(t, "user:2", raw.Deletions[0]["subject"])
+	})
+
+	t.Run("should round trip", func(t *testing.T) {
+		data, err := json.Marshal(result)
+		require.NoError(t, err)
+
+		var decoded ReconcileResult
+		require.NoError(t, json.Unmarshal(data, &decoded))
+
+		require.Len(t, decoded.Additions, len(result.Additions))
+		for i := range result.Additions {
+			assert.Equal(t, result.Additions[i].String(), decoded.Additions[i].String())
+		}
+		require.Len(t, decoded.Deletions, len(result.Deletions))
+		assert.Equal(t, result.Deletions[0].String(), decoded.Deletions[0].String())
+	})
+
+	t.Run("should encode empty result as empty lists", func(t *testing.T) {
+		data, err := json.Marshal(ReconcileResult{})
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"additions":[],"deletions":[]}`, string(data))
+	})
+}
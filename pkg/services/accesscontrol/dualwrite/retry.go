@@ -0,0 +1,143 @@
+package dualwrite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+	"github.com/grafana/grafana/pkg/util/retryer"
+)
+
+var (
+	// maxRetriesPerCall is the maximum number of attempts for a single call, budget permitting.
+	maxRetriesPerCall = 5
+	retryMinDelay     = 10 * time.Millisecond
+	retryMaxDelay     = time.Second
+)
+
+// errRetryBudgetExhausted is returned for failed calls once there is no budget left to retry them.
+var errRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// retryBudget is a token bucket shared by all reads and writes. Every retry consumes a token
+// and tokens are refilled at a fixed rate, so a flaky backend cannot cause unbounded retries.
+// A run budget is never refilled and is used for a single reconciliation run.
+type retryBudget struct {
+	limiter *rate.Limiter
+	// remaining is the number of retries left in a run budget
+	remaining atomic.Int64
+	exhausted atomic.Bool
+}
+
+// newRetryBudget creates a budget allowing a burst of retries that is refilled by one retry every refill.
+func newRetryBudget(retries int, refill time.Duration) *retryBudget {
+	return &retryBudget{limiter: rate.NewLimiter(rate.Every(refill), retries)}
+}
+
+// newRunRetryBudget creates a budget allowing retries in total that is never refilled.
+func newRunRetryBudget(retries int) *retryBudget {
+	b := &retryBudget{}
+	b.remaining.Store(int64(retries))
+	return b
+}
+
+func (b *retryBudget) allow() bool {
+	var ok bool
+	if b.limiter != nil {
+		ok = b.limiter.Allow()
+	} else {
+		ok = b.remaining.Add(-1) >= 0
+	}
+
+	if !ok {
+		b.exhausted.Store(true)
+	}
+	return ok
+}
+
+// isExhausted returns true once a retry has been denied. It is safe to call on a nil budget.
+func (b *retryBudget) isExhausted() bool {
+	return b != nil && b.exhausted.Load()
+}
+
+type runRetryBudgetKey struct{}
+
+// withRunRetryBudget returns a context where all calls made by retry clients use budget.
+func withRunRetryBudget(ctx context.Context, budget *retryBudget) context.Context {
+	return context.WithValue(ctx, runRetryBudgetKey{}, budget)
+}
+
+func runRetryBudgetFromContext(ctx context.Context) *retryBudget {
+	budget, _ := ctx.Value(runRetryBudgetKey{}).(*retryBudget)
+	return budget
+}
+
+// retry calls fn and retries it on failure as long as there is budget left.
+func (b *retryBudget) retry(ctx context.Context, fn func() error) error {
+	var lastErr error
+	err := retryer.Retry(func() (retryer.RetrySignal, error) {
+		if err := ctx.Err(); err != nil {
+			return retryer.FuncError, err
+		}
+
+		lastErr = fn()
+		if lastErr == nil {
+			return retryer.FuncComplete, nil
+		}
+
+		if !b.allow() {
+			return retryer.FuncError, fmt.Errorf("%w: %w", errRetryBudgetExhausted, lastErr)
+		}
+
+		return retryer.FuncFailure, nil
+	}, maxRetriesPerCall, retryMinDelay, retryMaxDelay)
+
+	if err != nil && lastErr != nil && !errors.Is(err, lastErr) && ctx.Err() == nil {
+		// retryer only reports that max retries was exceeded so we include the last error
+		return fmt.Errorf("%w: %w", err, lastErr)
+	}
+
+	return err
+}
+
+// retryClient retries reads and writes made to zanzana using a shared retry budget. The budget
+// of the current run takes precedence, calls are not retried if there is neither.
+type retryClient struct {
+	zanzana.Client
+	budget *retryBudget
+}
+
+func newRetryClient(client zanzana.Client, budget *retryBudget) *retryClient {
+	return &retryClient{Client: client, budget: budget}
+}
+
+func (c *retryClient) retry(ctx context.Context, fn func() error) error {
+	if budget := runRetryBudgetFromContext(ctx); budget != nil {
+		return budget.retry(ctx, fn)
+	}
+	if c.budget != nil {
+		return c.budget.retry(ctx, fn)
+	}
+	return fn()
+}
+
+func (c *retryClient) Read(ctx context.Context, req *authzextv1.ReadRequest) (*authzextv1.ReadResponse, error) {
+	var res *authzextv1.ReadResponse
+	err := c.retry(ctx, func() error {
+		var err error
+		res, err = c.Client.Read(ctx, req)
+		return err
+	})
+	return res, err
+}
+
+func (c *retryClient) Write(ctx context.Context, req *authzextv1.WriteRequest) error {
+	return c.retry(ctx, func() error {
+		return c.Client.Write(ctx, req)
+	})
+}
@@ -0,0 +1,134 @@
+package dualwrite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+func TestRetryClient(t *testing.T) {
+	minDelay, maxDelay := retryMinDelay, retryMaxDelay
+	retryMinDelay, retryMaxDelay = time.Millisecond, time.Millisecond
+	t.Cleanup(func() {
+		retryMinDelay, retryMaxDelay = minDelay, maxDelay
+	})
+
+	ctx := context.Background()
+
+	t.Run("should stop retrying once the shared budget is exhausted", func(t *testing.T) {
+		client := &failingClient{fakeZanzanaClient: newFakeZanzanaClient(), failures: -1}
+		rc := newRetryClient(client, newRetryBudget(3, time.Hour))
+
+		err := rc.Write(ctx, &authzextv1.WriteRequest{Namespace: "default"})
+		require.ErrorContains(t, err, "retry budget exhausted")
+		// first attempt + 3 retries
+		assert.Equal(t, 4, client.calls)
+
+		_, err = rc.Read(ctx, &authzextv1.ReadRequest{Namespace: "default"})
+		require.ErrorContains(t, err, "retry budget exhausted")
+		// budget is shared so read is not retried
+		assert.Equal(t, 5, client.calls)
+	})
+
+	t.Run("should retry failed calls within budget", func(t *testing.T) {
+		client := &failingClient{fakeZanzanaClient: newFakeZanzanaClient(), failures: 2}
+		rc := newRetryClient(client, newRetryBudget(3, time.Hour))
+
+		_, err := rc.Read(ctx, &authzextv1.ReadRequest{Namespace: "default"})
+		require.NoError(t, err)
+		assert.Equal(t, 3, client.calls)
+	})
+}
+
+func TestRunRetryBudget(t *testing.T) {
+	minDelay, maxDelay := retryMinDelay, retryMaxDelay
+	retryMinDelay, retryMaxDelay = time.Millisecond, time.Millisecond
+	t.Cleanup(func() {
+		retryMinDelay, retryMaxDelay = minDelay, maxDelay
+	})
+
+	t.Run("should cap total retries across clients of a run", func(t *testing.T) {
+		client := &failingClient{fakeZanzanaClient: newFakeZanzanaClient(), failures: -1}
+		budget := newRunRetryBudget(3)
+		ctx := withRunRetryBudget(context.Background(), budget)
+
+		// the run budget takes precedence over the budget of the client
+		first := newRetryClient(client, newRetryBudget(10, time.Millisecond))
+		second := newRetryClient(client, nil)
+
+		err := first.Write(ctx, &authzextv1.WriteRequest{Namespace: "default"})
+		require.ErrorIs(t, err, errRetryBudgetExhausted)
+		require.ErrorIs(t, err, errUnavailable)
+		// first attempt + 3 retries
+		assert.Equal(t, 4, client.calls)
+		assert.True(t, budget.isExhausted())
+
+		for i := 0; i < 3; i++ {
+			_, err = second.Read(ctx, &authzextv1.ReadRequest{Namespace: "default"})
+			require.ErrorIs(t, err, errRetryBudgetExhausted)
+		}
+		// calls are no longer retried once the budget is exhausted
+		assert.Equal(t, 7, client.calls)
+	})
+
+	t.Run("should not retry without any budget", func(t *testing.T) {
+		client := &failingClient{fakeZanzanaClient: newFakeZanzanaClient(), failures: -1}
+		err := newRetryClient(client, nil).Write(context.Background(), &authzextv1.WriteRequest{Namespace: "default"})
+		require.ErrorIs(t, err, errUnavailable)
+		assert.Equal(t, 1, client.calls)
+	})
+
+	t.Run("should stop reconciliation once the run budget is exhausted", func(t *testing.T) {
+		client := &failingClient{fakeZanzanaClient: newFakeZanzanaClient(), failures: -1}
+		rc := newRetryClient(client, nil)
+
+		r := &ZanzanaReconciler{log: log.NewNopLogger(), cfg: newReconcileConfig()}
+		for _, name := range []string{"first", "second", "third"} {
+			r.reconcilers = append(r.reconcilers, newResourceReconciler(name, staticCollector(
+				common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+			), zanzanaCollector([]string{zanzana.RelationRead}), rc))
+		}
+		r.cfg.runRetries = 2
+
+		r.reconcileNamespace(r.withRunRetryBudget(context.Background()), "default")
+		// read of the first reconciler + 2 retries, the remaining reconcilers are skipped
+		assert.Equal(t, 3, client.calls)
+	})
+}
+
+var errUnavailable = errors.New("unavailable")
+
+// failingClient fails the first number of reads and writes specified by failures, -1 fails all calls.
+type failingClient struct {
+	*fakeZanzanaClient
+	failures int
+	calls    int
+}
+
+func (c *failingClient) fail() bool {
+	c.calls++
+	return c.failures < 0 || c.calls <= c.failures
+}
+
+func (c *failingClient) Read(ctx context.Context, req *authzextv1.ReadRequest) (*authzextv1.ReadResponse, error) {
+	if c.fail() {
+		return nil, errUnavailable
+	}
+	return c.fakeZanzanaClient.Read(ctx, req)
+}
+
+func (c *failingClient) Write(ctx context.Context, req *authzextv1.WriteRequest) error {
+	if c.fail() {
+		return errUnavailable
+	}
+	return c.fakeZanzanaClient.Write(ctx, req)
+}
@@ -0,0 +1,185 @@
+package dualwrite
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+// rollbackJournal tracks the tuples written and deleted during a reconciliation run so they can
+// be reversed if the run fails. Only the first change of every tuple is kept, it holds the
+// state before the run.
+type rollbackJournal struct {
+	mu sync.Mutex
+	// original holds the tuple stored before the run, or nil if there was none, by tuple key.
+	original map[string]*openfgav1.TupleKey
+	// present is set for tuples stored after the last change, by tuple key.
+	present map[string]*openfgav1.TupleKey
+	// order is the order tuples were first changed in so rollbacks are deterministic.
+	order []string
+	// objects are the objects marked as applied in the idempotency store during the run.
+	objects []appliedObject
+}
+
+// appliedObject is an object marked as applied by the reconciler with name.
+type appliedObject struct {
+	name   string
+	object string
+}
+
+func newRollbackJournal() *rollbackJournal {
+	return &rollbackJournal{
+		original: make(map[string]*openfgav1.TupleKey),
+		present:  make(map[string]*openfgav1.TupleKey),
+	}
+}
+
+// written records tuples that were written.
+func (j *rollbackJournal) written(tuples []*openfgav1.TupleKey) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, t := range tuples {
+		key := tupleStringWithoutCondition(t)
+		j.touch(key, nil)
+		j.present[key] = t
+	}
+}
+
+// deleted records stored tuples that were deleted.
+func (j *rollbackJournal) deleted(tuples []*openfgav1.TupleKey) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, t := range tuples {
+		key := tupleStringWithoutCondition(t)
+		j.touch(key, t)
+		delete(j.present, key)
+	}
+}
+
+// applied records that object was marked as applied by the reconciler with name.
+func (j *rollbackJournal) applied(name, object string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.objects = append(j.objects, appliedObject{name: name, object: object})
+}
+
+// appliedObjects returns the objects marked as applied during the run.
+func (j *rollbackJournal) appliedObjects() []appliedObject {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return slices.Clone(j.objects)
+}
+
+func (j *rollbackJournal) touch(key string, original *openfgav1.TupleKey) {
+	if _, ok := j.original[key]; ok {
+		return
+	}
+	j.original[key] = original
+	j.order = append(j.order, key)
+}
+
+// rollback restores every changed tuple to its state before the run. Tuples written by the run
+// are deleted first so tuples with a replaced condition can be written again.
+func (j *rollbackJournal) rollback(ctx context.Context, client zanzana.Client, namespace string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var (
+		deletes []*openfgav1.TupleKeyWithoutCondition
+		writes  []*openfgav1.TupleKey
+	)
+	for _, key := range j.order {
+		if t, ok := j.present[key]; ok {
+			deletes = append(deletes, &openfgav1.TupleKeyWithoutCondition{User: t.User, Relation: t.Relation, Object: t.Object})
+		}
+		if t := j.original[key]; t != nil {
+			writes = append(writes, t)
+		}
+	}
+
+	err := batch(deletes, maxWriteSize, func(items []*openfgav1.TupleKeyWithoutCondition) error {
+		return client.Write(ctx, &authzextv1.WriteRequest{
+			Namespace: namespace,
+			Deletes:   &authzextv1.WriteRequestDeletes{TupleKeys: common.ToAuthzExtTupleKeysWithoutCondition(items)},
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = batch(writes, maxWriteSize, func(items []*openfgav1.TupleKey) error {
+		return client.Write(ctx, &authzextv1.WriteRequest{
+			Namespace: namespace,
+			Writes:    &authzextv1.WriteRequestWrites{TupleKeys: common.ToAuthzExtTupleKeys(items)},
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	j.original = make(map[string]*openfgav1.TupleKey)
+	j.present = make(map[string]*openfgav1.TupleKey)
+	j.order = nil
+	return nil
+}
+
+type rollbackJournalKey struct{}
+
+// withRollbackJournal returns a context where all writes are recorded in journal.
+func withRollbackJournal(ctx context.Context, journal *rollbackJournal) context.Context {
+	return context.WithValue(ctx, rollbackJournalKey{}, journal)
+}
+
+func rollbackJournalFromContext(ctx context.Context) *rollbackJournal {
+	journal, _ := ctx.Value(rollbackJournalKey{}).(*rollbackJournal)
+	return journal
+}
+
+// journalClient records successful writes in the rollback journal of the context. Deleted
+// tuples are read before they are deleted so they can be restored with their condition.
+type journalClient struct {
+	zanzana.Client
+}
+
+func newJournalClient(client zanzana.Client) *journalClient {
+	return &journalClient{Client: client}
+}
+
+func (c *journalClient) Write(ctx context.Context, req *authzextv1.WriteRequest) error {
+	journal := rollbackJournalFromContext(ctx)
+	if journal == nil {
+		return c.Client.Write(ctx, req)
+	}
+
+	deleted := make([]*openfgav1.TupleKey, 0, len(req.GetDeletes().GetTupleKeys()))
+	for _, t := range req.GetDeletes().GetTupleKeys() {
+		res, err := c.Client.Read(ctx, &authzextv1.ReadRequest{
+			Namespace: req.GetNamespace(),
+			TupleKey:  &authzextv1.ReadRequestTupleKey{User: t.GetUser(), Relation: t.GetRelation(), Object: t.GetObject()},
+		})
+		if err != nil {
+			return err
+		}
+		for _, stored := range res.GetTuples() {
+			deleted = append(deleted, common.ToOpenFGATupleKey(stored.GetKey()))
+		}
+	}
+
+	if err := c.Client.Write(ctx, req); err != nil {
+		return err
+	}
+
+	journal.deleted(deleted)
+	written := make([]*openfgav1.TupleKey, 0, len(req.GetWrites().GetTupleKeys()))
+	for _, t := range req.GetWrites().GetTupleKeys() {
+		written = append(written, common.ToOpenFGATupleKey(t))
+	}
+	journal.written(written)
+	return nil
+}
@@ -0,0 +1,112 @@
+package dualwrite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/grafana/authlib/claims"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestReconcileNamespace_RollbackOnFailure(t *testing.T) {
+	namespace := claims.OrgNamespaceFormatter(1)
+
+	run := func(t *testing.T, second legacyTupleCollector, opts ...ReconcilerOption) (before, after []string) {
+		t.Helper()
+
+		client := newFakeZanzanaClient()
+		client.seed(namespace,
+			common.NewFolderTuple("user:2", zanzana.RelationRead, "f1"),
+			common.NewFolderResourceTuple("user:3", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"),
+		)
+		for _, tuple := range client.stored(namespace) {
+			before = append(before, tuple.String())
+		}
+
+		// the first reconciler writes user:1, deletes user:2 and updates the condition of user:3
+		update := common.NewFolderResourceTuple("user:3", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")
+		zanzana.MergeFolderResourceTuples(update, common.NewFolderResourceTuple("user:3", zanzana.RelationRead, dashboardGroup, "librarypanels", "f1"))
+
+		r := NewZanzanaReconciler(client, nil, nil, opts...)
+		r.reconcilers = []resourceReconciler{
+			newResourceReconciler("first", staticCollector(
+				common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+				update,
+			), zanzanaCollector(zanzana.FolderRelations), client),
+			newResourceReconciler("second", second, zanzanaCollector(zanzana.FolderRelations), client),
+		}
+		for i := range r.reconcilers {
+			r.reconcilers[i].cfg = r.cfg
+			if r.cfg.rollbackOnFailure {
+				r.reconcilers[i].client = newJournalClient(client)
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		r.reconcileNamespace(context.WithValue(ctx, cancelKey{}, cancel), namespace)
+
+		for _, tuple := range client.stored(namespace) {
+			after = append(after, tuple.String())
+		}
+		return before, after
+	}
+
+	failing := func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		return nil, errors.New("failed to collect")
+	}
+
+	cancelling := func(ctx context.Context, orgId int64) (map[string]map[string]*openfgav1.TupleKey, error) {
+		ctx.Value(cancelKey{}).(context.CancelFunc)()
+		return nil, ctx.Err()
+	}
+
+	t.Run("should restore the prior state after a mid-run failure", func(t *testing.T) {
+		before, after := run(t, failing, WithRollbackOnFailure())
+		assert.ElementsMatch(t, before, after)
+	})
+
+	t.Run("should restore the prior state after cancellation", func(t *testing.T) {
+		before, after := run(t, cancelling, WithRollbackOnFailure())
+		assert.ElementsMatch(t, before, after)
+	})
+
+	t.Run("should keep partial changes when disabled", func(t *testing.T) {
+		before, after := run(t, failing)
+		require.Len(t, after, 2)
+		assert.NotEqual(t, before, after)
+	})
+}
+
+type cancelKey struct{}
+
+func TestRollbackJournal(t *testing.T) {
+	const namespace = "default"
+
+	client := newFakeZanzanaClient()
+	stored := common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")
+	client.seed(namespace, stored)
+
+	journal := newRollbackJournal()
+	// written and deleted again within the run
+	journal.written([]*openfgav1.TupleKey{common.NewFolderTuple("user:2", zanzana.RelationRead, "f1")})
+	journal.deleted([]*openfgav1.TupleKey{common.NewFolderTuple("user:2", zanzana.RelationRead, "f1")})
+	// deleted and written again within the run
+	journal.deleted([]*openfgav1.TupleKey{stored})
+	journal.written([]*openfgav1.TupleKey{stored})
+
+	require.NoError(t, journal.rollback(context.Background(), client, namespace))
+
+	// user:1 is deleted and written again, nothing is done for user:2
+	require.Len(t, client.writes, 2)
+	assert.Len(t, client.writes[0].GetDeletes().GetTupleKeys(), 1)
+	assert.Len(t, client.writes[1].GetWrites().GetTupleKeys(), 1)
+	require.Len(t, client.stored(namespace), 1)
+	assert.Equal(t, stored.String(), client.stored(namespace)[0].String())
+}
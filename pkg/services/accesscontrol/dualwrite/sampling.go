@@ -0,0 +1,55 @@
+package dualwrite
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+)
+
+// checkSampling selects the tuples semantic verification checks against zanzana. Checks are
+// expensive, sampling lets verification run continuously at a fraction of the cost.
+type checkSampling struct {
+	// rate is the fraction of tuples checked, 0 or 1 and above checks every tuple.
+	rate float64
+	// seed makes the sample reproducible, the same seed selects the same tuples.
+	seed int64
+	// fixedSeed keeps seed for every run, otherwise each run selects its own sample so all
+	// tuples are eventually checked.
+	fixedSeed bool
+}
+
+// forRun returns the sampling used by a run started at now. Unless the seed is fixed, it's
+// derived from now so consecutive runs check different tuples.
+func (s checkSampling) forRun(now time.Time) checkSampling {
+	if !s.fixedSeed {
+		s.seed = now.UnixNano()
+	}
+	return s
+}
+
+// sample returns rate of tuples, rounded to the nearest count but at least one. Tuples are
+// ordered before sampling so the selection only depends on the seed and the tuples.
+func (s checkSampling) sample(tuples []*openfgav1.TupleKey) []*openfgav1.TupleKey {
+	sorted := slices.Clone(tuples)
+	slices.SortFunc(sorted, func(a, b *openfgav1.TupleKey) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	if s.rate <= 0 || s.rate >= 1 || len(sorted) == 0 {
+		return sorted
+	}
+
+	n := max(int(math.Round(s.rate*float64(len(sorted)))), 1)
+	indexes := rand.New(rand.NewSource(s.seed)).Perm(len(sorted))[:n]
+	slices.Sort(indexes)
+
+	sampled := make([]*openfgav1.TupleKey, 0, n)
+	for _, i := range indexes {
+		sampled = append(sampled, sorted[i])
+	}
+	return sampled
+}
@@ -0,0 +1,90 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+)
+
+func TestCheckSampling(t *testing.T) {
+	tuples := make([]*openfgav1.TupleKey, 0, 200)
+	for i := 0; i < 200; i++ {
+		tuples = append(tuples, &openfgav1.TupleKey{
+			User:     zanzana.NewTupleEntry(zanzana.TypeUser, fmt.Sprintf("u%d", i), ""),
+			Relation: zanzana.RelationTeamAdmin,
+			Object:   zanzana.NewTupleEntry(zanzana.TypeTeam, "t1", ""),
+		})
+	}
+
+	t.Run("should sample the configured rate of tuples", func(t *testing.T) {
+		assert.Len(t, checkSampling{rate: 0.01, seed: 1}.sample(tuples), 2)
+		assert.Len(t, checkSampling{rate: 0.25, seed: 1}.sample(tuples), 50)
+		assert.Len(t, checkSampling{rate: 0.001, seed: 1}.sample(tuples), 1)
+		assert.Empty(t, checkSampling{rate: 0.5, seed: 1}.sample(nil))
+	})
+
+	t.Run("should check every tuple when sampling is disabled", func(t *testing.T) {
+		assert.Len(t, checkSampling{}.sample(tuples), 200)
+		assert.Len(t, checkSampling{rate: 1}.sample(tuples), 200)
+	})
+
+	t.Run("should select the same tuples for the same seed", func(t *testing.T) {
+		reversed := make([]*openfgav1.TupleKey, 0, len(tuples))
+		for i := len(tuples) - 1; i >= 0; i-- {
+			reversed = append(reversed, tuples[i])
+		}
+
+		sampled := tupleStrings(checkSampling{rate: 0.1, seed: 42}.sample(tuples)...)
+		assert.Equal(t, sampled, tupleStrings(checkSampling{rate: 0.1, seed: 42}.sample(reversed)...))
+		assert.NotEqual(t, sampled, tupleStrings(checkSampling{rate: 0.1, seed: 43}.sample(tuples)...))
+	})
+
+	t.Run("should select a different sample for every run unless the seed is fixed", func(t *testing.T) {
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		sampling := checkSampling{rate: 0.1}
+
+		first := tupleStrings(sampling.forRun(start).sample(tuples)...)
+		assert.Equal(t, first, tupleStrings(sampling.forRun(start).sample(tuples)...))
+		assert.NotEqual(t, first, tupleStrings(sampling.forRun(start.Add(time.Hour)).sample(tuples)...))
+
+		fixed := checkSampling{rate: 0.1, seed: 42, fixedSeed: true}
+		assert.Equal(t,
+			tupleStrings(fixed.forRun(start).sample(tuples)...),
+			tupleStrings(fixed.forRun(start.Add(time.Hour)).sample(tuples)...),
+		)
+	})
+
+	t.Run("should configure sampling with options", func(t *testing.T) {
+		r := &ZanzanaReconciler{cfg: newReconcileConfig()}
+		WithCheckSampling(0.1)(r)
+		assert.Equal(t, checkSampling{rate: 0.1}, r.cfg.checkSampling)
+
+		WithCheckSamplingSeed(42)(r)
+		assert.Equal(t, checkSampling{rate: 0.1, seed: 42, fixedSeed: true}, r.cfg.checkSampling)
+	})
+
+	t.Run("should only check sampled team admins", func(t *testing.T) {
+		legacy := map[string]map[string]*openfgav1.TupleKey{}
+		for _, tuple := range tuples {
+			putTuple(legacy, tuple)
+		}
+
+		var checks int
+		checker := tupleCheckerFunc(func(_ string, _ *openfgav1.CheckRequestTupleKey) (bool, error) {
+			checks++
+			return false, nil
+		})
+
+		failed, err := verifyTeamAdminMembership(context.Background(), checker, "default", legacy, checkSampling{rate: 0.05, seed: 7})
+		require.NoError(t, err)
+		assert.Equal(t, 10, checks)
+		assert.Len(t, failed, 10)
+	})
+}
@@ -0,0 +1,80 @@
+package dualwrite
+
+import (
+	"fmt"
+	"sort"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+// MarshalCollection serializes tuples collected for namespace into batches of at most
+// maxWriteSize tuples. Every batch is an encoded authzextv1.WriteRequest so a collection can be
+// shipped to a remote migrator and written to zanzana as is. Tuples are ordered by object so the
+// same collection is always serialized the same way.
+func MarshalCollection(namespace string, tuples map[string]map[string]*openfgav1.TupleKey) ([][]byte, error) {
+	objects := make([]string, 0, len(tuples))
+	for object := range tuples {
+		objects = append(objects, object)
+	}
+	sort.Strings(objects)
+
+	var flat []*openfgav1.TupleKey
+	for _, object := range objects {
+		keys := make([]string, 0, len(tuples[object]))
+		for key := range tuples[object] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			flat = append(flat, tuples[object][key])
+		}
+	}
+
+	var batches [][]byte
+	err := batch(flat, maxWriteSize, func(items []*openfgav1.TupleKey) error {
+		// conditions hold maps that are only encoded the same way with deterministic marshaling
+		data, err := proto.MarshalOptions{Deterministic: true}.Marshal(&authzextv1.WriteRequest{
+			Namespace: namespace,
+			Writes:    &authzextv1.WriteRequestWrites{TupleKeys: common.ToAuthzExtTupleKeys(items)},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode batch: %w", err)
+		}
+		batches = append(batches, data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batches, nil
+}
+
+// UnmarshalCollection decodes batches encoded with MarshalCollection into the namespace and
+// tuples grouped by object and keyed the same way collectors do. All batches must be for the
+// same namespace.
+func UnmarshalCollection(batches [][]byte) (string, map[string]map[string]*openfgav1.TupleKey, error) {
+	var namespace string
+	tuples := make(map[string]map[string]*openfgav1.TupleKey)
+
+	for i, data := range batches {
+		var req authzextv1.WriteRequest
+		if err := proto.Unmarshal(data, &req); err != nil {
+			return "", nil, fmt.Errorf("failed to decode batch %d: %w", i, err)
+		}
+
+		if i > 0 && req.GetNamespace() != namespace {
+			return "", nil, fmt.Errorf("batch %d is for namespace %s, expected %s", i, req.GetNamespace(), namespace)
+		}
+		namespace = req.GetNamespace()
+
+		for _, t := range req.GetWrites().GetTupleKeys() {
+			putTuple(tuples, common.ToOpenFGATupleKey(t))
+		}
+	}
+
+	return namespace, tuples, nil
+}
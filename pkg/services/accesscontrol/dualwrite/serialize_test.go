@@ -0,0 +1,62 @@
+package dualwrite
+
+import (
+	"fmt"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestMarshalCollection(t *testing.T) {
+	const namespace = "org-1"
+
+	tuples := make(map[string]map[string]*openfgav1.TupleKey)
+	for i := 0; i < maxWriteSize+10; i++ {
+		putTuple(tuples, common.NewFolderTuple(fmt.Sprintf("user:%d", i), zanzana.RelationRead, "f1"))
+	}
+	putTuple(tuples, common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"))
+	putTuple(tuples, common.NewResourceTuple("team:t1#member", zanzana.RelationWrite, dashboardGroup, dashboardResource, "d1"))
+	putTuple(tuples, &openfgav1.TupleKey{Object: "folder:f2", Relation: zanzana.RelationParent, User: "folder:f1"})
+
+	t.Run("should round-trip collected tuples", func(t *testing.T) {
+		batches, err := MarshalCollection(namespace, tuples)
+		require.NoError(t, err)
+		require.Len(t, batches, 2)
+
+		decodedNamespace, decoded, err := UnmarshalCollection(batches)
+		require.NoError(t, err)
+		assert.Equal(t, namespace, decodedNamespace)
+
+		require.Len(t, decoded, len(tuples))
+		for object, expected := range tuples {
+			require.Len(t, decoded[object], len(expected), object)
+			for key, tuple := range expected {
+				require.Contains(t, decoded[object], key)
+				assert.Equal(t, tuple.String(), decoded[object][key].String())
+			}
+		}
+	})
+
+	t.Run("should serialize the same collection the same way", func(t *testing.T) {
+		a, err := MarshalCollection(namespace, tuples)
+		require.NoError(t, err)
+		b, err := MarshalCollection(namespace, tuples)
+		require.NoError(t, err)
+		assert.Equal(t, a, b)
+	})
+
+	t.Run("should reject batches of different namespaces", func(t *testing.T) {
+		a, err := MarshalCollection("org-1", tuples)
+		require.NoError(t, err)
+		b, err := MarshalCollection("org-2", tuples)
+		require.NoError(t, err)
+
+		_, _, err = UnmarshalCollection(append(a, b...))
+		require.ErrorContains(t, err, "org-2")
+	})
+}
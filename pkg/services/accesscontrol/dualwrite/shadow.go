@@ -0,0 +1,143 @@
+package dualwrite
+
+import (
+	"context"
+	"time"
+
+	"github.com/grafana/authlib/authz"
+	"github.com/grafana/authlib/claims"
+	"golang.org/x/time/rate"
+
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+)
+
+const (
+	shadowResultMatch    = "match"
+	shadowResultMismatch = "mismatch"
+	shadowResultError    = "error"
+	shadowResultSkipped  = "skipped"
+)
+
+const (
+	// shadowCheckTimeout bounds every zanzana check made by the shadow checker.
+	shadowCheckTimeout = 100 * time.Millisecond
+	// shadowCheckMaxInFlight is the number of asynchronous shadow checks that can run at the
+	// same time, checks made while it is reached are skipped.
+	shadowCheckMaxInFlight = 100
+	// shadowErrorLogInterval is the minimum interval between two logged shadow check failures.
+	shadowErrorLogInterval = time.Minute
+)
+
+// ShadowChecker is used while zanzana is written to but not yet trusted for authorization.
+// Legacy access control is still the one making the decision, zanzana is checked for the
+// same request and any divergence is logged and counted.
+type ShadowChecker struct {
+	log     log.Logger
+	client  zanzana.Client
+	metrics *dualwriteMetrics
+	timeout time.Duration
+	// inFlight limits the number of asynchronous checks.
+	inFlight chan struct{}
+	// errorLogs limits how often failures are logged, a failing zanzana fails every check.
+	errorLogs *rate.Limiter
+}
+
+func NewShadowChecker(client zanzana.Client) *ShadowChecker {
+	return &ShadowChecker{
+		log:       log.New("zanzana.shadow"),
+		client:    client,
+		metrics:   initMetrics(),
+		timeout:   shadowCheckTimeout,
+		inFlight:  make(chan struct{}, shadowCheckMaxInFlight),
+		errorLogs: rate.NewLimiter(rate.Every(shadowErrorLogInterval), 1),
+	}
+}
+
+// Check performs a zanzana check for req and compares the result with the legacy decision.
+// The legacy decision is always returned so it is safe to wrap existing authorization with it.
+// The zanzana check is cancelled after a short timeout so it adds a bounded latency at most,
+// use CheckAsync on latency sensitive paths.
+func (s *ShadowChecker) Check(ctx context.Context, id claims.AuthInfo, req authz.CheckRequest, legacy bool) bool {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.ShadowChecker.Check")
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	res, err := s.client.Check(ctx, id, req)
+	if err != nil {
+		s.metrics.shadowCheckTotal.WithLabelValues(shadowResultError).Inc()
+		if s.errorLogs.Allow() {
+			s.log.Warn("Failed to perform zanzana shadow check", "error", err)
+		}
+		return legacy
+	}
+
+	if res.Allowed != legacy {
+		s.metrics.shadowCheckTotal.WithLabelValues(shadowResultMismatch).Inc()
+		s.log.Warn(
+			"Zanzana decision does not match legacy decision",
+			"legacy_decision", legacy,
+			"zanzana_decision", res.Allowed,
+			"namespace", req.Namespace,
+			"verb", req.Verb,
+			"group", req.Group,
+			"resource", req.Resource,
+			"name", req.Name,
+			"folder", req.Folder,
+		)
+		return legacy
+	}
+
+	s.metrics.shadowCheckTotal.WithLabelValues(shadowResultMatch).Inc()
+	return legacy
+}
+
+// CheckAsync runs Check in the background so zanzana never delays the legacy decision. The
+// check outlives the request it is made for, it is skipped when too many checks are running.
+func (s *ShadowChecker) CheckAsync(ctx context.Context, id claims.AuthInfo, req authz.CheckRequest, legacy bool) {
+	select {
+	case s.inFlight <- struct{}{}:
+	default:
+		s.metrics.shadowCheckTotal.WithLabelValues(shadowResultSkipped).Inc()
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer func() { <-s.inFlight }()
+		s.Check(ctx, id, req, legacy)
+	}()
+}
+
+// shadowAccessClient makes authorization decisions with legacy and shadow checks every
+// decision against zanzana in the background.
+type shadowAccessClient struct {
+	legacy authz.AccessClient
+	shadow *ShadowChecker
+}
+
+var _ authz.AccessClient = (*shadowAccessClient)(nil)
+
+func (c *shadowAccessClient) Check(ctx context.Context, id claims.AuthInfo, req authz.CheckRequest) (authz.CheckResponse, error) {
+	res, err := c.legacy.Check(ctx, id, req)
+	if err != nil {
+		return res, err
+	}
+	c.shadow.CheckAsync(ctx, id, req, res.Allowed)
+	return res, nil
+}
+
+func (c *shadowAccessClient) Compile(ctx context.Context, id claims.AuthInfo, req authz.ListRequest) (authz.ItemChecker, error) {
+	return c.legacy.Compile(ctx, id, req)
+}
+
+// AccessClient wraps legacy so every check is shadow checked against zanzana when the
+// reconciler is created with WithShadowChecks. Otherwise legacy is returned as is.
+func (r *ZanzanaReconciler) AccessClient(legacy authz.AccessClient) authz.AccessClient {
+	if r.shadow == nil {
+		return legacy
+	}
+	return &shadowAccessClient{legacy: legacy, shadow: r.shadow}
+}
@@ -0,0 +1,183 @@
+package dualwrite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/grafana/authlib/authz"
+	"github.com/grafana/authlib/claims"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/grafana/grafana/pkg/apimachinery/identity"
+)
+
+func TestShadowChecker_Check(t *testing.T) {
+	type testCase struct {
+		desc     string
+		legacy   bool
+		zanzana  bool
+		err      error
+		expected string
+	}
+
+	tests := []testCase{
+		{desc: "should count match when both allow", legacy: true, zanzana: true, expected: shadowResultMatch},
+		{desc: "should count match when both deny", legacy: false, zanzana: false, expected: shadowResultMatch},
+		{desc: "should count mismatch when only legacy allows", legacy: true, zanzana: false, expected: shadowResultMismatch},
+		{desc: "should count mismatch when only zanzana allows", legacy: false, zanzana: true, expected: shadowResultMismatch},
+		{desc: "should count error when zanzana check fails", legacy: true, err: errors.New("unavailable"), expected: shadowResultError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			client := newFakeZanzanaClient()
+			client.checkFn = func(_ claims.AuthInfo, _ authz.CheckRequest) (bool, error) {
+				return tt.zanzana, tt.err
+			}
+
+			checker := NewShadowChecker(client)
+			before := shadowCounts(checker)
+
+			decision := checker.Check(context.Background(), &identity.StaticRequester{}, authz.CheckRequest{
+				Namespace: "default",
+				Verb:      "get",
+				Group:     "dashboard.grafana.app",
+				Resource:  "dashboards",
+				Name:      "1",
+			}, tt.legacy)
+
+			// legacy decision should always be the one returned
+			assert.Equal(t, tt.legacy, decision)
+
+			after := shadowCounts(checker)
+			for _, result := range []string{shadowResultMatch, shadowResultMismatch, shadowResultError} {
+				expected := 0.0
+				if result == tt.expected {
+					expected = 1
+				}
+				assert.Equal(t, expected, after[result]-before[result], result)
+			}
+		})
+	}
+}
+
+func TestShadowChecker_Timeout(t *testing.T) {
+	client := &blockingCheckClient{fakeZanzanaClient: newFakeZanzanaClient(), release: make(chan struct{})}
+	defer close(client.release)
+
+	checker := NewShadowChecker(client)
+	checker.timeout = 10 * time.Millisecond
+	before := shadowCounts(checker)
+
+	// a zanzana check that never completes is cancelled and counted as failed
+	decision := checker.Check(context.Background(), &identity.StaticRequester{}, authz.CheckRequest{Namespace: "default"}, true)
+	assert.True(t, decision)
+
+	after := shadowCounts(checker)
+	assert.Equal(t, 1.0, after[shadowResultError]-before[shadowResultError])
+}
+
+// blockingCheckClient blocks every check until release is closed or the context is done.
+type blockingCheckClient struct {
+	*fakeZanzanaClient
+	release chan struct{}
+}
+
+func (c *blockingCheckClient) Check(ctx context.Context, _ claims.AuthInfo, _ authz.CheckRequest) (authz.CheckResponse, error) {
+	select {
+	case <-c.release:
+		return authz.CheckResponse{}, nil
+	case <-ctx.Done():
+		return authz.CheckResponse{}, ctx.Err()
+	}
+}
+
+func shadowCounts(checker *ShadowChecker) map[string]float64 {
+	out := map[string]float64{}
+	for _, result := range []string{shadowResultMatch, shadowResultMismatch, shadowResultError, shadowResultSkipped} {
+		out[result] = testutil.ToFloat64(checker.metrics.shadowCheckTotal.WithLabelValues(result))
+	}
+	return out
+}
+
+func TestZanzanaReconciler_AccessClient(t *testing.T) {
+	req := authz.CheckRequest{Namespace: "default", Verb: "get", Group: "dashboard.grafana.app", Resource: "dashboards", Name: "1"}
+
+	t.Run("should return legacy client when shadow checks are disabled", func(t *testing.T) {
+		legacy := &staticAccessClient{allowed: true}
+		r := NewZanzanaReconciler(newFakeZanzanaClient(), nil, nil)
+		assert.Same(t, legacy, r.AccessClient(legacy))
+	})
+
+	t.Run("should shadow check legacy decisions when enabled", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		client.checkFn = func(_ claims.AuthInfo, _ authz.CheckRequest) (bool, error) {
+			return false, nil
+		}
+
+		r := NewZanzanaReconciler(client, nil, nil, WithShadowChecks())
+		before := shadowCounts(r.shadow)
+
+		res, err := r.AccessClient(&staticAccessClient{allowed: true}).Check(context.Background(), &identity.StaticRequester{}, req)
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed)
+
+		// the shadow check runs in the background
+		assert.Eventually(t, func() bool {
+			after := shadowCounts(r.shadow)
+			return after[shadowResultMismatch]-before[shadowResultMismatch] == 1
+		}, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("should not wait for zanzana before returning legacy decision", func(t *testing.T) {
+		client := &blockingCheckClient{fakeZanzanaClient: newFakeZanzanaClient(), release: make(chan struct{})}
+		defer close(client.release)
+
+		r := NewZanzanaReconciler(client, nil, nil, WithShadowChecks())
+		res, err := r.AccessClient(&staticAccessClient{allowed: true}).Check(context.Background(), &identity.StaticRequester{}, req)
+		assert.NoError(t, err)
+		assert.True(t, res.Allowed)
+	})
+
+	t.Run("should skip shadow checks when too many are running", func(t *testing.T) {
+		client := &blockingCheckClient{fakeZanzanaClient: newFakeZanzanaClient(), release: make(chan struct{})}
+		defer close(client.release)
+
+		r := NewZanzanaReconciler(client, nil, nil, WithShadowChecks())
+		r.shadow.timeout = time.Minute
+		before := shadowCounts(r.shadow)
+
+		for i := 0; i < shadowCheckMaxInFlight+1; i++ {
+			_, err := r.AccessClient(&staticAccessClient{allowed: true}).Check(context.Background(), &identity.StaticRequester{}, req)
+			assert.NoError(t, err)
+		}
+
+		after := shadowCounts(r.shadow)
+		assert.Equal(t, 1.0, after[shadowResultSkipped]-before[shadowResultSkipped])
+	})
+
+	t.Run("should not shadow check when legacy check fails", func(t *testing.T) {
+		r := NewZanzanaReconciler(newFakeZanzanaClient(), nil, nil, WithShadowChecks())
+		before := shadowCounts(r.shadow)
+
+		_, err := r.AccessClient(&staticAccessClient{err: errors.New("failed")}).Check(context.Background(), &identity.StaticRequester{}, req)
+		assert.Error(t, err)
+		assert.Equal(t, before, shadowCounts(r.shadow))
+	})
+}
+
+type staticAccessClient struct {
+	allowed bool
+	err     error
+}
+
+func (c *staticAccessClient) Check(_ context.Context, _ claims.AuthInfo, _ authz.CheckRequest) (authz.CheckResponse, error) {
+	return authz.CheckResponse{Allowed: c.allowed}, c.err
+}
+
+func (c *staticAccessClient) Compile(_ context.Context, _ claims.AuthInfo, _ authz.ListRequest) (authz.ItemChecker, error) {
+	return func(_, _, _ string) bool { return c.allowed }, c.err
+}
@@ -0,0 +1,41 @@
+package dualwrite
+
+import (
+	"context"
+)
+
+type snapshotIDKey struct{}
+
+// ContextWithSnapshotID returns a context where everything produced by collection, e.g. reports,
+// progress, dry-run results and logs, is tagged with id. It is used to correlate a reconciliation
+// run with the migration job that started it.
+func ContextWithSnapshotID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, snapshotIDKey{}, id)
+}
+
+// SnapshotIDFromContext returns the snapshot id of ctx, it is empty if none is set.
+func SnapshotIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(snapshotIDKey{}).(string)
+	return id
+}
+
+// snapshotLogArgs appends the snapshot id of ctx, if any, to the key value pairs of a log line.
+func snapshotLogArgs(ctx context.Context, args ...any) []any {
+	if id := SnapshotIDFromContext(ctx); id != "" {
+		return append(args, "snapshotId", id)
+	}
+	return args
+}
+
+// observeSnapshot exposes the snapshot id of ctx as the current snapshot. Only the last snapshot
+// is kept so the metric doesn't grow with every run.
+func observeSnapshot(ctx context.Context) {
+	id := SnapshotIDFromContext(ctx)
+	if id == "" {
+		return
+	}
+
+	m := initMetrics()
+	m.snapshotInfo.Reset()
+	m.snapshotInfo.WithLabelValues(id).Set(1)
+}
@@ -0,0 +1,82 @@
+package dualwrite
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/grafana/authlib/claims"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/infra/log/logtest"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestSnapshotID(t *testing.T) {
+	const snapshotID = "migration-42"
+	namespace := claims.OrgNamespaceFormatter(1)
+	ctx := ContextWithSnapshotID(context.Background(), snapshotID)
+	tuple := common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")
+
+	newReconciler := func(store ProgressStore) (*ZanzanaReconciler, *fakeZanzanaClient) {
+		client := newFakeZanzanaClient()
+		r := NewZanzanaReconciler(client, nil, nil, WithProgressStore(store, 1))
+		rr := newResourceReconciler("test", staticCollector(tuple), zanzanaCollector(zanzana.FolderRelations), client)
+		rr.cfg = r.cfg
+		r.reconcilers = []resourceReconciler{rr}
+		return r, client
+	}
+
+	t.Run("should attach snapshot id to report and progress", func(t *testing.T) {
+		store := &recordingProgressStore{}
+		r, _ := newReconciler(store)
+
+		report, err := r.reconcilers[0].reconcile(ctx, namespace)
+		require.NoError(t, err)
+		assert.Equal(t, snapshotID, report.SnapshotID)
+
+		require.NotEmpty(t, store.saved)
+		for _, p := range store.saved {
+			assert.Equal(t, snapshotID, p.SnapshotID)
+		}
+	})
+
+	t.Run("should attach snapshot id to dry-run result", func(t *testing.T) {
+		r, _ := newReconciler(nil)
+
+		result, err := r.DryRun(ctx, namespace)
+		require.NoError(t, err)
+		assert.Equal(t, snapshotID, result.SnapshotID)
+
+		data, err := json.Marshal(result)
+		require.NoError(t, err)
+		var decoded ReconcileResult
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, snapshotID, decoded.SnapshotID)
+	})
+
+	t.Run("should attach snapshot id to logs and metrics", func(t *testing.T) {
+		logger := &logtest.Fake{}
+		r, client := newReconciler(nil)
+		r.log = logger
+
+		r.migrateOrgs(ctx, []int64{1})
+		assert.Len(t, client.stored(namespace), 1)
+
+		assert.Equal(t, "Finished reconciliation", logger.DebugLogs.Message)
+		assert.Subset(t, logger.DebugLogs.Ctx, []any{"snapshotId", snapshotID})
+		assert.Equal(t, float64(1), testutil.ToFloat64(initMetrics().snapshotInfo.WithLabelValues(snapshotID)))
+	})
+
+	t.Run("should not log snapshot id when not set", func(t *testing.T) {
+		logger := &logtest.Fake{}
+		r, _ := newReconciler(nil)
+		r.log = logger
+
+		r.reconcileNamespace(context.Background(), namespace)
+		assert.NotContains(t, logger.DebugLogs.Ctx, "snapshotId")
+	})
+}
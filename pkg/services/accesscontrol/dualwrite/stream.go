@@ -0,0 +1,63 @@
+package dualwrite
+
+import (
+	"context"
+	"errors"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+// streamTuples reads all tuples matching req one page at a time and calls fn for every tuple,
+// so callers don't have to hold all tuples of large objects in memory. The context is checked
+// before every page and for every tuple so a read stops as soon as the deadline is exceeded.
+// Iteration stops at the first error returned by fn. Reads are served directly from the
+// store without any cache so they are always strongly consistent. Clients that can stream
+// reads are read with a single stream, falling back to pages when streaming is unavailable.
+func streamTuples(ctx context.Context, client zanzana.Client, req *authzextv1.ReadRequest, fn func(tuple *openfgav1.TupleKey) error) error {
+	if streamer, ok := client.(zanzana.StreamingReader); ok {
+		err := streamer.ReadStream(ctx, req, func(t *authzextv1.Tuple) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fn(common.ToOpenFGATupleKey(t.GetKey()))
+		})
+		if !errors.Is(err, zanzana.ErrStreamingUnavailable) {
+			return err
+		}
+	}
+
+	token := req.GetContinuationToken()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		res, err := client.Read(ctx, &authzextv1.ReadRequest{
+			Namespace:         req.GetNamespace(),
+			TupleKey:          req.GetTupleKey(),
+			PageSize:          req.GetPageSize(),
+			ContinuationToken: token,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, t := range res.GetTuples() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(common.ToOpenFGATupleKey(t.GetKey())); err != nil {
+				return err
+			}
+		}
+
+		token = res.GetContinuationToken()
+		if token == "" {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+func TestStreamTuples(t *testing.T) {
+	client := newFakeZanzanaClient()
+	client.pageSize = 3
+
+	seeded := make([]*openfgav1.TupleKey, 0, 10)
+	for i := 0; i < 10; i++ {
+		seeded = append(seeded, common.NewFolderTuple(fmt.Sprintf("user:%d", i), zanzana.RelationRead, "f1"))
+	}
+	client.seed("default", seeded...)
+
+	req := &authzextv1.ReadRequest{
+		Namespace: "default",
+		TupleKey:  &authzextv1.ReadRequestTupleKey{Object: "folder:f1"},
+	}
+
+	t.Run("should yield all tuples across pages", func(t *testing.T) {
+		var streamed []string
+		err := streamTuples(context.Background(), client, req, func(tuple *openfgav1.TupleKey) error {
+			streamed = append(streamed, tuple.String())
+			return nil
+		})
+		require.NoError(t, err)
+
+		expected := make([]string, 0, len(seeded))
+		for _, tuple := range seeded {
+			expected = append(expected, tuple.String())
+		}
+		assert.ElementsMatch(t, expected, streamed)
+	})
+
+	t.Run("should stop when context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var streamed int
+		err := streamTuples(ctx, client, req, func(tuple *openfgav1.TupleKey) error {
+			streamed++
+			if streamed == 4 {
+				cancel()
+			}
+			return nil
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 4, streamed)
+	})
+
+	t.Run("should not read when deadline is exceeded", func(t *testing.T) {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+		defer cancel()
+
+		err := streamTuples(ctx, client, req, func(tuple *openfgav1.TupleKey) error {
+			t.Fatal("no tuples should be yielded")
+			return nil
+		})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestZanzanaCollector(t *testing.T) {
+	client := newFakeZanzanaClient()
+	client.pageSize = 2
+	client.seed("default",
+		common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+		common.NewFolderTuple("user:2", zanzana.RelationRead, "f1"),
+		common.NewFolderTuple("user:3", zanzana.RelationRead, "f1"),
+		common.NewFolderTuple("user:1", zanzana.RelationWrite, "f1"),
+		common.NewFolderTuple("user:1", zanzana.RelationRead, "f2"),
+	)
+
+	tuples, err := zanzanaCollector(zanzana.FolderRelations)(context.Background(), client, "folder:f1", "default")
+	require.NoError(t, err)
+	// all pages should be collected for every relation
+	assert.Len(t, tuples, 4)
+}
+
+// streamingZanzanaClient is a fake client that streams reads unless streaming is unavailable.
+type streamingZanzanaClient struct {
+	*fakeZanzanaClient
+	unavailable bool
+	// streams and reads are the number of streamed and paged reads made
+	streams int
+	reads   int
+}
+
+func (c *streamingZanzanaClient) Read(ctx context.Context, req *authzextv1.ReadRequest) (*authzextv1.ReadResponse, error) {
+	c.reads++
+	return c.fakeZanzanaClient.Read(ctx, req)
+}
+
+func (c *streamingZanzanaClient) ReadStream(ctx context.Context, req *authzextv1.ReadRequest, fn func(tuple *authzextv1.Tuple) error) error {
+	c.streams++
+	if c.unavailable {
+		return zanzana.ErrStreamingUnavailable
+	}
+
+	var tuples []*authzextv1.Tuple
+	for token := ""; ; {
+		res, err := c.fakeZanzanaClient.Read(ctx, &authzextv1.ReadRequest{Namespace: req.GetNamespace(), TupleKey: req.GetTupleKey(), ContinuationToken: token})
+		if err != nil {
+			return err
+		}
+		tuples = append(tuples, res.GetTuples()...)
+		if token = res.GetContinuationToken(); token == "" {
+			break
+		}
+	}
+
+	return zanzana.ConsumeReadStream(func() (*authzextv1.Tuple, error) {
+		if len(tuples) == 0 {
+			return nil, io.EOF
+		}
+		tuple := tuples[0]
+		tuples = tuples[1:]
+		return tuple, nil
+	}, fn)
+}
+
+func TestZanzanaCollector_Streaming(t *testing.T) {
+	newClient := func(unavailable bool) *streamingZanzanaClient {
+		client := &streamingZanzanaClient{fakeZanzanaClient: newFakeZanzanaClient(), unavailable: unavailable}
+		client.pageSize = 2
+		client.seed("default",
+			common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("user:2", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("user:3", zanzana.RelationRead, "f1"),
+			common.NewFolderTuple("user:1", zanzana.RelationRead, "f2"),
+		)
+		return client
+	}
+
+	t.Run("should read with a single stream per relation", func(t *testing.T) {
+		client := newClient(false)
+		tuples, err := zanzanaCollector([]string{zanzana.RelationRead})(context.Background(), client, "folder:f1", "default")
+		require.NoError(t, err)
+		assert.Len(t, tuples, 3)
+		assert.Equal(t, 1, client.streams)
+		assert.Equal(t, 0, client.reads)
+	})
+
+	t.Run("should fall back to pages when streaming is unavailable", func(t *testing.T) {
+		client := newClient(true)
+		tuples, err := zanzanaCollector([]string{zanzana.RelationRead})(context.Background(), client, "folder:f1", "default")
+		require.NoError(t, err)
+		assert.Len(t, tuples, 3)
+		assert.Equal(t, 1, client.streams)
+		assert.Equal(t, 2, client.reads)
+	})
+
+	t.Run("should stop streaming when context is canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var streamed int
+		err := streamTuples(ctx, newClient(false), &authzextv1.ReadRequest{
+			Namespace: "default",
+			TupleKey:  &authzextv1.ReadRequestTupleKey{Object: "folder:f1"},
+		}, func(tuple *openfgav1.TupleKey) error {
+			streamed++
+			cancel()
+			return nil
+		})
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 1, streamed)
+	})
+}
@@ -0,0 +1,40 @@
+package dualwrite
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultOrphanSweepInterval is how often reconcilers read the whole namespace to find tuples of
+// objects that are gone from legacy.
+const defaultOrphanSweepInterval = time.Hour
+
+// sweepSchedule limits how often orphaned tuples are swept. Sweeping requires reading every tuple
+// in the namespace while tuples of deleted objects don't grant access to anything that exists, so
+// there is no need to sweep on every run.
+type sweepSchedule struct {
+	mu       sync.Mutex
+	interval time.Duration
+	// last is when the reconciler and namespace in the key were last swept
+	last map[string]time.Time
+}
+
+func newSweepSchedule(interval time.Duration) *sweepSchedule {
+	return &sweepSchedule{interval: interval, last: make(map[string]time.Time)}
+}
+
+// due returns true if key has never been swept or was last swept at least an interval before now.
+func (s *sweepSchedule) due(key string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last, ok := s.last[key]
+	return !ok || now.Sub(last) >= s.interval
+}
+
+// swept records that key was swept at now.
+func (s *sweepSchedule) swept(key string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last[key] = now
+}
@@ -0,0 +1,84 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestResourceReconciler_OrphanSweeps(t *testing.T) {
+	const namespace = "default"
+
+	legacy := common.NewResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "d1")
+	orphan := func(name string) *openfgav1.TupleKey {
+		return common.NewResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, name)
+	}
+
+	setup := func(interval time.Duration) (*fakeZanzanaClient, resourceReconciler, *clock.Mock) {
+		client := newFakeZanzanaClient()
+		client.seed(namespace, legacy, orphan("d2"))
+
+		cfg := newReconcileConfig()
+		r := newResourceReconciler("test", staticCollector(legacy), zanzanaCollector(zanzana.ResourceRelations), client).
+			withOrphans(orphanCollector(zanzana.KindDashboards, cfg, zanzana.ResourceRelations))
+		clk := clock.NewMock()
+		r.cfg.clock = clk
+		r.cfg.orphanSweeps = newSweepSchedule(interval)
+		return client, r, clk
+	}
+
+	t.Run("should sweep orphans at most once every interval", func(t *testing.T) {
+		client, r, clk := setup(time.Hour)
+
+		report, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Deletes)
+
+		client.seed(namespace, orphan("d3"))
+		clk.Add(30 * time.Minute)
+		report, err = r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 0, report.Deletes)
+		assert.Len(t, client.stored(namespace), 2)
+
+		clk.Add(30 * time.Minute)
+		report, err = r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Deletes)
+		assert.Len(t, client.stored(namespace), 1)
+	})
+
+	t.Run("should sweep orphans on every run without interval", func(t *testing.T) {
+		client, r, _ := setup(0)
+
+		_, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+
+		client.seed(namespace, orphan("d3"))
+		report, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+		assert.Equal(t, 1, report.Deletes)
+		assert.Len(t, client.stored(namespace), 1)
+	})
+
+	t.Run("should always sweep orphans in dry runs", func(t *testing.T) {
+		client, r, _ := setup(time.Hour)
+
+		_, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+
+		client.seed(namespace, orphan("d3"))
+		result, err := r.dryRun(context.Background(), namespace)
+		require.NoError(t, err)
+		require.Len(t, result.Deletions, 1)
+		assert.Equal(t, orphan("d3").Object, result.Deletions[0].GetObject())
+	})
+}
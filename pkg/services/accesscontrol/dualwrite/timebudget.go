@@ -0,0 +1,40 @@
+package dualwrite
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/benbjohnson/clock"
+)
+
+// errTimeBudgetExceeded is returned by reconcilers halted because the run took longer than its budget.
+var errTimeBudgetExceeded = errors.New("time budget exceeded")
+
+// timeBudget limits the wall-clock time of a reconciliation run. Reconcilers check it between
+// objects so a run halts gracefully instead of being cancelled in the middle of a write.
+type timeBudget struct {
+	clock    clock.Clock
+	deadline time.Time
+}
+
+func newTimeBudget(clk clock.Clock, budget time.Duration) *timeBudget {
+	return &timeBudget{clock: clk, deadline: clk.Now().Add(budget)}
+}
+
+// isExceeded returns true once the deadline has passed. It is safe to call on a nil budget.
+func (b *timeBudget) isExceeded() bool {
+	return b != nil && !b.clock.Now().Before(b.deadline)
+}
+
+type timeBudgetKey struct{}
+
+// withTimeBudget returns a context where all reconcilers halt once budget is exceeded.
+func withTimeBudget(ctx context.Context, budget *timeBudget) context.Context {
+	return context.WithValue(ctx, timeBudgetKey{}, budget)
+}
+
+func timeBudgetFromContext(ctx context.Context) *timeBudget {
+	budget, _ := ctx.Value(timeBudgetKey{}).(*timeBudget)
+	return budget
+}
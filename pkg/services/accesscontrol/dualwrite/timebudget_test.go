@@ -0,0 +1,106 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+// slowZanzanaClient delays every write by latency. If clock is set it is advanced by latency
+// instead of sleeping.
+type slowZanzanaClient struct {
+	*fakeZanzanaClient
+	latency time.Duration
+	clock   *clock.Mock
+}
+
+func (c *slowZanzanaClient) Write(ctx context.Context, req *authzextv1.WriteRequest) error {
+	if c.clock != nil {
+		c.clock.Add(c.latency)
+	} else {
+		time.Sleep(c.latency)
+	}
+	return c.fakeZanzanaClient.Write(ctx, req)
+}
+
+func TestTimeBudget(t *testing.T) {
+	var budget *timeBudget
+	assert.False(t, budget.isExceeded())
+
+	assert.False(t, newTimeBudget(clock.New(), time.Hour).isExceeded())
+	assert.True(t, newTimeBudget(clock.New(), 0).isExceeded())
+
+	t.Run("should be exceeded once the clock passes the deadline", func(t *testing.T) {
+		clk := clock.NewMock()
+		budget := newTimeBudget(clk, time.Minute)
+
+		clk.Add(time.Minute - time.Second)
+		assert.False(t, budget.isExceeded())
+		clk.Add(time.Second)
+		assert.True(t, budget.isExceeded())
+	})
+}
+
+func TestResourceReconciler_TimeBudget(t *testing.T) {
+	const (
+		namespace = "default"
+		objects   = 20
+		latency   = 10 * time.Millisecond
+		budget    = 50 * time.Millisecond
+	)
+
+	tuples := make([]*openfgav1.TupleKey, 0, objects)
+	for i := 0; i < objects; i++ {
+		tuples = append(tuples, common.NewFolderTuple("user:1", zanzana.RelationRead, fmt.Sprintf("f%02d", i)))
+	}
+
+	store := &recordingProgressStore{}
+	fake := newFakeZanzanaClient()
+	client := &slowZanzanaClient{fakeZanzanaClient: fake, latency: latency}
+	r := newResourceReconciler("test", staticCollector(tuples...), zanzanaCollector(zanzana.FolderRelations), client)
+	r.cfg.progressStore = store
+	r.cfg.progressInterval = objects
+
+	start := time.Now()
+	_, err := r.reconcile(withTimeBudget(context.Background(), newTimeBudget(clock.New(), budget)), namespace)
+	elapsed := time.Since(start)
+
+	require.ErrorIs(t, err, errTimeBudgetExceeded)
+	// the run halts before the next object once the budget is exceeded
+	assert.Less(t, elapsed, budget+5*latency)
+
+	written := len(fake.stored(namespace))
+	assert.Greater(t, written, 0)
+	assert.Less(t, written, objects)
+
+	require.NotEmpty(t, store.saved)
+	checkpoint := store.saved[len(store.saved)-1]
+	assert.Equal(t, written, checkpoint.Processed)
+	assert.Equal(t, objects, checkpoint.Total)
+	assert.Equal(t, fmt.Sprintf("folder:f%02d", written-1), checkpoint.Cursor)
+
+	t.Run("should resume after the checkpoint", func(t *testing.T) {
+		writes := len(fake.writes)
+
+		_, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+
+		// only objects after the checkpoint are reconciled
+		assert.Len(t, fake.writes, writes+objects-written)
+		assert.Len(t, fake.stored(namespace), objects)
+
+		last := store.saved[len(store.saved)-1]
+		assert.Equal(t, objects, last.Processed)
+		assert.Empty(t, last.Cursor)
+	})
+}
@@ -0,0 +1,171 @@
+package dualwrite
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/schema"
+)
+
+// SchemaViolation is a collected tuple that can't be written with the zanzana schema.
+type SchemaViolation struct {
+	Tuple *openfgav1.TupleKey
+	// Reason describes which part of the tuple is not allowed by the schema.
+	Reason string
+}
+
+// schemaValidator checks tuples against the type restrictions of an authorization model.
+type schemaValidator struct {
+	types      map[string]*openfgav1.TypeDefinition
+	conditions map[string]*openfgav1.Condition
+}
+
+func newSchemaValidator(model *openfgav1.AuthorizationModel) *schemaValidator {
+	types := make(map[string]*openfgav1.TypeDefinition, len(model.GetTypeDefinitions()))
+	for _, td := range model.GetTypeDefinitions() {
+		types[td.GetType()] = td
+	}
+	return &schemaValidator{types: types, conditions: model.GetConditions()}
+}
+
+// loadSchemaValidator creates a validator for the schema zanzana is running with.
+func loadSchemaValidator() (*schemaValidator, error) {
+	model, err := schema.TransformModulesToModel(schema.SchemaModules)
+	if err != nil {
+		return nil, err
+	}
+	return newSchemaValidator(model), nil
+}
+
+// validate returns a violation if the object type, the relation or the subject of tuple are not
+// defined by the schema. A subject is only allowed if the relation directly accepts its type
+// together with the condition of the tuple.
+func (v *schemaValidator) validate(t *openfgav1.TupleKey) *SchemaViolation {
+	objectType, _, _ := strings.Cut(t.GetObject(), ":")
+	td, ok := v.types[objectType]
+	if !ok {
+		return &SchemaViolation{Tuple: t, Reason: fmt.Sprintf("type %q is not defined", objectType)}
+	}
+
+	if _, ok := td.GetRelations()[t.GetRelation()]; !ok {
+		return &SchemaViolation{Tuple: t, Reason: fmt.Sprintf("relation %q is not defined for type %q", t.GetRelation(), objectType)}
+	}
+
+	subjectType, subjectID, _ := strings.Cut(t.GetUser(), ":")
+	_, subjectRelation, _ := strings.Cut(subjectID, "#")
+	condition := t.GetCondition().GetName()
+
+	refs := td.GetMetadata().GetRelations()[t.GetRelation()].GetDirectlyRelatedUserTypes()
+	for _, ref := range refs {
+		if ref.GetType() != subjectType || ref.GetCondition() != condition {
+			continue
+		}
+		if subjectID == "*" && ref.GetWildcard() != nil {
+			return v.validateCondition(t)
+		}
+		if subjectID != "*" && ref.GetWildcard() == nil && ref.GetRelation() == subjectRelation {
+			return v.validateCondition(t)
+		}
+	}
+
+	subject := subjectType
+	if subjectRelation != "" {
+		subject += "#" + subjectRelation
+	}
+	if condition != "" {
+		subject += " with " + condition
+	}
+
+	return &SchemaViolation{Tuple: t, Reason: fmt.Sprintf("subject %q is not allowed for relation %q of type %q", subject, t.GetRelation(), objectType)}
+}
+
+// validateCondition returns a violation if the condition context of t has a parameter that is
+// not defined by the condition or has a value of another type. Parameters that are not set are
+// provided when checking access and are not required.
+func (v *schemaValidator) validateCondition(t *openfgav1.TupleKey) *SchemaViolation {
+	c := t.GetCondition()
+	if c == nil {
+		return nil
+	}
+
+	params := v.conditions[c.GetName()].GetParameters()
+	for name, value := range c.GetContext().GetFields() {
+		param, ok := params[name]
+		if !ok {
+			return &SchemaViolation{Tuple: t, Reason: fmt.Sprintf("parameter %q is not defined for condition %q", name, c.GetName())}
+		}
+		if !matchesParamType(value, param) {
+			return &SchemaViolation{Tuple: t, Reason: fmt.Sprintf("parameter %q of condition %q is not of type %s", name, c.GetName(), formatParamType(param))}
+		}
+	}
+	return nil
+}
+
+// matchesParamType returns true if value can be used for a condition parameter of type param.
+func matchesParamType(value *structpb.Value, param *openfgav1.ConditionParamTypeRef) bool {
+	switch param.GetTypeName() {
+	case openfgav1.ConditionParamTypeRef_TYPE_NAME_ANY:
+		return true
+	case openfgav1.ConditionParamTypeRef_TYPE_NAME_BOOL:
+		_, ok := value.GetKind().(*structpb.Value_BoolValue)
+		return ok
+	case openfgav1.ConditionParamTypeRef_TYPE_NAME_STRING:
+		_, ok := value.GetKind().(*structpb.Value_StringValue)
+		return ok
+	case openfgav1.ConditionParamTypeRef_TYPE_NAME_INT, openfgav1.ConditionParamTypeRef_TYPE_NAME_UINT, openfgav1.ConditionParamTypeRef_TYPE_NAME_DOUBLE:
+		_, ok := value.GetKind().(*structpb.Value_NumberValue)
+		return ok
+	case openfgav1.ConditionParamTypeRef_TYPE_NAME_DURATION:
+		_, err := time.ParseDuration(value.GetStringValue())
+		return err == nil
+	case openfgav1.ConditionParamTypeRef_TYPE_NAME_TIMESTAMP:
+		_, err := time.Parse(time.RFC3339, value.GetStringValue())
+		return err == nil
+	case openfgav1.ConditionParamTypeRef_TYPE_NAME_IPADDRESS:
+		return net.ParseIP(value.GetStringValue()) != nil
+	case openfgav1.ConditionParamTypeRef_TYPE_NAME_MAP:
+		s, ok := value.GetKind().(*structpb.Value_StructValue)
+		if !ok {
+			return false
+		}
+		if len(param.GetGenericTypes()) == 0 {
+			return true
+		}
+		for _, v := range s.StructValue.GetFields() {
+			if !matchesParamType(v, param.GetGenericTypes()[0]) {
+				return false
+			}
+		}
+		return true
+	case openfgav1.ConditionParamTypeRef_TYPE_NAME_LIST:
+		l, ok := value.GetKind().(*structpb.Value_ListValue)
+		if !ok {
+			return false
+		}
+		if len(param.GetGenericTypes()) == 0 {
+			return true
+		}
+		for _, v := range l.ListValue.GetValues() {
+			if !matchesParamType(v, param.GetGenericTypes()[0]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// formatParamType formats param like the schema, e.g. list<string>.
+func formatParamType(param *openfgav1.ConditionParamTypeRef) string {
+	name := strings.ToLower(strings.TrimPrefix(param.GetTypeName().String(), "TYPE_NAME_"))
+	if len(param.GetGenericTypes()) == 0 {
+		return name
+	}
+	return name + "<" + formatParamType(param.GetGenericTypes()[0]) + ">"
+}
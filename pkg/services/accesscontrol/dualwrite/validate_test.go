@@ -0,0 +1,120 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestSchemaValidator(t *testing.T) {
+	validator, err := loadSchemaValidator()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		tuple *openfgav1.TupleKey
+		valid bool
+	}{
+		{
+			name:  "folder tuple",
+			tuple: common.NewFolderTuple("team:t1#member", zanzana.RelationRead, "f1"),
+			valid: true,
+		},
+		{
+			name:  "folder resource tuple",
+			tuple: common.NewFolderResourceTuple("user:u1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"),
+			valid: true,
+		},
+		{
+			name:  "service account team member",
+			tuple: common.NewTypedTuple(zanzana.TypeTeam, "service_account:sa1", zanzana.RelationTeamMember, "t1"),
+			valid: true,
+		},
+		{
+			name:  "unknown type",
+			tuple: &openfgav1.TupleKey{User: "user:u1", Relation: zanzana.RelationRead, Object: "unknown:o1"},
+		},
+		{
+			name:  "unknown relation",
+			tuple: common.NewFolderTuple("user:u1", "unknown", "f1"),
+		},
+		{
+			name:  "subject type not allowed",
+			tuple: common.NewTypedTuple(zanzana.TypeTeam, "service_account:sa1", zanzana.RelationTeamAdmin, "t1"),
+		},
+		{
+			name:  "subject relation not allowed",
+			tuple: common.NewFolderTuple("team:t1", zanzana.RelationRead, "f1"),
+		},
+		{
+			name:  "wrong condition parameter type",
+			tuple: withConditionContext(common.NewFolderResourceTuple("user:u1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"), "group_resources", structpb.NewStringValue("dashboard.grafana.app/dashboards")),
+		},
+		{
+			name:  "wrong condition parameter element type",
+			tuple: withConditionContext(common.NewFolderResourceTuple("user:u1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"), "group_resources", structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{structpb.NewNumberValue(1)}})),
+		},
+		{
+			name:  "unknown condition parameter",
+			tuple: withConditionContext(common.NewFolderResourceTuple("user:u1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"), "unknown", structpb.NewStringValue("x")),
+		},
+		{
+			name:  "missing condition",
+			tuple: &openfgav1.TupleKey{User: "user:u1", Relation: zanzana.RelationRead, Object: common.NewResourceIdent(dashboardGroup, dashboardResource, "d1")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violation := validator.validate(tt.tuple)
+			if tt.valid {
+				assert.Nil(t, violation)
+				return
+			}
+			require.NotNil(t, violation)
+			assert.Equal(t, tt.tuple, violation.Tuple)
+			assert.NotEmpty(t, violation.Reason)
+		})
+	}
+}
+
+// withConditionContext sets the condition parameter name of t to value.
+func withConditionContext(t *openfgav1.TupleKey, name string, value *structpb.Value) *openfgav1.TupleKey {
+	t.Condition.Context.Fields[name] = value
+	return t
+}
+
+func TestResourceReconciler_ValidatedDryRun(t *testing.T) {
+	const namespace = "default"
+
+	validator, err := loadSchemaValidator()
+	require.NoError(t, err)
+
+	client := newFakeZanzanaClient()
+	stale := common.NewFolderTuple("user:2", zanzana.RelationRead, "f1")
+	client.seed(namespace, stale)
+
+	valid := common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")
+	invalid := common.NewFolderTuple("user:1", "unknown", "f1")
+	r := newResourceReconciler("test", staticCollector(valid, invalid), zanzanaCollector(zanzana.FolderRelations), client)
+
+	result, err := r.validatedDryRun(context.Background(), namespace, validator)
+	require.NoError(t, err)
+
+	require.Len(t, result.Additions, 2)
+	require.Len(t, result.Deletions, 1)
+	assert.Equal(t, stale.GetUser(), result.Deletions[0].GetUser())
+
+	require.Len(t, result.Violations, 1)
+	assert.Equal(t, invalid.String(), result.Violations[0].Tuple.String())
+
+	// nothing should be applied
+	assert.Empty(t, client.writes)
+}
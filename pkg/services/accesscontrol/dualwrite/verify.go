@@ -0,0 +1,167 @@
+package dualwrite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/grafana/authlib/claims"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+// errTupleChecksUnavailable is returned by verifications that need to check relations on objects
+// that are not exposed as resources when no TupleChecker is available.
+var errTupleChecksUnavailable = errors.New("tuple checks are unavailable, configure a tuple checker")
+
+// VerifyTeamAdminMembership verifies that every team admin in legacy access control also
+// resolves as a team member in zanzana. Admin implies member in our schema so any returned
+// tuple points to either a schema or a tuple issue. Only a sample of the admins is checked
+// when configured with WithCheckSampling. Teams are not exposed as resources so the checks
+// requires a TupleChecker, see WithTupleChecker.
+func (r *ZanzanaReconciler) VerifyTeamAdminMembership(ctx context.Context, namespace string) ([]*openfgav1.TupleKey, error) {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.VerifyTeamAdminMembership")
+	defer span.End()
+
+	checker := r.tupleChecker
+	if checker == nil {
+		var ok bool
+		if checker, ok = r.client.(zanzana.TupleChecker); !ok {
+			return nil, errTupleChecksUnavailable
+		}
+	}
+
+	info, err := claims.ParseNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	tuples, err := teamMembershipCollector(r.store, r.cfg)(ctx, info.OrgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect team memberships: %w", err)
+	}
+
+	return verifyTeamAdminMembership(ctx, checker, namespace, tuples, r.cfg.checkSampling.forRun(r.cfg.clock.Now()))
+}
+
+// verifyTeamAdminMembership checks that the subject of every sampled team admin tuple is a member
+// of the team and returns the admin tuples where it is not.
+func verifyTeamAdminMembership(ctx context.Context, checker zanzana.TupleChecker, namespace string, tuples map[string]map[string]*openfgav1.TupleKey, sampling checkSampling) ([]*openfgav1.TupleKey, error) {
+	var admins []*openfgav1.TupleKey
+	for _, objectTuples := range tuples {
+		for _, t := range objectTuples {
+			if t.Relation == zanzana.RelationTeamAdmin {
+				admins = append(admins, t)
+			}
+		}
+	}
+
+	var failed []*openfgav1.TupleKey
+	for _, t := range sampling.sample(admins) {
+		allowed, err := checker.CheckTuple(ctx, namespace, &openfgav1.CheckRequestTupleKey{
+			User:     t.User,
+			Relation: zanzana.RelationTeamMember,
+			Object:   t.Object,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if !allowed {
+			failed = append(failed, t)
+		}
+	}
+
+	return failed, nil
+}
+
+// InvalidGroupResource is a group resource in the condition of a folder resource tuple that is
+// not known by the current schema.
+type InvalidGroupResource struct {
+	Tuple         *openfgav1.TupleKey
+	GroupResource string
+}
+
+// VerifyFolderResourceGroups reads every folder resource tuple in namespace and reports group
+// resources in their conditions that permissions can't be translated into, e.g. a typo or a
+// group that is no longer supported.
+func (r *ZanzanaReconciler) VerifyFolderResourceGroups(ctx context.Context, namespace string) ([]InvalidGroupResource, error) {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.VerifyFolderResourceGroups")
+	defer span.End()
+
+	return verifyFolderResourceGroups(ctx, r.client, namespace, zanzana.FolderResourceGroups(zanzana.TranslationLatest))
+}
+
+func verifyFolderResourceGroups(ctx context.Context, client zanzana.Client, namespace string, known []string) ([]InvalidGroupResource, error) {
+	var invalid []InvalidGroupResource
+	err := streamTuples(ctx, client, &authzextv1.ReadRequest{Namespace: namespace}, func(t *openfgav1.TupleKey) error {
+		if !zanzana.IsFolderResourceTuple(t) {
+			return nil
+		}
+
+		for _, gr := range zanzana.FolderResourceTupleGroups(t) {
+			if !slices.Contains(known, gr) {
+				invalid = append(invalid, InvalidGroupResource{Tuple: t, GroupResource: gr})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return invalid, nil
+}
+
+// VerifyKnownRelations reads every tuple in namespace and reports tuples with a relation that is
+// not known by the current version, e.g. written by a newer or older version. Such tuples are
+// never deleted by stale deletion.
+func (r *ZanzanaReconciler) VerifyKnownRelations(ctx context.Context, namespace string) ([]*openfgav1.TupleKey, error) {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.VerifyKnownRelations")
+	defer span.End()
+
+	return verifyKnownRelations(ctx, r.client, namespace)
+}
+
+func verifyKnownRelations(ctx context.Context, client zanzana.Client, namespace string) ([]*openfgav1.TupleKey, error) {
+	var unknown []*openfgav1.TupleKey
+	err := streamTuples(ctx, client, &authzextv1.ReadRequest{Namespace: namespace}, func(t *openfgav1.TupleKey) error {
+		if !zanzana.IsKnownRelation(t.Relation) {
+			unknown = append(unknown, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return unknown, nil
+}
+
+// VerifyConditionParameters reads every tuple with a condition in namespace and reports the
+// ones with condition parameters that are not defined by the schema or have the wrong type.
+func (r *ZanzanaReconciler) VerifyConditionParameters(ctx context.Context, namespace string) ([]SchemaViolation, error) {
+	ctx, span := tracer.Start(ctx, "accesscontrol.migrator.VerifyConditionParameters")
+	defer span.End()
+
+	validator, err := loadSchemaValidator()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema: %w", err)
+	}
+	return verifyConditionParameters(ctx, r.client, namespace, validator)
+}
+
+func verifyConditionParameters(ctx context.Context, client zanzana.Client, namespace string, validator *schemaValidator) ([]SchemaViolation, error) {
+	var violations []SchemaViolation
+	err := streamTuples(ctx, client, &authzextv1.ReadRequest{Namespace: namespace}, func(t *openfgav1.TupleKey) error {
+		if v := validator.validateCondition(t); v != nil {
+			violations = append(violations, *v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return violations, nil
+}
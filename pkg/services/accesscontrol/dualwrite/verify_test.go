@@ -0,0 +1,186 @@
+package dualwrite
+
+import (
+	"context"
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/grafana/grafana/pkg/infra/db"
+	"github.com/grafana/grafana/pkg/infra/log"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/server"
+	zstore "github.com/grafana/grafana/pkg/services/authz/zanzana/store"
+	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
+)
+
+func TestIntegrationVerifyTeamAdminMembership(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test")
+	}
+
+	const namespace = "default"
+
+	newAdmin := func(user string) *openfgav1.TupleKey {
+		return &openfgav1.TupleKey{
+			User:     zanzana.NewTupleEntry(zanzana.TypeUser, user, ""),
+			Relation: zanzana.RelationTeamAdmin,
+			Object:   zanzana.NewTupleEntry(zanzana.TypeTeam, "t1", ""),
+		}
+	}
+
+	srv := newEmbeddedZanzanaServer(t)
+	admin := newAdmin("u1")
+	_, err := srv.Write(context.Background(), &authzextv1.WriteRequest{
+		Namespace: namespace,
+		Writes:    &authzextv1.WriteRequestWrites{TupleKeys: common.ToAuthzExtTupleKeys([]*openfgav1.TupleKey{admin})},
+	})
+	require.NoError(t, err)
+
+	t.Run("should pass when admin resolves as member", func(t *testing.T) {
+		legacy := map[string]map[string]*openfgav1.TupleKey{}
+		putTuple(legacy, admin)
+
+		failed, err := verifyTeamAdminMembership(context.Background(), srv, namespace, legacy, checkSampling{})
+		require.NoError(t, err)
+		assert.Empty(t, failed)
+	})
+
+	t.Run("should report admin tuple that is missing in zanzana", func(t *testing.T) {
+		missing := newAdmin("u2")
+		legacy := map[string]map[string]*openfgav1.TupleKey{}
+		putTuple(legacy, admin)
+		putTuple(legacy, missing)
+
+		failed, err := verifyTeamAdminMembership(context.Background(), srv, namespace, legacy, checkSampling{})
+		require.NoError(t, err)
+		require.Len(t, failed, 1)
+		assert.Equal(t, missing.String(), failed[0].String())
+	})
+}
+
+func TestZanzanaReconciler_VerifyTeamAdminMembership(t *testing.T) {
+	t.Run("should fail without a tuple checker", func(t *testing.T) {
+		r := NewZanzanaReconciler(newFakeZanzanaClient(), nil, nil)
+		_, err := r.VerifyTeamAdminMembership(context.Background(), "default")
+		assert.ErrorIs(t, err, errTupleChecksUnavailable)
+	})
+}
+
+// newEmbeddedZanzanaServer starts a zanzana server backed by an embedded OpenFGA server that
+// loads the real schema.
+func newEmbeddedZanzanaServer(t *testing.T) *server.Server {
+	t.Helper()
+
+	testDB, cfg := db.InitTestDBWithCfg(t)
+	// Hack to skip these tests on mysql 5.7
+	if testDB.GetDialect().DriverName() == migrator.MySQL {
+		if supported, err := testDB.RecursiveQueriesAreSupported(); !supported || err != nil {
+			t.Skip("skipping integration test")
+		}
+	}
+
+	store, err := zstore.NewEmbeddedStore(cfg, testDB, log.NewNopLogger())
+	require.NoError(t, err)
+	openfga, err := server.NewOpenFGA(&cfg.Zanzana, store, log.NewNopLogger())
+	require.NoError(t, err)
+	srv, err := server.NewAuthz(openfga)
+	require.NoError(t, err)
+	return srv
+}
+
+// tupleCheckerFunc adapts a function to a zanzana.TupleChecker.
+type tupleCheckerFunc func(namespace string, tuple *openfgav1.CheckRequestTupleKey) (bool, error)
+
+func (f tupleCheckerFunc) CheckTuple(_ context.Context, namespace string, tuple *openfgav1.CheckRequestTupleKey) (bool, error) {
+	return f(namespace, tuple)
+}
+
+func TestVerifyFolderResourceGroups(t *testing.T) {
+	const namespace = "default"
+
+	known := zanzana.FolderResourceGroups(zanzana.TranslationLatest)
+	require.Contains(t, known, "dashboard.grafana.app/dashboards")
+
+	t.Run("should not report known group resources", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		tuple := common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")
+		zanzana.MergeFolderResourceTuples(tuple, common.NewFolderResourceTuple("user:1", zanzana.RelationRead, "rules.alerting.grafana.app", "alertrules", "f1"))
+		client.seed(namespace, tuple, common.NewFolderTuple("user:1", zanzana.RelationRead, "f1"))
+
+		invalid, err := verifyFolderResourceGroups(context.Background(), client, namespace, known)
+		require.NoError(t, err)
+		assert.Empty(t, invalid)
+	})
+
+	t.Run("should report invalid group resource in merged condition", func(t *testing.T) {
+		client := newFakeZanzanaClient()
+		tuple := common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")
+		zanzana.MergeFolderResourceTuples(tuple, common.NewFolderResourceTuple("user:1", zanzana.RelationRead, "dashbaord.grafana.app", "dashboards", "f1"))
+		client.seed(namespace, tuple)
+
+		invalid, err := verifyFolderResourceGroups(context.Background(), client, namespace, known)
+		require.NoError(t, err)
+		require.Len(t, invalid, 1)
+		assert.Equal(t, "dashbaord.grafana.app/dashboards", invalid[0].GroupResource)
+		assert.Equal(t, "folder:f1", invalid[0].Tuple.Object)
+	})
+}
+
+func TestVerifyKnownRelations(t *testing.T) {
+	const namespace = "default"
+
+	known := common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")
+	unknown := &openfgav1.TupleKey{User: "user:1", Relation: "annotate", Object: "folder:f1"}
+
+	client := newFakeZanzanaClient()
+	client.seed(namespace, known, unknown)
+
+	t.Run("should report tuples with unknown relations", func(t *testing.T) {
+		reported, err := verifyKnownRelations(context.Background(), client, namespace)
+		require.NoError(t, err)
+		require.Len(t, reported, 1)
+		assert.Equal(t, unknown.String(), reported[0].String())
+	})
+
+	t.Run("should not delete tuples with unknown relations", func(t *testing.T) {
+		// a collector reading a relation that is written by a different version
+		r := newResourceReconciler("test", staticCollector(known), zanzanaCollector([]string{zanzana.RelationRead, "annotate"}), client)
+		r.orphans = func(ctx context.Context, client zanzana.Client, namespace string, legacy map[string]map[string]*openfgav1.TupleKey) ([]*openfgav1.TupleKey, error) {
+			return []*openfgav1.TupleKey{unknown}, nil
+		}
+		_, err := r.reconcile(context.Background(), namespace)
+		require.NoError(t, err)
+
+		stored := client.stored(namespace)
+		require.Len(t, stored, 2)
+		assert.ElementsMatch(t, []string{known.String(), unknown.String()}, []string{stored[0].String(), stored[1].String()})
+	})
+}
+
+func TestVerifyConditionParameters(t *testing.T) {
+	const namespace = "default"
+
+	validator, err := loadSchemaValidator()
+	require.NoError(t, err)
+
+	valid := common.NewFolderResourceTuple("user:1", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1")
+	malformed := withConditionContext(
+		common.NewFolderResourceTuple("user:2", zanzana.RelationRead, dashboardGroup, dashboardResource, "f1"),
+		"group_resources", structpb.NewStringValue("dashboard.grafana.app/dashboards"),
+	)
+
+	client := newFakeZanzanaClient()
+	client.seed(namespace, valid, malformed)
+
+	violations, err := verifyConditionParameters(context.Background(), client, namespace, validator)
+	require.NoError(t, err)
+	require.Len(t, violations, 1)
+	assert.Equal(t, malformed.String(), violations[0].Tuple.String())
+	assert.Contains(t, violations[0].Reason, "list<string>")
+}
@@ -0,0 +1,74 @@
+package dualwrite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/grafana/grafana/pkg/util/retryer"
+)
+
+// reportWebhook posts reconcile reports as JSON to an external endpoint for alerting and
+// automation. Failed requests are retried, a report that can't be delivered is dropped.
+type reportWebhook struct {
+	url    string
+	client *http.Client
+	// attempts is the maximum number of requests made for a single report.
+	attempts int
+}
+
+func newReportWebhook(url string, timeout time.Duration, retries int) *reportWebhook {
+	return &reportWebhook{
+		url:      url,
+		client:   &http.Client{Timeout: timeout},
+		attempts: retries + 1,
+	}
+}
+
+// send posts report to the webhook, retrying failed requests and non-2xx responses.
+func (w *reportWebhook) send(ctx context.Context, report *ReconcileReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode reconcile report: %w", err)
+	}
+
+	var lastErr error
+	err = retryer.Retry(func() (retryer.RetrySignal, error) {
+		if err := ctx.Err(); err != nil {
+			return retryer.FuncError, err
+		}
+
+		lastErr = w.post(ctx, body)
+		if lastErr == nil {
+			return retryer.FuncComplete, nil
+		}
+		return retryer.FuncFailure, nil
+	}, w.attempts, retryMinDelay, retryMaxDelay)
+
+	if err != nil && lastErr != nil && ctx.Err() == nil {
+		return fmt.Errorf("%w: %w", err, lastErr)
+	}
+	return err
+}
+
+func (w *reportWebhook) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package dualwrite
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/grafana/authlib/claims"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestReportWebhook(t *testing.T) {
+	namespace := claims.OrgNamespaceFormatter(1)
+	tuple := common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")
+
+	newReconciler := func(url string, retries int) (*ZanzanaReconciler, *fakeZanzanaClient) {
+		client := newFakeZanzanaClient()
+		r := NewZanzanaReconciler(client, nil, nil, WithReportWebhook(url, time.Second, retries))
+		rr := newResourceReconciler("test", staticCollector(tuple), zanzanaCollector(zanzana.FolderRelations), client)
+		rr.cfg = r.cfg
+		r.reconcilers = []resourceReconciler{rr}
+		return r, client
+	}
+
+	t.Run("should post report after reconciliation and retry failures", func(t *testing.T) {
+		var requests atomic.Int32
+		reports := make(chan ReconcileReport, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if requests.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+
+			var report ReconcileReport
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&report))
+			reports <- report
+		}))
+		defer server.Close()
+
+		r, _ := newReconciler(server.URL, 1)
+		r.reconcileNamespace(context.Background(), namespace)
+
+		require.Len(t, reports, 1)
+		report := <-reports
+		assert.Equal(t, "test", report.Name)
+		assert.Equal(t, namespace, report.Namespace)
+		assert.Equal(t, 1, report.Writes)
+		assert.Equal(t, int32(2), requests.Load())
+	})
+
+	t.Run("should not fail reconciliation when webhook is unavailable", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		r, client := newReconciler(server.URL, 2)
+		r.reconcileNamespace(context.Background(), namespace)
+		assert.Len(t, client.stored(namespace), 1)
+	})
+}
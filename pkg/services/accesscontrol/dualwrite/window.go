@@ -0,0 +1,37 @@
+package dualwrite
+
+import (
+	"context"
+
+	"golang.org/x/sync/semaphore"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+// windowClient bounds the number of reads and writes in flight to zanzana. The window is shared
+// by all reconcilers so the limit holds no matter how many orgs or phases run at the same time.
+type windowClient struct {
+	zanzana.Client
+	window *semaphore.Weighted
+}
+
+func newWindowClient(client zanzana.Client, window *semaphore.Weighted) *windowClient {
+	return &windowClient{Client: client, window: window}
+}
+
+func (c *windowClient) Read(ctx context.Context, req *authzextv1.ReadRequest) (*authzextv1.ReadResponse, error) {
+	if err := c.window.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	defer c.window.Release(1)
+	return c.Client.Read(ctx, req)
+}
+
+func (c *windowClient) Write(ctx context.Context, req *authzextv1.WriteRequest) error {
+	if err := c.window.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	defer c.window.Release(1)
+	return c.Client.Write(ctx, req)
+}
@@ -0,0 +1,80 @@
+package dualwrite
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana"
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+// concurrencyClient records the maximum number of reads and writes in flight.
+type concurrencyClient struct {
+	*fakeZanzanaClient
+	inFlight atomic.Int64
+	max      atomic.Int64
+}
+
+func (c *concurrencyClient) track() func() {
+	n := c.inFlight.Add(1)
+	for {
+		m := c.max.Load()
+		if n <= m || c.max.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond)
+	return func() { c.inFlight.Add(-1) }
+}
+
+func (c *concurrencyClient) Read(ctx context.Context, req *authzextv1.ReadRequest) (*authzextv1.ReadResponse, error) {
+	defer c.track()()
+	return c.fakeZanzanaClient.Read(ctx, req)
+}
+
+func (c *concurrencyClient) Write(ctx context.Context, req *authzextv1.WriteRequest) error {
+	defer c.track()()
+	return c.fakeZanzanaClient.Write(ctx, req)
+}
+
+func TestWindowClient(t *testing.T) {
+	const (
+		window  = 3
+		workers = 20
+	)
+
+	client := &concurrencyClient{fakeZanzanaClient: newFakeZanzanaClient()}
+	windowed := newWindowClient(client, semaphore.NewWeighted(window))
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			namespace := fmt.Sprintf("org-%d", i)
+			tuple := common.NewFolderTuple("user:1", zanzana.RelationRead, "f1")
+			for j := 0; j < 5; j++ {
+				err := windowed.Write(context.Background(), &authzextv1.WriteRequest{
+					Namespace: namespace,
+					Writes:    &authzextv1.WriteRequestWrites{TupleKeys: common.ToAuthzExtTupleKeys([]*openfgav1.TupleKey{tuple})},
+				})
+				assert.NoError(t, err)
+				_, err = windowed.Read(context.Background(), &authzextv1.ReadRequest{Namespace: namespace})
+				assert.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.LessOrEqual(t, client.max.Load(), int64(window))
+	assert.Positive(t, client.max.Load())
+}
@@ -2,9 +2,14 @@ package zanzana
 
 import (
 	"context"
+	"errors"
+	"io"
 
 	"github.com/grafana/authlib/authz"
 	"github.com/grafana/authlib/claims"
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	"github.com/grafana/grafana/pkg/services/authz/zanzana/client"
 	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
@@ -18,6 +23,45 @@ type Client interface {
 	Write(ctx context.Context, req *authzextv1.WriteRequest) error
 }
 
+// ErrStreamingUnavailable is returned by ReadStream when the server doesn't support streaming
+// reads, callers should fall back to reading one page at a time.
+var ErrStreamingUnavailable = errors.New("streaming reads are unavailable")
+
+// StreamingReader is implemented by clients that can stream all tuples matching a read request
+// instead of returning them one page at a time. ErrStreamingUnavailable is returned before any
+// tuple is passed to fn.
+type StreamingReader interface {
+	ReadStream(ctx context.Context, req *authzextv1.ReadRequest, fn func(tuple *authzextv1.Tuple) error) error
+}
+
+// TupleChecker is implemented by clients that can check a relation between a subject and any
+// object in the schema, including objects that are not exposed as resources through Check.
+type TupleChecker interface {
+	CheckTuple(ctx context.Context, namespace string, tuple *openfgav1.CheckRequestTupleKey) (bool, error)
+}
+
+// ConsumeReadStream passes every tuple received with recv to fn until the stream ends. recv is
+// usually the Recv method of a gRPC stream, streams rejected as unimplemented by the server
+// return ErrStreamingUnavailable.
+func ConsumeReadStream(recv func() (*authzextv1.Tuple, error), fn func(tuple *authzextv1.Tuple) error) error {
+	for received := false; ; received = true {
+		tuple, err := recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			if !received && status.Code(err) == codes.Unimplemented {
+				return ErrStreamingUnavailable
+			}
+			return err
+		}
+
+		if err := fn(tuple); err != nil {
+			return err
+		}
+	}
+}
+
 func NewNoopClient() *client.NoopClient {
 	return client.NewNoop()
 }
@@ -0,0 +1,63 @@
+package zanzana
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
+)
+
+func TestConsumeReadStream(t *testing.T) {
+	// stream returns recv yielding tuples followed by err
+	stream := func(err error, tuples ...*authzextv1.Tuple) func() (*authzextv1.Tuple, error) {
+		return func() (*authzextv1.Tuple, error) {
+			if len(tuples) == 0 {
+				return nil, err
+			}
+			tuple := tuples[0]
+			tuples = tuples[1:]
+			return tuple, nil
+		}
+	}
+
+	tuple := &authzextv1.Tuple{Key: &authzextv1.TupleKey{User: "user:1", Relation: RelationRead, Object: "folder:f1"}}
+
+	t.Run("should consume every tuple until the stream ends", func(t *testing.T) {
+		var consumed int
+		err := ConsumeReadStream(stream(io.EOF, tuple, tuple), func(*authzextv1.Tuple) error {
+			consumed++
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, consumed)
+	})
+
+	t.Run("should report streaming as unavailable when unimplemented", func(t *testing.T) {
+		err := ConsumeReadStream(stream(status.Error(codes.Unimplemented, "unknown method")), func(*authzextv1.Tuple) error {
+			return nil
+		})
+		assert.ErrorIs(t, err, ErrStreamingUnavailable)
+	})
+
+	t.Run("should not fall back after tuples were consumed", func(t *testing.T) {
+		err := ConsumeReadStream(stream(status.Error(codes.Unimplemented, "unknown method"), tuple), func(*authzextv1.Tuple) error {
+			return nil
+		})
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+		assert.NotErrorIs(t, err, ErrStreamingUnavailable)
+	})
+
+	t.Run("should stop at the first error of fn", func(t *testing.T) {
+		failed := errors.New("failed")
+		err := ConsumeReadStream(stream(io.EOF, tuple, tuple), func(*authzextv1.Tuple) error {
+			return failed
+		})
+		assert.ErrorIs(t, err, failed)
+	})
+}
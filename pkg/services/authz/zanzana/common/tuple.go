@@ -16,8 +16,26 @@ const (
 	TypeFolder    string = "folder"
 	TypeResource  string = "resource"
 	TypeNamespace string = "namespace"
+
+	TypeServiceAccount  string = "service_account"
+	TypeGroup           string = "group"
+	TypeOrg             string = "org"
+	TypePublicDashboard string = "public_dashboard"
 )
 
+// GeneralFolderUID is the uid of the reserved General folder. It is the root of the folder tree,
+// resources without a folder are stored in it and inherit its grants.
+const GeneralFolderUID = "general"
+
+// ResourceFolder returns the folder a resource in folder is stored in, resources without a
+// folder are stored in the General folder.
+func ResourceFolder(folder string) string {
+	if folder == "" {
+		return GeneralFolderUID
+	}
+	return folder
+}
+
 const (
 	RelationTeamMember string = "member"
 	RelationTeamAdmin  string = "admin"
@@ -35,6 +53,11 @@ const (
 	RelationPermissionsRead  string = "permissions_read"
 	RelationPermissionsWrite string = "permissions_write"
 
+	RelationPublicRead string = "public_" + RelationRead
+
+	RelationSubresourceRead  string = "subresource_" + RelationRead
+	RelationSubresourceWrite string = "subresource_" + RelationWrite
+
 	RelationFolderResourceSetView  string = "resource_" + RelationSetView
 	RelationFolderResourceSetEdit  string = "resource_" + RelationSetEdit
 	RelationFolderResourceSetAdmin string = "resource_" + RelationSetAdmin
@@ -87,6 +110,27 @@ func NewResourceTuple(subject, relation, group, resource, name string) *openfgav
 	}
 }
 
+// NewSubresourceTuple creates a tuple granting access to subresource of a resource, e.g. a panel
+// within a dashboard. Subresources are stored as a condition so multiple grants for the same
+// subject can be merged into one tuple.
+func NewSubresourceTuple(subject, relation, group, resource, name, subresource string) *openfgav1.TupleKey {
+	return &openfgav1.TupleKey{
+		User:     subject,
+		Relation: relation,
+		Object:   NewResourceIdent(group, resource, name),
+		Condition: &openfgav1.RelationshipCondition{
+			Name: "subresource_filter",
+			Context: &structpb.Struct{
+				Fields: map[string]*structpb.Value{
+					"subresources": structpb.NewListValue(&structpb.ListValue{
+						Values: []*structpb.Value{structpb.NewStringValue(subresource)},
+					}),
+				},
+			},
+		},
+	}
+}
+
 func isFolderResourceRelationSet(relation string) bool {
 	return relation == RelationFolderResourceSetView ||
 		relation == RelationFolderResourceSetEdit ||
@@ -20,6 +20,28 @@ func (s *Server) Check(ctx context.Context, r *authzv1.CheckRequest) (*authzv1.C
 	return s.checkGeneric(ctx, r)
 }
 
+// CheckTuple checks tuple against the store of namespace. It implements zanzana.TupleChecker.
+func (s *Server) CheckTuple(ctx context.Context, namespace string, tuple *openfgav1.CheckRequestTupleKey) (bool, error) {
+	ctx, span := tracer.Start(ctx, "authzServer.CheckTuple")
+	defer span.End()
+
+	storeInf, err := s.getNamespaceStore(ctx, namespace)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := s.openfga.Check(ctx, &openfgav1.CheckRequest{
+		StoreId:              storeInf.Id,
+		AuthorizationModelId: storeInf.AuthorizationModelId,
+		TupleKey:             tuple,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return res.GetAllowed(), nil
+}
+
 func (s *Server) checkTyped(ctx context.Context, r *authzv1.CheckRequest, info common.TypeInfo) (*authzv1.CheckResponse, error) {
 	storeInf, err := s.getNamespaceStore(ctx, r.Namespace)
 	if err != nil {
@@ -114,18 +136,15 @@ func (s *Server) checkGeneric(ctx context.Context, r *authzv1.CheckRequest) (*au
 		return &authzv1.CheckResponse{Allowed: true}, nil
 	}
 
-	if r.Folder == "" {
-		return &authzv1.CheckResponse{Allowed: false}, nil
-	}
-
-	// 3. check if subject has access as a sub resource for the folder
+	// 3. check if subject has access as a sub resource for the folder, resources without a folder
+	// inherit the grants of the General folder
 	res, err = s.openfga.Check(ctx, &openfgav1.CheckRequest{
 		StoreId:              storeInf.Id,
 		AuthorizationModelId: storeInf.AuthorizationModelId,
 		TupleKey: &openfgav1.CheckRequestTupleKey{
 			User:     r.GetSubject(),
 			Relation: common.FolderResourceRelation(relation),
-			Object:   common.NewFolderIdent(r.GetFolder()),
+			Object:   common.NewFolderIdent(common.ResourceFolder(r.GetFolder())),
 		},
 		Context: &structpb.Struct{
 			Fields: map[string]*structpb.Value{
@@ -148,9 +148,14 @@ func directObjects(group, resource string, objects []string) []string {
 	return objects
 }
 
+// folderObject returns the uids of folder objects. Resources without a folder are stored in the
+// General folder, so the empty folder is listed along with it, the same as Check does.
 func folderObject(objects []string) []string {
 	for i := range objects {
 		objects[i] = strings.TrimPrefix(objects[i], folderTypePrefix)
+		if objects[i] == common.GeneralFolderUID {
+			objects = append(objects, "")
+		}
 	}
 	return objects
 }
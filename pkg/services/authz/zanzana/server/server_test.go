@@ -2,14 +2,19 @@ package server
 
 import (
 	"context"
+	"slices"
 	"testing"
 
+	authzv1 "github.com/grafana/authlib/authz/proto/v1"
 	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/grafana/grafana/pkg/apimachinery/utils"
 	"github.com/grafana/grafana/pkg/infra/db"
 	"github.com/grafana/grafana/pkg/infra/log"
 	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+	authzextv1 "github.com/grafana/grafana/pkg/services/authz/zanzana/proto/v1"
 	"github.com/grafana/grafana/pkg/services/authz/zanzana/store"
 	"github.com/grafana/grafana/pkg/services/sqlstore/migrator"
 	"github.com/grafana/grafana/pkg/setting"
@@ -49,6 +54,53 @@ func TestIntegrationServer(t *testing.T) {
 	t.Run("test list", func(t *testing.T) {
 		testList(t, srv)
 	})
+
+	t.Run("test general folder", func(t *testing.T) {
+		testGeneralFolder(t, srv)
+	})
+}
+
+// testGeneralFolder checks that Check and List agree on access to resources through the General
+// folder, resources without a folder are stored in it.
+func testGeneralFolder(t *testing.T, server *Server) {
+	tests := []struct {
+		desc    string
+		subject string
+		folder  string
+		allowed bool
+	}{
+		{desc: "resource without folder", subject: "user:9", folder: "", allowed: true},
+		{desc: "resource in the General folder", subject: "user:9", folder: common.GeneralFolderUID, allowed: true},
+		{desc: "resource in another folder", subject: "user:9", folder: "1", allowed: false},
+		{desc: "resource without folder with grant on another folder", subject: "user:4", folder: "", allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			check, err := server.Check(context.Background(), &authzv1.CheckRequest{
+				Namespace: "default",
+				Subject:   tt.subject,
+				Verb:      utils.VerbGet,
+				Group:     dashboardGroup,
+				Resource:  dashboardResource,
+				Name:      "13",
+				Folder:    tt.folder,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.allowed, check.GetAllowed(), "check")
+
+			list, err := server.List(context.Background(), &authzextv1.ListRequest{
+				Namespace: "default",
+				Subject:   tt.subject,
+				Verb:      utils.VerbList,
+				Group:     dashboardGroup,
+				Resource:  dashboardResource,
+			})
+			require.NoError(t, err)
+			listed := list.GetAll() || slices.Contains(list.GetFolders(), tt.folder) || slices.Contains(list.GetItems(), "13")
+			assert.Equal(t, tt.allowed, listed, "list")
+		})
+	}
 }
 
 func setup(t *testing.T, testDB db.DB, cfg *setting.Cfg) *Server {
@@ -82,6 +134,7 @@ func setup(t *testing.T, testDB db.DB, cfg *setting.Cfg) *Server {
 				common.NewFolderParentTuple("5", "4"),
 				common.NewFolderParentTuple("6", "5"),
 				common.NewFolderResourceTuple("user:8", "view", dashboardGroup, dashboardResource, "5"),
+				common.NewFolderResourceTuple("user:9", "read", dashboardGroup, dashboardResource, common.GeneralFolderUID),
 			},
 		},
 	})
@@ -9,13 +9,18 @@ type resourceTranslation struct {
 	typ      string
 	group    string
 	resource string
-	mapping  map[string]actionMappig
+	// subresource is set when permissions targets a subresource of the resource.
+	subresource bool
+	mapping     map[string]actionMappig
 }
 
 type actionMappig struct {
 	relation string
 	group    string
 	resource string
+	// resources are other resources in group the action applies to. Only used for
+	// folder resources where all of them are added to the same tuple.
+	resources []string
 }
 
 func newMapping(relation string) actionMappig {
@@ -23,7 +28,13 @@ func newMapping(relation string) actionMappig {
 }
 
 func newScopedMapping(relation, group, resource string) actionMappig {
-	return actionMappig{relation, group, resource}
+	return actionMappig{relation: relation, group: group, resource: resource}
+}
+
+// withResources returns a copy of the mapping that also applies to resources.
+func (m actionMappig) withResources(resources ...string) actionMappig {
+	m.resources = resources
+	return m
 }
 
 var (
@@ -32,6 +43,51 @@ var (
 
 	dashboardGroup    = dashboardalpha1.DashboardResourceInfo.GroupResource().Group
 	dashboardResource = dashboardalpha1.DashboardResourceInfo.GroupResource().Resource
+
+	libraryPanelGroup    = dashboardalpha1.LibraryPanelResourceInfo.GroupResource().Group
+	libraryPanelResource = dashboardalpha1.LibraryPanelResourceInfo.GroupResource().Resource
+)
+
+// Alert rules don't have an api group registered yet. Recording rules are alert rules
+// and share the same actions, but they are served as their own resource.
+const (
+	alertRuleGroup        = "rules.alerting.grafana.app"
+	alertRuleResource     = "alertrules"
+	recordingRuleResource = "recordingrules"
+)
+
+// Annotations don't have an api group registered yet. Annotation permissions on a dashboard
+// are translated into a resource with the same name as the dashboard.
+const (
+	annotationGroup    = "annotation.grafana.app"
+	annotationResource = "annotations"
+)
+
+// Query history doesn't have an api group registered yet.
+const (
+	queryHistoryGroup    = "queryhistory.grafana.app"
+	queryHistoryResource = "queryhistory"
+)
+
+// Datasources are served in a group per plugin, permissions are granted on a single group
+// for all of them. Querying requires read access to the datasource.
+const (
+	datasourceGroup    = "datasource.grafana.app"
+	datasourceResource = "datasources"
+)
+
+// App plugins are served by the plugins group. Access to their pages is granted on subresources
+// of the plugin.
+const (
+	pluginGroup    = "plugins.grafana.app"
+	pluginResource = "apps"
+)
+
+// Silences don't have an api group registered yet. They are managed by the alertmanager and
+// get their permissions from the folder of the rules they silence.
+const (
+	silenceGroup    = "notifications.alerting.grafana.app"
+	silenceResource = "silences"
 )
 
 var resourceTranslations = map[string]resourceTranslation{
@@ -40,18 +96,29 @@ var resourceTranslations = map[string]resourceTranslation{
 		group:    folderGroup,
 		resource: folderResource,
 		mapping: map[string]actionMappig{
+			"folders:view":                 newMapping(RelationSetView),
+			"folders:edit":                 newMapping(RelationSetEdit),
+			"folders:admin":                newMapping(RelationSetAdmin),
 			"folders:read":                 newMapping(RelationRead),
 			"folders:write":                newMapping(RelationWrite),
 			"folders:create":               newMapping(RelationCreate),
 			"folders:delete":               newMapping(RelationDelete),
 			"folders.permissions:read":     newMapping(RelationPermissionsRead),
-			"folders.permissions:write":    newMapping(RelationPermissionsWrite),
+			"folders.permissions:write":    newMapping(RelationSetAdmin),
 			"dashboards:read":              newScopedMapping(RelationRead, dashboardGroup, dashboardResource),
 			"dashboards:write":             newScopedMapping(RelationWrite, dashboardGroup, dashboardResource),
 			"dashboards:create":            newScopedMapping(RelationCreate, dashboardGroup, dashboardResource),
 			"dashboards:delete":            newScopedMapping(RelationDelete, dashboardGroup, dashboardResource),
 			"dashboards.permissions:read":  newScopedMapping(RelationPermissionsRead, dashboardGroup, dashboardResource),
-			"dashboards.permissions:write": newScopedMapping(RelationPermissionsWrite, dashboardGroup, dashboardResource),
+			"dashboards.permissions:write": newScopedMapping(RelationSetAdmin, dashboardGroup, dashboardResource),
+			"alert.rules:read":             newScopedMapping(RelationRead, alertRuleGroup, alertRuleResource).withResources(recordingRuleResource),
+			"alert.rules:write":            newScopedMapping(RelationWrite, alertRuleGroup, alertRuleResource).withResources(recordingRuleResource),
+			"alert.rules:create":           newScopedMapping(RelationCreate, alertRuleGroup, alertRuleResource).withResources(recordingRuleResource),
+			"alert.rules:delete":           newScopedMapping(RelationDelete, alertRuleGroup, alertRuleResource).withResources(recordingRuleResource),
+			"library.panels:read":          newScopedMapping(RelationRead, libraryPanelGroup, libraryPanelResource),
+			"library.panels:write":         newScopedMapping(RelationWrite, libraryPanelGroup, libraryPanelResource),
+			"library.panels:create":        newScopedMapping(RelationCreate, libraryPanelGroup, libraryPanelResource),
+			"library.panels:delete":        newScopedMapping(RelationDelete, libraryPanelGroup, libraryPanelResource),
 		},
 	},
 	KindDashboards: {
@@ -59,12 +126,279 @@ var resourceTranslations = map[string]resourceTranslation{
 		group:    dashboardGroup,
 		resource: dashboardResource,
 		mapping: map[string]actionMappig{
+			"dashboards:view":              newMapping(RelationSetView),
+			"dashboards:edit":              newMapping(RelationSetEdit),
+			"dashboards:admin":             newMapping(RelationSetAdmin),
 			"dashboards:read":              newMapping(RelationRead),
 			"dashboards:write":             newMapping(RelationWrite),
 			"dashboards:create":            newMapping(RelationCreate),
 			"dashboards:delete":            newMapping(RelationDelete),
 			"dashboards.permissions:read":  newMapping(RelationPermissionsRead),
-			"dashboards.permissions:write": newMapping(RelationPermissionsWrite),
+			"dashboards.permissions:write": newMapping(RelationSetAdmin),
+			"annotations:read":             newScopedMapping(RelationRead, annotationGroup, annotationResource),
+			"annotations:write":            newScopedMapping(RelationWrite, annotationGroup, annotationResource),
+			"annotations:create":           newScopedMapping(RelationCreate, annotationGroup, annotationResource),
+			"annotations:delete":           newScopedMapping(RelationDelete, annotationGroup, annotationResource),
 		},
 	},
+	KindLibraryPanels: {
+		typ:      TypeResource,
+		group:    libraryPanelGroup,
+		resource: libraryPanelResource,
+		mapping: map[string]actionMappig{
+			"library.panels:read":   newMapping(RelationRead),
+			"library.panels:write":  newMapping(RelationWrite),
+			"library.panels:delete": newMapping(RelationDelete),
+		},
+	},
+	KindServiceAccounts: {
+		typ: TypeServiceAccount,
+		mapping: map[string]actionMappig{
+			"serviceaccounts:edit":              newMapping(RelationSetEdit),
+			"serviceaccounts:admin":             newMapping(RelationSetAdmin),
+			"serviceaccounts:read":              newMapping(RelationRead),
+			"serviceaccounts:write":             newMapping(RelationWrite),
+			"serviceaccounts:delete":            newMapping(RelationDelete),
+			"serviceaccounts.permissions:read":  newMapping(RelationPermissionsRead),
+			"serviceaccounts.permissions:write": newMapping(RelationSetAdmin),
+		},
+	},
+	KindQueryHistory: {
+		typ:      TypeResource,
+		group:    queryHistoryGroup,
+		resource: queryHistoryResource,
+		mapping: map[string]actionMappig{
+			ActionQueryHistoryRead:   newMapping(RelationRead),
+			ActionQueryHistoryWrite:  newMapping(RelationWrite),
+			ActionQueryHistoryDelete: newMapping(RelationDelete),
+		},
+	},
+	KindDatasources: {
+		typ:      TypeResource,
+		group:    datasourceGroup,
+		resource: datasourceResource,
+		mapping: map[string]actionMappig{
+			"datasources:query":             newMapping(RelationRead),
+			"datasources:read":              newMapping(RelationRead),
+			"datasources:write":             newMapping(RelationWrite),
+			"datasources:delete":            newMapping(RelationDelete),
+			"datasources.permissions:read":  newMapping(RelationPermissionsRead),
+			"datasources.permissions:write": newMapping(RelationSetAdmin),
+		},
+	},
+	KindAlertRules: {
+		typ:      TypeResource,
+		group:    alertRuleGroup,
+		resource: alertRuleResource,
+		mapping: map[string]actionMappig{
+			"alert.rules:read":   newMapping(RelationRead),
+			"alert.rules:write":  newMapping(RelationWrite),
+			"alert.rules:delete": newMapping(RelationDelete),
+		},
+	},
+	KindPanels: {
+		typ:         TypeResource,
+		group:       dashboardGroup,
+		resource:    dashboardResource,
+		subresource: true,
+		mapping: map[string]actionMappig{
+			"panels:read":  newMapping(RelationSubresourceRead),
+			"panels:write": newMapping(RelationSubresourceWrite),
+		},
+	},
+	KindPlugins: {
+		typ:         TypeResource,
+		group:       pluginGroup,
+		resource:    pluginResource,
+		subresource: true,
+		mapping: map[string]actionMappig{
+			"plugins.app:access": newMapping(RelationSubresourceRead),
+		},
+	},
+	KindTeams: {
+		typ: TypeTeam,
+		mapping: map[string]actionMappig{
+			"teams:read": newMapping(RelationRead),
+		},
+	},
+	KindSilences: {
+		typ:      TypeFolder,
+		group:    folderGroup,
+		resource: folderResource,
+		mapping: map[string]actionMappig{
+			"alert.silences:read":   newScopedMapping(RelationRead, silenceGroup, silenceResource),
+			"alert.silences:create": newScopedMapping(RelationCreate, silenceGroup, silenceResource),
+			"alert.silences:write":  newScopedMapping(RelationWrite, silenceGroup, silenceResource),
+		},
+	},
+}
+
+// Pinned translation versions are derived from the next version by removing or replacing what
+// it added, so changing a mapping of resourceTranslations can change every pinned version.
+// TestResourceTranslationVersions compares the effective mapping of each pinned version with
+// a golden file and fails when it changes.
+
+// resourceTranslationsV1 is the translation before alert rule and panel permissions were supported.
+var resourceTranslationsV1 = map[string]resourceTranslation{
+	KindFolders: withoutActions(
+		resourceTranslationsV2[KindFolders],
+		"alert.rules:read", "alert.rules:write", "alert.rules:create", "alert.rules:delete",
+	),
+	KindDashboards: resourceTranslationsV2[KindDashboards],
+}
+
+// resourceTranslationsV2 is the translation before service account permissions were supported.
+var resourceTranslationsV2 = withoutKinds(resourceTranslationsV3, KindServiceAccounts)
+
+// resourceTranslationsV3 is the translation before annotation permissions on dashboards were
+// supported.
+var resourceTranslationsV3 = withKind(resourceTranslationsV4, KindDashboards, withoutActions(
+	resourceTranslationsV4[KindDashboards],
+	"annotations:read", "annotations:write", "annotations:create", "annotations:delete",
+))
+
+// resourceTranslationsV4 is the translation before library panel permissions were supported.
+var resourceTranslationsV4 = withKind(withoutKinds(resourceTranslationsV5, KindLibraryPanels), KindFolders, withoutActions(
+	resourceTranslationsV5[KindFolders],
+	"library.panels:read", "library.panels:write", "library.panels:create", "library.panels:delete",
+))
+
+// resourceTranslationsV5 is the translation before action sets on folders and dashboards were
+// supported.
+var resourceTranslationsV5 = withKind(
+	withKind(resourceTranslationsV6, KindFolders, withoutActions(
+		resourceTranslationsV6[KindFolders],
+		"folders:view", "folders:edit", "folders:admin",
+	)),
+	KindDashboards, withoutActions(
+		resourceTranslationsV6[KindDashboards],
+		"dashboards:view", "dashboards:edit", "dashboards:admin",
+	),
+)
+
+// resourceTranslationsV6 is the translation before recording rules were covered by alert
+// rule permissions on folders.
+var resourceTranslationsV6 = withKind(resourceTranslationsV7, KindFolders, withMappings(
+	resourceTranslationsV7[KindFolders],
+	map[string]actionMappig{
+		"alert.rules:read":   newScopedMapping(RelationRead, alertRuleGroup, alertRuleResource),
+		"alert.rules:write":  newScopedMapping(RelationWrite, alertRuleGroup, alertRuleResource),
+		"alert.rules:create": newScopedMapping(RelationCreate, alertRuleGroup, alertRuleResource),
+		"alert.rules:delete": newScopedMapping(RelationDelete, alertRuleGroup, alertRuleResource),
+	},
+))
+
+// resourceTranslationsV7 is the translation before query history was supported.
+var resourceTranslationsV7 = withoutKinds(resourceTranslationsV8, KindQueryHistory)
+
+// resourceTranslationsV8 is the translation before alert rule permissions were applied to the
+// alert rules within folders.
+var resourceTranslationsV8 = withoutKinds(resourceTranslationsV9, KindAlertRules)
+
+// resourceTranslationsV9 is the translation before datasource permissions were supported.
+var resourceTranslationsV9 = withoutKinds(resourceTranslationsV10, KindDatasources)
+
+// resourceTranslationsV10 is the translation before permission management was translated into
+// the admin set.
+var resourceTranslationsV10 = withPermissionsWrite(
+	withKind(resourceTranslationsV11, KindFolders, withMappings(
+		resourceTranslationsV11[KindFolders],
+		map[string]actionMappig{
+			"dashboards.permissions:write": newScopedMapping(RelationPermissionsWrite, dashboardGroup, dashboardResource),
+		},
+	)),
+	map[string]string{
+		KindFolders:     "folders.permissions:write",
+		KindDashboards:  "dashboards.permissions:write",
+		KindDatasources: "datasources.permissions:write",
+	},
+)
+
+// resourceTranslationsV11 is the translation before access to pages of app plugins was supported.
+var resourceTranslationsV11 = withoutKinds(resourceTranslationsV12, KindPlugins)
+
+// resourceTranslationsV12 is the translation before teams could be granted read access to
+// other teams.
+var resourceTranslationsV12 = withoutKinds(resourceTranslationsV13, KindTeams)
+
+// resourceTranslationsV13 is the translation before alerting silence permissions were supported.
+var resourceTranslationsV13 = withoutKinds(resourceTranslationsV14, KindSilences)
+
+// resourceTranslationsV14 is the translation before edit and admin action sets on service
+// accounts were supported and their permission management was translated into the admin set.
+var resourceTranslationsV14 = withPermissionsWrite(
+	withKind(resourceTranslations, KindServiceAccounts, withoutActions(
+		resourceTranslations[KindServiceAccounts],
+		"serviceaccounts:edit", "serviceaccounts:admin",
+	)),
+	map[string]string{KindServiceAccounts: "serviceaccounts.permissions:write"},
+)
+
+var resourceTranslationVersions = map[TranslationVersion]map[string]resourceTranslation{
+	TranslationV1:  resourceTranslationsV1,
+	TranslationV2:  resourceTranslationsV2,
+	TranslationV3:  resourceTranslationsV3,
+	TranslationV4:  resourceTranslationsV4,
+	TranslationV5:  resourceTranslationsV5,
+	TranslationV6:  resourceTranslationsV6,
+	TranslationV7:  resourceTranslationsV7,
+	TranslationV8:  resourceTranslationsV8,
+	TranslationV9:  resourceTranslationsV9,
+	TranslationV10: resourceTranslationsV10,
+	TranslationV11: resourceTranslationsV11,
+	TranslationV12: resourceTranslationsV12,
+	TranslationV13: resourceTranslationsV13,
+	TranslationV14: resourceTranslationsV14,
+	TranslationV15: resourceTranslations,
+}
+
+func withKind(translations map[string]resourceTranslation, kind string, t resourceTranslation) map[string]resourceTranslation {
+	out := withoutKinds(translations)
+	out[kind] = t
+	return out
+}
+
+func withoutKinds(translations map[string]resourceTranslation, kinds ...string) map[string]resourceTranslation {
+	out := make(map[string]resourceTranslation, len(translations))
+	for kind, t := range translations {
+		out[kind] = t
+	}
+	for _, kind := range kinds {
+		delete(out, kind)
+	}
+	return out
+}
+
+// withPermissionsWrite maps the permission management action of every kind in actions to the
+// permissions_write relation.
+func withPermissionsWrite(translations map[string]resourceTranslation, actions map[string]string) map[string]resourceTranslation {
+	out := withoutKinds(translations)
+	for kind, action := range actions {
+		out[kind] = withMappings(out[kind], map[string]actionMappig{action: newMapping(RelationPermissionsWrite)})
+	}
+	return out
+}
+
+func withoutActions(t resourceTranslation, actions ...string) resourceTranslation {
+	mapping := make(map[string]actionMappig, len(t.mapping))
+	for action, m := range t.mapping {
+		mapping[action] = m
+	}
+	for _, action := range actions {
+		delete(mapping, action)
+	}
+	t.mapping = mapping
+	return t
+}
+
+func withMappings(t resourceTranslation, mappings map[string]actionMappig) resourceTranslation {
+	mapping := make(map[string]actionMappig, len(t.mapping))
+	for action, m := range t.mapping {
+		mapping[action] = m
+	}
+	for action, m := range mappings {
+		mapping[action] = m
+	}
+	t.mapping = mapping
+	return t
 }
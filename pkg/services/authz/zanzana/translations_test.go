@@ -0,0 +1,52 @@
+package zanzana
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// TestResourceTranslationVersions fails when the effective mapping of a pinned translation
+// version changes. Pinned versions are derived from newer ones, so changing a mapping of the
+// latest version can change them too. Run with -update only when adding a new version.
+func TestResourceTranslationVersions(t *testing.T) {
+	for version, translations := range resourceTranslationVersions {
+		if version == TranslationLatest {
+			continue
+		}
+
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			path := filepath.Join("testdata", "translations", fmt.Sprintf("v%d.txt", version))
+			actual := formatResourceTranslations(translations)
+			if *update {
+				require.NoError(t, os.WriteFile(path, []byte(actual), 0o600))
+			}
+
+			golden, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, string(golden), actual)
+		})
+	}
+}
+
+// formatResourceTranslations writes one sorted line per kind and per action of translations.
+func formatResourceTranslations(translations map[string]resourceTranslation) string {
+	var lines []string
+	for kind, t := range translations {
+		lines = append(lines, fmt.Sprintf("%s type=%s group=%s resource=%s subresource=%t", kind, t.typ, t.group, t.resource, t.subresource))
+		for action, m := range t.mapping {
+			lines = append(lines, fmt.Sprintf("%s %s relation=%s group=%s resource=%s resources=%s", kind, action, m.relation, m.group, m.resource, strings.Join(m.resources, ",")))
+		}
+	}
+	slices.Sort(lines)
+	return strings.Join(lines, "\n") + "\n"
+}
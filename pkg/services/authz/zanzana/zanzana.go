@@ -1,10 +1,14 @@
 package zanzana
 
 import (
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
 
 	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
 )
@@ -16,6 +20,11 @@ const (
 	TypeFolder    = common.TypeFolder
 	TypeResource  = common.TypeResource
 	TypeNamespace = common.TypeNamespace
+
+	TypeServiceAccount  = common.TypeServiceAccount
+	TypeGroup           = common.TypeGroup
+	TypeOrg             = common.TypeOrg
+	TypePublicDashboard = common.TypePublicDashboard
 )
 
 const (
@@ -39,6 +48,11 @@ const (
 	RelationFolderResourceSetEdit  = common.RelationFolderResourceSetEdit
 	RelationFolderResourceSetAdmin = common.RelationFolderResourceSetAdmin
 
+	RelationPublicRead = common.RelationPublicRead
+
+	RelationSubresourceRead  = common.RelationSubresourceRead
+	RelationSubresourceWrite = common.RelationSubresourceWrite
+
 	RelationFolderResourceRead             = common.RelationFolderResourceRead
 	RelationFolderResourceWrite            = common.RelationFolderResourceWrite
 	RelationFolderResourceCreate           = common.RelationFolderResourceCreate
@@ -48,6 +62,9 @@ const (
 )
 
 var ResourceRelations = []string{
+	RelationSetView,
+	RelationSetEdit,
+	RelationSetAdmin,
 	RelationRead,
 	RelationWrite,
 	RelationCreate,
@@ -56,8 +73,26 @@ var ResourceRelations = []string{
 	RelationPermissionsWrite,
 }
 
+var ServiceAccountRelations = []string{
+	RelationSetEdit,
+	RelationSetAdmin,
+	RelationRead,
+	RelationWrite,
+	RelationDelete,
+	RelationPermissionsRead,
+	RelationPermissionsWrite,
+}
+
+var SubresourceRelations = []string{
+	RelationSubresourceRead,
+	RelationSubresourceWrite,
+}
+
 var FolderRelations = append(
 	ResourceRelations,
+	RelationFolderResourceSetView,
+	RelationFolderResourceSetEdit,
+	RelationFolderResourceSetAdmin,
 	RelationFolderResourceRead,
 	RelationFolderResourceWrite,
 	RelationFolderResourceCreate,
@@ -66,9 +101,65 @@ var FolderRelations = append(
 	RelationFolderResourcePermissionsWrite,
 )
 
+// KnownRelations are all relations tuples are written with.
+var KnownRelations = append(
+	slices.Clone(FolderRelations),
+	RelationTeamMember,
+	RelationTeamAdmin,
+	RelationParent,
+	RelationAssignee,
+	RelationPublicRead,
+	RelationSubresourceRead,
+	RelationSubresourceWrite,
+)
+
+// IsKnownRelation returns true if relation is one of KnownRelations. Tuples with other relations
+// were written by a different version.
+func IsKnownRelation(relation string) bool {
+	return slices.Contains(KnownRelations, relation)
+}
+
 const (
 	KindDashboards string = "dashboards"
 	KindFolders    string = "folders"
+	// KindPanels is used for permissions scoped to a single panel within a dashboard.
+	// They are only migrated when explicitly enabled.
+	KindPanels string = "panels"
+	// KindServiceAccounts is used for permissions on service accounts. Tokens of a service account
+	// don't carry scopes of their own, they authenticate as the service account, so no tuples are
+	// written for them and expired tokens need no cleanup.
+	KindServiceAccounts string = "serviceaccounts"
+	// KindLibraryPanels is used for permissions granted directly on a library panel. Library panels
+	// mostly get their permissions from the folder they are stored in.
+	KindLibraryPanels string = "library.panels"
+	// KindQueryHistory is used for access to the query history of a user, identified by the uid
+	// of the user.
+	KindQueryHistory string = "queryhistory"
+	// KindAlertRules is used for alert rule permissions on a single alert rule. Alert rule
+	// permissions are scoped to folders in legacy, they are applied to every rule in the folder.
+	KindAlertRules string = "alert.rules"
+	// KindDatasources is used for permissions on datasources. Permissions on all datasources are
+	// translated into namespace tuples. Datasources can't be organized into groups or folders, so
+	// there is no intermediate object permissions are inherited from.
+	KindDatasources string = "datasources"
+	// KindPlugins is used for access to a single page of an app plugin. Page access is a
+	// subresource of the plugin, identified by <plugin id>/<page>.
+	KindPlugins string = "plugins"
+	// KindTeams is used for visibility of a team granted to the members of another team. Team
+	// membership is reconciled from team members and never translated from permissions.
+	KindTeams string = "teams"
+	// KindSilences is used for alerting silence permissions. Silences are scoped to folders in
+	// legacy and translated into folder resource tuples. They are only migrated when explicitly
+	// enabled.
+	KindSilences string = "alert.silences"
+)
+
+// Query history has no permissions in legacy access control, users can always access the
+// entries they created. These actions are implied for the owner of a query history.
+const (
+	ActionQueryHistoryRead   = "queryhistory:read"
+	ActionQueryHistoryWrite  = "queryhistory:write"
+	ActionQueryHistoryDelete = "queryhistory:delete"
 )
 
 const (
@@ -95,41 +186,291 @@ func NewTupleEntry(objectType, id, relation string) string {
 	return obj
 }
 
+// TranslationVersion selects what version of the translation from legacy permissions to tuples
+// to use. Older versions are kept so a migration can be reproduced with the translation it was run with.
+type TranslationVersion int
+
+const (
+	// TranslationV1 translates folder and dashboard actions for folders and dashboards.
+	TranslationV1 TranslationVersion = iota + 1
+	// TranslationV2 adds alert rule actions for folders and panel permissions.
+	TranslationV2
+	// TranslationV3 adds permissions on service accounts.
+	TranslationV3
+	// TranslationV4 adds annotation permissions on dashboards.
+	TranslationV4
+	// TranslationV5 adds library panel permissions.
+	TranslationV5
+	// TranslationV6 adds view, edit and admin action sets on folders and dashboards.
+	TranslationV6
+	// TranslationV7 adds recording rules to alert rule permissions on folders.
+	TranslationV7
+	// TranslationV8 adds access to the query history of users.
+	TranslationV8
+	// TranslationV9 adds folder scoped alert rule permissions on the alert rules within folders.
+	TranslationV9
+	// TranslationV10 adds datasource permissions.
+	TranslationV10
+	// TranslationV11 translates permission management on folders, dashboards and datasources into
+	// the admin set, as anyone allowed to write permissions can grant themselves any other.
+	TranslationV11
+	// TranslationV12 adds access to pages of app plugins.
+	TranslationV12
+	// TranslationV13 adds read access to teams granted to other teams.
+	TranslationV13
+	// TranslationV14 adds alerting silence permissions on folders.
+	TranslationV14
+	// TranslationV15 adds edit and admin action sets on service accounts and translates their
+	// permission management into the admin set.
+	TranslationV15
+
+	TranslationLatest = TranslationV15
+)
+
 func TranslateToResourceTuple(subject string, action, kind, name string) (*openfgav1.TupleKey, bool) {
-	translation, ok := resourceTranslations[kind]
+	return TranslateToResourceTupleVersion(TranslationLatest, subject, action, kind, name)
+}
+
+// TranslateToResourceTupleVersion translates a legacy permission using the translation for version.
+func TranslateToResourceTupleVersion(version TranslationVersion, subject string, action, kind, name string) (*openfgav1.TupleKey, bool) {
+	tuple, err := TranslateResourcePermission(version, subject, action, kind, name)
+	return tuple, err == nil
+}
+
+// NormalizeScope canonicalizes a legacy scope into the kind and identifier used to build object
+// keys. Both kind:uid:identifier and the older kind:identifier form are supported, so e.g.
+// folders:uid:abc and folders:abc resolve to the same folder. Wildcards and scopes using other
+// attributes are not supported.
+func NormalizeScope(scope string) (kind, identifier string, ok bool) {
+	parts := strings.SplitN(scope, ":", 3)
+	switch {
+	case len(parts) == 2 && parts[1] != "uid":
+		kind, identifier = parts[0], parts[1]
+	case len(parts) == 3 && parts[1] == "uid":
+		kind, identifier = parts[0], parts[2]
+	default:
+		return "", "", false
+	}
+
+	if kind == "" || identifier == "" || identifier == "*" {
+		return "", "", false
+	}
+	return kind, identifier, true
+}
 
+// TranslateScopePermission translates a legacy permission granted on scope using the translation
+// for version. The scope is normalized with NormalizeScope before the object is built.
+func TranslateScopePermission(version TranslationVersion, subject string, action, scope string) (*openfgav1.TupleKey, error) {
+	kind, identifier, ok := NormalizeScope(scope)
 	if !ok {
-		return nil, false
+		return nil, ErrInvalidIdentifier
+	}
+	return TranslateResourcePermission(version, subject, action, kind, identifier)
+}
+
+var (
+	ErrUnsupportedTranslationVersion = errors.New("unsupported translation version")
+	ErrUnsupportedKind               = errors.New("unsupported kind")
+	ErrUnsupportedAction             = errors.New("unsupported action")
+	ErrInvalidIdentifier             = errors.New("invalid identifier")
+)
+
+// TranslateResourcePermission translates a legacy permission using the translation for version.
+// It returns an error describing why the permission could not be translated.
+func TranslateResourcePermission(version TranslationVersion, subject string, action, kind, name string) (*openfgav1.TupleKey, error) {
+	translations, ok := resourceTranslationVersions[version]
+	if !ok {
+		return nil, ErrUnsupportedTranslationVersion
+	}
+
+	translation, ok := translations[kind]
+	if !ok {
+		return nil, ErrUnsupportedKind
 	}
 
 	m, ok := translation.mapping[action]
 	if !ok {
-		return nil, false
+		return nil, ErrUnsupportedAction
 	}
 
 	if translation.typ == TypeResource {
-		return common.NewResourceTuple(subject, m.relation, translation.group, translation.resource, name), true
+		group, resource := translation.group, translation.resource
+		if m.group != "" && m.resource != "" {
+			// Action targets a resource related to the one permission is granted for.
+			group, resource = m.group, m.resource
+		}
+
+		if translation.subresource {
+			// Subresource identifiers are on the form <name>/<subresource>
+			name, subresource, found := strings.Cut(name, "/")
+			if !found || name == "" || subresource == "" {
+				return nil, ErrInvalidIdentifier
+			}
+			return common.NewSubresourceTuple(subject, m.relation, group, resource, name, subresource), nil
+		}
+
+		return common.NewResourceTuple(subject, m.relation, group, resource, name), nil
 	}
 
 	if translation.typ == TypeFolder {
 		if m.group != "" && m.resource != "" {
-			return common.NewFolderResourceTuple(subject, m.relation, m.group, m.resource, name), true
+			tuple := common.NewFolderResourceTuple(subject, m.relation, m.group, m.resource, name)
+			for _, resource := range m.resources {
+				MergeFolderResourceTuples(tuple, common.NewFolderResourceTuple(subject, m.relation, m.group, resource, name))
+			}
+			return tuple, nil
 		}
 
-		return common.NewFolderTuple(subject, m.relation, name), true
+		return common.NewFolderTuple(subject, m.relation, name), nil
 	}
 
-	return common.NewTypedTuple(translation.typ, subject, m.relation, name), true
+	return common.NewTypedTuple(translation.typ, subject, m.relation, name), nil
+}
+
+// TranslateNamespacePermission translates a legacy permission granted on all resources of kind
+// into tuples on the namespace of the resources the action targets. Kinds without an api group
+// and subresources are not supported.
+func TranslateNamespacePermission(version TranslationVersion, subject string, action, kind string) ([]*openfgav1.TupleKey, error) {
+	translations, ok := resourceTranslationVersions[version]
+	if !ok {
+		return nil, ErrUnsupportedTranslationVersion
+	}
+
+	translation, ok := translations[kind]
+	if !ok {
+		return nil, ErrUnsupportedKind
+	}
+
+	m, ok := translation.mapping[action]
+	if !ok || translation.subresource {
+		return nil, ErrUnsupportedAction
+	}
+
+	group, resource := translation.group, translation.resource
+	if m.group != "" && m.resource != "" {
+		group, resource = m.group, m.resource
+	}
+	if group == "" || resource == "" {
+		return nil, ErrUnsupportedKind
+	}
+
+	tuples := []*openfgav1.TupleKey{common.NewNamespaceResourceTuple(subject, m.relation, group, resource)}
+	for _, r := range m.resources {
+		tuples = append(tuples, common.NewNamespaceResourceTuple(subject, m.relation, group, r))
+	}
+	return tuples, nil
+}
+
+// ResourceObjectPrefixes returns the object prefixes of all resources permissions of kind are
+// translated into. Only kinds translated into resource tuples are supported.
+func ResourceObjectPrefixes(version TranslationVersion, kind string) []string {
+	translation, ok := resourceTranslationVersions[version][kind]
+	if !ok || translation.typ != TypeResource {
+		return nil
+	}
+
+	prefixes := []string{common.NewResourceIdent(translation.group, translation.resource, "")}
+	for _, m := range translation.mapping {
+		if m.group == "" || m.resource == "" {
+			continue
+		}
+		prefix := common.NewResourceIdent(m.group, m.resource, "")
+		if !slices.Contains(prefixes, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// FolderResourceGroups returns all group resources that folder resource tuples can be
+// scoped to, e.g. dashboard.grafana.app/dashboards. Kinds other than folders that are
+// translated into folder resource tuples, like silences, are included.
+func FolderResourceGroups(version TranslationVersion) []string {
+	var groups []string
+	for _, translation := range resourceTranslationVersions[version] {
+		if translation.typ != TypeFolder {
+			continue
+		}
+		for _, m := range translation.mapping {
+			if m.group == "" || m.resource == "" {
+				continue
+			}
+			for _, resource := range append([]string{m.resource}, m.resources...) {
+				group := common.FormatGroupResource(m.group, resource)
+				if !slices.Contains(groups, group) {
+					groups = append(groups, group)
+				}
+			}
+		}
+	}
+
+	sort.Strings(groups)
+	return groups
+}
+
+// FolderResourceTupleGroups returns the group resources in the condition of a folder resource tuple.
+func FolderResourceTupleGroups(t *openfgav1.TupleKey) []string {
+	values := t.GetCondition().GetContext().GetFields()["group_resources"].GetListValue().GetValues()
+	groups := make([]string, 0, len(values))
+	for _, v := range values {
+		groups = append(groups, v.GetStringValue())
+	}
+	return groups
 }
 
 func IsFolderResourceTuple(t *openfgav1.TupleKey) bool {
 	return strings.HasPrefix(t.Object, TypeFolder) && strings.HasPrefix(t.Relation, "resource_")
 }
 
+// MergeFolderResourceTuples merges group_resources of b into a. The merged list is kept
+// sorted and without duplicates so the result does not depend on the order tuples are merged in.
 func MergeFolderResourceTuples(a, b *openfgav1.TupleKey) {
-	va := a.Condition.Context.Fields["group_resources"]
-	vb := b.Condition.Context.Fields["group_resources"]
-	va.GetListValue().Values = append(va.GetListValue().Values, vb.GetListValue().Values...)
+	mergeConditionList(a, b, "group_resources")
+}
+
+func IsSubresourceTuple(t *openfgav1.TupleKey) bool {
+	return strings.HasPrefix(t.Object, TypeResource) && strings.HasPrefix(t.Relation, "subresource_")
+}
+
+// MergeSubresourceTuples merges subresources of b into a.
+func MergeSubresourceTuples(a, b *openfgav1.TupleKey) {
+	mergeConditionList(a, b, "subresources")
+}
+
+func mergeConditionList(a, b *openfgav1.TupleKey, field string) {
+	if a.GetCondition() == nil || b.GetCondition() == nil {
+		return
+	}
+
+	va := a.Condition.GetContext().GetFields()[field]
+	vb := b.Condition.GetContext().GetFields()[field]
+
+	seen := make(map[string]struct{})
+	values := make([]*structpb.Value, 0, len(va.GetListValue().GetValues())+len(vb.GetListValue().GetValues()))
+	for _, list := range [][]*structpb.Value{va.GetListValue().GetValues(), vb.GetListValue().GetValues()} {
+		for _, v := range list {
+			if _, ok := seen[v.GetStringValue()]; ok {
+				continue
+			}
+			seen[v.GetStringValue()] = struct{}{}
+			values = append(values, v)
+		}
+	}
+
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].GetStringValue() < values[j].GetStringValue()
+	})
+
+	if a.Condition.Context == nil {
+		a.Condition.Context = &structpb.Struct{}
+	}
+	if a.Condition.Context.Fields == nil {
+		a.Condition.Context.Fields = make(map[string]*structpb.Value)
+	}
+	// The field is replaced as it may be missing or not hold a list in a.
+	a.Condition.Context.Fields[field] = structpb.NewListValue(&structpb.ListValue{Values: values})
 }
 
 func TranslateFixedRole(role string) string {
@@ -0,0 +1,232 @@
+package zanzana
+
+import (
+	"testing"
+
+	openfgav1 "github.com/openfga/api/proto/openfga/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/grafana/grafana/pkg/services/authz/zanzana/common"
+)
+
+func TestMergeFolderResourceTuples(t *testing.T) {
+	newTuple := func(group, resource string) *openfgav1.TupleKey {
+		return common.NewFolderResourceTuple("user:1", RelationRead, group, resource, "1")
+	}
+
+	groupResources := func(t *openfgav1.TupleKey) []string {
+		var out []string
+		for _, v := range t.GetCondition().GetContext().GetFields()["group_resources"].GetListValue().GetValues() {
+			out = append(out, v.GetStringValue())
+		}
+		return out
+	}
+
+	expected := []string{"alerting.grafana.app/rules", "dashboard.grafana.app/dashboards"}
+
+	t.Run("should merge group resources into a sorted set", func(t *testing.T) {
+		a := newTuple("dashboard.grafana.app", "dashboards")
+		MergeFolderResourceTuples(a, newTuple("alerting.grafana.app", "rules"))
+		MergeFolderResourceTuples(a, newTuple("dashboard.grafana.app", "dashboards"))
+		assert.Equal(t, expected, groupResources(a))
+	})
+
+	t.Run("should not depend on merge order", func(t *testing.T) {
+		a := newTuple("alerting.grafana.app", "rules")
+		MergeFolderResourceTuples(a, newTuple("dashboard.grafana.app", "dashboards"))
+		MergeFolderResourceTuples(a, newTuple("alerting.grafana.app", "rules"))
+		assert.Equal(t, expected, groupResources(a))
+	})
+
+	t.Run("should merge into tuple without group resources", func(t *testing.T) {
+		a := newTuple("dashboard.grafana.app", "dashboards")
+		delete(a.Condition.Context.Fields, "group_resources")
+		assert.NotPanics(t, func() {
+			MergeFolderResourceTuples(a, newTuple("alerting.grafana.app", "rules"))
+		})
+		assert.Equal(t, []string{"alerting.grafana.app/rules"}, groupResources(a))
+	})
+
+	t.Run("should merge into tuple where group resources is not a list", func(t *testing.T) {
+		a := newTuple("dashboard.grafana.app", "dashboards")
+		a.Condition.Context.Fields["group_resources"] = structpb.NewStringValue("dashboard.grafana.app/dashboards")
+		assert.NotPanics(t, func() {
+			MergeFolderResourceTuples(a, newTuple("alerting.grafana.app", "rules"))
+		})
+		assert.Equal(t, []string{"alerting.grafana.app/rules"}, groupResources(a))
+	})
+}
+
+func TestTranslateResourcePermission_Annotations(t *testing.T) {
+	tuple, err := TranslateResourcePermission(TranslationLatest, "user:1", "annotations:write", KindDashboards, "d1")
+	require.NoError(t, err)
+	assert.Equal(t, "resource:annotation.grafana.app/annotations/d1", tuple.Object)
+	assert.Equal(t, RelationWrite, tuple.Relation)
+
+	_, err = TranslateResourcePermission(TranslationV3, "user:1", "annotations:write", KindDashboards, "d1")
+	assert.ErrorIs(t, err, ErrUnsupportedAction)
+
+	assert.Equal(t, []string{
+		"resource:annotation.grafana.app/annotations/",
+		"resource:dashboard.grafana.app/dashboards/",
+	}, ResourceObjectPrefixes(TranslationLatest, KindDashboards))
+}
+
+func TestTranslateResourcePermission_QueryHistory(t *testing.T) {
+	tuple, err := TranslateResourcePermission(TranslationLatest, "user:u1", ActionQueryHistoryRead, KindQueryHistory, "u1")
+	require.NoError(t, err)
+	assert.Equal(t, "resource:queryhistory.grafana.app/queryhistory/u1", tuple.Object)
+	assert.Equal(t, RelationRead, tuple.Relation)
+
+	_, err = TranslateResourcePermission(TranslationV7, "user:u1", ActionQueryHistoryRead, KindQueryHistory, "u1")
+	assert.ErrorIs(t, err, ErrUnsupportedKind)
+}
+
+func TestTranslateResourcePermission_AlertRules(t *testing.T) {
+	tuple, err := TranslateResourcePermission(TranslationLatest, "team:t1#member", "alert.rules:write", KindAlertRules, "r1")
+	require.NoError(t, err)
+	assert.Equal(t, "resource:rules.alerting.grafana.app/alertrules/r1", tuple.Object)
+	assert.Equal(t, RelationWrite, tuple.Relation)
+
+	_, err = TranslateResourcePermission(TranslationV8, "team:t1#member", "alert.rules:write", KindAlertRules, "r1")
+	assert.ErrorIs(t, err, ErrUnsupportedKind)
+}
+
+func TestTranslateNamespacePermission_Datasources(t *testing.T) {
+	tuples, err := TranslateNamespacePermission(TranslationLatest, "user:1", "datasources:query", KindDatasources)
+	require.NoError(t, err)
+	require.Len(t, tuples, 1)
+	assert.Equal(t, "namespace:datasource.grafana.app/datasources", tuples[0].Object)
+	assert.Equal(t, RelationRead, tuples[0].Relation)
+
+	_, err = TranslateNamespacePermission(TranslationV9, "user:1", "datasources:query", KindDatasources)
+	assert.ErrorIs(t, err, ErrUnsupportedKind)
+}
+
+func TestTranslateResourcePermission_PluginPages(t *testing.T) {
+	tuple, err := TranslateResourcePermission(TranslationLatest, "user:1", "plugins.app:access", KindPlugins, "grafana-oncall-app/alert-groups")
+	require.NoError(t, err)
+	assert.Equal(t, "resource:plugins.grafana.app/apps/grafana-oncall-app", tuple.Object)
+	assert.Equal(t, RelationSubresourceRead, tuple.Relation)
+
+	_, err = TranslateResourcePermission(TranslationV11, "user:1", "plugins.app:access", KindPlugins, "grafana-oncall-app/alert-groups")
+	assert.ErrorIs(t, err, ErrUnsupportedKind)
+}
+
+func TestTranslateResourcePermission_Teams(t *testing.T) {
+	tuple, err := TranslateResourcePermission(TranslationLatest, "team:t2#member", "teams:read", KindTeams, "t1")
+	require.NoError(t, err)
+	assert.Equal(t, "team:t1", tuple.Object)
+	assert.Equal(t, RelationRead, tuple.Relation)
+
+	_, err = TranslateResourcePermission(TranslationLatest, "team:t2#member", "teams:write", KindTeams, "t1")
+	assert.ErrorIs(t, err, ErrUnsupportedAction)
+
+	_, err = TranslateResourcePermission(TranslationV12, "team:t2#member", "teams:read", KindTeams, "t1")
+	assert.ErrorIs(t, err, ErrUnsupportedKind)
+}
+
+func TestTranslateResourcePermission_Silences(t *testing.T) {
+	tuple, err := TranslateResourcePermission(TranslationLatest, "user:1", "alert.silences:write", KindSilences, "f1")
+	require.NoError(t, err)
+	assert.Equal(t, "folder:f1", tuple.Object)
+	assert.Equal(t, common.FolderResourceRelation(RelationWrite), tuple.Relation)
+	assert.Equal(t, []string{"notifications.alerting.grafana.app/silences"}, FolderResourceTupleGroups(tuple))
+
+	_, err = TranslateResourcePermission(TranslationLatest, "user:1", "alert.silences:write", KindFolders, "f1")
+	assert.ErrorIs(t, err, ErrUnsupportedAction)
+
+	_, err = TranslateResourcePermission(TranslationV13, "user:1", "alert.silences:write", KindSilences, "f1")
+	assert.ErrorIs(t, err, ErrUnsupportedKind)
+}
+
+func TestTranslateResourcePermission_PermissionsWrite(t *testing.T) {
+	tuple, err := TranslateResourcePermission(TranslationLatest, "user:1", "folders.permissions:write", KindFolders, "f1")
+	require.NoError(t, err)
+	assert.Equal(t, "folder:f1", tuple.Object)
+	assert.Equal(t, RelationSetAdmin, tuple.Relation)
+
+	tuple, err = TranslateResourcePermission(TranslationLatest, "user:1", "folders.permissions:read", KindFolders, "f1")
+	require.NoError(t, err)
+	assert.Equal(t, RelationPermissionsRead, tuple.Relation)
+
+	tuple, err = TranslateResourcePermission(TranslationV10, "user:1", "folders.permissions:write", KindFolders, "f1")
+	require.NoError(t, err)
+	assert.Equal(t, RelationPermissionsWrite, tuple.Relation)
+
+	tuple, err = TranslateResourcePermission(TranslationLatest, "user:1", "dashboards.permissions:write", KindFolders, "f1")
+	require.NoError(t, err)
+	assert.Equal(t, "folder:f1", tuple.Object)
+	assert.Equal(t, RelationFolderResourceSetAdmin, tuple.Relation)
+
+	tuple, err = TranslateResourcePermission(TranslationV10, "user:1", "dashboards.permissions:write", KindFolders, "f1")
+	require.NoError(t, err)
+	assert.Equal(t, RelationFolderResourcePermissionsWrite, tuple.Relation)
+}
+
+func TestFolderResourceGroups(t *testing.T) {
+	assert.Contains(t, FolderResourceGroups(TranslationLatest), "dashboard.grafana.app/librarypanels")
+	assert.NotContains(t, FolderResourceGroups(TranslationV4), "dashboard.grafana.app/librarypanels")
+	assert.Contains(t, FolderResourceGroups(TranslationLatest), "rules.alerting.grafana.app/recordingrules")
+	assert.NotContains(t, FolderResourceGroups(TranslationV6), "rules.alerting.grafana.app/recordingrules")
+	assert.Contains(t, FolderResourceGroups(TranslationLatest), "notifications.alerting.grafana.app/silences")
+	assert.NotContains(t, FolderResourceGroups(TranslationV13), "notifications.alerting.grafana.app/silences")
+	assert.Empty(t, FolderResourceGroups(TranslationVersion(0)))
+}
+
+func TestTranslateNamespacePermission(t *testing.T) {
+	t.Run("should translate permission on all resources of kind", func(t *testing.T) {
+		tuples, err := TranslateNamespacePermission(TranslationLatest, "role:basic_viewer#assignee", "dashboards:read", KindDashboards)
+		require.NoError(t, err)
+		assert.Equal(t, []*openfgav1.TupleKey{
+			common.NewNamespaceResourceTuple("role:basic_viewer#assignee", RelationRead, "dashboard.grafana.app", "dashboards"),
+		}, tuples)
+	})
+
+	t.Run("should translate into every resource the action applies to", func(t *testing.T) {
+		tuples, err := TranslateNamespacePermission(TranslationLatest, "role:basic_editor#assignee", "alert.rules:write", KindFolders)
+		require.NoError(t, err)
+		assert.Equal(t, []*openfgav1.TupleKey{
+			common.NewNamespaceResourceTuple("role:basic_editor#assignee", RelationWrite, "rules.alerting.grafana.app", "alertrules"),
+			common.NewNamespaceResourceTuple("role:basic_editor#assignee", RelationWrite, "rules.alerting.grafana.app", "recordingrules"),
+		}, tuples)
+	})
+
+	t.Run("should not translate kinds without api group", func(t *testing.T) {
+		_, err := TranslateNamespacePermission(TranslationLatest, "role:basic_admin#assignee", "serviceaccounts:read", KindServiceAccounts)
+		assert.ErrorIs(t, err, ErrUnsupportedKind)
+	})
+}
+
+func TestNormalizeScope(t *testing.T) {
+	t.Run("should resolve both scope variants identically", func(t *testing.T) {
+		for _, scope := range []string{"folders:uid:abc", "folders:abc"} {
+			kind, identifier, ok := NormalizeScope(scope)
+			require.True(t, ok, scope)
+			assert.Equal(t, KindFolders, kind, scope)
+			assert.Equal(t, "abc", identifier, scope)
+		}
+
+		a, err := TranslateScopePermission(TranslationLatest, "user:1", "dashboards:read", "dashboards:uid:d1")
+		require.NoError(t, err)
+		b, err := TranslateScopePermission(TranslationLatest, "user:1", "dashboards:read", "dashboards:d1")
+		require.NoError(t, err)
+		assert.Equal(t, a.String(), b.String())
+	})
+
+	t.Run("should keep colons in identifier", func(t *testing.T) {
+		kind, identifier, ok := NormalizeScope("dashboards:uid:a:b")
+		require.True(t, ok)
+		assert.Equal(t, KindDashboards, kind)
+		assert.Equal(t, "a:b", identifier)
+	})
+
+	t.Run("should not normalize unsupported scopes", func(t *testing.T) {
+		for _, scope := range []string{"", "*", "folders:*", "folders:uid:*", "folders:uid", "folders:id:1", ":abc"} {
+			_, _, ok := NormalizeScope(scope)
+			assert.False(t, ok, scope)
+		}
+	})
+}